@@ -17,6 +17,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	csiConfig "github.com/IBM/ibm-object-csi-driver/config"
 	"github.com/IBM/ibm-object-csi-driver/pkg/driver"
@@ -37,6 +38,25 @@ type Options struct {
 	Endpoint       string
 	NodeID         string
 	MetricsAddress string
+	// COSRequestTimeout bounds each request sent to the object storage endpoints
+	COSRequestTimeout time.Duration
+	// COSRetry tells how the failed requests sent to the object storage endpoints are retried
+	COSRetry s3client.RetryPolicy
+	// COSSessionCache tells how the clients of the object storage sessions are reused
+	COSSessionCache s3client.SessionCache
+	// BucketTagsNamespace holds the config maps keeping the tags of the buckets
+	BucketTagsNamespace string
+	// ResourceConfigCache tells how the resource configuration clients are reused
+	ResourceConfigCache s3client.SessionCache
+	// VolumeUsageTTL is how long the node server keeps the usage of a volume
+	VolumeUsageTTL time.Duration
+
+	OrphanCollector driver.OrphanCollectorOptions
+	// WorkloadIdentityAddress serves the credentials of the volumes mounted with
+	// workload identity in node mode, WorkloadIdentityDir storing the keys of the
+	// mounts
+	WorkloadIdentityAddress string
+	WorkloadIdentityDir     string
 }
 
 func getOptions() *Options {
@@ -45,17 +65,78 @@ func getOptions() *Options {
 		serverMode     = flag.String("servermode", "controller", "Server Mode node/controller")
 		nodeID         = flag.String("nodeid", "host01", "node id")
 		metricsAddress = flag.String("metrics-address", "0.0.0.0:9080", "Metrics address")
+		cosTimeout     = flag.Duration("cos-request-timeout", 5*time.Minute, "Timeout of each request sent to the object storage endpoint, retries included. 0 disables it")
+		cosMaxAttempts = flag.Int("cos-max-attempts", s3client.DefaultRetryPolicy.MaxAttempts, "Number of attempts of the idempotent requests sent to the object storage endpoint failing with a transient error. 1 disables retries")
+		cosBaseBackoff = flag.Duration("cos-retry-base-backoff", s3client.DefaultRetryPolicy.BaseBackoff, "Delay before the first retry of a request sent to the object storage endpoint, doubled at each retry")
+		cosMaxBackoff  = flag.Duration("cos-retry-max-backoff", s3client.DefaultRetryPolicy.MaxBackoff, "Maximum delay between two attempts of a request sent to the object storage endpoint")
+		cosJitter      = flag.Float64("cos-retry-jitter", s3client.DefaultRetryPolicy.Jitter, "Fraction of the retry delay, between 0 and 1, randomly taken off")
+		cosCacheSize   = flag.Int("cos-session-cache-size", s3client.DefaultSessionCache.Size, "Number of object storage clients, with their IAM token, kept for reuse by the next requests with the same endpoint and credentials. 0 disables the cache")
+		cosSessionTTL  = flag.Duration("cos-session-ttl", s3client.DefaultSessionCache.TTL, "How long an object storage client is reused after its creation. 0 keeps it until it is evicted")
+		bucketTagsNS   = flag.String("bucket-tags-namespace", "", "Namespace of the config maps keeping the tags of the buckets, defaults to the namespace of the pod")
+		rcCacheSize    = flag.Int("resource-config-cache-size", utils.DefaultResourceConfigCacheSize, "Number of resource configuration clients, with their IAM token, kept for reuse to read the bucket usage and set quotas. 0 disables the cache")
+		rcCacheTTL     = flag.Duration("resource-config-cache-ttl", utils.DefaultResourceConfigCacheTTL, "How long a resource configuration client is reused after its creation. 0 keeps it until it is evicted")
+		volumeUsageTTL = flag.Duration("volume-usage-ttl", 5*time.Minute, "How long the node server reports the usage of a volume before computing it again, listing its objects when the provider cannot tell it. 0 computes it at each call")
+
+		orphanGCInterval    = flag.Duration("orphan-gc-interval", 0, "Interval between two scans for orphaned buckets, 0 disables the collector")
+		orphanGCGracePeriod = flag.Duration("orphan-gc-grace-period", 24*time.Hour, "How long a bucket is found orphaned before it is collected")
+		orphanGCDelete      = flag.Bool("orphan-gc-delete", false, "Delete the orphaned buckets, they are only reported otherwise")
+		orphanGCDryRun      = flag.Bool("orphan-gc-dry-run", false, "Report the orphaned buckets that would be deleted without deleting them")
+		orphanGCSecrets     = flag.String("orphan-gc-secrets", "", "Comma separated namespace/name of secrets holding the credentials of more accounts to scan")
+		leaderElection      = flag.Bool("leader-election", true, "Collect orphaned buckets on the leader controller replica only")
+		leaderElectionNS    = flag.String("leader-election-namespace", "", "Namespace of the leader election lease, defaults to the namespace of the pod")
+
+		workloadIdentityAddress = flag.String("workload-identity-address", "127.0.0.1:9081", "Loopback address serving the credentials of the volumes mounted with workload identity to their mounter, and the rotated keys of the secrets, empty disables workload identity")
+		workloadIdentityDir     = flag.String("workload-identity-dir", "/var/lib/kubelet/plugins/cos.s3.csi.ibm.io/workload-identity", "Directory of the node storing the keys the mounts authenticate to the workload identity address with, kept across restarts of the node server")
 	)
 	_ = flag.Set("logtostderr", "true") // #nosec G104: Attempt to set flags for logging to stderr only on best-effort basis.Error cannot be usefully handled.
 	flag.Parse()
 	return &Options{
-		ServerMode:     *serverMode,
-		Endpoint:       *endpoint,
-		NodeID:         *nodeID,
-		MetricsAddress: *metricsAddress,
+		ServerMode:        *serverMode,
+		Endpoint:          *endpoint,
+		NodeID:            *nodeID,
+		MetricsAddress:    *metricsAddress,
+		COSRequestTimeout: *cosTimeout,
+		COSRetry: s3client.RetryPolicy{
+			MaxAttempts: *cosMaxAttempts,
+			BaseBackoff: *cosBaseBackoff,
+			MaxBackoff:  *cosMaxBackoff,
+			Jitter:      *cosJitter,
+		},
+		COSSessionCache: s3client.SessionCache{
+			Size: *cosCacheSize,
+			TTL:  *cosSessionTTL,
+		},
+		BucketTagsNamespace: *bucketTagsNS,
+		ResourceConfigCache: s3client.SessionCache{
+			Size: *rcCacheSize,
+			TTL:  *rcCacheTTL,
+		},
+		VolumeUsageTTL: *volumeUsageTTL,
+		OrphanCollector: driver.OrphanCollectorOptions{
+			Interval:                *orphanGCInterval,
+			GracePeriod:             *orphanGCGracePeriod,
+			Delete:                  *orphanGCDelete,
+			DryRun:                  *orphanGCDryRun,
+			Secrets:                 splitList(*orphanGCSecrets),
+			LeaderElection:          *leaderElection,
+			LeaderElectionNamespace: *leaderElectionNS,
+		},
+		WorkloadIdentityAddress: *workloadIdentityAddress,
+		WorkloadIdentityDir:     *workloadIdentityDir,
 	}
 }
 
+// splitList returns the non empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getZapLogger() *zap.Logger {
 	// Prepare a new logger
 	atom := zap.NewAtomicLevel()
@@ -113,14 +194,20 @@ func serverSetup(options *Options, logger *zap.Logger) {
 		os.Exit(1)
 	}
 
-	statsUtil := &(utils.DriverStatsUtils{})
+	statsUtil := utils.NewDriverStatsUtils(options.ResourceConfigCache.Size, options.ResourceConfigCache.TTL)
 	mounterUtil := &(mounterUtils.MounterOptsUtils{})
 
-	S3CSIDriver, err := csiDriver.NewS3CosDriver(options.NodeID, options.Endpoint, s3client.NewObjectStorageSessionFactory(), mounter.NewCSIMounterFactory(), statsUtil, mounterUtil)
+	cosSession := s3client.NewObjectStorageSessionFactory(options.COSRequestTimeout, options.COSRetry, options.COSSessionCache)
+	cosSession.SetBucketTagStore(utils.NewBucketTagConfigMaps(options.BucketTagsNamespace))
+
+	S3CSIDriver, err := csiDriver.NewS3CosDriver(options.NodeID, options.Endpoint, cosSession, mounter.NewCSIMounterFactory(), statsUtil, mounterUtil)
 	if err != nil {
 		logger.Fatal("Failed in initialize s3 COS driver", zap.Error(err))
 		os.Exit(1)
 	}
+	S3CSIDriver.EnableOrphanCollector(options.OrphanCollector)
+	S3CSIDriver.EnableWorkloadIdentity(options.WorkloadIdentityAddress, options.WorkloadIdentityDir)
+	S3CSIDriver.EnableVolumeUsageCache(options.VolumeUsageTTL)
 	serveMetrics(options.MetricsAddress, logger)
 	S3CSIDriver.Run()
 }
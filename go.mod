@@ -8,7 +8,6 @@ require (
 	github.com/IBM/ibm-cos-sdk-go-config/v2 v2.0.6
 	github.com/IBM/ibm-csi-common v1.1.13
 	github.com/IBM/ibmcloud-volume-interface v1.2.20
-	github.com/aws/aws-sdk-go v1.53.19
 	github.com/container-storage-interface/spec v1.9.0
 	github.com/google/uuid v1.6.0
 	github.com/kubernetes-csi/csi-test/v5 v5.2.0
@@ -20,6 +19,7 @@ require (
 	go.uber.org/zap v1.27.0
 	golang.org/x/net v0.26.0
 	google.golang.org/grpc v1.64.0
+	google.golang.org/protobuf v1.33.0
 	k8s.io/api v0.30.1
 	k8s.io/apimachinery v0.30.1
 	k8s.io/client-go v0.30.1
@@ -124,7 +124,6 @@ require (
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20240318140521-94a12d6c2237 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
-	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/inf.v0 v0.9.1 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -9,7 +9,68 @@ const (
 	S3FS   = "s3fs"
 	RClone = "rclone"
 
+	// Object storage providers, set by the provider parameter
+	ProviderIBMCOS = "ibm-cos"
+	ProviderAWS    = "aws"
+	ProviderMinIO  = "minio"
+	ProviderCeph   = "ceph"
+
 	IAMEP                   = "https://private.iam.cloud.ibm.com/identity/token"
 	ResourceConfigEPPrivate = "https://config.private.cloud-object-storage.cloud.ibm.com/v1"
 	ResourceConfigEPDirect  = "https://config.direct.cloud-object-storage.cloud.ibm.com/v1"
+
+	// Bucket tags recorded on snapshot buckets
+	SnapshotIDTag     = "csi-snapshot-id"
+	SourceVolumeIDTag = "csi-source-volume-id"
+	CreationTimeTag   = "csi-creation-time"
+	SizeBytesTag      = "csi-size-bytes"
+	ReadyToUseTag     = "csi-ready-to-use"
+
+	// Bucket tags recorded on the buckets created for volumes
+	VolumeIDTag      = "csi-volume-id"
+	CapacityBytesTag = "csi-capacity-bytes"
+	ParametersTag    = "csi-parameters"
+
+	// Bucket tags telling the owner of the buckets created by the driver
+	DriverNameTag         = "csi-driver-name"
+	ClusterIDTag          = "csi-cluster-id"
+	PVCNamespaceTag       = "csi-pvc-namespace"
+	PVCNameTag            = "csi-pvc-name"
+	UserProvidedBucketTag = "csi-user-provided-bucket"
+
+	// Version of the volume IDs describing their volume, and the longest ID allowed by CSI.
+	// The IDs of the first version have no provider.
+	VolumeIDVersion   = "v2"
+	VolumeIDVersion1  = "v1"
+	MaxVolumeIDLength = 128
+
+	// Parameters passed by the provisioner run with --extra-create-metadata
+	PVCNameKey      = "csi.storage.k8s.io/pvc/name"
+	PVCNamespaceKey = "csi.storage.k8s.io/pvc/namespace"
+	PVNameKey       = "csi.storage.k8s.io/pv/name"
+
+	// Volume context attribute holding the service account tokens of the pod, passed
+	// to NodePublishVolume for the tokenRequests of the CSIDriver
+	ServiceAccountTokensKey = "csi.storage.k8s.io/serviceAccount.tokens"
+
+	// Workload identity, the audiences of the service account tokens exchanged with
+	// IBM IAM and AWS STS, and the AWS STS endpoint
+	IAMTokenAudience   = "iam"
+	STSTokenAudience   = "sts.amazonaws.com"
+	DefaultSTSEndPoint = "https://sts.amazonaws.com"
+
+	// Annotation of the PV holding the default mount options set by ControllerModifyVolume
+	MountOptionsAnnotation = "cos.s3.csi.ibm.io/mount-options"
+
+	// Config maps holding the bucket tags, named after their bucket with a prefix, and
+	// labelled and annotated with their bucket
+	BucketTagsConfigMapPrefix = "csi-bucket-tags-"
+	BucketTagsLabel           = "cos.s3.csi.ibm.io/bucket-tags"
+	BucketAnnotation          = "cos.s3.csi.ibm.io/bucket"
+
+	// Number of objects copied in parallel when populating a bucket
+	CopyWorkers = 16
+
+	// Lease held by the controller replica collecting the orphaned buckets
+	OrphanCollectorLease = "ibm-object-csi-orphan-collector"
 )
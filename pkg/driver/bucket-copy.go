@@ -0,0 +1,230 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/klog/v2"
+)
+
+// bucketCopy copies the objects below a prefix of a bucket into a prefix of
+// another bucket. Objects are copied by parallel workers, and the objects already
+// present at the destination are skipped so that an interrupted copy resumes
+// where it stopped.
+type bucketCopy struct {
+	srcSess   s3client.ObjectStorageSession
+	srcBucket string
+	srcPrefix string
+	dstSess   s3client.ObjectStorageSession
+	dstBucket string
+	dstPrefix string
+	// crossEndpoint is set when the buckets are not served by the same endpoint,
+	// in which case objects are streamed through the driver instead of being
+	// copied server-side
+	crossEndpoint bool
+
+	total  atomic.Int64
+	copied atomic.Int64
+}
+
+// run copies the objects and returns the number of bytes of the source objects
+func (c *bucketCopy) run(ctx context.Context) (int64, error) {
+	srcPrefix := objectPrefix(c.srcPrefix)
+	dstPrefix := objectPrefix(c.dstPrefix)
+
+	objects, err := c.srcSess.ListObjects(ctx, c.srcBucket, srcPrefix)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := c.dstSess.ListObjects(ctx, c.dstBucket, dstPrefix)
+	if err != nil {
+		return 0, err
+	}
+	copied := make(map[string]s3client.ObjectInfo, len(existing))
+	for _, obj := range existing {
+		copied[obj.Key] = obj
+	}
+
+	var size int64
+	for _, obj := range objects {
+		size += obj.Size
+	}
+	c.total.Store(int64(len(objects)))
+	c.copied.Store(0)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	work := make(chan s3client.ObjectInfo)
+	for i := 0; i < constants.CopyWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range work {
+				dstKey := dstPrefix + strings.TrimPrefix(obj.Key, srcPrefix)
+				if dst, ok := copied[dstKey]; !ok || !c.isCopyOf(dst, obj) {
+					if err := c.copyObject(ctx, obj, dstKey); err != nil {
+						errOnce.Do(func() {
+							firstErr = err
+							cancel()
+						})
+						continue
+					}
+				}
+				c.copied.Add(1)
+			}
+		}()
+	}
+
+feed:
+	for _, obj := range objects {
+		select {
+		case work <- obj:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	klog.Infof("Copied %d objects (%d bytes) from %s/%s to %s/%s", len(objects), size, c.srcBucket, srcPrefix, c.dstBucket, dstPrefix)
+	return size, nil
+}
+
+// isCopyOf tells whether dst was copied from src by an earlier attempt. Entity
+// tags only match for objects copied server-side from a single part upload,
+// otherwise the sizes are compared.
+func (c *bucketCopy) isCopyOf(dst, src s3client.ObjectInfo) bool {
+	if dst.Size != src.Size {
+		return false
+	}
+	if c.crossEndpoint || strings.Contains(src.ETag, "-") {
+		return true
+	}
+	return dst.ETag == src.ETag
+}
+
+func (c *bucketCopy) copyObject(ctx context.Context, src s3client.ObjectInfo, dstKey string) error {
+	if !c.crossEndpoint {
+		return c.dstSess.CopyObject(ctx, c.srcBucket, src.Key, c.dstBucket, dstKey)
+	}
+
+	body, err := c.srcSess.GetObject(ctx, c.srcBucket, src.Key)
+	if err != nil {
+		return err
+	}
+	defer body.Close() // #nosec G307 read only
+	return c.dstSess.UploadObject(ctx, c.dstBucket, dstKey, body, src.Size)
+}
+
+// copyJob is a bucket copy populating a new volume in the background. The copy
+// outlives the CreateVolume call that started it, later calls for the same volume
+// report its progress until it completes.
+type copyJob struct {
+	copy   *bucketCopy
+	volume *csi.Volume
+	done   chan struct{}
+	err    error
+	cancel context.CancelFunc
+}
+
+// failed tells whether the copy of the job ended with an error
+func (job *copyJob) failed() bool {
+	select {
+	case <-job.done:
+		return job.err != nil
+	default:
+		return false
+	}
+}
+
+// copyJobs holds the copy jobs by volume name. Its zero value is ready to use.
+type copyJobs struct {
+	mutex sync.Mutex
+	jobs  map[string]*copyJob
+}
+
+func (j *copyJobs) get(volumeName string) *copyJob {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.jobs[volumeName]
+}
+
+// start runs the copy of a job, resuming it when it is already known
+func (j *copyJobs) start(volumeName string, job *copyJob) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.jobs == nil {
+		j.jobs = map[string]*copyJob{}
+	}
+	j.jobs[volumeName] = job
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job.done = make(chan struct{})
+	job.err = nil
+	job.cancel = cancel
+	go func() {
+		defer close(job.done)
+		_, job.err = job.copy.run(ctx)
+	}()
+}
+
+// remove forgets the job of a volume, stopping its copy if it still runs
+func (j *copyJobs) remove(volumeName string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if job, ok := j.jobs[volumeName]; ok {
+		job.cancel()
+		delete(j.jobs, volumeName)
+	}
+}
+
+// removeAll forgets every job, stopping the copies still running, when the driver
+// shuts down
+func (j *copyJobs) removeAll() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for name, job := range j.jobs {
+		job.cancel()
+		delete(j.jobs, name)
+	}
+}
+
+// removeVolume cancels the job populating the volume of the given ID. Jobs are held
+// by volume name, as the ID of a volume is only known once its bucket is.
+func (j *copyJobs) removeVolume(volumeID string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for name, job := range j.jobs {
+		if job.volume.GetVolumeId() == volumeID {
+			job.cancel()
+			delete(j.jobs, name)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recordingSession lists fixed objects per bucket and records the keys written
+type recordingSession struct {
+	s3client.ObjectStorageSession
+
+	mutex   sync.Mutex
+	objects map[string][]s3client.ObjectInfo
+	written []string
+	block   chan struct{}
+	err     error
+}
+
+func (s *recordingSession) ListObjects(_ context.Context, bucket, prefix string) ([]s3client.ObjectInfo, error) {
+	return s.objects[bucket], nil
+}
+
+func (s *recordingSession) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return s.record(dstKey)
+}
+
+func (s *recordingSession) GetObject(_ context.Context, bucket, key string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(key)), nil
+}
+
+func (s *recordingSession) UploadObject(_ context.Context, bucket, key string, body io.Reader, size int64) error {
+	return s.record(key)
+}
+
+func (s *recordingSession) record(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.written = append(s.written, key)
+	return nil
+}
+
+func TestBucketCopy(t *testing.T) {
+	source := []s3client.ObjectInfo{
+		{Key: "a", Size: 1, ETag: "0cc175b9"},
+		{Key: "b", Size: 2, ETag: "92eb5ffe"},
+		{Key: "c", Size: 3, ETag: "4a8a08f0"},
+	}
+
+	testCases := []struct {
+		testCaseName    string
+		destination     []s3client.ObjectInfo
+		crossEndpoint   bool
+		err             error
+		expectedWritten []string
+		expectedSize    int64
+		expectedErr     error
+	}{
+		{
+			testCaseName:    "Positive: Copied every object",
+			expectedWritten: []string{"a", "b", "c"},
+			expectedSize:    6,
+		},
+		{
+			testCaseName: "Positive: Resumed a partial copy",
+			destination: []s3client.ObjectInfo{
+				{Key: "a", Size: 1, ETag: "0cc175b9"},
+				{Key: "b", Size: 2, ETag: "d41d8cd9"},
+			},
+			expectedWritten: []string{"b", "c"},
+			expectedSize:    6,
+		},
+		{
+			testCaseName: "Positive: Resumed a partial copy from another endpoint",
+			destination: []s3client.ObjectInfo{
+				{Key: "a", Size: 1, ETag: "d41d8cd9"},
+				{Key: "b", Size: 5, ETag: "d41d8cd9"},
+			},
+			crossEndpoint:   true,
+			expectedWritten: []string{"b", "c"},
+			expectedSize:    6,
+		},
+		{
+			testCaseName: "Negative: Failed to copy an object",
+			err:          errors.New("failed to copy object"),
+			expectedErr:  errors.New("failed to copy object"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+
+		sess := &recordingSession{
+			objects: map[string][]s3client.ObjectInfo{"src": source, "dst": tc.destination},
+			err:     tc.err,
+		}
+		c := &bucketCopy{
+			srcSess:       sess,
+			srcBucket:     "src",
+			dstSess:       sess,
+			dstBucket:     "dst",
+			crossEndpoint: tc.crossEndpoint,
+		}
+		size, err := c.run(ctx)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectedErr.Error())
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectedSize, size)
+		assert.Equal(t, int64(len(source)), c.copied.Load())
+		sort.Strings(sess.written)
+		assert.Equal(t, tc.expectedWritten, sess.written)
+	}
+}
+
+func TestWaitForCopyJob(t *testing.T) {
+	defer func(wait time.Duration) { copyJobWait = wait }(copyJobWait)
+	copyJobWait = 10 * time.Millisecond
+
+	sess := &recordingSession{
+		objects: map[string][]s3client.ObjectInfo{"src": {{Key: "a", Size: 1}}},
+		block:   make(chan struct{}),
+	}
+	volume := &csi.Volume{VolumeId: testVolumeID}
+	job := &copyJob{
+		copy:   &bucketCopy{srcSess: sess, srcBucket: "src", dstSess: sess, dstBucket: "dst"},
+		volume: volume,
+	}
+	jobs := &copyJobs{}
+	jobs.start(testVolumeID, job)
+
+	_, err := waitForCopyJob(testVolumeID, job, jobs)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Equal(t, job, jobs.get(testVolumeID))
+
+	close(sess.block)
+	<-job.done
+	resp, err := waitForCopyJob(testVolumeID, job, jobs)
+	assert.NoError(t, err)
+	assert.Equal(t, volume, resp.Volume)
+	assert.Nil(t, jobs.get(testVolumeID))
+}
+
+func TestCopyJobsRemoveAll(t *testing.T) {
+	sess := &recordingSession{
+		objects: map[string][]s3client.ObjectInfo{"src": {{Key: "a", Size: 1}}},
+		block:   make(chan struct{}),
+	}
+	job := &copyJob{
+		copy:   &bucketCopy{srcSess: sess, srcBucket: "src", dstSess: sess, dstBucket: "dst"},
+		volume: &csi.Volume{VolumeId: testVolumeID},
+	}
+	jobs := &copyJobs{}
+	jobs.start(testVolumeID, job)
+
+	jobs.removeAll()
+	<-job.done
+	assert.ErrorIs(t, job.err, context.Canceled)
+	assert.Empty(t, jobs.jobs)
+	assert.Empty(t, sess.written)
+}
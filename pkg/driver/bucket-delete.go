@@ -0,0 +1,101 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deleteJobWait is how long DeleteVolume waits for the objects of a volume to be
+// deleted before letting the provisioner retry
+var deleteJobWait = 20 * time.Second
+
+// deleteJob deletes the objects of a volume in the background. Emptying a large
+// bucket outlives the DeleteVolume call that started it, later calls for the same
+// volume report its progress until it completes.
+type deleteJob struct {
+	progress s3client.DeleteProgress
+	done     chan struct{}
+	err      error
+	cancel   context.CancelFunc
+}
+
+// deleteJobs holds the delete jobs by volume ID. Its zero value is ready to use.
+type deleteJobs struct {
+	mutex sync.Mutex
+	jobs  map[string]*deleteJob
+}
+
+// start runs the deletion of a volume in a job, and returns the job. The job already
+// deleting the volume is returned instead when there is one. The deletion is given
+// its own context, as it outlives the call that started it, cancelled when the job
+// is removed.
+func (j *deleteJobs) start(volumeID string, deleteVolume func(ctx context.Context, progress *s3client.DeleteProgress) error) *deleteJob {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if job, ok := j.jobs[volumeID]; ok {
+		return job
+	}
+	if j.jobs == nil {
+		j.jobs = map[string]*deleteJob{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &deleteJob{done: make(chan struct{}), cancel: cancel}
+	j.jobs[volumeID] = job
+	go func() {
+		defer close(job.done)
+		defer cancel()
+		job.err = deleteVolume(ctx, &job.progress)
+	}()
+	return job
+}
+
+// remove forgets the job of a volume, stopping its deletion if it still runs
+func (j *deleteJobs) remove(volumeID string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if job, ok := j.jobs[volumeID]; ok {
+		job.cancel()
+		delete(j.jobs, volumeID)
+	}
+}
+
+// removeAll forgets every job, stopping the deletions still running, when the driver
+// shuts down
+func (j *deleteJobs) removeAll() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for volumeID, job := range j.jobs {
+		job.cancel()
+		delete(j.jobs, volumeID)
+	}
+}
+
+// waitForDeleteJob returns the result of a delete job once it completes, or an
+// Aborted error reporting its progress when it still runs after deleteJobWait. A
+// completed job is forgotten, a failed deletion starts over on retry.
+func waitForDeleteJob(volumeID string, job *deleteJob, jobs *deleteJobs) error {
+	select {
+	case <-job.done:
+	case <-time.After(deleteJobWait):
+		return status.Error(codes.Aborted, fmt.Sprintf("volume %s is being deleted: %d objects deleted", volumeID, job.progress.Deleted.Load()))
+	}
+	jobs.remove(volumeID)
+	return job.err
+}
@@ -0,0 +1,131 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWaitForDeleteJob(t *testing.T) {
+	defer func(wait time.Duration) { deleteJobWait = wait }(deleteJobWait)
+	deleteJobWait = 10 * time.Millisecond
+
+	block := make(chan struct{})
+	deleteVolume := func(_ context.Context, progress *s3client.DeleteProgress) error {
+		progress.Deleted.Add(1000)
+		<-block
+		return errors.New("failed to delete bucket")
+	}
+	jobs := &deleteJobs{}
+	job := jobs.start(testVolumeID, deleteVolume)
+
+	err := waitForDeleteJob(testVolumeID, job, jobs)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Contains(t, err.Error(), "1000 objects deleted")
+	assert.Equal(t, job, jobs.start(testVolumeID, deleteVolume))
+
+	close(block)
+	err = waitForDeleteJob(testVolumeID, job, jobs)
+	assert.EqualError(t, err, "failed to delete bucket")
+
+	// The failed deletion starts over
+	retried := jobs.start(testVolumeID, func(context.Context, *s3client.DeleteProgress) error { return nil })
+	assert.NotEqual(t, job, retried)
+	assert.NoError(t, waitForDeleteJob(testVolumeID, retried, jobs))
+}
+
+func TestDeleteJobsRemove(t *testing.T) {
+	deleteVolume := func(ctx context.Context, _ *s3client.DeleteProgress) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	jobs := &deleteJobs{}
+	job := jobs.start(testVolumeID, deleteVolume)
+	other := jobs.start(testOwnedVolumeID, deleteVolume)
+
+	jobs.remove(testVolumeID)
+	<-job.done
+	assert.ErrorIs(t, job.err, context.Canceled)
+	assert.NotEqual(t, job, jobs.start(testVolumeID, deleteVolume))
+
+	jobs.removeAll()
+	<-other.done
+	assert.ErrorIs(t, other.err, context.Canceled)
+	assert.Empty(t, jobs.jobs)
+}
+
+func TestCreateVolumeCancelsDeletion(t *testing.T) {
+	defer func(wait time.Duration) { deleteJobWait = wait }(deleteJobWait)
+	deleteJobWait = 10 * time.Millisecond
+
+	cosSession := &s3client.FakeCOSSessionFactory{DeletionBlocked: make(chan struct{})}
+	cs := &controllerServer{
+		S3Driver:   &S3Driver{name: driverName},
+		Stats:      utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+		cosSession: cosSession,
+	}
+	_, err := cs.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: testOwnedVolumeID, Secrets: quotaSecret})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	job := cs.deleteJobs.jobs[testOwnedVolumeID]
+
+	// The volume of the same name is created again before its deletion completes
+	resp, err := cs.CreateVolume(ctx, &csi.CreateVolumeRequest{
+		Name:               testVolumeName,
+		VolumeCapabilities: []*csi.VolumeCapability{{AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER}}},
+		Parameters:         map[string]string{},
+		Secrets:            quotaSecret,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, testOwnedVolumeID, resp.GetVolume().GetVolumeId())
+	<-job.done
+	assert.ErrorIs(t, job.err, context.Canceled)
+	assert.Empty(t, cosSession.DeletedBuckets)
+}
+
+func TestDeleteVolumeInBackground(t *testing.T) {
+	defer func(wait time.Duration) { deleteJobWait = wait }(deleteJobWait)
+	deleteJobWait = 10 * time.Millisecond
+
+	cosSession := &s3client.FakeCOSSessionFactory{DeletionBlocked: make(chan struct{})}
+	cs := &controllerServer{
+		S3Driver:   &S3Driver{name: driverName},
+		Stats:      utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+		cosSession: cosSession,
+	}
+	req := &csi.DeleteVolumeRequest{VolumeId: testOwnedVolumeID, Secrets: testSecret}
+
+	_, err := cs.DeleteVolume(ctx, req)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	_, err = cs.DeleteVolume(ctx, req)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	close(cosSession.DeletionBlocked)
+	deleteJobWait = time.Second
+	_, err = cs.DeleteVolume(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testVolumeName}, cosSession.DeletedBuckets)
+}
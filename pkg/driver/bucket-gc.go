@@ -0,0 +1,251 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// OrphanCollectorOptions configures the collection of the buckets created by the
+// driver for volumes whose PV no longer exists
+type OrphanCollectorOptions struct {
+	// Interval between two scans, the collector is disabled when it is zero
+	Interval time.Duration
+	// GracePeriod is how long a bucket is found orphaned before it is collected, so
+	// that the buckets of volumes being provisioned are left alone
+	GracePeriod time.Duration
+	// Delete deletes the orphaned buckets, they are only reported otherwise
+	Delete bool
+	// DryRun reports the buckets that would be deleted, without deleting them
+	DryRun bool
+	// Secrets name the secrets, as namespace/name, holding the credentials of the
+	// accounts scanned besides the accounts of the existing volumes
+	Secrets []string
+	// LeaderElection runs the collector on a single controller replica, holding a
+	// lease in LeaderElectionNamespace
+	LeaderElection          bool
+	LeaderElectionNamespace string
+}
+
+// orphanCollector finds the buckets created for a volume by the driver of this
+// cluster, whose volume has no PV anymore. Such buckets are left behind when
+// DeleteVolume could not resolve the bucket of a volume, or by CreateVolume
+// calls whose volume was given up by the provisioner.
+type orphanCollector struct {
+	cs   *controllerServer
+	opts OrphanCollectorOptions
+	// orphanedSince holds when each orphaned bucket was first found
+	orphanedSince map[string]time.Time
+	now           func() time.Time
+}
+
+func newOrphanCollector(cs *controllerServer, opts OrphanCollectorOptions) *orphanCollector {
+	return &orphanCollector{
+		cs:            cs,
+		opts:          opts,
+		orphanedSince: map[string]time.Time{},
+		now:           time.Now,
+	}
+}
+
+// start runs the collector in the background, on the leader replica only when
+// leader election is enabled
+func (c *orphanCollector) start(ctx context.Context) {
+	klog.Infof("Starting the orphaned bucket collector: interval %v, grace period %v, delete %t, dry run %t",
+		c.opts.Interval, c.opts.GracePeriod, c.opts.Delete, c.opts.DryRun)
+	if !c.opts.LeaderElection {
+		go c.run(ctx)
+		return
+	}
+	go func() {
+		if err := utils.RunAsLeader(ctx, c.opts.LeaderElectionNamespace, constants.OrphanCollectorLease, c.run); err != nil {
+			klog.Errorf("Orphaned bucket collector disabled, leader election failed: %v", err)
+		}
+	}()
+}
+
+// run scans the accounts at every interval until ctx is done. Orphans found by an
+// earlier leader are timed again, which only delays their collection.
+func (c *orphanCollector) run(ctx context.Context) {
+	c.orphanedSince = map[string]time.Time{}
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		c.collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect scans the accounts once, and reports or deletes the buckets orphaned for
+// longer than the grace period. It returns these buckets.
+func (c *orphanCollector) collect(ctx context.Context) []string {
+	if c.cs.clusterID == "" {
+		// The buckets of the clusters sharing an account could not be told apart
+		klog.Warning("OrphanCollector: the cluster ID is unknown, buckets are not collected")
+		return nil
+	}
+	volumes, err := c.cs.Stats.ListDriverVolumes(c.cs.name)
+	if err != nil {
+		klog.Errorf("OrphanCollector: Unable to list the volumes: %v", err)
+		return nil
+	}
+	inUse := map[string]bool{}
+	for _, volume := range volumes {
+		inUse[volume.VolumeID] = true
+		if bucketName := volume.Attributes["bucketName"]; bucketName != "" {
+			inUse[bucketName] = true
+		}
+	}
+
+	now := c.now()
+	orphans := map[string]bool{}
+	var collected []string
+	for _, sess := range c.accountSessions(volumes) {
+		buckets, err := sess.ListBuckets(ctx)
+		if err != nil {
+			klog.Warningf("OrphanCollector: Unable to list buckets: %v", err)
+			continue
+		}
+		for _, bucket := range buckets {
+			if orphans[bucket] {
+				continue
+			}
+			tags, err := sess.GetBucketTags(ctx, bucket)
+			if err != nil {
+				klog.V(3).Infof("OrphanCollector: Unable to read tags of bucket %s: %v", bucket, err)
+				continue
+			}
+			if !c.isOrphan(bucket, tags, inUse) {
+				continue
+			}
+			orphans[bucket] = true
+			since, found := c.orphanedSince[bucket]
+			if !found {
+				klog.Infof("OrphanCollector: bucket %s of volume %s has no PV, collected after %v", bucket, tags[constants.VolumeIDTag], c.opts.GracePeriod)
+				since = now
+				c.orphanedSince[bucket] = now
+			}
+			if now.Sub(since) < c.opts.GracePeriod {
+				continue
+			}
+			collected = append(collected, bucket)
+			if c.collectBucket(ctx, sess, bucket, tags[constants.VolumeIDTag]) {
+				delete(orphans, bucket)
+			}
+		}
+	}
+
+	// Buckets found back in use, or gone, are timed again if they are orphaned later
+	for bucket := range c.orphanedSince {
+		if !orphans[bucket] {
+			delete(c.orphanedSince, bucket)
+		}
+	}
+	return collected
+}
+
+// isOrphan tells whether a bucket was created for a volume by the driver of this
+// cluster, and the volume has no PV. Buckets of older releases are not tagged with
+// their driver and cluster, they are never collected.
+func (c *orphanCollector) isOrphan(bucket string, tags map[string]string, inUse map[string]bool) bool {
+	volumeID := tags[constants.VolumeIDTag]
+	return volumeID != "" &&
+		c.cs.isDriverBucket(tags) &&
+		tags[constants.UserProvidedBucketTag] == "false" &&
+		!inUse[volumeID] && !inUse[bucket]
+}
+
+// collectBucket reports or deletes an orphaned bucket, and tells whether it was deleted
+func (c *orphanCollector) collectBucket(ctx context.Context, sess s3client.ObjectStorageSession, bucket, volumeID string) bool {
+	switch {
+	case !c.opts.Delete:
+		klog.Warningf("OrphanCollector: bucket %s of deleted volume %s is orphaned", bucket, volumeID)
+		return false
+	case c.opts.DryRun:
+		klog.Infof("OrphanCollector: dry run, bucket %s of deleted volume %s would be deleted", bucket, volumeID)
+		return false
+	}
+
+	// The volume is locked as DeleteVolume and CreateVolume lock it, a retried
+	// CreateVolume adopting the bucket would lose it otherwise
+	release, err := c.cs.locks.acquire(volumeIDLock, volumeID)
+	if err != nil {
+		klog.Infof("OrphanCollector: bucket %s of volume %s is in use, not deleted: %v", bucket, volumeID, err)
+		return false
+	}
+	defer release()
+
+	err = sess.DeleteBucket(ctx, bucket, nil)
+	if errors.Is(err, s3client.ErrBucketProtected) {
+		klog.Warningf("OrphanCollector: bucket %s of deleted volume %s holds objects under retention: %v", bucket, volumeID, err)
+		return false
+	}
+	if err != nil {
+		klog.Errorf("OrphanCollector: Unable to delete bucket %s of deleted volume %s: %v", bucket, volumeID, err)
+		return false
+	}
+	klog.Infof("OrphanCollector: deleted bucket %s of deleted volume %s", bucket, volumeID)
+	return true
+}
+
+// accountSessions returns a session for each account holding volumes, and for each
+// account of the configured secrets
+func (c *orphanCollector) accountSessions(volumes []utils.DriverVolume) []s3client.ObjectStorageSession {
+	type account struct {
+		secrets map[string]string
+		params  map[string]string
+	}
+	var accounts []account
+	for _, name := range c.opts.Secrets {
+		namespace, secretName, found := strings.Cut(name, "/")
+		if !found {
+			klog.Warningf("OrphanCollector: secret %s is not named as namespace/name", name)
+			continue
+		}
+		secretMap, err := c.cs.Stats.GetSecret(namespace, secretName)
+		if err != nil {
+			klog.Warningf("OrphanCollector: Unable to get secret %s: %v", name, err)
+			continue
+		}
+		accounts = append(accounts, account{secrets: secretMap})
+	}
+	for _, volume := range volumes {
+		accounts = append(accounts, account{secrets: volume.Secrets, params: volume.Attributes})
+	}
+
+	seen := map[string]bool{}
+	var sessions []s3client.ObjectStorageSession
+	for _, acc := range accounts {
+		key, err := accountKey(acc.secrets, acc.params)
+		if err != nil || seen[key] {
+			continue
+		}
+		sess, err := c.cs.newSessionFromSecrets(acc.secrets, acc.params)
+		if err != nil {
+			continue
+		}
+		seen[key] = true
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
@@ -0,0 +1,226 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// volumeBucketTags returns the tags of a bucket created for a volume by the test driver
+func volumeBucketTags(volumeID string) map[string]string {
+	return map[string]string{
+		constants.DriverNameTag:         driverName,
+		constants.ClusterIDTag:          testClusterID,
+		constants.VolumeIDTag:           volumeID,
+		constants.UserProvidedBucketTag: "false",
+	}
+}
+
+func TestOrphanCollector(t *testing.T) {
+	liveVolume := utils.DriverVolume{
+		VolumeID:   "v1:o:live-bucket:test-region:test-endpoint",
+		Attributes: map[string]string{"bucketName": "live-bucket"},
+		Secrets:    quotaSecret,
+	}
+	bucketTags := map[string]map[string]string{
+		"live-bucket":   volumeBucketTags(liveVolume.VolumeID),
+		"orphan-bucket": volumeBucketTags("v1:o:orphan-bucket:test-region:test-endpoint"),
+		"other-cluster": {
+			constants.DriverNameTag:         driverName,
+			constants.ClusterIDTag:          "other-cluster-id",
+			constants.VolumeIDTag:           "v1:o:other-cluster:test-region:test-endpoint",
+			constants.UserProvidedBucketTag: "false",
+		},
+		"shared-bucket": {
+			constants.DriverNameTag: driverName,
+			constants.ClusterIDTag:  testClusterID,
+		},
+	}
+	buckets := []string{"live-bucket", "orphan-bucket", "other-cluster", "shared-bucket", "untagged-bucket"}
+
+	testCases := []struct {
+		testCaseName      string
+		opts              OrphanCollectorOptions
+		clusterID         string
+		volumes           []utils.DriverVolume
+		listVolumesErr    error
+		protected         []string
+		locked            []string
+		elapsed           time.Duration
+		expectedCollected []string
+		expectedDeleted   []string
+	}{
+		{
+			testCaseName:      "Orphan deleted after the grace period",
+			opts:              OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true},
+			clusterID:         testClusterID,
+			volumes:           []utils.DriverVolume{liveVolume},
+			elapsed:           time.Hour,
+			expectedCollected: []string{"orphan-bucket"},
+			expectedDeleted:   []string{"orphan-bucket"},
+		},
+		{
+			testCaseName: "Orphan kept during the grace period",
+			opts:         OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true},
+			clusterID:    testClusterID,
+			volumes:      []utils.DriverVolume{liveVolume},
+			elapsed:      time.Minute,
+		},
+		{
+			testCaseName:      "Orphan only reported",
+			opts:              OrphanCollectorOptions{GracePeriod: time.Hour},
+			clusterID:         testClusterID,
+			volumes:           []utils.DriverVolume{liveVolume},
+			elapsed:           time.Hour,
+			expectedCollected: []string{"orphan-bucket"},
+		},
+		{
+			testCaseName:      "Dry run",
+			opts:              OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true, DryRun: true},
+			clusterID:         testClusterID,
+			volumes:           []utils.DriverVolume{liveVolume},
+			elapsed:           time.Hour,
+			expectedCollected: []string{"orphan-bucket"},
+		},
+		{
+			testCaseName:      "Orphan holding objects under retention",
+			opts:              OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true},
+			clusterID:         testClusterID,
+			volumes:           []utils.DriverVolume{liveVolume},
+			protected:         []string{"orphan-bucket"},
+			elapsed:           time.Hour,
+			expectedCollected: []string{"orphan-bucket"},
+		},
+		{
+			testCaseName:      "Orphan of a volume with an operation in flight",
+			opts:              OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true},
+			clusterID:         testClusterID,
+			volumes:           []utils.DriverVolume{liveVolume},
+			locked:            []string{"v1:o:orphan-bucket:test-region:test-endpoint"},
+			elapsed:           time.Hour,
+			expectedCollected: []string{"orphan-bucket"},
+		},
+		{
+			testCaseName:      "Account of a configured secret",
+			opts:              OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true, Secrets: []string{"default/cos-secret"}},
+			clusterID:         testClusterID,
+			volumes:           []utils.DriverVolume{},
+			elapsed:           time.Hour,
+			expectedCollected: []string{"live-bucket", "orphan-bucket"},
+			expectedDeleted:   []string{"live-bucket", "orphan-bucket"},
+		},
+		{
+			testCaseName:   "Volumes cannot be listed",
+			opts:           OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true},
+			clusterID:      testClusterID,
+			listVolumesErr: errors.New("failed to list PVs"),
+			elapsed:        time.Hour,
+		},
+		{
+			testCaseName: "Cluster ID unknown",
+			opts:         OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true},
+			volumes:      []utils.DriverVolume{liveVolume},
+			elapsed:      time.Hour,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		cosSession := &s3client.FakeCOSSessionFactory{
+			Buckets:          buckets,
+			BucketTags:       bucketTags,
+			ProtectedBuckets: tc.protected,
+		}
+		stats := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+			ListDriverVolumesFn: func(name string) ([]utils.DriverVolume, error) {
+				assert.Equal(t, driverName, name)
+				return tc.volumes, tc.listVolumesErr
+			},
+			GetSecretFn: func(namespace, name string) (map[string]string, error) {
+				assert.Equal(t, "default", namespace)
+				assert.Equal(t, "cos-secret", name)
+				return quotaSecret, nil
+			},
+		})
+		cs := &controllerServer{
+			S3Driver:   &S3Driver{name: driverName},
+			Stats:      stats,
+			cosSession: cosSession,
+			Logger:     zap.NewNop(),
+			clusterID:  tc.clusterID,
+		}
+		for _, volumeID := range tc.locked {
+			_, err := cs.locks.acquire(volumeIDLock, volumeID)
+			assert.NoError(t, err)
+		}
+
+		now := time.Now()
+		collector := newOrphanCollector(cs, tc.opts)
+		collector.now = func() time.Time { return now }
+		assert.Empty(t, collector.collect(ctx))
+
+		now = now.Add(tc.elapsed)
+		assert.Equal(t, tc.expectedCollected, collector.collect(ctx))
+		assert.Equal(t, tc.expectedDeleted, cosSession.DeletedBuckets)
+	}
+}
+
+func TestOrphanCollectorForgetsBucketsInUse(t *testing.T) {
+	volumes := []utils.DriverVolume{}
+	cosSession := &s3client.FakeCOSSessionFactory{
+		Buckets:    []string{"orphan-bucket"},
+		BucketTags: map[string]map[string]string{"orphan-bucket": volumeBucketTags("v1:o:orphan-bucket::")},
+	}
+	cs := &controllerServer{
+		S3Driver: &S3Driver{name: driverName},
+		Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+			ListDriverVolumesFn: func(name string) ([]utils.DriverVolume, error) { return volumes, nil },
+			GetSecretFn:         func(namespace, name string) (map[string]string, error) { return quotaSecret, nil },
+		}),
+		cosSession: cosSession,
+		Logger:     zap.NewNop(),
+		clusterID:  testClusterID,
+	}
+
+	now := time.Now()
+	collector := newOrphanCollector(cs, OrphanCollectorOptions{GracePeriod: time.Hour, Delete: true, Secrets: []string{"default/cos-secret"}})
+	collector.now = func() time.Time { return now }
+	assert.Empty(t, collector.collect(ctx))
+
+	// The PV of the bucket shows up, the bucket is timed again once orphaned back
+	volumes = []utils.DriverVolume{{VolumeID: "v1:o:orphan-bucket::", Attributes: map[string]string{"bucketName": "orphan-bucket"}}}
+	now = now.Add(30 * time.Minute)
+	assert.Empty(t, collector.collect(ctx))
+
+	volumes = []utils.DriverVolume{}
+	now = now.Add(45 * time.Minute)
+	assert.Empty(t, collector.collect(ctx))
+	assert.Empty(t, cosSession.DeletedBuckets)
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, []string{"orphan-bucket"}, collector.collect(ctx))
+	assert.Equal(t, []string{"orphan-bucket"}, cosSession.DeletedBuckets)
+}
@@ -0,0 +1,136 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+)
+
+const (
+	minBucketNameLength = 3
+	maxBucketNameLength = 63
+
+	// bucketNameAttempts is the number of names tried for the bucket of a volume
+	// when its name is taken, the rendered name then the name with a suffix
+	bucketNameAttempts = 5
+)
+
+var (
+	// bucketNameVariables matches the variables of a bucket name template
+	bucketNameVariables = regexp.MustCompile(`\$\{[^}]*\}`)
+	// bucketNameSeparators matches the runs of dots and hyphens, which bucket names
+	// cannot hold next to each other
+	bucketNameSeparators = regexp.MustCompile(`[.-]{2,}`)
+
+	// errBucketNameTaken is returned when the bucket of a volume is named after
+	// another volume, or is owned by another account
+	errBucketNameTaken = errors.New("bucket name already taken")
+)
+
+// getVolumeBucketName returns the name of the bucket created for a volume, rendered
+// from the bucketNameTemplate parameter when it is set. The name only depends on the
+// volume, so that a retried CreateVolume finds the bucket again.
+func getVolumeBucketName(params map[string]string, mounterType, volumeName string) (string, error) {
+	if template := params["bucketNameTemplate"]; template != "" {
+		return renderBucketName(template, params, volumeName)
+	}
+	return normalizeBucketName(getTempBucketName(mounterType, volumeName))
+}
+
+// renderBucketName replaces the variables of a bucket name template, ${pvc.name},
+// ${pvc.namespace}, ${pv.name} and ${rand}, and normalizes the result. ${rand} is
+// derived from the volume name, to stay the same across retries.
+func renderBucketName(template string, params map[string]string, volumeName string) (string, error) {
+	var err error
+	name := bucketNameVariables.ReplaceAllStringFunc(template, func(variable string) string {
+		var value string
+		switch variable {
+		case "${pvc.name}":
+			value = params[constants.PVCNameKey]
+		case "${pvc.namespace}":
+			value = params[constants.PVCNamespaceKey]
+		case "${pv.name}":
+			value = volumeName
+		case "${rand}":
+			value = shortDigest(volumeName)
+		default:
+			err = fmt.Errorf("unknown variable %s in bucketNameTemplate", variable)
+		}
+		if value == "" && err == nil {
+			err = fmt.Errorf("no value for %s in bucketNameTemplate, the provisioner must run with --extra-create-metadata", variable)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return normalizeBucketName(name)
+}
+
+// normalizeBucketName turns a name into a valid bucket name: lower case letters,
+// digits, dots and hyphens, starting and ending with a letter or a digit. Names
+// longer than allowed are cut, and keep a digest of the full name to stay unique.
+func normalizeBucketName(name string) (string, error) {
+	normalized := invalidBucketNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	normalized = bucketNameSeparators.ReplaceAllString(normalized, "-")
+	normalized = strings.Trim(normalized, ".-")
+	if len(normalized) > maxBucketNameLength {
+		suffix := "-" + shortDigest(name)
+		normalized = strings.TrimRight(normalized[:maxBucketNameLength-len(suffix)], ".-") + suffix
+	}
+	if err := validateBucketName(normalized); err != nil {
+		return "", fmt.Errorf("invalid bucket name %q rendered from %q: %v", normalized, name, err)
+	}
+	return normalized, nil
+}
+
+// validateBucketName checks the S3 bucket naming rules not enforced by the
+// normalization
+func validateBucketName(name string) error {
+	switch {
+	case len(name) < minBucketNameLength || len(name) > maxBucketNameLength:
+		return fmt.Errorf("bucket names must be %d to %d characters long", minBucketNameLength, maxBucketNameLength)
+	case net.ParseIP(name) != nil:
+		return errors.New("bucket names must not be formatted as an IP address")
+	case strings.HasSuffix(name, "-s3alias"):
+		return errors.New("bucket names must not end with -s3alias")
+	}
+	return nil
+}
+
+// bucketNameCandidates returns the names tried in turn for the bucket of a volume,
+// the name followed by the name with a numbered suffix
+func bucketNameCandidates(name string) []string {
+	candidates := []string{name}
+	for i := 1; i < bucketNameAttempts; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := name
+		if len(base)+len(suffix) > maxBucketNameLength {
+			base = strings.TrimRight(base[:maxBucketNameLength-len(suffix)], ".-")
+		}
+		candidates = append(candidates, base+suffix)
+	}
+	return candidates
+}
+
+// shortDigest returns the first 8 hexadecimal characters of the digest of a string
+func shortDigest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
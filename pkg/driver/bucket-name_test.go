@@ -0,0 +1,137 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNormalizeBucketName(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		name         string
+		expected     string
+		expectedErr  string
+	}{
+		{
+			testCaseName: "Valid name left unchanged",
+			name:         "s3fs-pvc-1234",
+			expected:     "s3fs-pvc-1234",
+		},
+		{
+			testCaseName: "Invalid characters and separators replaced",
+			name:         "-My_Namespace..Claim.-Data-",
+			expected:     "my-namespace-claim-data",
+		},
+		{
+			testCaseName: "Long name cut and suffixed with a digest",
+			name:         strings.Repeat("a", 70),
+			expected:     strings.Repeat("a", 54) + "-" + shortDigest(strings.Repeat("a", 70)),
+		},
+		{
+			testCaseName: "Too short",
+			name:         "a_",
+			expectedErr:  "must be 3 to 63 characters long",
+		},
+		{
+			testCaseName: "IP address",
+			name:         "192.168.5.4",
+			expectedErr:  "must not be formatted as an IP address",
+		},
+		{
+			testCaseName: "Reserved suffix",
+			name:         "data-s3alias",
+			expectedErr:  "must not end with -s3alias",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		actual, err := normalizeBucketName(tc.name)
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, actual)
+	}
+}
+
+func TestRenderBucketName(t *testing.T) {
+	params := map[string]string{constants.PVCNamespaceKey: "Team-A", constants.PVCNameKey: "data_claim"}
+
+	testCases := []struct {
+		testCaseName string
+		template     string
+		params       map[string]string
+		expected     string
+		expectedErr  string
+	}{
+		{
+			testCaseName: "Named after the PVC",
+			template:     "${pvc.namespace}-${pvc.name}-${rand}",
+			params:       params,
+			expected:     "team-a-data-claim-" + shortDigest(testVolumeName),
+		},
+		{
+			testCaseName: "Named after the PV",
+			template:     "cos-${pv.name}",
+			params:       params,
+			expected:     "cos-" + testVolumeName,
+		},
+		{
+			testCaseName: "Unknown variable",
+			template:     "${pvc.uid}",
+			params:       params,
+			expectedErr:  "unknown variable ${pvc.uid}",
+		},
+		{
+			testCaseName: "PVC metadata missing",
+			template:     "${pvc.namespace}-${pvc.name}",
+			params:       map[string]string{},
+			expectedErr:  "--extra-create-metadata",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		actual, err := renderBucketName(tc.template, tc.params, testVolumeName)
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, actual)
+	}
+}
+
+func TestBucketNameCandidates(t *testing.T) {
+	assert.Equal(t, []string{"bucket", "bucket-1", "bucket-2", "bucket-3", "bucket-4"}, bucketNameCandidates("bucket"))
+
+	long := strings.Repeat("b", 62) + "c"
+	for _, candidate := range bucketNameCandidates(long)[1:] {
+		assert.Len(t, candidate, 63)
+		assert.True(t, strings.HasPrefix(candidate, strings.Repeat("b", 61)))
+	}
+}
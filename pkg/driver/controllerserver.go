@@ -11,35 +11,49 @@
 package driver
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
 	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"go.uber.org/zap"
-	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"k8s.io/klog/v2"
 )
 
+// invalidBucketNameChars matches the characters not allowed in a bucket name
+var invalidBucketNameChars = regexp.MustCompile(`[^a-z0-9.-]`)
+
+// copyJobWait is how long CreateVolume waits for the copy populating a volume
+// before letting the provisioner retry
+var copyJobWait = 20 * time.Second
+
 // Implements Controller csi.ControllerServer
 type controllerServer struct {
 	*S3Driver
 	Stats      utils.StatsUtils
 	cosSession s3client.ObjectStorageSessionFactory
 	Logger     *zap.Logger
+	copyJobs   copyJobs
+	deleteJobs deleteJobs
+	// clusterID identifies the cluster in the tags of the buckets created by the driver
+	clusterID string
 }
 
-func (cs *controllerServer) CreateVolume(_ context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+func (cs *controllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 	var (
 		bucketName         string
 		endPoint           string
@@ -56,11 +70,15 @@ func (cs *controllerServer) CreateVolume(_ context.Context, req *csi.CreateVolum
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in sanitizeVolumeID  %v", err))
 	}
-	volumeID := volumeName
-	if len(volumeID) == 0 {
+	if len(volumeName) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume name missing in request")
 	}
-	klog.Infof("Got a request to create volume: %s", volumeID)
+	klog.Infof("Got a request to create volume: %s", volumeName)
+	release, err := cs.locks.acquire(volumeNameLock, volumeName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	caps := req.GetVolumeCapabilities()
 	if caps == nil {
@@ -73,7 +91,17 @@ func (cs *controllerServer) CreateVolume(_ context.Context, req *csi.CreateVolum
 	}
 
 	params := req.GetParameters()
-	klog.Info("CreateVolume Parameters:\n\t", params)
+	klog.Info("CreateVolume Parameters:\n\t", utils.MaskSecrets(params))
+
+	modification, err := parseMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	bucketOptions, err := parseBucketParameters(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	fingerprint := volumeFingerprint(req)
 
 	secretMap := req.GetSecrets()
 	creds, err := getCredentials(req.GetSecrets())
@@ -81,6 +109,21 @@ func (cs *controllerServer) CreateVolume(_ context.Context, req *csi.CreateVolum
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in getting credentials %v", err))
 	}
 
+	provider, err := getProvider(secretMap, params)
+	if err != nil {
+		return nil, err
+	}
+	if creds.AuthType == "iam" && !provider.IBMExtensions {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("provider %s does not support IAM authentication, accessKey and secretKey are required", provider.Name))
+	}
+	if bucketOptions.Retention != nil && !provider.IBMExtensions {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("provider %s does not support retention policies", provider.Name))
+	}
+	// Volumes record their provider, for the nodes to find it without the secret
+	if provider.Name != utils.DefaultProvider.Name {
+		params["provider"] = provider.Name
+	}
+
 	endPoint = secretMap["cosEndpoint"]
 	locationConstraint = secretMap["locationConstraint"]
 
@@ -90,6 +133,9 @@ func (cs *controllerServer) CreateVolume(_ context.Context, req *csi.CreateVolum
 	if locationConstraint == "" {
 		locationConstraint = params["locationConstraint"]
 	}
+	if locationConstraint == "" {
+		locationConstraint = provider.DefaultRegion
+	}
 
 	if endPoint == "" {
 		return nil, status.Error(codes.InvalidArgument, "cosEndpoint unknown")
@@ -100,55 +146,137 @@ func (cs *controllerServer) CreateVolume(_ context.Context, req *csi.CreateVolum
 
 	kpRootKeyCrn = secretMap["kpRootKeyCRN"]
 	if kpRootKeyCrn != "" {
+		if !provider.IBMExtensions {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("provider %s does not support Key Protect encryption", provider.Name))
+		}
 		klog.Infof("key protect root key crn provided for bucket creation")
 	}
 
-	sess := cs.cosSession.NewObjectStorageSession(endPoint, locationConstraint, creds, cs.Logger)
-	bucketName = secretMap["bucketName"]
-	params["userProvidedBucket"] = "true"
-	if bucketName != "" {
-		// User Provided bucket. Check its existence and create if not present
-		klog.Infof("Bucket name provided")
-		if err := sess.CheckBucketAccess(bucketName); err != nil {
-			klog.Infof("CreateVolume: Unable to access the bucket: %v, Creating with given name", err)
-			err = createBucket(sess, bucketName, kpRootKeyCrn)
-			if err != nil {
-				return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("%v: %v", err, bucketName))
+	sess := cs.cosSession.NewObjectStorageSession(provider, endPoint, locationConstraint, creds, cs.Logger)
+
+	contentSource := req.GetVolumeContentSource()
+	if contentSource != nil {
+		// An earlier call may already be populating the volume
+		if job := cs.copyJobs.get(volumeName); job != nil {
+			if job.failed() {
+				klog.Infof("CreateVolume: resuming the population of volume %s", volumeName)
+				cs.copyJobs.start(volumeName, job)
 			}
-			params["userProvidedBucket"] = "false"
-			klog.Infof("Created bucket: %s", bucketName)
+			return waitForCopyJob(volumeName, job, &cs.copyJobs)
 		}
-		params["bucketName"] = bucketName
-	} else {
-		// Generate random temp bucket name based on volume id
-		klog.Infof("Bucket name not provided")
-		tempBucketName := getTempBucketName(secretMap["mounter"], volumeID)
-		if tempBucketName == "" {
-			klog.Errorf("CreateVolume: Unable to generate the bucket name")
-			return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("Unable to access the bucket: %v", tempBucketName))
-		}
-		err = createBucket(sess, tempBucketName, kpRootKeyCrn)
+	}
+
+	// Resolve the content source before any bucket gets created
+	var populate *bucketCopy
+	if contentSource != nil {
+		populate, err = cs.newContentSourceCopy(ctx, contentSource, sess, provider, creds, endPoint, locationConstraint)
 		if err != nil {
-			return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("%v: %v", err, tempBucketName))
+			return nil, err
+		}
+		klog.Infof("CreateVolume: volume %s will be populated from bucket %s", volumeName, populate.srcBucket)
+	}
+
+	var volumeID, prefix string
+	capacity := req.GetCapacityRange().GetRequiredBytes()
+	if bucketName = params["sharedBucket"]; bucketName != "" {
+		// The volume only owns a prefix of a bucket shared with other volumes
+		if modification.changesBucket() || bucketOptions != (s3client.BucketOptions{}) {
+			return nil, status.Error(codes.InvalidArgument, "bucket settings cannot be set on volumes sharing a bucket")
+		}
+		prefix = getVolumePrefix(params, volumeName, bucketName, provider.Name)
+		volumeID = utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: bucketName, Prefix: prefix, Provider: provider.Name, Endpoint: endPoint, Region: locationConstraint})
+		var releaseVolume func()
+		if releaseVolume, err = cs.locks.acquire(volumeIDLock, volumeID); err != nil {
+			return nil, err
+		}
+		defer releaseVolume()
+		// A volume of the same name still being deleted would delete the new volume
+		cs.deleteJobs.remove(volumeID)
+		if err = cs.createVolumePrefix(ctx, sess, bucketName, prefix, s3client.BucketOptions{KPRootKeyCRN: kpRootKeyCrn}); err != nil {
+			return nil, err
+		}
+		klog.Infof("CreateVolume: volume %s uses prefix %s of bucket %s", volumeName, prefix, bucketName)
+		params["objPath"] = prefix
+		params["userProvidedBucket"] = "true"
+	} else {
+		bucketName = secretMap["bucketName"]
+		userProvided := bucketName != ""
+		names := []string{bucketName}
+		if !userProvided {
+			klog.Infof("Bucket name not provided")
+			if bucketName, err = getVolumeBucketName(params, secretMap["mounter"], volumeName); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			// A name taken by another volume or account is retried with a suffix
+			names = bucketNameCandidates(bucketName)
+		}
+
+		// The lock of the volume ID of each rejected name is released before the next
+		// name is tried, a DeleteVolume of the volume would race with its creation
+		var releaseVolume func()
+		for i, name := range names {
+			bucketName = name
+			// The volume ID describes the bucket, for the volume to be found without its PV
+			idInfo := utils.VolumeIDInfo{BucketName: bucketName, Owned: true, Provider: provider.Name, Endpoint: endPoint, Region: locationConstraint}
+			release, err := cs.locks.acquire(volumeIDLock, utils.EncodeVolumeID(idInfo))
+			if err != nil {
+				return nil, err
+			}
+			// A volume of the same name still being deleted would delete the new bucket
+			cs.deleteJobs.remove(utils.EncodeVolumeID(idInfo))
+			bucketOptions.KPRootKeyCRN = kpRootKeyCrn
+			volumeID, capacity, err = cs.createVolumeBucket(ctx, sess, provider, idInfo, userProvided, req.GetCapacityRange(), fingerprint, bucketOptions, params, secretMap)
+			if err == nil {
+				releaseVolume = release
+				break
+			}
+			release()
+			if !errors.Is(err, errBucketNameTaken) {
+				return nil, err
+			}
+			if i == len(names)-1 {
+				return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("%v: %v", err, bucketName))
+			}
+			klog.Infof("CreateVolume: bucket name %s is taken, trying the next name", bucketName)
 		}
-		klog.Infof("Created temp bucket: %s", tempBucketName)
-		params["userProvidedBucket"] = "false"
-		params["bucketName"] = tempBucketName
+		defer releaseVolume()
+	}
+	params["bucketName"] = bucketName
+
+	if err = cs.modifyBucket(ctx, sess, provider, params["bucketName"], secretMap, modification); err != nil {
+		return nil, err
+	}
+	// The PV does not exist yet, the nodes find the mount options in the volume context
+	if modification.mountOptions != nil {
+		params["mountOptions"] = *modification.mountOptions
 	}
+
 	klog.Infof("create volume: %v", volumeID)
 	//COS Endpoint, bucket, access keys will be stored in the csiProvisionerSecretName
 	//The other tunables will be SC Parameters like ibm.io/multireq-max and other
 
-	return &csi.CreateVolumeResponse{
-		Volume: &csi.Volume{
-			VolumeId:      volumeID,
-			CapacityBytes: req.GetCapacityRange().GetRequiredBytes(),
-			VolumeContext: params,
-		},
-	}, nil
+	volume := &csi.Volume{
+		VolumeId:      volumeID,
+		CapacityBytes: capacity,
+		VolumeContext: params,
+		ContentSource: contentSource,
+	}
+	if populate != nil {
+		populate.dstSess = sess
+		populate.dstBucket = params["bucketName"]
+		populate.dstPrefix = secretMap["objPath"]
+		if prefix != "" {
+			populate.dstPrefix = prefix
+		}
+		job := &copyJob{copy: populate, volume: volume}
+		cs.copyJobs.start(volumeName, job)
+		return waitForCopyJob(volumeName, job, &cs.copyJobs)
+	}
+
+	return &csi.CreateVolumeResponse{Volume: volume}, nil
 }
 
-func (cs *controllerServer) DeleteVolume(_ context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+func (cs *controllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 	modifiedRequest, err := utils.ReplaceAndReturnCopy(req)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in modifying requests %v", err))
@@ -160,26 +288,79 @@ func (cs *controllerServer) DeleteVolume(_ context.Context, req *csi.DeleteVolum
 		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
 	}
 	klog.Infof("Deleting volume %v", volumeID)
+	release, err := cs.locks.acquire(volumeIDLock, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	cs.copyJobs.removeVolume(volumeID)
 	secretMap := req.GetSecrets()
 
 	creds, err := getCredentials(req.GetSecrets())
 	if err != nil {
-		return nil, fmt.Errorf("cannot get credentials: %v", err)
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("cannot get credentials: %v", err))
 	}
 
-	endPoint := secretMap["cosEndpoint"]
-	locationConstraint := secretMap["locationConstraint"]
-	sess := cs.cosSession.NewObjectStorageSession(endPoint, locationConstraint, creds, cs.Logger)
-
-	bucketToDelete, err := cs.Stats.BucketToDelete(volumeID)
+	provider, err := getVolumeProvider(volumeID, secretMap)
 	if err != nil {
-		return &csi.DeleteVolumeResponse{}, nil
+		return nil, err
+	}
+	endPoint, locationConstraint := volumeLocation(volumeID, secretMap)
+	sess := cs.cosSession.NewObjectStorageSession(provider, endPoint, locationConstraint, creds, cs.Logger)
+
+	var bucketToDelete string
+	if info, ok := utils.DecodeVolumeID(volumeID); ok {
+		if info.Prefix != "" {
+			// The bucket is shared with other volumes, only the objects of the volume go
+			job := cs.deleteJobs.start(volumeID, func(ctx context.Context, progress *s3client.DeleteProgress) error {
+				return sess.DeleteObjects(ctx, info.BucketName, objectPrefix(info.Prefix), progress)
+			})
+			err = waitForDeleteJob(volumeID, job, &cs.deleteJobs)
+			if status.Code(err) == codes.Aborted {
+				return nil, err
+			}
+			if err != nil {
+				klog.Errorf("DeleteVolume: Unable to delete prefix %s of bucket %s: %v", info.Prefix, info.BucketName, err)
+				if errors.Is(err, s3client.ErrBucketProtected) {
+					return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("objects of volume %s are still under retention: %v", volumeID, err))
+				}
+				return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to delete the objects of volume %s: %v", volumeID, err))
+			}
+			klog.Infof("End of prefix delete for %v", volumeID)
+		}
+		if info.Owned {
+			bucketToDelete = info.BucketName
+		}
+	} else {
+		// Plain volume IDs of older releases are resolved through their PV
+		bucketToDelete, err = cs.Stats.BucketToDelete(volumeID)
+		if err != nil {
+			return &csi.DeleteVolumeResponse{}, nil
+		}
 	}
 
 	if bucketToDelete != "" {
-		err = sess.DeleteBucket(bucketToDelete)
+		job := cs.deleteJobs.start(volumeID, func(ctx context.Context, progress *s3client.DeleteProgress) error {
+			return sess.DeleteBucket(ctx, bucketToDelete, progress)
+		})
+		err = waitForDeleteJob(volumeID, job, &cs.deleteJobs)
+		if status.Code(err) == codes.Aborted {
+			return nil, err
+		}
+		if errors.Is(err, s3client.ErrBucketProtected) {
+			// Retrying is useless until the retention of the objects expires
+			klog.Errorf("DeleteVolume: bucket %s holds objects under retention: %v", bucketToDelete, err)
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("bucket %s of volume %s holds objects under retention: %v", bucketToDelete, volumeID, err))
+		}
 		if err != nil {
-			klog.V(3).Infof("Cannot delete temp bucket: %v; error msg: %v", bucketToDelete, err)
+			// A bucket already gone needs no retry, the bucket is left behind otherwise
+			// unless the provisioner retries
+			code := cosErrorCode(err, codes.Internal)
+			if code != codes.NotFound {
+				klog.Errorf("DeleteVolume: Unable to delete bucket %s of volume %s: %v", bucketToDelete, volumeID, err)
+				return nil, status.Error(code, fmt.Sprintf("unable to delete bucket %s of volume %s: %v", bucketToDelete, volumeID, err))
+			}
+			klog.Infof("DeleteVolume: bucket %s of volume %s is already deleted", bucketToDelete, volumeID)
 		}
 		klog.Infof("End of bucket delete for  %v", volumeID)
 	}
@@ -221,9 +402,32 @@ func (cs *controllerServer) ValidateVolumeCapabilities(_ context.Context, req *c
 	}, nil
 }
 
-func (cs *controllerServer) ListVolumes(_ context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
-	klog.V(3).Infof("ListVolumes: Request: %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "ListVolumes")
+func (cs *controllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	klog.V(3).Infof("ListVolumes: Request: %+v", req)
+
+	volumes, err := cs.Stats.ListDriverVolumes(cs.name)
+	if err != nil {
+		klog.Errorf("ListVolumes: Unable to list volumes: %v", err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to list volumes: %v", err))
+	}
+
+	// The tags of the buckets are only read for the candidates of the page, which
+	// may hold fewer entries than requested
+	candidates := cs.listVolumeCandidates(ctx, volumes)
+	start, end, nextToken, err := paginate(len(candidates), req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, end-start)
+	for _, candidate := range candidates[start:end] {
+		if entry := cs.volumeEntry(ctx, candidate); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
 }
 
 func (cs *controllerServer) GetCapacity(_ context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
@@ -247,34 +451,381 @@ func (cs *controllerServer) ControllerGetCapabilities(_ context.Context, req *cs
 	return &csi.ControllerGetCapabilitiesResponse{Capabilities: caps}, nil
 }
 
-func (cs *controllerServer) CreateSnapshot(_ context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
-	klog.V(3).Infof("CreateSnapshot: Request: %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "CreateSnapshot")
+func (cs *controllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	modifiedRequest, err := utils.ReplaceAndReturnCopy(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in modifying requests %v", err))
+	}
+	klog.V(3).Infof("CreateSnapshot: Request: %+v", modifiedRequest.(*csi.CreateSnapshotRequest))
+
+	if len(req.GetName()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot name missing in request")
+	}
+	sourceVolumeID := req.GetSourceVolumeId()
+	if len(sourceVolumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Source volume ID missing in request")
+	}
+
+	secretMap := req.GetSecrets()
+	sess, err := cs.newSessionFromSecrets(secretMap, req.GetParameters())
+	if err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(secretMap, req.GetParameters())
+	if err != nil {
+		return nil, err
+	}
+
+	// A snapshot is a dedicated bucket named after the snapshot, tagged as ready to
+	// use once the copy is complete
+	snapshotID := getSnapshotBucketName(req.GetName())
+	release, err := cs.locks.acquire(snapshotLock, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	tags, err := sess.GetBucketTags(ctx, snapshotID)
+	if err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to read snapshot %s: %v", snapshotID, err))
+	}
+	if tags[constants.SnapshotIDTag] == snapshotID {
+		if tags[constants.SourceVolumeIDTag] != sourceVolumeID {
+			return nil, status.Error(codes.AlreadyExists, fmt.Sprintf("snapshot %s already exists for source volume %s", snapshotID, tags[constants.SourceVolumeIDTag]))
+		}
+		if tags[constants.ReadyToUseTag] != "false" {
+			klog.Infof("CreateSnapshot: snapshot %s already exists", snapshotID)
+			return &csi.CreateSnapshotResponse{Snapshot: snapshotFromTags(provider.Name, tags)}, nil
+		}
+		klog.Infof("CreateSnapshot: resuming the copy of snapshot %s", snapshotID)
+	}
+
+	sourceBucket, err := cs.getVolumeBucket(sourceVolumeID, secretMap)
+	if err != nil {
+		return nil, err
+	}
+	if err = sess.CheckBucketAccess(ctx, sourceBucket); err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.NotFound), fmt.Sprintf("unable to access bucket %s of volume %s: %v", sourceBucket, sourceVolumeID, err))
+	}
+
+	if err = createBucket(ctx, sess, snapshotID, s3client.BucketOptions{KPRootKeyCRN: secretMap["kpRootKeyCRN"]}); err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("%v: %v", err, snapshotID))
+	}
+
+	// The bucket is tagged before the copy, for DeleteSnapshot to find it should it
+	// be left behind
+	tags = cs.ownershipTags()
+	tags[constants.SnapshotIDTag] = snapshotID
+	tags[constants.SourceVolumeIDTag] = sourceVolumeID
+	tags[constants.CreationTimeTag] = time.Now().UTC().Format(time.RFC3339)
+	tags[constants.ReadyToUseTag] = "false"
+	if err = sess.SetBucketTags(ctx, snapshotID, tags); err != nil {
+		deleteSnapshotBucket(ctx, sess, snapshotID)
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to tag snapshot %s: %v", snapshotID, err))
+	}
+
+	snapshotCopy := &bucketCopy{
+		srcSess:   sess,
+		srcBucket: sourceBucket,
+		srcPrefix: getVolumeObjPath(sourceVolumeID, secretMap),
+		dstSess:   sess,
+		dstBucket: snapshotID,
+	}
+	size, err := snapshotCopy.run(ctx)
+	if err != nil {
+		klog.Errorf("CreateSnapshot: Unable to copy volume %s into snapshot %s: %v", sourceVolumeID, snapshotID, err)
+		deleteSnapshotBucket(ctx, sess, snapshotID)
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to copy volume %s: %v", sourceVolumeID, err))
+	}
+
+	tags[constants.SizeBytesTag] = strconv.FormatInt(size, 10)
+	tags[constants.ReadyToUseTag] = "true"
+	if err = sess.SetBucketTags(ctx, snapshotID, tags); err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to tag snapshot %s: %v", snapshotID, err))
+	}
+	klog.Infof("Created snapshot %s of volume %s", snapshotID, sourceVolumeID)
+
+	return &csi.CreateSnapshotResponse{Snapshot: snapshotFromTags(provider.Name, tags)}, nil
 }
 
-func (cs *controllerServer) DeleteSnapshot(_ context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
-	klog.V(3).Infof("DeleteSnapshot: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "DeleteSnapshot")
+func (cs *controllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	modifiedRequest, err := utils.ReplaceAndReturnCopy(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in modifying requests %v", err))
+	}
+	klog.V(3).Infof("DeleteSnapshot: called with args %+v", modifiedRequest.(*csi.DeleteSnapshotRequest))
+
+	if len(req.GetSnapshotId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in request")
+	}
+	providerName, snapshotID := utils.DecodeSnapshotID(req.GetSnapshotId())
+	release, err := cs.locks.acquire(snapshotLock, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	sess, err := cs.newSessionFromSecrets(req.GetSecrets(), map[string]string{"provider": providerName})
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := sess.GetBucketTags(ctx, snapshotID)
+	if err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to read snapshot %s: %v", snapshotID, err))
+	}
+	if tags[constants.SnapshotIDTag] != snapshotID {
+		// Never delete a bucket which was not tagged as a snapshot by the driver
+		klog.Infof("DeleteSnapshot: snapshot %s not found, nothing to delete", snapshotID)
+		return &csi.DeleteSnapshotResponse{}, nil
+	}
+
+	if err = sess.DeleteBucket(ctx, snapshotID, nil); err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to delete snapshot %s: %v", snapshotID, err))
+	}
+	klog.Infof("Deleted snapshot %s", snapshotID)
+
+	return &csi.DeleteSnapshotResponse{}, nil
 }
 
-func (cs *controllerServer) ListSnapshots(_ context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
-	klog.V(3).Infof("ListSnapshots: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "ListSnapshots")
+func (cs *controllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	modifiedRequest, err := utils.ReplaceAndReturnCopy(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in modifying requests %v", err))
+	}
+	klog.V(3).Infof("ListSnapshots: called with args %+v", modifiedRequest.(*csi.ListSnapshotsRequest))
+
+	// The provider is named by the snapshot ID, or by the ID of the source volume
+	var providerName, snapshotBucket string
+	if req.GetSnapshotId() != "" {
+		providerName, snapshotBucket = utils.DecodeSnapshotID(req.GetSnapshotId())
+	} else if info, ok := utils.DecodeVolumeID(req.GetSourceVolumeId()); ok {
+		providerName = info.Provider
+	}
+	sess, err := cs.newSessionFromSecrets(req.GetSecrets(), map[string]string{"provider": providerName})
+	if err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(req.GetSecrets(), map[string]string{"provider": providerName})
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	if snapshotBucket != "" {
+		candidates = []string{snapshotBucket}
+	} else {
+		candidates, err = sess.ListBuckets(ctx)
+		if err != nil {
+			return nil, status.Error(cosErrorCode(err, codes.Internal), err.Error())
+		}
+		sort.Strings(candidates)
+	}
+
+	var snapshots []*csi.Snapshot
+	for _, bucket := range candidates {
+		tags, err := sess.GetBucketTags(ctx, bucket)
+		if err != nil {
+			// Buckets of other regions cannot be read through this endpoint
+			klog.V(4).Infof("ListSnapshots: skipping bucket %s: %v", bucket, err)
+			continue
+		}
+		if tags[constants.SnapshotIDTag] != bucket {
+			continue
+		}
+		if req.GetSourceVolumeId() != "" && tags[constants.SourceVolumeIDTag] != req.GetSourceVolumeId() {
+			continue
+		}
+		snapshots = append(snapshots, snapshotFromTags(provider.Name, tags))
+	}
+
+	start, end, nextToken, err := paginate(len(snapshots), req.GetStartingToken(), req.GetMaxEntries())
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, end-start)
+	for _, snapshot := range snapshots[start:end] {
+		entries = append(entries, &csi.ListSnapshotsResponse_Entry{Snapshot: snapshot})
+	}
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
 }
 
-func (cs *controllerServer) ControllerExpandVolume(_ context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
-	klog.V(3).Infof("ControllerExpandVolume: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "ControllerExpandVolume")
+func (cs *controllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	modifiedRequest, err := utils.ReplaceAndReturnCopy(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in modifying requests %v", err))
+	}
+	klog.V(3).Infof("ControllerExpandVolume: called with args %+v", modifiedRequest.(*csi.ControllerExpandVolumeRequest))
+
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	release, err := cs.locks.acquire(volumeIDLock, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	capRange := req.GetCapacityRange()
+	if capRange == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity range missing in request")
+	}
+	capacity := capRange.GetRequiredBytes()
+	if capacity == 0 {
+		capacity = capRange.GetLimitBytes()
+	}
+	if limit := capRange.GetLimitBytes(); limit > 0 && capacity > limit {
+		return nil, status.Error(codes.OutOfRange, fmt.Sprintf("required bytes %d exceed limit bytes %d", capacity, limit))
+	}
+
+	volume, err := cs.Stats.GetDriverVolume(volumeID)
+	if errors.Is(err, utils.ErrVolumeNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		klog.Errorf("ControllerExpandVolume: Unable to fetch volume %s: %v", volumeID, err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to fetch volume %s: %v", volumeID, err))
+	}
+
+	// Quotas are only ever raised, a smaller request leaves the volume as it is
+	if capacity <= volume.CapacityBytes {
+		klog.Infof("ControllerExpandVolume: volume %s already has a capacity of %d bytes", volumeID, volume.CapacityBytes)
+		return &csi.ControllerExpandVolumeResponse{CapacityBytes: volume.CapacityBytes}, nil
+	}
+
+	// The quota of a bucket provided by the user is left to its owner
+	if volume.Attributes["userProvidedBucket"] == "false" {
+		bucketName := volume.Attributes["bucketName"]
+		sess, err := cs.newSessionFromSecrets(volume.Secrets, volume.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		provider, err := getProvider(volume.Secrets, volume.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		if err = cs.setVolumeQuota(ctx, nil, provider, bucketName, volume.Secrets, capacity); err != nil {
+			return nil, err
+		}
+		updateCapacityTag(ctx, sess, bucketName, capacity)
+	}
+
+	klog.Infof("ControllerExpandVolume: expanded volume %s to %d bytes", volumeID, capacity)
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         capacity,
+		NodeExpansionRequired: false,
+	}, nil
 }
 
-func (cs *controllerServer) ControllerGetVolume(_ context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
-	klog.V(3).Infof("ControllerGetVolume: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "ControllerGetVolume")
+func (cs *controllerServer) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+	klog.V(3).Infof("ControllerGetVolume: called with args %+v", req)
+
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+
+	volume, err := cs.Stats.GetDriverVolume(volumeID)
+	if errors.Is(err, utils.ErrVolumeNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		klog.Errorf("ControllerGetVolume: Unable to fetch volume %s: %v", volumeID, err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to fetch volume %s: %v", volumeID, err))
+	}
+
+	condition := cs.checkVolumeHealth(ctx, volume)
+	if condition.Abnormal {
+		klog.Warningf("ControllerGetVolume: volume %s is abnormal: %s", volumeID, condition.Message)
+	}
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: volume.CapacityBytes,
+			VolumeContext: volume.Attributes,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: volume.NodeIDs,
+			VolumeCondition:  condition,
+		},
+	}, nil
 }
 
-func (cs *controllerServer) ControllerModifyVolume(_ context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
-	klog.V(3).Infof("ControllerModifyVolume: called with args %+v", *req)
-	return nil, status.Error(codes.Unimplemented, "ControllerModifyVolume")
+func (cs *controllerServer) ControllerModifyVolume(ctx context.Context, req *csi.ControllerModifyVolumeRequest) (*csi.ControllerModifyVolumeResponse, error) {
+	modifiedRequest, err := utils.ReplaceAndReturnCopy(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in modifying requests %v", err))
+	}
+	klog.V(3).Infof("ControllerModifyVolume: called with args %+v", modifiedRequest.(*csi.ControllerModifyVolumeRequest))
+
+	volumeID := req.GetVolumeId()
+	if len(volumeID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	release, err := cs.locks.acquire(volumeIDLock, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	modification, err := parseMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if info, ok := utils.DecodeVolumeID(volumeID); ok && modification.changesBucket() {
+		switch {
+		case info.Prefix != "":
+			return nil, status.Error(codes.InvalidArgument, "bucket settings cannot be changed on volumes sharing a bucket")
+		case !info.Owned:
+			return nil, status.Error(codes.InvalidArgument, "bucket settings cannot be changed on volumes of a bucket provided by the user")
+		}
+	}
+
+	volume, err := cs.Stats.GetDriverVolume(volumeID)
+	if errors.Is(err, utils.ErrVolumeNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		klog.Errorf("ControllerModifyVolume: Unable to fetch volume %s: %v", volumeID, err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("unable to fetch volume %s: %v", volumeID, err))
+	}
+
+	// The settings of a bucket provided by the user are left to its owner, the plain
+	// volume IDs of older releases do not tell who owns the bucket
+	if modification.changesBucket() && volume.Attributes["userProvidedBucket"] != "false" {
+		return nil, status.Error(codes.InvalidArgument, "bucket settings cannot be changed on volumes of a bucket provided by the user")
+	}
+
+	secretMap := volume.Secrets
+	if len(req.GetSecrets()) > 0 {
+		secretMap = req.GetSecrets()
+	}
+	bucketName := volume.Attributes["bucketName"]
+	if bucketName == "" {
+		bucketName = secretMap["bucketName"]
+	}
+	sess, err := cs.newSessionFromSecrets(secretMap, volume.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(secretMap, volume.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cs.modifyBucket(ctx, sess, provider, bucketName, secretMap, modification); err != nil {
+		return nil, err
+	}
+	if modification.mountOptions != nil {
+		if err = cs.Stats.SetPVMountOptions(volumeID, *modification.mountOptions); err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("unable to set mount options of volume %s: %v", volumeID, err))
+		}
+	}
+
+	klog.Infof("ControllerModifyVolume: modified volume %s", volumeID)
+	return &csi.ControllerModifyVolumeResponse{}, nil
 }
 
 func getCredentials(secretMap map[string]string) (*s3client.ObjectStorageCredentials, error) {
@@ -298,6 +849,20 @@ func getCredentials(secretMap map[string]string) (*s3client.ObjectStorageCredent
 		apiKey = val
 	}
 
+	// In workload identity, the service account token of the pod is exchanged for
+	// short-lived credentials of the trusted profile or role of the secret. The token
+	// is only given to NodePublishVolume, the other calls use the keys of the secret.
+	if secretMap["serviceAccountToken"] != "" && (secretMap["trustedProfileId"] != "" || secretMap["roleArn"] != "") {
+		return &s3client.ObjectStorageCredentials{
+			AuthType:            "workload",
+			IAMEndpoint:         iamEndpoint,
+			TrustedProfileID:    secretMap["trustedProfileId"],
+			RoleARN:             secretMap["roleArn"],
+			STSEndpoint:         secretMap["stsEndpoint"],
+			ServiceAccountToken: secretMap["serviceAccountToken"],
+		}, nil
+	}
+
 	// Add In Docs APIKEY is require param in secret
 	authType = "iam"
 	serviceInstanceID = secretMap["serviceId"]
@@ -320,34 +885,811 @@ func getCredentials(secretMap map[string]string) (*s3client.ObjectStorageCredent
 	}, nil
 }
 
+// getTempBucketName returns the default name of the bucket created for a volume
 func getTempBucketName(mounterType, volumeID string) string {
-	currentTime := time.Now()
-	timestamp := currentTime.Format("20060102150405")
-
-	name := fmt.Sprintf("%s%s-%s", mounterType, timestamp, volumeID)
-	return name
+	if mounterType == "" {
+		return volumeID
+	}
+	return fmt.Sprintf("%s-%s", mounterType, volumeID)
 }
 
-func createBucket(sess s3client.ObjectStorageSession, bucketName, kpRootKeyCrn string) error {
-	msg, err := sess.CreateBucket(bucketName, kpRootKeyCrn)
+func createBucket(ctx context.Context, sess s3client.ObjectStorageSession, bucketName string, opts s3client.BucketOptions) error {
+	msg, err := sess.CreateBucket(ctx, bucketName, opts)
 	if msg != "" {
 		klog.Infof("Info:Create Volume module with user provided Bucket name: %v", msg)
 	}
+	alreadyExists := false
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "BucketAlreadyExists" {
-			klog.Warning(fmt.Sprintf("bucket '%s' already exists", bucketName))
-		} else {
+		if !errors.Is(err, s3client.ErrBucketTaken) {
 			klog.Errorf("CreateVolume: Unable to create the bucket: %v", err)
-			return errors.New("unable to create the bucket")
+			return fmt.Errorf("unable to create the bucket: %w", err)
 		}
+		klog.Warning(fmt.Sprintf("bucket '%s' already exists", bucketName))
+		alreadyExists = true
 	}
-	if err := sess.CheckBucketAccess(bucketName); err != nil {
-		klog.Errorf("CreateVolume: Unable to access the bucket: %v", err)
-		return errors.New("unable to access the bucket")
+	if accessErr := sess.CheckBucketAccess(ctx, bucketName); accessErr != nil {
+		klog.Errorf("CreateVolume: Unable to access the bucket: %v", accessErr)
+		if alreadyExists {
+			// The bucket belongs to another account
+			return fmt.Errorf("%w: %w", errBucketNameTaken, err)
+		}
+		return fmt.Errorf("unable to access the bucket: %w", accessErr)
+	}
+	if alreadyExists && opts.Lifecycle != nil {
+		// The rules of a bucket left by an interrupted attempt may be missing
+		if err := sess.SetBucketLifecycle(ctx, bucketName, *opts.Lifecycle); err != nil {
+			klog.Errorf("CreateVolume: Unable to set the lifecycle of the bucket: %v", err)
+			return fmt.Errorf("unable to set the lifecycle of the bucket: %w", err)
+		}
 	}
 	return nil
 }
 
+// newSessionFromSecrets creates an object storage session from the credentials and
+// the endpoint in the secret, falling back to the parameters for the endpoint
+func (cs *controllerServer) newSessionFromSecrets(secretMap, params map[string]string) (s3client.ObjectStorageSession, error) {
+	creds, err := getCredentials(secretMap)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Error in getting credentials %v", err))
+	}
+	provider, err := getProvider(secretMap, params)
+	if err != nil {
+		return nil, err
+	}
+
+	endPoint := secretMap["cosEndpoint"]
+	if endPoint == "" {
+		endPoint = params["cosEndpoint"]
+	}
+	locationConstraint := secretMap["locationConstraint"]
+	if locationConstraint == "" {
+		locationConstraint = params["locationConstraint"]
+	}
+	if endPoint == "" {
+		return nil, status.Error(codes.InvalidArgument, "cosEndpoint unknown")
+	}
+
+	return cs.cosSession.NewObjectStorageSession(provider, endPoint, locationConstraint, creds, cs.Logger), nil
+}
+
+// getProvider returns the provider of a volume. The provider in the secret takes
+// precedence over the one in the parameters, IBM COS being the default.
+func getProvider(secretMap, params map[string]string) (utils.Provider, error) {
+	name := secretMap["provider"]
+	if name == "" {
+		name = params["provider"]
+	}
+	provider, err := utils.GetProvider(name)
+	if err != nil {
+		return utils.Provider{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return provider, nil
+}
+
+// getVolumeProvider returns the provider of a volume. The provider of the secret
+// takes precedence over the one described by the volume ID.
+func getVolumeProvider(volumeID string, secretMap map[string]string) (utils.Provider, error) {
+	var params map[string]string
+	if info, ok := utils.DecodeVolumeID(volumeID); ok {
+		params = map[string]string{"provider": info.Provider}
+	}
+	return getProvider(secretMap, params)
+}
+
+// getVolumeBucket returns the bucket backing a volume. The bucket described by the
+// volume ID takes precedence, then a bucket name in the secret, otherwise the temp
+// bucket recorded on the PV of the volume is used.
+func (cs *controllerServer) getVolumeBucket(volumeID string, secretMap map[string]string) (string, error) {
+	if info, ok := utils.DecodeVolumeID(volumeID); ok {
+		return info.BucketName, nil
+	}
+	if bucketName := secretMap["bucketName"]; bucketName != "" {
+		return bucketName, nil
+	}
+
+	bucketName, err := cs.Stats.GetBucketNameFromPV(volumeID)
+	if err != nil {
+		klog.Errorf("Unable to fetch pv %v", err)
+		return "", status.Error(codes.NotFound, fmt.Sprintf("volume %s not found: %v", volumeID, err))
+	}
+	if bucketName == "" {
+		return "", status.Error(codes.NotFound, fmt.Sprintf("unable to fetch bucket name of volume %s", volumeID))
+	}
+	return bucketName, nil
+}
+
+// getVolumePrefix returns the prefix of a volume sharing a bucket, named after the
+// PVC when the provisioner passes it. The prefix ends with a digest of the volume
+// name, so that a PVC created again never finds the objects of a retained volume.
+// A digest alone is used when the prefix would not fit in the volume ID.
+func getVolumePrefix(params map[string]string, volumeName, bucketName, providerName string) string {
+	sum := sha256.Sum256([]byte(volumeName))
+	digest := hex.EncodeToString(sum[:])
+
+	prefix := volumeName
+	if namespace, name := params[constants.PVCNamespaceKey], params[constants.PVCNameKey]; namespace != "" && name != "" {
+		prefix = namespace + "/" + name
+	}
+	prefix += "-" + digest[:8]
+
+	// The ID holds "v2:p:<provider>:<bucket>/<prefix>:" at least
+	room := constants.MaxVolumeIDLength - len(constants.VolumeIDVersion) - len(providerName) - len(bucketName) - 7
+	if len(prefix) > room {
+		prefix = digest[:min(room, len(digest))]
+	}
+	return prefix
+}
+
+// createVolumePrefix creates the shared bucket of a volume when it is missing, and
+// marks the prefix of the volume with a directory object for the mounters to find it
+func (cs *controllerServer) createVolumePrefix(ctx context.Context, sess s3client.ObjectStorageSession, bucketName, prefix string, opts s3client.BucketOptions) error {
+	if err := sess.CheckBucketAccess(ctx, bucketName); err != nil {
+		klog.Infof("CreateVolume: Unable to access the shared bucket: %v, Creating with given name", err)
+		if err = createBucket(ctx, sess, bucketName, opts); err != nil {
+			return status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("%v: %v", err, bucketName))
+		}
+		if err = sess.SetBucketTags(ctx, bucketName, cs.ownershipTags()); err != nil {
+			klog.Warningf("CreateVolume: Unable to tag shared bucket %s: %v", bucketName, err)
+		}
+	}
+	if err := sess.UploadObject(ctx, bucketName, objectPrefix(prefix), strings.NewReader(""), 0); err != nil {
+		return status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to create prefix %s in bucket %s: %v", prefix, bucketName, err))
+	}
+	return nil
+}
+
+// getVolumeObjPath returns the objPath of a volume, the prefix of a volume sharing a
+// bucket taking precedence over the objPath of the secret
+func getVolumeObjPath(volumeID string, secretMap map[string]string) string {
+	if info, ok := utils.DecodeVolumeID(volumeID); ok && info.Prefix != "" {
+		return info.Prefix
+	}
+	return secretMap["objPath"]
+}
+
+// volumeLocation returns the endpoint and the region of a volume. Those of the secret
+// take precedence over those described by the volume ID.
+func volumeLocation(volumeID string, secretMap map[string]string) (string, string) {
+	endPoint := secretMap["cosEndpoint"]
+	locationConstraint := secretMap["locationConstraint"]
+	if info, ok := utils.DecodeVolumeID(volumeID); ok {
+		if endPoint == "" {
+			endPoint = info.Endpoint
+		}
+		if locationConstraint == "" {
+			locationConstraint = info.Region
+		}
+	}
+	return endPoint, locationConstraint
+}
+
+// createVolumeBucket creates the bucket of a volume, or adopts the bucket created for
+// the volume by an earlier attempt or provided by the user. It returns the ID and the
+// capacity of the volume, or errBucketNameTaken when the bucket belongs to another
+// volume or account.
+func (cs *controllerServer) createVolumeBucket(ctx context.Context, sess s3client.ObjectStorageSession, provider utils.Provider, idInfo utils.VolumeIDInfo,
+	userProvided bool, capRange *csi.CapacityRange, fingerprint string, opts s3client.BucketOptions, params, secretMap map[string]string) (string, int64, error) {
+	bucketName := idInfo.BucketName
+	volumeID := utils.EncodeVolumeID(idInfo)
+
+	// A retried request finds the bucket created for the volume by the first attempt
+	if sess.CheckBucketAccess(ctx, bucketName) == nil {
+		existing, capacity, err := checkVolumeBucket(ctx, sess, bucketName, volumeID, capRange, fingerprint, !userProvided)
+		switch {
+		case err != nil:
+			return "", 0, err
+		case existing:
+			klog.Infof("CreateVolume: bucket %s of volume %s already exists", bucketName, volumeID)
+			params["userProvidedBucket"] = "false"
+			return volumeID, capacity, nil
+		case userProvided:
+			klog.Infof("Bucket name provided")
+			params["userProvidedBucket"] = "true"
+			idInfo.Owned = false
+			return utils.EncodeVolumeID(idInfo), capacity, nil
+		}
+	}
+
+	capacity := capRange.GetRequiredBytes()
+	if err := createBucket(ctx, sess, bucketName, opts); err != nil {
+		if errors.Is(err, errBucketNameTaken) {
+			return "", 0, err
+		}
+		return "", 0, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("%v: %v", err, bucketName))
+	}
+	klog.Infof("Created bucket: %s", bucketName)
+	if err := cs.tagVolumeBucket(ctx, sess, bucketName, volumeID, capacity, fingerprint, params); err != nil {
+		return "", 0, err
+	}
+	if err := cs.setVolumeQuota(ctx, sess, provider, bucketName, secretMap, capacity); err != nil {
+		return "", 0, err
+	}
+	params["userProvidedBucket"] = "false"
+	return volumeID, capacity, nil
+}
+
+// tagVolumeBucket records the volume and its owner on the bucket created for it, for
+// ListVolumes and retried CreateVolume calls to find the bucket. A retried call would
+// take an untagged bucket for the bucket of another volume, so the bucket is deleted
+// when it cannot be tagged.
+func (cs *controllerServer) tagVolumeBucket(ctx context.Context, sess s3client.ObjectStorageSession, bucketName, volumeID string, capacity int64,
+	fingerprint string, params map[string]string) error {
+	tags := cs.ownershipTags()
+	tags[constants.VolumeIDTag] = volumeID
+	tags[constants.CapacityBytesTag] = strconv.FormatInt(capacity, 10)
+	tags[constants.ParametersTag] = fingerprint
+	tags[constants.UserProvidedBucketTag] = "false"
+	if namespace, name := params[constants.PVCNamespaceKey], params[constants.PVCNameKey]; namespace != "" && name != "" {
+		tags[constants.PVCNamespaceTag] = namespace
+		tags[constants.PVCNameTag] = name
+	}
+	err := sess.SetBucketTags(ctx, bucketName, tags)
+	if err == nil {
+		return nil
+	}
+	klog.Errorf("CreateVolume: Unable to tag bucket %s of volume %s: %v", bucketName, volumeID, err)
+	if delErr := sess.DeleteBucket(ctx, bucketName, nil); delErr != nil {
+		klog.Errorf("Unable to delete bucket %s: %v", bucketName, delErr)
+	}
+	return status.Error(codes.Internal, fmt.Sprintf("unable to tag bucket %s: %v", bucketName, err))
+}
+
+// ownershipTags returns the tags telling the driver and the cluster that created a
+// bucket
+func (cs *controllerServer) ownershipTags() map[string]string {
+	tags := map[string]string{constants.DriverNameTag: cs.name}
+	if cs.clusterID != "" {
+		tags[constants.ClusterIDTag] = cs.clusterID
+	}
+	return tags
+}
+
+// checkVolumeBucket tells whether an existing bucket was created for the volume by an
+// earlier CreateVolume call, and returns the capacity of the volume. AlreadyExists is
+// returned when the earlier call asked for an incompatible capacity or other
+// parameters. errBucketNameTaken is returned for a bucket named after the volume but
+// tagged for another volume, while an untagged one is left for the caller to adopt.
+func checkVolumeBucket(ctx context.Context, sess s3client.ObjectStorageSession, bucketName, volumeID string, capRange *csi.CapacityRange,
+	fingerprint string, namedAfterVolume bool) (bool, int64, error) {
+	required := capRange.GetRequiredBytes()
+	tags, err := sess.GetBucketTags(ctx, bucketName)
+	if err != nil {
+		klog.Errorf("CreateVolume: Unable to read tags of bucket %s: %v", bucketName, err)
+		return false, required, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to read tags of bucket %s: %v", bucketName, err))
+	}
+
+	switch owner := tags[constants.VolumeIDTag]; {
+	case owner == volumeID:
+	case owner != "" && namedAfterVolume:
+		klog.Infof("CreateVolume: bucket %s already belongs to volume %s", bucketName, owner)
+		return false, required, errBucketNameTaken
+	default:
+		return false, required, nil
+	}
+
+	capacity, _ := strconv.ParseInt(tags[constants.CapacityBytesTag], 10, 64)
+	if capacity < required || (capRange.GetLimitBytes() > 0 && capacity > capRange.GetLimitBytes()) {
+		return false, required, status.Error(codes.AlreadyExists,
+			fmt.Sprintf("volume %s already exists with an incompatible capacity of %d bytes", volumeID, capacity))
+	}
+	if previous := tags[constants.ParametersTag]; previous != "" && previous != fingerprint {
+		return false, required, status.Error(codes.AlreadyExists, fmt.Sprintf("volume %s already exists with different parameters", volumeID))
+	}
+	return true, capacity, nil
+}
+
+// volumeFingerprint digests the parameters and the content source of a volume, to
+// tell a retried CreateVolume call from a conflicting one
+func volumeFingerprint(req *csi.CreateVolumeRequest) string {
+	var entries []string
+	for k, v := range req.GetParameters() {
+		entries = append(entries, "parameter:"+k+"="+v)
+	}
+	for k, v := range req.GetMutableParameters() {
+		entries = append(entries, "mutable:"+k+"="+v)
+	}
+	if source := req.GetVolumeContentSource(); source != nil {
+		entries = append(entries, "snapshot:"+source.GetSnapshot().GetSnapshotId(), "volume:"+source.GetVolume().GetVolumeId())
+	}
+	sort.Strings(entries)
+	sum := sha256.Sum256([]byte(strings.Join(entries, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// updateCapacityTag records the expanded capacity of a volume on its bucket. As for
+// the other volume tags, a failure is only logged.
+func updateCapacityTag(ctx context.Context, sess s3client.ObjectStorageSession, bucketName string, capacity int64) {
+	tags, err := sess.GetBucketTags(ctx, bucketName)
+	if err != nil {
+		klog.Warningf("ControllerExpandVolume: Unable to read tags of bucket %s: %v", bucketName, err)
+		return
+	}
+	updated := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		updated[k] = v
+	}
+	updated[constants.CapacityBytesTag] = strconv.FormatInt(capacity, 10)
+	if err = sess.SetBucketTags(ctx, bucketName, updated); err != nil {
+		klog.Warningf("ControllerExpandVolume: Unable to tag bucket %s: %v", bucketName, err)
+	}
+}
+
+// setVolumeQuota puts a hard quota of the volume capacity on its bucket. The quota
+// is set through the resource configuration API which needs an IAM API key, buckets
+// reached with HMAC keys only are left without quota. When a session is given, the
+// bucket has just been created for the volume and is deleted if the quota cannot be
+// set, so that a retry starts over.
+func (cs *controllerServer) setVolumeQuota(ctx context.Context, sess s3client.ObjectStorageSession, provider utils.Provider, bucketName string,
+	secretMap map[string]string, capacity int64) error {
+	if capacity <= 0 {
+		return nil
+	}
+	if !provider.ResourceConfiguration {
+		klog.Warningf("Provider %s does not support quotas, bucket %s has no hard quota of %d bytes", provider.Name, bucketName, capacity)
+		return nil
+	}
+	apiKey := secretMap["apiKey"]
+	if apiKey == "" {
+		klog.Warningf("No apiKey provided, bucket %s has no hard quota of %d bytes", bucketName, capacity)
+		return nil
+	}
+
+	err := cs.Stats.SetBucketHardQuota(apiKey, bucketName, capacity)
+	if err == nil {
+		return nil
+	}
+	klog.Errorf("Unable to set hard quota of bucket %s: %v", bucketName, err)
+	if sess != nil {
+		if delErr := sess.DeleteBucket(ctx, bucketName, nil); delErr != nil {
+			klog.Errorf("Unable to delete bucket %s: %v", bucketName, delErr)
+		}
+	}
+	return status.Error(codes.Internal, fmt.Sprintf("unable to set hard quota of bucket %s: %v", bucketName, err))
+}
+
+// volumeAccount groups the volumes whose buckets are reached with the same
+// credentials, so that the buckets of an account are listed once
+type volumeAccount struct {
+	sess    s3client.ObjectStorageSession
+	volumes []utils.DriverVolume
+}
+
+// volumeCandidate is a persistent volume, or a bucket of the accounts of the
+// persistent volumes that may hold a volume created by the driver of this cluster
+type volumeCandidate struct {
+	sess   s3client.ObjectStorageSession
+	volume *utils.DriverVolume
+	bucket string
+	// found tells whether the bucket of the volume was listed
+	found bool
+}
+
+// key orders the candidates, the persistent volumes by ID and the buckets by name
+func (c volumeCandidate) key() string {
+	if c.volume != nil {
+		return c.volume.VolumeID
+	}
+	return c.bucket
+}
+
+// listVolumeCandidates returns the persistent volumes and the other buckets found
+// with their credentials, in a stable order. Each account is listed once, the tags of
+// the buckets are not read.
+func (cs *controllerServer) listVolumeCandidates(ctx context.Context, volumes []utils.DriverVolume) []volumeCandidate {
+	accounts := map[string]*volumeAccount{}
+	var keys []string
+	for _, volume := range volumes {
+		key, err := accountKey(volume.Secrets, volume.Attributes)
+		if err != nil {
+			klog.Warningf("ListVolumes: Unable to get credentials of volume %s: %v", volume.VolumeID, err)
+			continue
+		}
+		sess, err := cs.newSessionFromSecrets(volume.Secrets, volume.Attributes)
+		if err != nil {
+			klog.Warningf("ListVolumes: Unable to reach the bucket of volume %s: %v", volume.VolumeID, err)
+			continue
+		}
+		account, ok := accounts[key]
+		if !ok {
+			account = &volumeAccount{sess: sess}
+			accounts[key] = account
+			keys = append(keys, key)
+		}
+		account.volumes = append(account.volumes, volume)
+	}
+
+	// The buckets of the persistent volumes are listed through their volume only
+	claimed := make(map[string]bool, len(volumes))
+	for _, volume := range volumes {
+		claimed[volume.Attributes["bucketName"]] = true
+	}
+
+	var candidates []volumeCandidate
+	for _, key := range keys {
+		account := accounts[key]
+		buckets, err := account.sess.ListBuckets(ctx)
+		if err != nil {
+			klog.Warningf("ListVolumes: Unable to list buckets: %v", err)
+			continue
+		}
+		existing := make(map[string]bool, len(buckets))
+		for _, bucket := range buckets {
+			existing[bucket] = true
+			if !claimed[bucket] {
+				claimed[bucket] = true
+				candidates = append(candidates, volumeCandidate{sess: account.sess, bucket: bucket})
+			}
+		}
+		for i := range account.volumes {
+			volume := &account.volumes[i]
+			bucketName := volume.Attributes["bucketName"]
+			candidates = append(candidates, volumeCandidate{sess: account.sess, volume: volume, bucket: bucketName, found: existing[bucketName]})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].key() < candidates[j].key()
+	})
+	return candidates
+}
+
+// volumeEntry returns the entry of a candidate, or nil when it is not a volume
+// managed by the driver. A bucket is a volume when it is tagged with a volume by the
+// driver of this cluster. Volumes whose bucket was created by the driver but no
+// longer exists are reported with an abnormal condition.
+func (cs *controllerServer) volumeEntry(ctx context.Context, c volumeCandidate) *csi.ListVolumesResponse_Entry {
+	if c.volume == nil {
+		tags, err := c.sess.GetBucketTags(ctx, c.bucket)
+		if err != nil {
+			klog.Warningf("ListVolumes: Unable to read tags of bucket %s: %v", c.bucket, err)
+			return nil
+		}
+		volumeID := tags[constants.VolumeIDTag]
+		if volumeID == "" || !cs.isDriverBucket(tags) {
+			return nil
+		}
+		capacity, _ := strconv.ParseInt(tags[constants.CapacityBytesTag], 10, 64)
+		return newVolumeEntry(volumeID, capacity, map[string]string{"bucketName": c.bucket}, []string{}, nil)
+	}
+
+	volume := c.volume
+	capacity := volume.CapacityBytes
+	existingBucket := volume.Attributes["userProvidedBucket"] != "false" && volume.Attributes["sharedBucket"] == ""
+	tagged := false
+	if c.found && (existingBucket || capacity == 0) {
+		tags, err := c.sess.GetBucketTags(ctx, c.bucket)
+		if err != nil {
+			klog.Warningf("ListVolumes: Unable to read tags of bucket %s: %v", c.bucket, err)
+		}
+		tagged = tags[constants.VolumeIDTag] == volume.VolumeID && cs.isDriverBucket(tags)
+		if tagged && capacity == 0 {
+			capacity, _ = strconv.ParseInt(tags[constants.CapacityBytesTag], 10, 64)
+		}
+	}
+	if existingBucket && !tagged {
+		// Volumes using existing buckets are not managed by the driver
+		return nil
+	}
+
+	var condition *csi.VolumeCondition
+	if !c.found {
+		condition = &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("bucket %s not found", c.bucket),
+		}
+	}
+	return newVolumeEntry(volume.VolumeID, capacity, volume.Attributes, volume.NodeIDs, condition)
+}
+
+// isDriverBucket tells whether a bucket is tagged as created by the driver of this cluster
+func (cs *controllerServer) isDriverBucket(tags map[string]string) bool {
+	return tags[constants.DriverNameTag] == cs.name && tags[constants.ClusterIDTag] == cs.clusterID
+}
+
+// accountKey identifies the account and the endpoint of a set of credentials, to
+// reach each account once when scanning the buckets of several volumes
+func accountKey(secretMap, params map[string]string) (string, error) {
+	creds, err := getCredentials(secretMap)
+	if err != nil {
+		return "", err
+	}
+	endPoint := secretMap["cosEndpoint"]
+	if endPoint == "" {
+		endPoint = params["cosEndpoint"]
+	}
+	return strings.Join([]string{endPoint, creds.AccessKey, creds.APIKey, creds.ServiceInstanceID}, "|"), nil
+}
+
+// checkVolumeHealth checks that the bucket of a volume, and its objPath when one
+// is set, can be accessed with the credentials of the volume
+func (cs *controllerServer) checkVolumeHealth(ctx context.Context, volume *utils.DriverVolume) *csi.VolumeCondition {
+	sess, err := cs.newSessionFromSecrets(volume.Secrets, volume.Attributes)
+	if err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("credentials of the volume unavailable: %v", status.Convert(err).Message()),
+		}
+	}
+
+	bucketName := volume.Attributes["bucketName"]
+	if err = sess.CheckBucketAccess(ctx, bucketName); err != nil {
+		return &csi.VolumeCondition{Abnormal: true, Message: describeBucketError(bucketName, err)}
+	}
+
+	objPath := volume.Secrets["objPath"]
+	if objPath == "" {
+		objPath = volume.Attributes["objPath"]
+	}
+	if objPath != "" {
+		exists, err := sess.CheckObjectPathExistence(ctx, bucketName, objPath)
+		if err != nil {
+			return &csi.VolumeCondition{Abnormal: true, Message: describeBucketError(bucketName, err)}
+		}
+		if !exists {
+			return &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf("object path %s not found in bucket %s", objPath, bucketName),
+			}
+		}
+	}
+	return &csi.VolumeCondition{Message: "volume is healthy"}
+}
+
+// describeBucketError returns the cause of a failure to access a bucket
+func describeBucketError(bucketName string, err error) string {
+	switch {
+	case errors.Is(err, s3client.ErrBucketNotFound):
+		return fmt.Sprintf("bucket %s not found", bucketName)
+	case errors.Is(err, s3client.ErrAccessDenied):
+		return fmt.Sprintf("access denied to bucket %s", bucketName)
+	case errors.Is(err, s3client.ErrInvalidCredentials):
+		return fmt.Sprintf("credentials expired or invalid for bucket %s: %v", bucketName, err)
+	case errors.Is(err, s3client.ErrEndpointUnreachable):
+		return fmt.Sprintf("endpoint unreachable for bucket %s: %v", bucketName, err)
+	}
+	return fmt.Sprintf("unable to access bucket %s: %v", bucketName, err)
+}
+
+// cosErrorCode returns the gRPC code of an object storage error from its cause, for
+// the sidecars to retry the calls that may succeed later. fallback is returned when
+// the cause is unknown.
+func cosErrorCode(err error, fallback codes.Code) codes.Code {
+	switch {
+	case errors.Is(err, s3client.ErrBucketNotFound):
+		return codes.NotFound
+	case errors.Is(err, s3client.ErrBucketTaken), errors.Is(err, errBucketNameTaken):
+		return codes.AlreadyExists
+	case errors.Is(err, s3client.ErrAccessDenied):
+		return codes.PermissionDenied
+	case errors.Is(err, s3client.ErrInvalidCredentials):
+		return codes.Unauthenticated
+	case errors.Is(err, s3client.ErrThrottled), errors.Is(err, s3client.ErrEndpointUnreachable):
+		return codes.Unavailable
+	case errors.Is(err, s3client.ErrBucketProtected):
+		return codes.FailedPrecondition
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	return fallback
+}
+
+func newVolumeEntry(volumeID string, capacity int64, volumeContext map[string]string, nodeIDs []string,
+	condition *csi.VolumeCondition) *csi.ListVolumesResponse_Entry {
+	if condition == nil {
+		condition = &csi.VolumeCondition{Message: "volume is healthy"}
+	}
+	return &csi.ListVolumesResponse_Entry{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: capacity,
+			VolumeContext: volumeContext,
+		},
+		Status: &csi.ListVolumesResponse_VolumeStatus{
+			PublishedNodeIds: nodeIDs,
+			VolumeCondition:  condition,
+		},
+	}
+}
+
+// newContentSourceCopy returns the copy populating a new volume from its content
+// source, or NotFound when the source does not exist. The source volume may live
+// behind another endpoint, its objects are then streamed into the new bucket.
+func (cs *controllerServer) newContentSourceCopy(ctx context.Context, source *csi.VolumeContentSource, sess s3client.ObjectStorageSession,
+	provider utils.Provider, creds *s3client.ObjectStorageCredentials, endPoint, locationConstraint string) (*bucketCopy, error) {
+	if snapshot := source.GetSnapshot(); snapshot != nil {
+		snapshotID := snapshot.GetSnapshotId()
+		if snapshotID == "" {
+			return nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in volume content source")
+		}
+		// The snapshot is read through the session of the volume, of the same account
+		_, snapshotBucket := utils.DecodeSnapshotID(snapshotID)
+		if _, err := getSnapshot(ctx, sess, snapshotBucket); err != nil {
+			return nil, err
+		}
+		return &bucketCopy{srcSess: sess, srcBucket: snapshotBucket}, nil
+	}
+
+	if volume := source.GetVolume(); volume != nil {
+		sourceVolumeID := volume.GetVolumeId()
+		if sourceVolumeID == "" {
+			return nil, status.Error(codes.InvalidArgument, "Volume ID missing in volume content source")
+		}
+		attrs, err := cs.getSourceVolumeAttributes(sourceVolumeID)
+		if err != nil {
+			return nil, err
+		}
+		if attrs["bucketName"] == "" {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("unable to fetch bucket name of volume %s", sourceVolumeID))
+		}
+
+		sourceCopy := &bucketCopy{
+			srcSess:   sess,
+			srcBucket: attrs["bucketName"],
+			srcPrefix: attrs["objPath"],
+		}
+		if srcEndPoint := attrs["cosEndpoint"]; srcEndPoint != "" && !sameEndpoint(srcEndPoint, endPoint) {
+			srcLocationConstraint := attrs["locationConstraint"]
+			if srcLocationConstraint == "" {
+				srcLocationConstraint = locationConstraint
+			}
+			srcProvider := provider
+			if attrs["provider"] != "" {
+				if srcProvider, err = getProvider(nil, attrs); err != nil {
+					return nil, err
+				}
+			}
+			sourceCopy.srcSess = cs.cosSession.NewObjectStorageSession(srcProvider, srcEndPoint, srcLocationConstraint, creds, cs.Logger)
+			sourceCopy.crossEndpoint = true
+		}
+		if err = sourceCopy.srcSess.CheckBucketAccess(ctx, sourceCopy.srcBucket); err != nil {
+			return nil, status.Error(cosErrorCode(err, codes.NotFound), fmt.Sprintf("unable to access bucket %s of volume %s: %v", sourceCopy.srcBucket, sourceVolumeID, err))
+		}
+		return sourceCopy, nil
+	}
+
+	return nil, status.Error(codes.InvalidArgument, "Unsupported volume content source")
+}
+
+// getSourceVolumeAttributes returns the bucket, the prefix and the location of a
+// volume to clone, as described by its volume ID. The plain volume IDs of the
+// volumes created by earlier releases are resolved through their PV.
+func (cs *controllerServer) getSourceVolumeAttributes(volumeID string) (map[string]string, error) {
+	if info, ok := utils.DecodeVolumeID(volumeID); ok {
+		return map[string]string{
+			"bucketName":         info.BucketName,
+			"objPath":            info.Prefix,
+			"cosEndpoint":        info.Endpoint,
+			"locationConstraint": info.Region,
+			"provider":           info.Provider,
+		}, nil
+	}
+
+	attrs, err := cs.Stats.GetPVAttributes(volumeID)
+	if err != nil {
+		klog.Errorf("Unable to fetch pv %v", err)
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("source volume %s not found: %v", volumeID, err))
+	}
+	return attrs, nil
+}
+
+// sameEndpoint tells whether two endpoints are the same, the https scheme being
+// implied by the endpoints of the volume IDs
+func sameEndpoint(a, b string) bool {
+	return strings.TrimPrefix(a, "https://") == strings.TrimPrefix(b, "https://")
+}
+
+// waitForCopyJob waits for the copy populating a volume for a while. The volume
+// is returned once the copy is complete, a copy still running is reported as
+// Aborted so that the provisioner retries the call later.
+func waitForCopyJob(volumeName string, job *copyJob, jobs *copyJobs) (*csi.CreateVolumeResponse, error) {
+	select {
+	case <-job.done:
+	case <-time.After(copyJobWait):
+		return nil, status.Error(codes.Aborted, fmt.Sprintf("volume %s is being populated: %d/%d objects copied",
+			volumeName, job.copy.copied.Load(), job.copy.total.Load()))
+	}
+
+	if job.err != nil {
+		klog.Errorf("CreateVolume: Unable to populate volume %s: %v", volumeName, job.err)
+		return nil, status.Error(cosErrorCode(job.err, codes.Internal), fmt.Sprintf("unable to populate volume %s, the copy will resume on retry: %v", volumeName, job.err))
+	}
+	jobs.remove(volumeName)
+	klog.Infof("Populated volume %s from bucket %s", volumeName, job.copy.srcBucket)
+	return &csi.CreateVolumeResponse{Volume: job.volume}, nil
+}
+
+// getSnapshotBucketName returns the name of the bucket holding a snapshot
+func getSnapshotBucketName(snapshotName string) string {
+	name := invalidBucketNameChars.ReplaceAllString(strings.ToLower(snapshotName), "-")
+	name = strings.Trim(name, ".-")
+	if len(name) < 3 || len(name) > 63 {
+		h := sha256.Sum256([]byte(snapshotName))
+		name = "snapshot-" + hex.EncodeToString(h[:])[:54]
+	}
+	return name
+}
+
+// deleteSnapshotBucket deletes the bucket of a snapshot which could not be created,
+// even when the call was cancelled. A bucket which cannot be deleted stays tagged as
+// not ready, DeleteSnapshot deletes it.
+func deleteSnapshotBucket(ctx context.Context, sess s3client.ObjectStorageSession, snapshotID string) {
+	if err := sess.DeleteBucket(context.WithoutCancel(ctx), snapshotID, nil); err != nil {
+		klog.Errorf("CreateSnapshot: Unable to delete bucket %s of failed snapshot: %v", snapshotID, err)
+		return
+	}
+	klog.Infof("CreateSnapshot: deleted bucket %s of failed snapshot", snapshotID)
+}
+
+// getSnapshot returns the snapshot stored in the given bucket, NotFound when the
+// bucket does not hold a snapshot, or Unavailable while its copy is not complete
+func getSnapshot(ctx context.Context, sess s3client.ObjectStorageSession, snapshotID string) (*csi.Snapshot, error) {
+	tags, err := sess.GetBucketTags(ctx, snapshotID)
+	if err != nil {
+		return nil, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to read snapshot %s: %v", snapshotID, err))
+	}
+	if tags[constants.SnapshotIDTag] != snapshotID {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("snapshot %s not found", snapshotID))
+	}
+	if tags[constants.ReadyToUseTag] == "false" {
+		return nil, status.Error(codes.Unavailable, fmt.Sprintf("snapshot %s is not ready to use", snapshotID))
+	}
+	return snapshotFromTags("", tags), nil
+}
+
+// snapshotFromTags returns the snapshot described by the tags of its bucket, of the
+// named provider
+func snapshotFromTags(providerName string, tags map[string]string) *csi.Snapshot {
+	snapshot := &csi.Snapshot{
+		SnapshotId:     utils.EncodeSnapshotID(providerName, tags[constants.SnapshotIDTag]),
+		SourceVolumeId: tags[constants.SourceVolumeIDTag],
+		// Snapshots of older releases were only tagged once complete
+		ReadyToUse: tags[constants.ReadyToUseTag] != "false",
+	}
+	if size, err := strconv.ParseInt(tags[constants.SizeBytesTag], 10, 64); err == nil {
+		snapshot.SizeBytes = size
+	}
+	if creationTime, err := time.Parse(time.RFC3339, tags[constants.CreationTimeTag]); err == nil {
+		snapshot.CreationTime = timestamppb.New(creationTime)
+	}
+	return snapshot
+}
+
+// objectPrefix turns an objPath into a key prefix
+func objectPrefix(objPath string) string {
+	objPath = strings.Trim(objPath, "/")
+	if objPath == "" {
+		return ""
+	}
+	return objPath + "/"
+}
+
+// paginate returns the bounds of the page selected by startingToken and maxEntries
+// in a list of total entries, along with the token of the next page
+func paginate(total int, startingToken string, maxEntries int32) (int, int, string, error) {
+	if maxEntries < 0 {
+		return 0, 0, "", status.Error(codes.InvalidArgument, "max_entries must not be negative")
+	}
+
+	start := 0
+	if startingToken != "" {
+		var err error
+		start, err = strconv.Atoi(startingToken)
+		if err != nil || start < 0 || start > total {
+			return 0, 0, "", status.Error(codes.Aborted, fmt.Sprintf("invalid starting_token %s", startingToken))
+		}
+	}
+
+	end := total
+	nextToken := ""
+	if maxEntries > 0 && start+int(maxEntries) < total {
+		end = start + int(maxEntries)
+		nextToken = strconv.Itoa(end)
+	}
+	return start, end, nextToken, nil
+}
+
 func sanitizeVolumeID(volumeID string) (string, error) {
 	var err error
 	volumeID = strings.ToLower(volumeID)
@@ -20,10 +20,12 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
 	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -39,11 +41,15 @@ var (
 	driverName    = "testDriver"
 	driverVersion = "testDriverVersion"
 
-	testVolumeID   = "testVolumeID"
-	testVolumeName = "test-volume-name"
-	testTargetPath = "test/path"
-	testNodeID     = "testNodeID"
-	bucketName     = "testBucket"
+	testVolumeID          = "testVolumeID"
+	testVolumeName        = "test-volume-name"
+	testTargetPath        = "test/path"
+	testPVName            = "pvc-5f2a"
+	testKubeletTargetPath = "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/" + testPVName + "/mount"
+	testNodeID            = "testNodeID"
+	bucketName            = "testBucket"
+	testSnapshotID        = "snapshot-test"
+	testClusterID         = "test-cluster-id"
 
 	testSecret = map[string]string{
 		"accessKey":          "testAccessKey",
@@ -53,16 +59,43 @@ var (
 		"bucketName":         bucketName,
 	}
 
+	quotaSecret = map[string]string{
+		"apiKey":             "testAPIKey",
+		"serviceId":          "testServiceID",
+		"locationConstraint": "test-region",
+		"cosEndpoint":        "test-endpoint",
+	}
+
+	// Volume IDs of the volumes created with testSecret and quotaSecret
+	testSharedVolumeID = utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: bucketName, Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS})
+	testOwnedVolumeID  = utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: testVolumeName, Owned: true, Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS})
+	testPrefixVolumeID = utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: "shared-bucket", Prefix: "ns/claim", Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS})
+
 	testEndpoint = flag.String("endpoint", "unix:/tmp/testcsi.sock", "Test CSI endpoint")
 )
 
 func TestCreateVolume(t *testing.T) {
+	cloneSource := &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Volume{
+			Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: testVolumeID},
+		},
+	}
+	encodedCloneSource := &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Volume{
+			Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: testPrefixVolumeID},
+		},
+	}
+
 	testCases := []struct {
-		testCaseName string
-		req          *csi.CreateVolumeRequest
-		cosSession   s3client.ObjectStorageSessionFactory
-		expectedResp *csi.CreateVolumeResponse
-		expectedErr  error
+		testCaseName      string
+		req               *csi.CreateVolumeRequest
+		driverStatsUtils  utils.StatsUtils
+		cosSession        s3client.ObjectStorageSessionFactory
+		expectedResp      *csi.CreateVolumeResponse
+		expectedErr       error
+		expectedLifecycle *s3client.BucketLifecycle
+		expectedTags      map[string]string
+		expectedDeleted   bool
 	}{
 		{
 			testCaseName: "Positive: Successfully created volume",
@@ -81,7 +114,7 @@ func TestCreateVolume(t *testing.T) {
 			cosSession: &s3client.FakeCOSSessionFactory{},
 			expectedResp: &csi.CreateVolumeResponse{
 				Volume: &csi.Volume{
-					VolumeId: testVolumeName,
+					VolumeId: testSharedVolumeID,
 					VolumeContext: map[string]string{
 						"bucketName":         bucketName,
 						"userProvidedBucket": "true",
@@ -113,7 +146,7 @@ func TestCreateVolume(t *testing.T) {
 			cosSession: &s3client.FakeCOSSessionFactory{},
 			expectedResp: &csi.CreateVolumeResponse{
 				Volume: &csi.Volume{
-					VolumeId: testVolumeName,
+					VolumeId: testOwnedVolumeID,
 					VolumeContext: map[string]string{
 						"userProvidedBucket": "false",
 					},
@@ -122,41 +155,91 @@ func TestCreateVolume(t *testing.T) {
 			expectedErr: nil,
 		},
 		{
-			testCaseName: "Negative: Volume Name is missing",
+			testCaseName: "Positive: Hard quota set on the created bucket",
 			req: &csi.CreateVolumeRequest{
-				Name: "",
+				Name: testVolumeName,
+				CapacityRange: &csi.CapacityRange{
+					RequiredBytes: 1024,
+				},
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
 			},
-			cosSession:   &s3client.FakeCOSSessionFactory{},
-			expectedResp: nil,
-			expectedErr:  errors.New("Volume name missing in request"),
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				SetBucketHardQuotaFn: func(apiKey, bucketName string, quotaBytes int64) error {
+					if apiKey != "testAPIKey" || quotaBytes != 1024 {
+						return errors.New("unexpected quota")
+					}
+					return nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId:      testOwnedVolumeID,
+					CapacityBytes: 1024,
+					VolumeContext: map[string]string{
+						"userProvidedBucket": "false",
+					},
+				},
+			},
+			expectedErr: nil,
 		},
 		{
-			testCaseName: "Negative: Volume Capabilities are missing",
+			testCaseName: "Negative: Failed to set hard quota on the created bucket",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
+				CapacityRange: &csi.CapacityRange{
+					RequiredBytes: 1024,
+				},
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
 			},
-			cosSession:   &s3client.FakeCOSSessionFactory{},
-			expectedResp: nil,
-			expectedErr:  errors.New("Volume Capabilities missing in request"),
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				SetBucketHardQuotaFn: func(apiKey, bucketName string, quotaBytes int64) error {
+					return errors.New("failed to set quota")
+				},
+			}),
+			cosSession:      &s3client.FakeCOSSessionFactory{},
+			expectedResp:    nil,
+			expectedErr:     status.Error(codes.Internal, "unable to set hard quota"),
+			expectedDeleted: true,
 		},
 		{
-			testCaseName: "Negative: Invalid Volume Capabilities",
+			testCaseName: "Negative: Failed to tag the created bucket",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
 				VolumeCapabilities: []*csi.VolumeCapability{
 					{
-						AccessType: &csi.VolumeCapability_Block{
-							Block: &csi.VolumeCapability_BlockVolume{},
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
 						},
 					},
 				},
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
 			},
-			cosSession:   &s3client.FakeCOSSessionFactory{},
-			expectedResp: nil,
-			expectedErr:  errors.New("Volume type block Volume not supported"),
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{FailSetBucketTags: true},
+			expectedResp:     nil,
+			expectedErr:      status.Error(codes.Internal, "unable to tag bucket"),
+			expectedDeleted:  true,
 		},
 		{
-			testCaseName: "Negative: Secret Key not provided",
+			testCaseName: "Positive: Volume created on a prefix of a shared bucket",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
 				VolumeCapabilities: []*csi.VolumeCapability{
@@ -166,16 +249,32 @@ func TestCreateVolume(t *testing.T) {
 						},
 					},
 				},
-				Secrets: map[string]string{
-					"accessKey": "testAccessKey",
+				Parameters: map[string]string{
+					"sharedBucket":            "shared-bucket",
+					constants.PVCNamespaceKey: "ns",
+					constants.PVCNameKey:      "claim",
 				},
+				Secrets: quotaSecret,
 			},
-			cosSession:   &s3client.FakeCOSSessionFactory{},
-			expectedResp: nil,
-			expectedErr:  errors.New("Error in getting credentials"),
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: "shared-bucket", Prefix: "ns/claim-0b478b41",
+						Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS}),
+					VolumeContext: map[string]string{
+						"sharedBucket":            "shared-bucket",
+						constants.PVCNamespaceKey: "ns",
+						constants.PVCNameKey:      "claim",
+						"bucketName":              "shared-bucket",
+						"objPath":                 "ns/claim-0b478b41",
+						"userProvidedBucket":      "true",
+					},
+				},
+			},
+			expectedErr: nil,
 		},
 		{
-			testCaseName: "Negative: API Key is present in secret but not service ID",
+			testCaseName: "Negative: Bucket settings on a shared bucket",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
 				VolumeCapabilities: []*csi.VolumeCapability{
@@ -185,17 +284,16 @@ func TestCreateVolume(t *testing.T) {
 						},
 					},
 				},
-				Secrets: map[string]string{
-					"iamEndpoint": "testIAMEndpoint",
-					"apiKey":      "testAPIKey",
-				},
+				Parameters:        map[string]string{"sharedBucket": "shared-bucket"},
+				MutableParameters: map[string]string{"versioning": "true"},
+				Secrets:           quotaSecret,
 			},
 			cosSession:   &s3client.FakeCOSSessionFactory{},
 			expectedResp: nil,
-			expectedErr:  errors.New("Error in getting credentials"),
+			expectedErr:  errors.New("bucket settings cannot be set on volumes sharing a bucket"),
 		},
 		{
-			testCaseName: "Negative: cosEndpoint is missing",
+			testCaseName: "Negative: Failed to create the prefix of a shared bucket",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
 				VolumeCapabilities: []*csi.VolumeCapability{
@@ -205,19 +303,22 @@ func TestCreateVolume(t *testing.T) {
 						},
 					},
 				},
-				Secrets: map[string]string{
-					"accessKey": "testAccessKey",
-					"secretKey": "testSecretKey",
-				},
+				Parameters: map[string]string{"sharedBucket": "shared-bucket"},
+				Secrets:    quotaSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailUploadObject: true,
 			},
-			cosSession:   &s3client.FakeCOSSessionFactory{},
 			expectedResp: nil,
-			expectedErr:  errors.New("cosEndpoint unknown"),
+			expectedErr:  errors.New("unable to create prefix"),
 		},
 		{
-			testCaseName: "Negative: locationConstraint is missing",
+			testCaseName: "Positive: Volume already created by an earlier request",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
+				CapacityRange: &csi.CapacityRange{
+					RequiredBytes: 1024,
+				},
 				VolumeCapabilities: []*csi.VolumeCapability{
 					{
 						AccessMode: &csi.VolumeCapability_AccessMode{
@@ -225,20 +326,36 @@ func TestCreateVolume(t *testing.T) {
 						},
 					},
 				},
-				Secrets: map[string]string{
-					"accessKey":   "testAccessKey",
-					"secretKey":   "testSecretKey",
-					"cosEndpoint": "test-endpoint",
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags: map[string]map[string]string{
+					testVolumeName: {
+						constants.VolumeIDTag:      testOwnedVolumeID,
+						constants.CapacityBytesTag: "2048",
+						constants.ParametersTag:    volumeFingerprint(&csi.CreateVolumeRequest{}),
+					},
 				},
 			},
-			cosSession:   &s3client.FakeCOSSessionFactory{},
-			expectedResp: nil,
-			expectedErr:  errors.New("locationConstraint unknown"),
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId:      testOwnedVolumeID,
+					CapacityBytes: 2048,
+					VolumeContext: map[string]string{
+						"userProvidedBucket": "false",
+					},
+				},
+			},
+			expectedErr: nil,
 		},
 		{
-			testCaseName: "Negative: Failed to check bucket access",
+			testCaseName: "Negative: Volume already created with an incompatible capacity",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
+				CapacityRange: &csi.CapacityRange{
+					RequiredBytes: 1024,
+				},
 				VolumeCapabilities: []*csi.VolumeCapability{
 					{
 						AccessMode: &csi.VolumeCapability_AccessMode{
@@ -247,18 +364,27 @@ func TestCreateVolume(t *testing.T) {
 					},
 				},
 				Parameters: map[string]string{},
-				Secrets:    testSecret,
+				Secrets:    quotaSecret,
 			},
 			cosSession: &s3client.FakeCOSSessionFactory{
-				FailCheckBucketAccess: true,
+				BucketTags: map[string]map[string]string{
+					testVolumeName: {
+						constants.VolumeIDTag:      testOwnedVolumeID,
+						constants.CapacityBytesTag: "512",
+						constants.ParametersTag:    volumeFingerprint(&csi.CreateVolumeRequest{}),
+					},
+				},
 			},
 			expectedResp: nil,
-			expectedErr:  errors.New("unable to access the bucket"),
+			expectedErr:  errors.New("already exists with an incompatible capacity of 512 bytes"),
 		},
 		{
-			testCaseName: "Negative: Failed to create the bucket",
+			testCaseName: "Negative: Volume already created with different parameters",
 			req: &csi.CreateVolumeRequest{
 				Name: testVolumeName,
+				CapacityRange: &csi.CapacityRange{
+					RequiredBytes: 1024,
+				},
 				VolumeCapabilities: []*csi.VolumeCapability{
 					{
 						AccessMode: &csi.VolumeCapability_AccessMode{
@@ -267,119 +393,953 @@ func TestCreateVolume(t *testing.T) {
 					},
 				},
 				Parameters: map[string]string{},
-				Secrets:    testSecret,
+				Secrets:    quotaSecret,
 			},
 			cosSession: &s3client.FakeCOSSessionFactory{
-				FailCheckBucketAccess: true,
-				FailCreateBucket:      true,
+				BucketTags: map[string]map[string]string{
+					testVolumeName: {
+						constants.VolumeIDTag:      testOwnedVolumeID,
+						constants.CapacityBytesTag: "1024",
+						constants.ParametersTag:    "other",
+					},
+				},
 			},
 			expectedResp: nil,
-			expectedErr:  errors.New("unable to create the bucket"),
+			expectedErr:  errors.New("already exists with different parameters"),
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
-
-		controllerServer := &controllerServer{
-			cosSession: tc.cosSession,
-		}
-		actualResp, actualErr := controllerServer.CreateVolume(ctx, tc.req)
-
-		if tc.expectedErr != nil {
-			assert.Error(t, actualErr)
-			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
-		} else {
-			assert.NoError(t, actualErr)
-		}
-
-		if len(tc.req.Name) > 63 {
-			tc.expectedResp.Volume.VolumeId = actualResp.Volume.VolumeId
-		}
-		if actualResp != nil && strings.Contains(actualResp.Volume.VolumeContext["bucketName"], actualResp.Volume.VolumeId) {
-			tc.expectedResp.Volume.VolumeContext["bucketName"] = actualResp.Volume.VolumeContext["bucketName"]
-		}
-
-		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
-			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
-		}
-	}
-}
-
-func TestDeleteVolume(t *testing.T) {
-	testCases := []struct {
-		testCaseName     string
-		req              *csi.DeleteVolumeRequest
-		driverStatsUtils utils.StatsUtils
-		cosSession       s3client.ObjectStorageSessionFactory
-		expectedResp     *csi.DeleteVolumeResponse
-		expectedErr      error
-	}{
 		{
-			testCaseName: "Positive: Successfully deleted volume",
-			req: &csi.DeleteVolumeRequest{
-				VolumeId: testVolumeID,
-				Secrets:  testSecret,
+			testCaseName: "Positive: Bucket name of another volume retried with a suffix",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
 			},
-			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
-				BucketToDeleteFn: func(volumeID string) (string, error) {
-					return bucketName, nil
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags: map[string]map[string]string{
+					testVolumeName: {constants.VolumeIDTag: "other-volume"},
 				},
-			}),
-			cosSession:   &s3client.FakeCOSSessionFactory{},
-			expectedResp: &csi.DeleteVolumeResponse{},
-			expectedErr:  nil,
-		},
-		{
-			testCaseName: "Negative: Volume ID is missing",
-			req: &csi.DeleteVolumeRequest{
-				VolumeId: "",
 			},
-			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
-			cosSession:       &s3client.FakeCOSSessionFactory{},
-			expectedResp:     nil,
-			expectedErr:      errors.New("Volume ID missing"),
-		},
-		{
-			testCaseName: "Negative: Access Key not provided",
-			req: &csi.DeleteVolumeRequest{
-				VolumeId: testVolumeID,
-				Secrets:  map[string]string{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: testVolumeName + "-1", Owned: true, Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS}),
+					VolumeContext: map[string]string{
+						"userProvidedBucket": "false",
+					},
+				},
 			},
-			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
-			cosSession:       &s3client.FakeCOSSessionFactory{},
-			expectedResp:     nil,
-			expectedErr:      errors.New("cannot get credentials"),
+			expectedErr: nil,
 		},
 		{
-			testCaseName: "Incomplete: Can't delete bucket",
-			req: &csi.DeleteVolumeRequest{
-				VolumeId: testVolumeID,
-				Secrets:  testSecret,
-			},
-			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
-				BucketToDeleteFn: func(volumeID string) (string, error) {
-					return bucketName, nil
+			testCaseName: "Positive: Bucket name of another account retried with a suffix",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
 				},
-			}),
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
+			},
 			cosSession: &s3client.FakeCOSSessionFactory{
-				FailDeleteBucket: true,
+				TakenBuckets: []string{testVolumeName, testVolumeName + "-1"},
 			},
-			expectedResp: &csi.DeleteVolumeResponse{},
-			expectedErr:  nil,
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: testVolumeName + "-2", Owned: true, Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS}),
+					VolumeContext: map[string]string{
+						"userProvidedBucket": "false",
+					},
+				},
+			},
+			expectedErr: nil,
 		},
 		{
-			testCaseName: "Negative: Failed to get bucket to delete",
-			req: &csi.DeleteVolumeRequest{
-				VolumeId: testVolumeID,
-				Secrets:  testSecret,
-			},
-			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
-				BucketToDeleteFn: func(volumeID string) (string, error) {
-					return "", errors.New("failed to get bucket to delete")
-				},
-			}),
-			cosSession:   &s3client.FakeCOSSessionFactory{},
+			testCaseName: "Negative: Every bucket name taken",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    quotaSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				TakenBuckets: bucketNameCandidates(testVolumeName),
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.AlreadyExists, "bucket name already taken"),
+		},
+		{
+			testCaseName: "Positive: Bucket named from the bucket name template",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{
+					"bucketNameTemplate":      "${pvc.namespace}-${pvc.name}-${rand}",
+					constants.PVCNamespaceKey: "ns",
+					constants.PVCNameKey:      "My_Claim",
+				},
+				Secrets: quotaSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: "ns-my-claim-0b478b41", Owned: true, Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS}),
+					VolumeContext: map[string]string{
+						"bucketNameTemplate":      "${pvc.namespace}-${pvc.name}-${rand}",
+						constants.PVCNamespaceKey: "ns",
+						constants.PVCNameKey:      "My_Claim",
+						"userProvidedBucket":      "false",
+					},
+				},
+			},
+			expectedErr: nil,
+			expectedTags: map[string]string{
+				constants.DriverNameTag:         driverName,
+				constants.ClusterIDTag:          testClusterID,
+				constants.VolumeIDTag:           utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: "ns-my-claim-0b478b41", Owned: true, Endpoint: "test-endpoint", Region: "test-region", Provider: constants.ProviderIBMCOS}),
+				constants.PVCNamespaceTag:       "ns",
+				constants.PVCNameTag:            "My_Claim",
+				constants.UserProvidedBucketTag: "false",
+			},
+		},
+		{
+			testCaseName: "Negative: Invalid bucket name template",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"bucketNameTemplate": "${pvc.uid}"},
+				Secrets:    quotaSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "unknown variable ${pvc.uid} in bucketNameTemplate"),
+		},
+		{
+			testCaseName: "Positive: Lifecycle rules installed on the created bucket",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{
+					"expirationDays":           "30",
+					"archiveDays":              "7",
+					"noncurrentExpirationDays": "14",
+					"abortMultipartDays":       "2",
+				},
+				Secrets: quotaSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: testOwnedVolumeID,
+					VolumeContext: map[string]string{
+						"expirationDays":           "30",
+						"archiveDays":              "7",
+						"noncurrentExpirationDays": "14",
+						"abortMultipartDays":       "2",
+						"userProvidedBucket":       "false",
+					},
+				},
+			},
+			expectedErr: nil,
+			expectedLifecycle: &s3client.BucketLifecycle{
+				ExpirationDays:           30,
+				ArchiveDays:              7,
+				ArchiveType:              "GLACIER",
+				NoncurrentExpirationDays: 14,
+				AbortMultipartDays:       2,
+			},
+		},
+		{
+			testCaseName: "Negative: Invalid lifecycle parameters",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"expirationDays": "5", "archiveDays": "7"},
+				Secrets:    quotaSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "expirationDays 5 must be greater than archiveDays 7"),
+		},
+		{
+			testCaseName: "Negative: Retention policy on a versioned bucket",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"versioning": "true", "retentionDefaultDays": "30"},
+				Secrets:    quotaSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "a retention policy cannot be set on a versioned bucket"),
+		},
+		{
+			testCaseName: "Negative: Lifecycle parameters on a volume sharing a bucket",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"sharedBucket": "shared-bucket", "abortMultipartDays": "2"},
+				Secrets:    quotaSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "bucket settings cannot be set on volumes sharing a bucket"),
+		},
+		{
+			testCaseName: "Positive: Mutable parameters applied on the created bucket",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters:        map[string]string{},
+				MutableParameters: map[string]string{"versioning": "true", "mountOptions": "parallel_count=8"},
+				Secrets:           testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: testSharedVolumeID,
+					VolumeContext: map[string]string{
+						"bucketName":         bucketName,
+						"userProvidedBucket": "true",
+						"mountOptions":       "parallel_count=8",
+					},
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Negative: Invalid mutable parameters",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters:        map[string]string{},
+				MutableParameters: map[string]string{"versioning": "sometimes"},
+				Secrets:           testSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "versioning must be true or false"),
+		},
+		{
+			testCaseName: "Positive: Successfully restored volume from snapshot",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{
+						Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: testSnapshotID},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags: map[string]map[string]string{
+					testSnapshotID: {constants.SnapshotIDTag: testSnapshotID},
+				},
+			},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: testSharedVolumeID,
+					VolumeContext: map[string]string{
+						"bucketName":         bucketName,
+						"userProvidedBucket": "true",
+					},
+					ContentSource: &csi.VolumeContentSource{
+						Type: &csi.VolumeContentSource_Snapshot{
+							Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: testSnapshotID},
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Negative: Source snapshot not found",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{
+						Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: testSnapshotID},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    testSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.NotFound, ""),
+		},
+		{
+			testCaseName: "Positive: Successfully cloned volume",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: cloneSource,
+				Parameters:          map[string]string{},
+				Secrets:             testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetPVAttributesFn: func(volumeID string) (map[string]string, error) {
+					return map[string]string{"bucketName": "sourceBucket"}, nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects: map[string][]s3client.ObjectInfo{"sourceBucket": {{Key: "object", Size: 1}}},
+			},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: testSharedVolumeID,
+					VolumeContext: map[string]string{
+						"bucketName":         bucketName,
+						"userProvidedBucket": "true",
+					},
+					ContentSource: cloneSource,
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Positive: Successfully cloned volume described by its volume ID",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: encodedCloneSource,
+				Parameters:          map[string]string{},
+				Secrets:             testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects: map[string][]s3client.ObjectInfo{"shared-bucket": {{Key: "ns/claim/object", Size: 1}}},
+			},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: testSharedVolumeID,
+					VolumeContext: map[string]string{
+						"bucketName":         bucketName,
+						"userProvidedBucket": "true",
+					},
+					ContentSource: encodedCloneSource,
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Positive: Successfully cloned volume from another endpoint",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: cloneSource,
+				Parameters:          map[string]string{},
+				Secrets:             testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetPVAttributesFn: func(volumeID string) (map[string]string, error) {
+					return map[string]string{"bucketName": "sourceBucket", "cosEndpoint": "other-endpoint"}, nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects:        map[string][]s3client.ObjectInfo{"sourceBucket": {{Key: "object", Size: 1}}},
+				FailCopyObject: true,
+			},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId: testSharedVolumeID,
+					VolumeContext: map[string]string{
+						"bucketName":         bucketName,
+						"userProvidedBucket": "true",
+					},
+					ContentSource: cloneSource,
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Negative: Source volume not found",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: cloneSource,
+				Parameters:          map[string]string{},
+				Secrets:             testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetPVAttributesFn: func(volumeID string) (map[string]string, error) {
+					return nil, errors.New("pv not found")
+				},
+			}),
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.NotFound, ""),
+		},
+		{
+			testCaseName: "Negative: Failed to copy the source volume",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				VolumeContentSource: cloneSource,
+				Parameters:          map[string]string{},
+				Secrets:             testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetPVAttributesFn: func(volumeID string) (map[string]string, error) {
+					return map[string]string{"bucketName": "sourceBucket"}, nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects:        map[string][]s3client.ObjectInfo{"sourceBucket": {{Key: "object", Size: 1}}},
+				FailCopyObject: true,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("unable to populate volume"),
+		},
+		{
+			testCaseName: "Positive: MinIO volume created in the default region without hard quota",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				CapacityRange: &csi.CapacityRange{
+					RequiredBytes: 1024,
+				},
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"provider": constants.ProviderMinIO},
+				Secrets: map[string]string{
+					"accessKey":   "testAccessKey",
+					"secretKey":   "testSecretKey",
+					"cosEndpoint": "test-endpoint",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				SetBucketHardQuotaFn: func(apiKey, bucketName string, quotaBytes int64) error {
+					return errors.New("unexpected quota")
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedResp: &csi.CreateVolumeResponse{
+				Volume: &csi.Volume{
+					VolumeId:      utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: testVolumeName, Owned: true, Endpoint: "test-endpoint", Region: "us-east-1", Provider: constants.ProviderMinIO}),
+					CapacityBytes: 1024,
+					VolumeContext: map[string]string{
+						"provider":           constants.ProviderMinIO,
+						"userProvidedBucket": "false",
+					},
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Negative: Unknown provider",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"provider": "unknown"},
+				Secrets:    testSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "unknown provider \"unknown\""),
+		},
+		{
+			testCaseName: "Negative: IAM authentication with a provider other than IBM COS",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{"provider": constants.ProviderCeph},
+				Secrets:    quotaSecret,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "provider ceph does not support IAM authentication"),
+		},
+		{
+			testCaseName: "Negative: kpRootKeyCRN with a provider other than IBM COS",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets: map[string]string{
+					"accessKey":          "testAccessKey",
+					"secretKey":          "testSecretKey",
+					"locationConstraint": "test-region",
+					"cosEndpoint":        "test-endpoint",
+					"kpRootKeyCRN":       "test-kpRootKeyCRN",
+					"provider":           constants.ProviderAWS,
+				},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.InvalidArgument, "provider aws does not support Key Protect encryption"),
+		},
+		{
+			testCaseName: "Negative: Volume Name is missing",
+			req: &csi.CreateVolumeRequest{
+				Name: "",
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Volume name missing in request"),
+		},
+		{
+			testCaseName: "Negative: Volume Capabilities are missing",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Volume Capabilities missing in request"),
+		},
+		{
+			testCaseName: "Negative: Invalid Volume Capabilities",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessType: &csi.VolumeCapability_Block{
+							Block: &csi.VolumeCapability_BlockVolume{},
+						},
+					},
+				},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Volume type block Volume not supported"),
+		},
+		{
+			testCaseName: "Negative: Secret Key not provided",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Secrets: map[string]string{
+					"accessKey": "testAccessKey",
+				},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Error in getting credentials"),
+		},
+		{
+			testCaseName: "Negative: API Key is present in secret but not service ID",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Secrets: map[string]string{
+					"iamEndpoint": "testIAMEndpoint",
+					"apiKey":      "testAPIKey",
+				},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Error in getting credentials"),
+		},
+		{
+			testCaseName: "Negative: cosEndpoint is missing",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Secrets: map[string]string{
+					"accessKey": "testAccessKey",
+					"secretKey": "testSecretKey",
+				},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("cosEndpoint unknown"),
+		},
+		{
+			testCaseName: "Negative: locationConstraint is missing",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Secrets: map[string]string{
+					"accessKey":   "testAccessKey",
+					"secretKey":   "testSecretKey",
+					"cosEndpoint": "test-endpoint",
+				},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("locationConstraint unknown"),
+		},
+		{
+			testCaseName: "Negative: Failed to check bucket access",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailCheckBucketAccess: true,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("unable to access the bucket"),
+		},
+		{
+			testCaseName: "Negative: Failed to create the bucket",
+			req: &csi.CreateVolumeRequest{
+				Name: testVolumeName,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+				Parameters: map[string]string{},
+				Secrets:    testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailCheckBucketAccess: true,
+				FailCreateBucket:      true,
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.Internal, "unable to create the bucket"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		controllerServer := &controllerServer{
+			S3Driver:   &S3Driver{name: driverName},
+			Stats:      tc.driverStatsUtils,
+			cosSession: tc.cosSession,
+			clusterID:  testClusterID,
+		}
+		actualResp, actualErr := controllerServer.CreateVolume(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+		} else {
+			assert.NoError(t, actualErr)
+		}
+
+		if len(tc.req.Name) > 63 {
+			tc.expectedResp.Volume.VolumeId = actualResp.Volume.VolumeId
+		}
+		if actualResp != nil && strings.Contains(actualResp.Volume.VolumeId, actualResp.Volume.VolumeContext["bucketName"]) {
+			tc.expectedResp.Volume.VolumeContext["bucketName"] = actualResp.Volume.VolumeContext["bucketName"]
+		}
+
+		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
+			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+		}
+		if tc.expectedLifecycle != nil {
+			assert.Equal(t, *tc.expectedLifecycle, tc.cosSession.(*s3client.FakeCOSSessionFactory).Lifecycle)
+		}
+		if tc.expectedTags != nil {
+			tags := tc.cosSession.(*s3client.FakeCOSSessionFactory).BucketTags[actualResp.GetVolume().GetVolumeContext()["bucketName"]]
+			for k, v := range tc.expectedTags {
+				assert.Equal(t, v, tags[k], k)
+			}
+		}
+		if tc.expectedDeleted {
+			assert.NotEmpty(t, tc.cosSession.(*s3client.FakeCOSSessionFactory).DeletedBuckets)
+		}
+	}
+}
+
+func TestDeleteVolume(t *testing.T) {
+	testCases := []struct {
+		testCaseName     string
+		req              *csi.DeleteVolumeRequest
+		driverStatsUtils utils.StatsUtils
+		cosSession       s3client.ObjectStorageSessionFactory
+		expectedResp     *csi.DeleteVolumeResponse
+		expectedErr      error
+		expectedDeleted  []string
+		expectedPrefixes []string
+	}{
+		{
+			testCaseName: "Positive: Successfully deleted volume",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				BucketToDeleteFn: func(volumeID string) (string, error) {
+					return bucketName, nil
+				},
+			}),
+			cosSession:      &s3client.FakeCOSSessionFactory{},
+			expectedResp:    &csi.DeleteVolumeResponse{},
+			expectedErr:     nil,
+			expectedDeleted: []string{bucketName},
+		},
+		{
+			testCaseName: "Positive: Bucket described by the volume ID deleted without the PV",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: "temp-bucket", Owned: true, Endpoint: "test-endpoint"}),
+				Secrets: map[string]string{
+					"accessKey": "testAccessKey",
+					"secretKey": "testSecretKey",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     &csi.DeleteVolumeResponse{},
+			expectedErr:      nil,
+			expectedDeleted:  []string{"temp-bucket"},
+		},
+		{
+			testCaseName: "Negative: Bucket holds objects under retention",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testOwnedVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				ProtectedBuckets: []string{testVolumeName},
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.FailedPrecondition, "bucket test-volume-name of volume "+testOwnedVolumeID+" holds objects under retention"),
+		},
+		{
+			testCaseName: "Positive: Only the prefix of a volume sharing a bucket deleted",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testPrefixVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     &csi.DeleteVolumeResponse{},
+			expectedErr:      nil,
+			expectedPrefixes: []string{"shared-bucket/ns/claim/"},
+		},
+		{
+			testCaseName: "Negative: Failed to delete the prefix of a volume sharing a bucket",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testPrefixVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailDeleteObjects: true,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("unable to delete the objects of volume"),
+		},
+		{
+			testCaseName: "Positive: Existing bucket described by the volume ID persisted",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testSharedVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     &csi.DeleteVolumeResponse{},
+			expectedErr:      nil,
+		},
+		{
+			testCaseName: "Negative: Volume ID is missing",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: "",
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     nil,
+			expectedErr:      errors.New("Volume ID missing"),
+		},
+		{
+			testCaseName: "Negative: Access Key not provided",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testVolumeID,
+				Secrets:  map[string]string{},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     nil,
+			expectedErr:      status.Error(codes.InvalidArgument, "cannot get credentials"),
+		},
+		{
+			testCaseName: "Negative: Can't delete bucket",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				BucketToDeleteFn: func(volumeID string) (string, error) {
+					return bucketName, nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailDeleteBucket: true,
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.Internal, "unable to delete bucket testBucket of volume testVolumeID"),
+		},
+		{
+			testCaseName: "Negative: Failed to get bucket to delete",
+			req: &csi.DeleteVolumeRequest{
+				VolumeId: testVolumeID,
+				Secrets:  testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				BucketToDeleteFn: func(volumeID string) (string, error) {
+					return "", errors.New("failed to get bucket to delete")
+				},
+			}),
+			cosSession:   &s3client.FakeCOSSessionFactory{},
 			expectedResp: &csi.DeleteVolumeResponse{},
 			expectedErr:  nil,
 		},
@@ -388,15 +1348,509 @@ func TestDeleteVolume(t *testing.T) {
 	for _, tc := range testCases {
 		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
 
-		lgr, teardown := GetTestLogger(t)
-		defer teardown()
-
+		lgr, teardown := GetTestLogger(t)
+		defer teardown()
+
+		controllerServer := &controllerServer{
+			S3Driver:   &S3Driver{name: driverName},
+			Stats:      tc.driverStatsUtils,
+			cosSession: tc.cosSession,
+			Logger:     lgr,
+		}
+		actualResp, actualErr := controllerServer.DeleteVolume(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+		} else {
+			assert.NoError(t, actualErr)
+		}
+
+		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
+			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+		}
+		assert.Equal(t, tc.expectedDeleted, tc.cosSession.(*s3client.FakeCOSSessionFactory).DeletedBuckets)
+		assert.Equal(t, tc.expectedPrefixes, tc.cosSession.(*s3client.FakeCOSSessionFactory).DeletedPrefixes)
+	}
+}
+
+func TestControllerPublishVolume(t *testing.T) {
+	t.Run("UnImplemented Method", func(t *testing.T) {
+		controllerServer := &controllerServer{}
+		actualResp, actualErr := controllerServer.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{})
+		assert.Nil(t, actualResp)
+		assert.Error(t, actualErr)
+		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
+	})
+}
+
+func TestControllerUnpublishVolume(t *testing.T) {
+	t.Run("UnImplemented Method", func(t *testing.T) {
+		controllerServer := &controllerServer{}
+		actualResp, actualErr := controllerServer.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{})
+		assert.Nil(t, actualResp)
+		assert.Error(t, actualErr)
+		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
+	})
+}
+
+func TestValidateVolumeCapabilities(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		req          *csi.ValidateVolumeCapabilitiesRequest
+		expectedResp *csi.ValidateVolumeCapabilitiesResponse
+		expectedErr  error
+	}{
+		{
+			testCaseName: "Positive: Successfully validated volume Capabilities",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId: testVolumeID,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: volumeCapabilities[0],
+						},
+					},
+				},
+			},
+			expectedResp: &csi.ValidateVolumeCapabilitiesResponse{
+				Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+					VolumeCapabilities: []*csi.VolumeCapability{
+						{
+
+							AccessMode: &csi.VolumeCapability_AccessMode{
+								Mode: volumeCapabilities[0],
+							},
+						},
+					},
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Negative: Volume ID is missing",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId: "",
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("Volume ID missing in request"),
+		},
+		{
+			testCaseName: "Negative: Volume capabilities are missing",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId: testVolumeID,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("Volume capabilities missing in request"),
+		},
+		{
+			testCaseName: "Negative: Invalid Volume Capabilities",
+			req: &csi.ValidateVolumeCapabilitiesRequest{
+				VolumeId: testVolumeID,
+				VolumeCapabilities: []*csi.VolumeCapability{
+					{
+						AccessMode: &csi.VolumeCapability_AccessMode{
+							Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+						},
+					},
+				},
+			},
+			expectedResp: &csi.ValidateVolumeCapabilitiesResponse{},
+			expectedErr:  nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		controllerServer := &controllerServer{}
+		actualResp, actualErr := controllerServer.ValidateVolumeCapabilities(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+		} else {
+			assert.NoError(t, actualErr)
+		}
+
+		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
+			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+		}
+	}
+}
+
+func TestListVolumes(t *testing.T) {
+	volumeTags := func(volumeID, clusterID string) map[string]string {
+		return map[string]string{constants.VolumeIDTag: volumeID, constants.DriverNameTag: driverName, constants.ClusterIDTag: clusterID}
+	}
+	bucketTags := map[string]map[string]string{
+		"bucket-1": {constants.VolumeIDTag: "vol-1", constants.DriverNameTag: driverName, constants.ClusterIDTag: testClusterID, constants.CapacityBytesTag: "1024"},
+		"bucket-2": volumeTags("vol-2", testClusterID),
+		"bucket-3": volumeTags("vol-3", testClusterID),
+		"bucket-4": volumeTags("vol-4", "other-cluster"),
+		"bucket-5": {constants.VolumeIDTag: "vol-5", constants.DriverNameTag: "other-driver", constants.ClusterIDTag: testClusterID},
+	}
+	buckets := []string{"bucket-3", bucketName, "bucket-1", "bucket-2", "bucket-4", "bucket-5"}
+	volume1 := utils.DriverVolume{
+		VolumeID:   "vol-1",
+		Attributes: map[string]string{"bucketName": "bucket-1", "userProvidedBucket": "false"},
+		Secrets:    testSecret,
+		NodeIDs:    []string{testNodeID},
+	}
+
+	testCases := []struct {
+		testCaseName      string
+		req               *csi.ListVolumesRequest
+		driverVolumes     []utils.DriverVolume
+		listVolumesErr    error
+		cosSession        s3client.ObjectStorageSessionFactory
+		expectedEntries   []*csi.ListVolumesResponse_Entry
+		expectedNextToken string
+		expectedTagsRead  []string
+		expectedErr       error
+	}{
+		{
+			testCaseName:  "Positive: List volumes of the buckets tagged by the driver of the cluster",
+			req:           &csi.ListVolumesRequest{},
+			driverVolumes: []utils.DriverVolume{volume1},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Buckets:    buckets,
+				BucketTags: bucketTags,
+			},
+			expectedEntries: []*csi.ListVolumesResponse_Entry{
+				newVolumeEntry("vol-2", 0, map[string]string{"bucketName": "bucket-2"}, []string{}, nil),
+				newVolumeEntry("vol-3", 0, map[string]string{"bucketName": "bucket-3"}, []string{}, nil),
+				newVolumeEntry("vol-1", 1024, volume1.Attributes, []string{testNodeID}, nil),
+			},
+		},
+		{
+			testCaseName:  "Positive: List volumes with pagination, reading the tags of the page only",
+			req:           &csi.ListVolumesRequest{StartingToken: "1", MaxEntries: 2},
+			driverVolumes: []utils.DriverVolume{volume1},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Buckets:    buckets,
+				BucketTags: bucketTags,
+			},
+			expectedEntries: []*csi.ListVolumesResponse_Entry{
+				newVolumeEntry("vol-3", 0, map[string]string{"bucketName": "bucket-3"}, []string{}, nil),
+			},
+			expectedNextToken: "3",
+			expectedTagsRead:  []string{"bucket-3", "bucket-4"},
+		},
+		{
+			testCaseName:  "Positive: Volume whose bucket disappeared is abnormal",
+			req:           &csi.ListVolumesRequest{},
+			driverVolumes: []utils.DriverVolume{volume1},
+			cosSession:    &s3client.FakeCOSSessionFactory{},
+			expectedEntries: []*csi.ListVolumesResponse_Entry{
+				newVolumeEntry("vol-1", 0, volume1.Attributes, []string{testNodeID}, &csi.VolumeCondition{
+					Abnormal: true,
+					Message:  "bucket bucket-1 not found",
+				}),
+			},
+		},
+		{
+			testCaseName: "Positive: Volume using an existing bucket is not listed",
+			req:          &csi.ListVolumesRequest{},
+			driverVolumes: []utils.DriverVolume{{
+				VolumeID:   testVolumeID,
+				Attributes: map[string]string{"bucketName": bucketName, "userProvidedBucket": "true"},
+				Secrets:    testSecret,
+			}},
+			cosSession:      &s3client.FakeCOSSessionFactory{Buckets: []string{bucketName}},
+			expectedEntries: []*csi.ListVolumesResponse_Entry{},
+		},
+		{
+			testCaseName:    "Positive: Buckets of accounts that cannot be listed are skipped",
+			req:             &csi.ListVolumesRequest{},
+			driverVolumes:   []utils.DriverVolume{volume1},
+			cosSession:      &s3client.FakeCOSSessionFactory{FailListBuckets: true},
+			expectedEntries: []*csi.ListVolumesResponse_Entry{},
+		},
+		{
+			testCaseName:   "Negative: Failed to list persistent volumes",
+			req:            &csi.ListVolumesRequest{},
+			listVolumesErr: errors.New("failed to list pvs"),
+			cosSession:     &s3client.FakeCOSSessionFactory{},
+			expectedErr:    errors.New("unable to list volumes"),
+		},
+		{
+			testCaseName:  "Negative: Invalid starting token",
+			req:           &csi.ListVolumesRequest{StartingToken: "invalid-token"},
+			driverVolumes: []utils.DriverVolume{volume1},
+			cosSession:    &s3client.FakeCOSSessionFactory{},
+			expectedErr:   status.Error(codes.Aborted, ""),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		controllerServer := &controllerServer{
+			S3Driver: &S3Driver{name: driverName},
+			Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				ListDriverVolumesFn: func(name string) ([]utils.DriverVolume, error) {
+					return tc.driverVolumes, tc.listVolumesErr
+				},
+			}),
+			cosSession: tc.cosSession,
+			clusterID:  testClusterID,
+		}
+		actualResp, actualErr := controllerServer.ListVolumes(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+			assert.Nil(t, actualResp)
+			continue
+		}
+
+		assert.NoError(t, actualErr)
+		if !reflect.DeepEqual(tc.expectedEntries, actualResp.GetEntries()) {
+			t.Errorf("Expected %v but got %v", tc.expectedEntries, actualResp.GetEntries())
+		}
+		assert.Equal(t, tc.expectedNextToken, actualResp.GetNextToken())
+		if tc.expectedTagsRead != nil {
+			assert.Equal(t, tc.expectedTagsRead, tc.cosSession.(*s3client.FakeCOSSessionFactory).TagsRead)
+		}
+	}
+}
+
+func TestGetCapacity(t *testing.T) {
+	t.Run("UnImplemented Method", func(t *testing.T) {
+		controllerServer := &controllerServer{}
+		actualResp, actualErr := controllerServer.GetCapacity(ctx, &csi.GetCapacityRequest{})
+		assert.Nil(t, actualResp)
+		assert.Error(t, actualErr)
+		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
+	})
+}
+
+func TestControllerGetCapabilities(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		req          *csi.ControllerGetCapabilitiesRequest
+		expectedResp *csi.ControllerGetCapabilitiesResponse
+		expectedErr  error
+	}{
+		{
+			testCaseName: "Positive: Successfully get controller capabilities",
+			req:          &csi.ControllerGetCapabilitiesRequest{},
+			expectedResp: &csi.ControllerGetCapabilitiesResponse{
+				Capabilities: func() []*csi.ControllerServiceCapability {
+					var caps []*csi.ControllerServiceCapability
+					for _, cap := range controllerCapabilities {
+						caps = append(caps, &csi.ControllerServiceCapability{
+							Type: &csi.ControllerServiceCapability_Rpc{
+								Rpc: &csi.ControllerServiceCapability_RPC{
+									Type: cap,
+								},
+							},
+						})
+					}
+					return caps
+				}(),
+			},
+			expectedErr: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		controllerServer := &controllerServer{}
+		actualResp, actualErr := controllerServer.ControllerGetCapabilities(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+		} else {
+			assert.NoError(t, actualErr)
+		}
+
+		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
+			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+		}
+	}
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	snapshotTags := map[string]string{
+		constants.SnapshotIDTag:     testSnapshotID,
+		constants.SourceVolumeIDTag: testVolumeID,
+		constants.CreationTimeTag:   "2024-01-02T03:04:05Z",
+		constants.SizeBytesTag:      "1024",
+	}
+
+	testCases := []struct {
+		testCaseName     string
+		req              *csi.CreateSnapshotRequest
+		driverStatsUtils utils.StatsUtils
+		cosSession       s3client.ObjectStorageSessionFactory
+		expectedResp     *csi.CreateSnapshotResponse
+		expectedErr      error
+		expectedDeleted  []string
+	}{
+		{
+			testCaseName: "Positive: Successfully created snapshot",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: testVolumeID,
+				Secrets:        testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects: map[string][]s3client.ObjectInfo{bucketName: {{Key: "a", Size: 1}, {Key: "b", Size: 2}}},
+			},
+			expectedResp: &csi.CreateSnapshotResponse{
+				Snapshot: &csi.Snapshot{
+					SnapshotId:     testSnapshotID,
+					SourceVolumeId: testVolumeID,
+					SizeBytes:      3,
+					ReadyToUse:     true,
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Positive: Snapshot already exists for the same source volume",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: testVolumeID,
+				Secrets:        testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags: map[string]map[string]string{testSnapshotID: snapshotTags},
+			},
+			expectedResp: &csi.CreateSnapshotResponse{
+				Snapshot: snapshotFromTags(constants.ProviderIBMCOS, snapshotTags),
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Positive: Copy of a snapshot not ready resumed",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: testVolumeID,
+				Secrets:        testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects: map[string][]s3client.ObjectInfo{bucketName: {{Key: "a", Size: 1}}},
+				BucketTags: map[string]map[string]string{testSnapshotID: {
+					constants.SnapshotIDTag:     testSnapshotID,
+					constants.SourceVolumeIDTag: testVolumeID,
+					constants.ReadyToUseTag:     "false",
+				}},
+			},
+			expectedResp: &csi.CreateSnapshotResponse{
+				Snapshot: &csi.Snapshot{
+					SnapshotId:     testSnapshotID,
+					SourceVolumeId: testVolumeID,
+					SizeBytes:      1,
+					ReadyToUse:     true,
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Negative: Snapshot already exists for another source volume",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: "otherVolumeID",
+				Secrets:        testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags: map[string]map[string]string{testSnapshotID: snapshotTags},
+			},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.AlreadyExists, ""),
+		},
+		{
+			testCaseName: "Negative: Snapshot name is missing",
+			req: &csi.CreateSnapshotRequest{
+				SourceVolumeId: testVolumeID,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     nil,
+			expectedErr:      errors.New("Snapshot name missing in request"),
+		},
+		{
+			testCaseName: "Negative: Source volume ID is missing",
+			req: &csi.CreateSnapshotRequest{
+				Name: testSnapshotID,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession:       &s3client.FakeCOSSessionFactory{},
+			expectedResp:     nil,
+			expectedErr:      errors.New("Source volume ID missing in request"),
+		},
+		{
+			testCaseName: "Negative: Source volume not found",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: testVolumeID,
+				Secrets: map[string]string{
+					"accessKey":   "testAccessKey",
+					"secretKey":   "testSecretKey",
+					"cosEndpoint": "test-endpoint",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetBucketNameFromPVFn: func(volumeID string) (string, error) {
+					return "", errors.New("pv not found")
+				},
+			}),
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  status.Error(codes.NotFound, ""),
+		},
+		{
+			testCaseName: "Negative: Failed to copy objects",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: testVolumeID,
+				Secrets:        testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects:        map[string][]s3client.ObjectInfo{bucketName: {{Key: "a", Size: 1}}},
+				FailCopyObject: true,
+			},
+			expectedResp:    nil,
+			expectedErr:     errors.New("failed to copy object"),
+			expectedDeleted: []string{testSnapshotID},
+		},
+		{
+			testCaseName: "Negative: Failed to tag snapshot",
+			req: &csi.CreateSnapshotRequest{
+				Name:           testSnapshotID,
+				SourceVolumeId: testVolumeID,
+				Secrets:        testSecret,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailSetBucketTags: true,
+			},
+			expectedResp:    nil,
+			expectedErr:     errors.New("failed to set bucket tags"),
+			expectedDeleted: []string{testSnapshotID},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
 		controllerServer := &controllerServer{
+			S3Driver:   &S3Driver{name: driverName},
 			Stats:      tc.driverStatsUtils,
 			cosSession: tc.cosSession,
-			Logger:     lgr,
+			clusterID:  testClusterID,
 		}
-		actualResp, actualErr := controllerServer.DeleteVolume(ctx, tc.req)
+		actualResp, actualErr := controllerServer.CreateSnapshot(ctx, tc.req)
 
 		if tc.expectedErr != nil {
 			assert.Error(t, actualErr)
@@ -405,237 +1859,921 @@ func TestDeleteVolume(t *testing.T) {
 			assert.NoError(t, actualErr)
 		}
 
+		if actualResp != nil && tc.expectedResp.Snapshot.CreationTime == nil {
+			assert.NotNil(t, actualResp.Snapshot.CreationTime)
+			tc.expectedResp.Snapshot.CreationTime = actualResp.Snapshot.CreationTime
+		}
+
 		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
 			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
 		}
+		assert.Equal(t, tc.expectedDeleted, tc.cosSession.(*s3client.FakeCOSSessionFactory).DeletedBuckets)
 	}
 }
 
-func TestControllerPublishVolume(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
+func TestDeleteSnapshot(t *testing.T) {
+	snapshotTags := map[string]string{
+		constants.SnapshotIDTag:     testSnapshotID,
+		constants.SourceVolumeIDTag: testVolumeID,
+	}
+
+	testCases := []struct {
+		testCaseName string
+		req          *csi.DeleteSnapshotRequest
+		cosSession   s3client.ObjectStorageSessionFactory
+		expectedResp *csi.DeleteSnapshotResponse
+		expectedErr  error
+	}{
+		{
+			testCaseName: "Positive: Successfully deleted snapshot",
+			req: &csi.DeleteSnapshotRequest{
+				SnapshotId: testSnapshotID,
+				Secrets:    testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags: map[string]map[string]string{testSnapshotID: snapshotTags},
+			},
+			expectedResp: &csi.DeleteSnapshotResponse{},
+			expectedErr:  nil,
+		},
+		{
+			testCaseName: "Positive: Bucket is not a snapshot",
+			req: &csi.DeleteSnapshotRequest{
+				SnapshotId: bucketName,
+				Secrets:    testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				FailDeleteBucket: true,
+			},
+			expectedResp: &csi.DeleteSnapshotResponse{},
+			expectedErr:  nil,
+		},
+		{
+			testCaseName: "Negative: Snapshot ID is missing",
+			req:          &csi.DeleteSnapshotRequest{},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Snapshot ID missing in request"),
+		},
+		{
+			testCaseName: "Negative: Credentials not provided",
+			req: &csi.DeleteSnapshotRequest{
+				SnapshotId: testSnapshotID,
+				Secrets:    map[string]string{},
+			},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Error in getting credentials"),
+		},
+		{
+			testCaseName: "Negative: Failed to delete snapshot bucket",
+			req: &csi.DeleteSnapshotRequest{
+				SnapshotId: testSnapshotID,
+				Secrets:    testSecret,
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{
+				BucketTags:       map[string]map[string]string{testSnapshotID: snapshotTags},
+				FailDeleteBucket: true,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("failed to delete bucket"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		controllerServer := &controllerServer{
+			S3Driver:   &S3Driver{name: driverName},
+			cosSession: tc.cosSession,
+		}
+		actualResp, actualErr := controllerServer.DeleteSnapshot(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+		} else {
+			assert.NoError(t, actualErr)
+		}
+
+		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
+			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+		}
+	}
 }
 
-func TestControllerUnpublishVolume(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
+func TestListSnapshots(t *testing.T) {
+	bucketTags := map[string]map[string]string{
+		"snap-1": {constants.SnapshotIDTag: "snap-1", constants.SourceVolumeIDTag: "vol-1"},
+		"snap-2": {constants.SnapshotIDTag: "snap-2", constants.SourceVolumeIDTag: "vol-2"},
+		"snap-3": {constants.SnapshotIDTag: "snap-3", constants.SourceVolumeIDTag: "vol-1"},
+	}
+	buckets := []string{"snap-3", bucketName, "snap-1", "snap-2"}
+
+	testCases := []struct {
+		testCaseName      string
+		req               *csi.ListSnapshotsRequest
+		cosSession        s3client.ObjectStorageSessionFactory
+		expectedSnapshots []string
+		expectedNextToken string
+		expectedErr       error
+	}{
+		{
+			testCaseName: "Positive: List all snapshots",
+			req: &csi.ListSnapshotsRequest{
+				Secrets: testSecret,
+			},
+			cosSession:        &s3client.FakeCOSSessionFactory{Buckets: buckets, BucketTags: bucketTags},
+			expectedSnapshots: []string{"snap-1", "snap-2", "snap-3"},
+		},
+		{
+			testCaseName: "Positive: List snapshots with pagination",
+			req: &csi.ListSnapshotsRequest{
+				MaxEntries: 2,
+				Secrets:    testSecret,
+			},
+			cosSession:        &s3client.FakeCOSSessionFactory{Buckets: buckets, BucketTags: bucketTags},
+			expectedSnapshots: []string{"snap-1", "snap-2"},
+			expectedNextToken: "2",
+		},
+		{
+			testCaseName: "Positive: List snapshots from starting token",
+			req: &csi.ListSnapshotsRequest{
+				StartingToken: "2",
+				Secrets:       testSecret,
+			},
+			cosSession:        &s3client.FakeCOSSessionFactory{Buckets: buckets, BucketTags: bucketTags},
+			expectedSnapshots: []string{"snap-3"},
+		},
+		{
+			testCaseName: "Positive: List snapshots of a source volume",
+			req: &csi.ListSnapshotsRequest{
+				SourceVolumeId: "vol-1",
+				Secrets:        testSecret,
+			},
+			cosSession:        &s3client.FakeCOSSessionFactory{Buckets: buckets, BucketTags: bucketTags},
+			expectedSnapshots: []string{"snap-1", "snap-3"},
+		},
+		{
+			testCaseName: "Positive: List snapshot by ID",
+			req: &csi.ListSnapshotsRequest{
+				SnapshotId: "snap-2",
+				Secrets:    testSecret,
+			},
+			cosSession:        &s3client.FakeCOSSessionFactory{FailListBuckets: true, BucketTags: bucketTags},
+			expectedSnapshots: []string{"snap-2"},
+		},
+		{
+			testCaseName: "Positive: Snapshot ID does not exist",
+			req: &csi.ListSnapshotsRequest{
+				SnapshotId: "none",
+				Secrets:    testSecret,
+			},
+			cosSession:        &s3client.FakeCOSSessionFactory{BucketTags: bucketTags},
+			expectedSnapshots: []string{},
+		},
+		{
+			testCaseName: "Negative: Invalid starting token",
+			req: &csi.ListSnapshotsRequest{
+				StartingToken: "invalid",
+				Secrets:       testSecret,
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{Buckets: buckets, BucketTags: bucketTags},
+			expectedErr: status.Error(codes.Aborted, ""),
+		},
+		{
+			testCaseName: "Negative: Failed to list buckets",
+			req: &csi.ListSnapshotsRequest{
+				Secrets: testSecret,
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{FailListBuckets: true},
+			expectedErr: errors.New("failed to list buckets"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		controllerServer := &controllerServer{
+			cosSession: tc.cosSession,
+		}
+		actualResp, actualErr := controllerServer.ListSnapshots(ctx, tc.req)
+
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+			assert.Nil(t, actualResp)
+			continue
+		}
+
+		assert.NoError(t, actualErr)
+		actualSnapshots := []string{}
+		for _, entry := range actualResp.GetEntries() {
+			actualSnapshots = append(actualSnapshots, entry.GetSnapshot().GetSnapshotId())
+		}
+		assert.Equal(t, tc.expectedSnapshots, actualSnapshots)
+		assert.Equal(t, tc.expectedNextToken, actualResp.GetNextToken())
+	}
 }
 
-func TestValidateVolumeCapabilities(t *testing.T) {
+func TestProviderFromIDs(t *testing.T) {
+	minioVolumeID := utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: testVolumeName, Owned: true, Endpoint: "test-endpoint", Provider: constants.ProviderMinIO})
+	minioSnapshotID := utils.EncodeSnapshotID(constants.ProviderMinIO, testSnapshotID)
+	snapshotTags := map[string]string{
+		constants.SnapshotIDTag:     testSnapshotID,
+		constants.SourceVolumeIDTag: minioVolumeID,
+	}
+	cosSession := &s3client.FakeCOSSessionFactory{
+		Buckets:    []string{testSnapshotID},
+		BucketTags: map[string]map[string]string{testSnapshotID: snapshotTags},
+	}
+	cs := &controllerServer{
+		S3Driver:   &S3Driver{name: driverName},
+		Stats:      utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+		cosSession: cosSession,
+	}
+
+	// The provider is not in the secret, it is read from the IDs
+	listResp, err := cs.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SnapshotId: minioSnapshotID, Secrets: testSecret})
+	assert.NoError(t, err)
+	assert.Len(t, listResp.GetEntries(), 1)
+	assert.Equal(t, minioSnapshotID, listResp.GetEntries()[0].GetSnapshot().GetSnapshotId())
+
+	listResp, err = cs.ListSnapshots(ctx, &csi.ListSnapshotsRequest{SourceVolumeId: minioVolumeID, Secrets: testSecret})
+	assert.NoError(t, err)
+	assert.Len(t, listResp.GetEntries(), 1)
+
+	_, err = cs.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: minioSnapshotID, Secrets: testSecret})
+	assert.NoError(t, err)
+	_, err = cs.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: minioVolumeID, Secrets: testSecret})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{testSnapshotID, testVolumeName}, cosSession.DeletedBuckets)
+	assert.NotEmpty(t, cosSession.Providers)
+	for _, provider := range cosSession.Providers {
+		assert.Equal(t, constants.ProviderMinIO, provider)
+	}
+}
+
+func TestGetVolumePrefix(t *testing.T) {
+	params := map[string]string{constants.PVCNamespaceKey: "ns", constants.PVCNameKey: "claim"}
+	assert.Equal(t, "ns/claim-0b478b41", getVolumePrefix(params, testVolumeName, "shared-bucket", constants.ProviderIBMCOS))
+	assert.Equal(t, "test-volume-name-0b478b41", getVolumePrefix(map[string]string{}, testVolumeName, "shared-bucket", constants.ProviderIBMCOS))
+
+	// A prefix too long for the volume ID is replaced by a digest
+	params[constants.PVCNameKey] = strings.Repeat("c", 100)
+	prefix := getVolumePrefix(params, testVolumeName, strings.Repeat("b", 63), constants.ProviderIBMCOS)
+	assert.Len(t, prefix, 49)
+	assert.True(t, strings.HasPrefix(prefix, "0b478b41"))
+	assert.LessOrEqual(t, len(utils.EncodeVolumeID(utils.VolumeIDInfo{BucketName: strings.Repeat("b", 63), Prefix: prefix, Provider: constants.ProviderIBMCOS})), 128)
+}
+
+func TestGetSnapshotBucketName(t *testing.T) {
+	assert.Equal(t, "snapshot-1234", getSnapshotBucketName("snapshot-1234"))
+	assert.Equal(t, "my-snapshot-1", getSnapshotBucketName("My_Snapshot-1"))
+
+	long := getSnapshotBucketName(strings.Repeat("a", 128))
+	assert.Len(t, long, 63)
+	assert.True(t, strings.HasPrefix(long, "snapshot-"))
+}
+
+func TestControllerExpandVolume(t *testing.T) {
+	volume := &utils.DriverVolume{
+		VolumeID:      testVolumeID,
+		CapacityBytes: 1024,
+		Attributes:    map[string]string{"bucketName": bucketName, "userProvidedBucket": "false"},
+		Secrets:       quotaSecret,
+	}
+
 	testCases := []struct {
-		testCaseName string
-		req          *csi.ValidateVolumeCapabilitiesRequest
-		expectedResp *csi.ValidateVolumeCapabilitiesResponse
-		expectedErr  error
+		testCaseName     string
+		req              *csi.ControllerExpandVolumeRequest
+		driverVolume     *utils.DriverVolume
+		driverVolumeErr  error
+		quotaErr         error
+		expectedQuota    int64
+		expectedCapacity int64
+		expectedErr      error
 	}{
 		{
-			testCaseName: "Positive: Successfully validated volume Capabilities",
-			req: &csi.ValidateVolumeCapabilitiesRequest{
+			testCaseName: "Positive: Raised the hard quota of the bucket",
+			req: &csi.ControllerExpandVolumeRequest{
+				VolumeId:      testVolumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2048},
+			},
+			driverVolume:     volume,
+			expectedQuota:    2048,
+			expectedCapacity: 2048,
+		},
+		{
+			testCaseName: "Positive: Smaller capacity leaves the quota unchanged",
+			req: &csi.ControllerExpandVolumeRequest{
+				VolumeId:      testVolumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 512},
+			},
+			driverVolume:     volume,
+			expectedCapacity: 1024,
+		},
+		{
+			testCaseName: "Positive: Bucket provided by the user has no quota",
+			req: &csi.ControllerExpandVolumeRequest{
+				VolumeId:      testVolumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2048},
+			},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:      testVolumeID,
+				CapacityBytes: 1024,
+				Attributes:    map[string]string{"bucketName": bucketName, "userProvidedBucket": "true"},
+				Secrets:       testSecret,
+			},
+			expectedCapacity: 2048,
+		},
+		{
+			testCaseName: "Negative: Volume ID is missing",
+			req: &csi.ControllerExpandVolumeRequest{
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2048},
+			},
+			expectedErr: errors.New("Volume ID missing in request"),
+		},
+		{
+			testCaseName: "Negative: Capacity range is missing",
+			req: &csi.ControllerExpandVolumeRequest{
 				VolumeId: testVolumeID,
-				VolumeCapabilities: []*csi.VolumeCapability{
-					{
-						AccessMode: &csi.VolumeCapability_AccessMode{
-							Mode: volumeCapabilities[0],
-						},
-					},
-				},
 			},
-			expectedResp: &csi.ValidateVolumeCapabilitiesResponse{
-				Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-					VolumeCapabilities: []*csi.VolumeCapability{
-						{
+			expectedErr: errors.New("Capacity range missing in request"),
+		},
+		{
+			testCaseName: "Negative: Required bytes exceed limit bytes",
+			req: &csi.ControllerExpandVolumeRequest{
+				VolumeId:      testVolumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2048, LimitBytes: 1024},
+			},
+			expectedErr: status.Error(codes.OutOfRange, ""),
+		},
+		{
+			testCaseName: "Negative: Volume not found",
+			req: &csi.ControllerExpandVolumeRequest{
+				VolumeId:      testVolumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2048},
+			},
+			driverVolumeErr: utils.ErrVolumeNotFound,
+			expectedErr:     status.Error(codes.NotFound, ""),
+		},
+		{
+			testCaseName: "Negative: Failed to set hard quota",
+			req: &csi.ControllerExpandVolumeRequest{
+				VolumeId:      testVolumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2048},
+			},
+			driverVolume:  volume,
+			quotaErr:      errors.New("failed to set quota"),
+			expectedQuota: 2048,
+			expectedErr:   status.Error(codes.Internal, "unable to set hard quota"),
+		},
+	}
 
-							AccessMode: &csi.VolumeCapability_AccessMode{
-								Mode: volumeCapabilities[0],
-							},
-						},
-					},
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		var quota int64
+		controllerServer := &controllerServer{
+			S3Driver: &S3Driver{name: driverName},
+			Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetDriverVolumeFn: func(volumeID string) (*utils.DriverVolume, error) {
+					return tc.driverVolume, tc.driverVolumeErr
+				},
+				SetBucketHardQuotaFn: func(apiKey, bucketName string, quotaBytes int64) error {
+					quota = quotaBytes
+					return tc.quotaErr
 				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{},
+		}
+		actualResp, actualErr := controllerServer.ControllerExpandVolume(ctx, tc.req)
+
+		assert.Equal(t, tc.expectedQuota, quota)
+		if tc.expectedErr != nil {
+			assert.Error(t, actualErr)
+			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
+			assert.Nil(t, actualResp)
+			continue
+		}
+
+		assert.NoError(t, actualErr)
+		assert.Equal(t, tc.expectedCapacity, actualResp.GetCapacityBytes())
+		assert.False(t, actualResp.GetNodeExpansionRequired())
+	}
+}
+
+func TestControllerGetVolume(t *testing.T) {
+	volume := &utils.DriverVolume{
+		VolumeID:      testVolumeID,
+		CapacityBytes: 1024,
+		Attributes:    map[string]string{"bucketName": bucketName},
+		Secrets:       testSecret,
+		NodeIDs:       []string{testNodeID},
+	}
+
+	testCases := []struct {
+		testCaseName      string
+		req               *csi.ControllerGetVolumeRequest
+		driverVolume      *utils.DriverVolume
+		driverVolumeErr   error
+		cosSession        s3client.ObjectStorageSessionFactory
+		expectedCondition *csi.VolumeCondition
+		expectedErr       error
+	}{
+		{
+			testCaseName:      "Positive: Volume is healthy",
+			req:               &csi.ControllerGetVolumeRequest{VolumeId: testVolumeID},
+			driverVolume:      volume,
+			cosSession:        &s3client.FakeCOSSessionFactory{},
+			expectedCondition: &csi.VolumeCondition{Message: "volume is healthy"},
+		},
+		{
+			testCaseName: "Positive: Volume with an object path is healthy",
+			req:          &csi.ControllerGetVolumeRequest{VolumeId: testVolumeID},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:      testVolumeID,
+				CapacityBytes: 1024,
+				Attributes:    map[string]string{"bucketName": bucketName, "objPath": "data"},
+				Secrets:       testSecret,
+				NodeIDs:       []string{testNodeID},
 			},
-			expectedErr: nil,
+			cosSession:        &s3client.FakeCOSSessionFactory{},
+			expectedCondition: &csi.VolumeCondition{Message: "volume is healthy"},
 		},
 		{
-			testCaseName: "Negative: Volume ID is missing",
-			req: &csi.ValidateVolumeCapabilitiesRequest{
-				VolumeId: "",
+			testCaseName: "Positive: Bucket cannot be accessed",
+			req:          &csi.ControllerGetVolumeRequest{VolumeId: testVolumeID},
+			driverVolume: volume,
+			cosSession:   &s3client.FakeCOSSessionFactory{FailCheckBucketAccess: true},
+			expectedCondition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "unable to access bucket testBucket: failed to check bucket access",
 			},
-			expectedResp: nil,
+		},
+		{
+			testCaseName: "Positive: Credentials of the volume are unavailable",
+			req:          &csi.ControllerGetVolumeRequest{VolumeId: testVolumeID},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:      testVolumeID,
+				CapacityBytes: 1024,
+				Attributes:    map[string]string{"bucketName": bucketName},
+				NodeIDs:       []string{testNodeID},
+			},
+			cosSession: &s3client.FakeCOSSessionFactory{},
+			expectedCondition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  "credentials of the volume unavailable: Error in getting credentials rpc error: code = Unauthenticated desc = Valid access credentials are not provided in the secret| serviceId/accessKey/secretKey unknown",
+			},
+		},
+		{
+			testCaseName: "Negative: Volume ID is missing",
+			req:          &csi.ControllerGetVolumeRequest{},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
 			expectedErr:  errors.New("Volume ID missing in request"),
 		},
 		{
-			testCaseName: "Negative: Volume capabilities are missing",
-			req: &csi.ValidateVolumeCapabilitiesRequest{
-				VolumeId: testVolumeID,
-			},
-			expectedResp: nil,
-			expectedErr:  errors.New("Volume capabilities missing in request"),
+			testCaseName:    "Negative: Volume not found",
+			req:             &csi.ControllerGetVolumeRequest{VolumeId: testVolumeID},
+			driverVolumeErr: utils.ErrVolumeNotFound,
+			cosSession:      &s3client.FakeCOSSessionFactory{},
+			expectedErr:     status.Error(codes.NotFound, ""),
 		},
 		{
-			testCaseName: "Negative: Invalid Volume Capabilities",
-			req: &csi.ValidateVolumeCapabilitiesRequest{
-				VolumeId: testVolumeID,
-				VolumeCapabilities: []*csi.VolumeCapability{
-					{
-						AccessMode: &csi.VolumeCapability_AccessMode{
-							Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
-						},
-					},
-				},
-			},
-			expectedResp: &csi.ValidateVolumeCapabilitiesResponse{},
-			expectedErr:  nil,
+			testCaseName:    "Negative: Failed to fetch the volume",
+			req:             &csi.ControllerGetVolumeRequest{VolumeId: testVolumeID},
+			driverVolumeErr: errors.New("failed to get pv"),
+			cosSession:      &s3client.FakeCOSSessionFactory{},
+			expectedErr:     status.Error(codes.Internal, ""),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
 
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ValidateVolumeCapabilities(ctx, tc.req)
+		controllerServer := &controllerServer{
+			Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetDriverVolumeFn: func(volumeID string) (*utils.DriverVolume, error) {
+					return tc.driverVolume, tc.driverVolumeErr
+				},
+			}),
+			cosSession: tc.cosSession,
+		}
+		actualResp, actualErr := controllerServer.ControllerGetVolume(ctx, tc.req)
 
 		if tc.expectedErr != nil {
 			assert.Error(t, actualErr)
 			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
-		} else {
-			assert.NoError(t, actualErr)
+			assert.Nil(t, actualResp)
+			continue
 		}
 
-		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
-			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+		assert.NoError(t, actualErr)
+		assert.Equal(t, tc.driverVolume.VolumeID, actualResp.GetVolume().GetVolumeId())
+		assert.Equal(t, tc.driverVolume.CapacityBytes, actualResp.GetVolume().GetCapacityBytes())
+		assert.Equal(t, tc.driverVolume.NodeIDs, actualResp.GetStatus().GetPublishedNodeIds())
+		if !reflect.DeepEqual(tc.expectedCondition, actualResp.GetStatus().GetVolumeCondition()) {
+			t.Errorf("Expected %v but got %v", tc.expectedCondition, actualResp.GetStatus().GetVolumeCondition())
 		}
 	}
 }
 
-func TestListVolumes(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ListVolumes(ctx, &csi.ListVolumesRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
+func TestDescribeBucketError(t *testing.T) {
+	testCases := []struct {
+		testCaseName    string
+		err             error
+		expectedMessage string
+	}{
+		{
+			testCaseName:    "Bucket not found",
+			err:             s3client.ErrBucketNotFound,
+			expectedMessage: "bucket testBucket not found",
+		},
+		{
+			testCaseName:    "Access denied",
+			err:             s3client.ErrAccessDenied,
+			expectedMessage: "access denied to bucket testBucket",
+		},
+		{
+			testCaseName:    "Expired credentials",
+			err:             fmt.Errorf("%w: token expired", s3client.ErrInvalidCredentials),
+			expectedMessage: "credentials expired or invalid for bucket testBucket: credentials expired or invalid: token expired",
+		},
+		{
+			testCaseName:    "Unreachable endpoint",
+			err:             fmt.Errorf("%w: send request failed", s3client.ErrEndpointUnreachable),
+			expectedMessage: "endpoint unreachable for bucket testBucket: endpoint unreachable: send request failed",
+		},
+		{
+			testCaseName:    "Wrapped error",
+			err:             fmt.Errorf("cannot list bucket: %w", s3client.ErrBucketNotFound),
+			expectedMessage: "bucket testBucket not found",
+		},
+		{
+			testCaseName:    "Unknown error",
+			err:             errors.New("failed"),
+			expectedMessage: "unable to access bucket testBucket: failed",
+		},
+	}
 
-func TestGetCapacity(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.GetCapacity(ctx, &csi.GetCapacityRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+		assert.Equal(t, tc.expectedMessage, describeBucketError(bucketName, tc.err))
+	}
 }
 
-func TestControllerGetCapabilities(t *testing.T) {
+func TestCosErrorCode(t *testing.T) {
 	testCases := []struct {
 		testCaseName string
-		req          *csi.ControllerGetCapabilitiesRequest
-		expectedResp *csi.ControllerGetCapabilitiesResponse
-		expectedErr  error
+		err          error
+		expectedCode codes.Code
 	}{
 		{
-			testCaseName: "Positive: Successfully get controller capabilities",
-			req:          &csi.ControllerGetCapabilitiesRequest{},
-			expectedResp: &csi.ControllerGetCapabilitiesResponse{
-				Capabilities: []*csi.ControllerServiceCapability{
-					{
-						Type: &csi.ControllerServiceCapability_Rpc{
-							Rpc: &csi.ControllerServiceCapability_RPC{
-								Type: controllerCapabilities[0],
-							},
-						},
-					},
+			testCaseName: "Bucket not found",
+			err:          fmt.Errorf("cannot list bucket: %w", s3client.ErrBucketNotFound),
+			expectedCode: codes.NotFound,
+		},
+		{
+			testCaseName: "Bucket owned by another account",
+			err:          s3client.ErrBucketTaken,
+			expectedCode: codes.AlreadyExists,
+		},
+		{
+			testCaseName: "Bucket name taken by another volume",
+			err:          errBucketNameTaken,
+			expectedCode: codes.AlreadyExists,
+		},
+		{
+			testCaseName: "Access denied",
+			err:          s3client.ErrAccessDenied,
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			testCaseName: "Invalid credentials",
+			err:          s3client.ErrInvalidCredentials,
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			testCaseName: "Throttled",
+			err:          s3client.ErrThrottled,
+			expectedCode: codes.Unavailable,
+		},
+		{
+			testCaseName: "Endpoint unreachable",
+			err:          s3client.ErrEndpointUnreachable,
+			expectedCode: codes.Unavailable,
+		},
+		{
+			testCaseName: "Objects under retention",
+			err:          s3client.ErrBucketProtected,
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			testCaseName: "Request timed out",
+			err:          fmt.Errorf("cannot list bucket: %w", context.DeadlineExceeded),
+			expectedCode: codes.DeadlineExceeded,
+		},
+		{
+			testCaseName: "Unknown error",
+			err:          errors.New("failed"),
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+		assert.Equal(t, tc.expectedCode, cosErrorCode(tc.err, codes.Internal))
+	}
+}
+
+func TestControllerModifyVolume(t *testing.T) {
+	volume := &utils.DriverVolume{
+		VolumeID:   testVolumeID,
+		Attributes: map[string]string{"bucketName": bucketName, "userProvidedBucket": "false"},
+		Secrets:    quotaSecret,
+	}
+	enabled := true
+
+	testCases := []struct {
+		testCaseName         string
+		req                  *csi.ControllerModifyVolumeRequest
+		driverVolume         *utils.DriverVolume
+		driverVolumeErr      error
+		mountOptionsErr      error
+		cosSession           *s3client.FakeCOSSessionFactory
+		expectedLifecycle    s3client.BucketLifecycle
+		expectedVersioning   *bool
+		expectedQuota        int64
+		expectedMountOptions string
+		expectedErr          error
+	}{
+		{
+			testCaseName: "Positive: Modified every mutable parameter",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId: testVolumeID,
+				MutableParameters: map[string]string{
+					"expirationDays": "90",
+					"archiveDays":    "30",
+					"archiveType":    "Accelerated",
+					"versioning":     "true",
+					"quota":          "1Gi",
+					"mountOptions":   "parallel_count=8, multipart_size=62",
 				},
 			},
-			expectedErr: nil,
+			driverVolume: volume,
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedLifecycle: s3client.BucketLifecycle{
+				ExpirationDays: 90,
+				ArchiveDays:    30,
+				ArchiveType:    "ACCELERATED",
+			},
+			expectedVersioning:   &enabled,
+			expectedQuota:        1 << 30,
+			expectedMountOptions: "parallel_count=8,multipart_size=62",
+		},
+		{
+			testCaseName: "Positive: Archive rule added to the existing lifecycle",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"archiveDays": "30"},
+			},
+			driverVolume: volume,
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Lifecycle: s3client.BucketLifecycle{ExpirationDays: 90},
+			},
+			expectedLifecycle: s3client.BucketLifecycle{
+				ExpirationDays: 90,
+				ArchiveDays:    30,
+				ArchiveType:    "GLACIER",
+			},
+		},
+		{
+			testCaseName: "Negative: Volume ID is missing",
+			req:          &csi.ControllerModifyVolumeRequest{},
+			cosSession:   &s3client.FakeCOSSessionFactory{},
+			expectedErr:  errors.New("Volume ID missing in request"),
+		},
+		{
+			testCaseName: "Negative: Immutable parameter",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"locationConstraint": "test-region"},
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "parameter locationConstraint cannot be modified"),
+		},
+		{
+			testCaseName: "Negative: Bucket settings of a volume sharing a bucket",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testPrefixVolumeID,
+				MutableParameters: map[string]string{"expirationDays": "30"},
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "bucket settings cannot be changed on volumes sharing a bucket"),
+		},
+		{
+			testCaseName: "Negative: Bucket settings of a volume of a bucket provided by the user",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testSharedVolumeID,
+				MutableParameters: map[string]string{"versioning": "true"},
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "bucket settings cannot be changed on volumes of a bucket provided by the user"),
+		},
+		{
+			testCaseName: "Negative: Bucket settings of a volume of an older release provided by the user",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"quota": "1Gi"},
+			},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:   testVolumeID,
+				Attributes: map[string]string{"bucketName": bucketName, "userProvidedBucket": "true"},
+				Secrets:    quotaSecret,
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "bucket settings cannot be changed on volumes of a bucket provided by the user"),
+		},
+		{
+			testCaseName: "Positive: Mount options of a volume of a bucket provided by the user",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testSharedVolumeID,
+				MutableParameters: map[string]string{"mountOptions": "parallel_count=8"},
+			},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:   testSharedVolumeID,
+				Attributes: map[string]string{"bucketName": bucketName, "userProvidedBucket": "true"},
+				Secrets:    testSecret,
+			},
+			cosSession:           &s3client.FakeCOSSessionFactory{},
+			expectedMountOptions: "parallel_count=8",
+		},
+		{
+			testCaseName: "Negative: Unknown parameter",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"storageTier": "cold"},
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "unknown mutable parameter storageTier"),
+		},
+		{
+			testCaseName: "Negative: Invalid number of days",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"expirationDays": "-1"},
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "expirationDays must be a number of days"),
+		},
+		{
+			testCaseName: "Negative: Expiration before archive",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"expirationDays": "30"},
+			},
+			driverVolume: volume,
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Lifecycle: s3client.BucketLifecycle{ArchiveDays: 30, ArchiveType: "GLACIER"},
+			},
+			expectedLifecycle: s3client.BucketLifecycle{ArchiveDays: 30, ArchiveType: "GLACIER"},
+			expectedErr:       status.Error(codes.InvalidArgument, "expirationDays 30 must be greater than archiveDays 30"),
+		},
+		{
+			testCaseName: "Negative: Quota without an API key",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"quota": "1Gi", "versioning": "true"},
+			},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:   testVolumeID,
+				Attributes: map[string]string{"bucketName": bucketName, "userProvidedBucket": "false"},
+				Secrets:    testSecret,
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "quota requires an apiKey"),
+		},
+		{
+			testCaseName: "Negative: Quota with a provider other than IBM COS",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"quota": "1Gi"},
+			},
+			driverVolume: &utils.DriverVolume{
+				VolumeID:   testVolumeID,
+				Attributes: map[string]string{"bucketName": bucketName, "userProvidedBucket": "false", "provider": constants.ProviderMinIO},
+				Secrets:    testSecret,
+			},
+			cosSession:  &s3client.FakeCOSSessionFactory{},
+			expectedErr: status.Error(codes.InvalidArgument, "provider minio does not support quotas"),
+		},
+		{
+			testCaseName: "Negative: Volume not found",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"versioning": "true"},
+			},
+			driverVolumeErr: utils.ErrVolumeNotFound,
+			cosSession:      &s3client.FakeCOSSessionFactory{},
+			expectedErr:     status.Error(codes.NotFound, ""),
+		},
+		{
+			testCaseName: "Negative: Versioning enabled on a bucket with a retention policy",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"versioning": "true", "expirationDays": "30"},
+			},
+			driverVolume: volume,
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Retention: &s3client.BucketRetention{MinimumDays: 1, DefaultDays: 30, MaximumDays: 365},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "versioning cannot be enabled on bucket "+bucketName+", which has a retention policy"),
+		},
+		{
+			testCaseName: "Negative: Versioning suspended on a bucket with object lock",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"versioning": "false"},
+			},
+			driverVolume: volume,
+			cosSession: &s3client.FakeCOSSessionFactory{
+				ObjectLock: &s3client.BucketObjectLock{DefaultDays: 30},
+			},
+			expectedErr: status.Error(codes.InvalidArgument, "versioning cannot be suspended on bucket "+bucketName+", which has object lock enabled"),
+		},
+		{
+			testCaseName: "Negative: Failed to get the protection of the bucket",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"versioning": "true"},
+			},
+			driverVolume: volume,
+			cosSession:   &s3client.FakeCOSSessionFactory{FailGetProtection: true},
+			expectedErr:  status.Error(codes.Internal, "failed to get bucket retention"),
+		},
+		{
+			testCaseName: "Negative: Failed to set lifecycle",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"expirationDays": "30"},
+			},
+			driverVolume: volume,
+			cosSession:   &s3client.FakeCOSSessionFactory{FailSetLifecycle: true},
+			expectedErr:  status.Error(codes.Internal, "failed to set bucket lifecycle"),
+		},
+		{
+			testCaseName: "Negative: Failed to set mount options",
+			req: &csi.ControllerModifyVolumeRequest{
+				VolumeId:          testVolumeID,
+				MutableParameters: map[string]string{"mountOptions": "parallel_count=8"},
+			},
+			driverVolume:         volume,
+			mountOptionsErr:      errors.New("failed to patch pv"),
+			cosSession:           &s3client.FakeCOSSessionFactory{},
+			expectedMountOptions: "parallel_count=8",
+			expectedErr:          status.Error(codes.Internal, "unable to set mount options"),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
 
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ControllerGetCapabilities(ctx, tc.req)
+		var (
+			quota        int64
+			mountOptions string
+		)
+		controllerServer := &controllerServer{
+			S3Driver: &S3Driver{name: driverName},
+			Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				GetDriverVolumeFn: func(volumeID string) (*utils.DriverVolume, error) {
+					return tc.driverVolume, tc.driverVolumeErr
+				},
+				SetBucketHardQuotaFn: func(apiKey, bucketName string, quotaBytes int64) error {
+					quota = quotaBytes
+					return nil
+				},
+				SetPVMountOptionsFn: func(volumeID, options string) error {
+					mountOptions = options
+					return tc.mountOptionsErr
+				},
+			}),
+			cosSession: tc.cosSession,
+		}
+		actualResp, actualErr := controllerServer.ControllerModifyVolume(ctx, tc.req)
 
+		assert.Equal(t, tc.expectedLifecycle, tc.cosSession.Lifecycle)
+		assert.Equal(t, tc.expectedVersioning, tc.cosSession.Versioning)
+		assert.Equal(t, tc.expectedQuota, quota)
+		assert.Equal(t, tc.expectedMountOptions, mountOptions)
 		if tc.expectedErr != nil {
 			assert.Error(t, actualErr)
 			assert.Contains(t, actualErr.Error(), tc.expectedErr.Error())
-		} else {
-			assert.NoError(t, actualErr)
-		}
-
-		if !reflect.DeepEqual(tc.expectedResp, actualResp) {
-			t.Errorf("Expected %v but got %v", tc.expectedResp, actualResp)
+			assert.Nil(t, actualResp)
+			continue
 		}
+		assert.NoError(t, actualErr)
+		assert.Equal(t, &csi.ControllerModifyVolumeResponse{}, actualResp)
 	}
 }
-
-func TestCreateSnapshot(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.CreateSnapshot(ctx, &csi.CreateSnapshotRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
-
-func TestDeleteSnapshot(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
-
-func TestListSnapshots(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ListSnapshots(ctx, &csi.ListSnapshotsRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
-
-func TestControllerExpandVolume(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
-
-func TestControllerGetVolume(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
-
-func TestControllerModifyVolume(t *testing.T) {
-	t.Run("UnImplemented Method", func(t *testing.T) {
-		controllerServer := &controllerServer{}
-		actualResp, actualErr := controllerServer.ControllerModifyVolume(ctx, &csi.ControllerModifyVolumeRequest{})
-		assert.Nil(t, actualResp)
-		assert.Error(t, actualErr)
-		assert.Contains(t, actualErr.Error(), status.Error(codes.Unimplemented, "").Error())
-	})
-}
@@ -103,6 +103,13 @@ func TestGetPluginCapabilities(t *testing.T) {
 							},
 						},
 					},
+					{
+						Type: &csi.PluginCapability_VolumeExpansion_{
+							VolumeExpansion: &csi.PluginCapability_VolumeExpansion{
+								Type: csi.PluginCapability_VolumeExpansion_ONLINE,
+							},
+						},
+					},
 				},
 			},
 			expectedErr: nil,
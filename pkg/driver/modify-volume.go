@@ -0,0 +1,405 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/ibm-cos-sdk-go/service/s3"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+)
+
+// volumeModification holds the changes requested through the mutable parameters of
+// a VolumeAttributesClass. Nil fields are left unchanged.
+type volumeModification struct {
+	expirationDays *int64
+	archiveDays    *int64
+	archiveType    *string
+	versioning     *bool
+	quotaBytes     *int64
+	mountOptions   *string
+}
+
+// immutableParameters are only applied when the volume is created
+var immutableParameters = map[string]bool{
+	"bucketName":         true,
+	"cosEndpoint":        true,
+	"locationConstraint": true,
+	"kpRootKeyCRN":       true,
+	"objPath":            true,
+	"mounter":            true,
+	"client":             true,
+	"userProvidedBucket": true,
+	"sharedBucket":       true,
+	"bucketNameTemplate": true,
+
+	"retentionMinimumDays": true,
+	"retentionDefaultDays": true,
+	"retentionMaximumDays": true,
+	"objectLock":           true,
+	"objectLockDays":       true,
+}
+
+// maxRetentionDays is the longest retention period accepted by COS
+const maxRetentionDays = 365243
+
+// archiveTypes maps the archiveType parameter to the storage class of the archive tier
+var archiveTypes = map[string]string{
+	"glacier":     s3.TransitionStorageClassGlacier,
+	"accelerated": s3.TransitionStorageClassAccelerated,
+}
+
+// parseMutableParameters validates the mutable parameters of a volume
+func parseMutableParameters(params map[string]string) (*volumeModification, error) {
+	m := &volumeModification{}
+	for key, value := range params {
+		switch key {
+		case "expirationDays":
+			days, err := parseDays(key, value)
+			if err != nil {
+				return nil, err
+			}
+			m.expirationDays = &days
+		case "archiveDays":
+			days, err := parseDays(key, value)
+			if err != nil {
+				return nil, err
+			}
+			m.archiveDays = &days
+		case "archiveType":
+			archiveType, ok := archiveTypes[strings.ToLower(value)]
+			if !ok {
+				return nil, fmt.Errorf("archiveType must be Glacier or Accelerated, got %q", value)
+			}
+			m.archiveType = &archiveType
+		case "versioning":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("versioning must be true or false, got %q", value)
+			}
+			m.versioning = &enabled
+		case "quota":
+			quota, err := resource.ParseQuantity(value)
+			if err != nil || quota.Value() <= 0 {
+				return nil, fmt.Errorf("quota must be a positive quantity, got %q", value)
+			}
+			quotaBytes := quota.Value()
+			m.quotaBytes = &quotaBytes
+		case "mountOptions":
+			options := splitMountOptions(value)
+			for _, option := range options {
+				if mountOptionKey(option) == "" || strings.ContainsAny(option, " \t") {
+					return nil, fmt.Errorf("invalid mount option %q", option)
+				}
+			}
+			mountOptions := strings.Join(options, ",")
+			m.mountOptions = &mountOptions
+		default:
+			if immutableParameters[key] {
+				return nil, fmt.Errorf("parameter %s cannot be modified", key)
+			}
+			return nil, fmt.Errorf("unknown mutable parameter %s", key)
+		}
+	}
+	return m, nil
+}
+
+// changesBucket tells whether a modification changes settings of the bucket, rather
+// than of the volume alone
+func (m *volumeModification) changesBucket() bool {
+	return m.expirationDays != nil || m.archiveDays != nil || m.archiveType != nil || m.versioning != nil || m.quotaBytes != nil
+}
+
+// parseBucketParameters returns the settings of the buckets created for the volumes
+// of a StorageClass. Combinations refused by COS are rejected up front.
+func parseBucketParameters(params map[string]string) (s3client.BucketOptions, error) {
+	var opts s3client.BucketOptions
+	var err error
+	if opts.Lifecycle, err = parseLifecycleParameters(params); err != nil {
+		return opts, err
+	}
+
+	versioning, versioningSet := params["versioning"]
+	if versioningSet {
+		if opts.Versioning, err = strconv.ParseBool(versioning); err != nil {
+			return opts, fmt.Errorf("versioning must be true or false, got %q", versioning)
+		}
+	}
+	if opts.Retention, err = parseRetentionParameters(params); err != nil {
+		return opts, err
+	}
+	if opts.ObjectLock, err = parseObjectLockParameters(params); err != nil {
+		return opts, err
+	}
+
+	switch {
+	case opts.Retention != nil && opts.ObjectLock != nil:
+		return opts, fmt.Errorf("a retention policy and object lock cannot be set on the same bucket")
+	case opts.Retention != nil && opts.Versioning:
+		return opts, fmt.Errorf("a retention policy cannot be set on a versioned bucket")
+	case opts.ObjectLock != nil && versioningSet && !opts.Versioning:
+		return opts, fmt.Errorf("object lock requires versioning")
+	}
+	return opts, nil
+}
+
+// parseRetentionParameters returns the retention policy set by the parameters of a
+// StorageClass, or nil. The minimum period defaults to zero and the maximum period
+// to the default one.
+func parseRetentionParameters(params map[string]string) (*s3client.BucketRetention, error) {
+	_, minSet := params["retentionMinimumDays"]
+	_, maxSet := params["retentionMaximumDays"]
+	value, defaultSet := params["retentionDefaultDays"]
+	if !defaultSet {
+		if minSet || maxSet {
+			return nil, fmt.Errorf("retentionDefaultDays is required with a retention policy")
+		}
+		return nil, nil
+	}
+
+	retention := &s3client.BucketRetention{}
+	var err error
+	if retention.DefaultDays, err = parseDays("retentionDefaultDays", value); err != nil {
+		return nil, err
+	}
+	retention.MaximumDays = retention.DefaultDays
+	if minSet {
+		if retention.MinimumDays, err = parseDays("retentionMinimumDays", params["retentionMinimumDays"]); err != nil {
+			return nil, err
+		}
+	}
+	if maxSet {
+		if retention.MaximumDays, err = parseDays("retentionMaximumDays", params["retentionMaximumDays"]); err != nil {
+			return nil, err
+		}
+	}
+	if retention.MinimumDays > retention.DefaultDays || retention.DefaultDays > retention.MaximumDays {
+		return nil, fmt.Errorf("retention periods must satisfy minimum %d <= default %d <= maximum %d",
+			retention.MinimumDays, retention.DefaultDays, retention.MaximumDays)
+	}
+	if retention.MaximumDays > maxRetentionDays {
+		return nil, fmt.Errorf("retentionMaximumDays must not exceed %d", maxRetentionDays)
+	}
+	return retention, nil
+}
+
+// parseObjectLockParameters returns the object lock settings of the parameters of
+// a StorageClass, or nil when object lock is not enabled
+func parseObjectLockParameters(params map[string]string) (*s3client.BucketObjectLock, error) {
+	enabled := false
+	if value, ok := params["objectLock"]; ok {
+		var err error
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("objectLock must be true or false, got %q", value)
+		}
+	}
+	value, daysSet := params["objectLockDays"]
+	if !enabled {
+		if daysSet {
+			return nil, fmt.Errorf("objectLockDays requires objectLock")
+		}
+		return nil, nil
+	}
+
+	lock := &s3client.BucketObjectLock{}
+	if daysSet {
+		var err error
+		if lock.DefaultDays, err = parseDays("objectLockDays", value); err != nil {
+			return nil, err
+		}
+		if lock.DefaultDays > maxRetentionDays {
+			return nil, fmt.Errorf("objectLockDays must not exceed %d", maxRetentionDays)
+		}
+	}
+	return lock, nil
+}
+
+// parseLifecycleParameters returns the lifecycle rules set by the parameters of a
+// StorageClass, to be installed on the buckets created for its volumes. It returns
+// nil when no rule is set.
+func parseLifecycleParameters(params map[string]string) (*s3client.BucketLifecycle, error) {
+	lifecycle := &s3client.BucketLifecycle{}
+	days := map[string]*int64{
+		"expirationDays":           &lifecycle.ExpirationDays,
+		"archiveDays":              &lifecycle.ArchiveDays,
+		"noncurrentExpirationDays": &lifecycle.NoncurrentExpirationDays,
+		"abortMultipartDays":       &lifecycle.AbortMultipartDays,
+	}
+	set := false
+	for key, field := range days {
+		value, ok := params[key]
+		if !ok {
+			continue
+		}
+		var err error
+		if *field, err = parseDays(key, value); err != nil {
+			return nil, err
+		}
+		set = true
+	}
+	if !set {
+		return nil, nil
+	}
+
+	lifecycle.ArchiveType = s3.TransitionStorageClassGlacier
+	if value, ok := params["archiveType"]; ok {
+		archiveType, ok := archiveTypes[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("archiveType must be Glacier or Accelerated, got %q", value)
+		}
+		lifecycle.ArchiveType = archiveType
+	}
+	if err := validateLifecycle(lifecycle); err != nil {
+		return nil, err
+	}
+	return lifecycle, nil
+}
+
+// validateLifecycle checks that objects are archived before they expire
+func validateLifecycle(lifecycle *s3client.BucketLifecycle) error {
+	if lifecycle.ExpirationDays > 0 && lifecycle.ArchiveDays > 0 && lifecycle.ExpirationDays <= lifecycle.ArchiveDays {
+		return fmt.Errorf("expirationDays %d must be greater than archiveDays %d", lifecycle.ExpirationDays, lifecycle.ArchiveDays)
+	}
+	return nil
+}
+
+func parseDays(key, value string) (int64, error) {
+	days, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("%s must be a number of days, got %q", key, value)
+	}
+	return days, nil
+}
+
+// modifyBucket applies the bucket level changes of a modification. Everything is
+// validated before the first change is made.
+func (cs *controllerServer) modifyBucket(ctx context.Context, sess s3client.ObjectStorageSession, provider utils.Provider, bucketName string,
+	secretMap map[string]string, m *volumeModification) error {
+	if m.quotaBytes != nil && !provider.ResourceConfiguration {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("provider %s does not support quotas", provider.Name))
+	}
+	if m.quotaBytes != nil && secretMap["apiKey"] == "" {
+		return status.Error(codes.InvalidArgument, "quota requires an apiKey in the secret of the volume")
+	}
+	if m.versioning != nil {
+		if err := checkVersioningChange(ctx, sess, provider, bucketName, *m.versioning); err != nil {
+			return err
+		}
+	}
+
+	if m.expirationDays != nil || m.archiveDays != nil || m.archiveType != nil {
+		lifecycle, err := sess.GetBucketLifecycle(ctx, bucketName)
+		if err != nil {
+			return status.Error(cosErrorCode(err, codes.Internal), err.Error())
+		}
+		if m.expirationDays != nil {
+			lifecycle.ExpirationDays = *m.expirationDays
+		}
+		if m.archiveDays != nil {
+			lifecycle.ArchiveDays = *m.archiveDays
+		}
+		if m.archiveType != nil {
+			lifecycle.ArchiveType = *m.archiveType
+		}
+		if lifecycle.ArchiveType == "" {
+			lifecycle.ArchiveType = s3.TransitionStorageClassGlacier
+		}
+		if err = validateLifecycle(&lifecycle); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err = sess.SetBucketLifecycle(ctx, bucketName, lifecycle); err != nil {
+			return status.Error(cosErrorCode(err, codes.Internal), err.Error())
+		}
+		klog.Infof("Set lifecycle of bucket %s: %+v", bucketName, lifecycle)
+	}
+
+	if m.versioning != nil {
+		if err := sess.SetBucketVersioning(ctx, bucketName, *m.versioning); err != nil {
+			return status.Error(cosErrorCode(err, codes.Internal), err.Error())
+		}
+		klog.Infof("Set versioning of bucket %s to %t", bucketName, *m.versioning)
+	}
+
+	if m.quotaBytes != nil {
+		if err := cs.Stats.SetBucketHardQuota(secretMap["apiKey"], bucketName, *m.quotaBytes); err != nil {
+			return status.Error(codes.Internal, fmt.Sprintf("unable to set hard quota of bucket %s: %v", bucketName, err))
+		}
+	}
+	return nil
+}
+
+// checkVersioningChange rejects a versioning change the protection of the bucket
+// does not allow. Versioning cannot be enabled on a bucket with a retention policy,
+// nor suspended on a bucket with object lock.
+func checkVersioningChange(ctx context.Context, sess s3client.ObjectStorageSession, provider utils.Provider, bucketName string, enabled bool) error {
+	if enabled && provider.IBMExtensions {
+		retention, err := sess.GetBucketRetention(ctx, bucketName)
+		if err != nil {
+			return status.Error(cosErrorCode(err, codes.Internal), err.Error())
+		}
+		if retention != nil {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("versioning cannot be enabled on bucket %s, which has a retention policy", bucketName))
+		}
+	}
+	if !enabled {
+		lock, err := sess.GetBucketObjectLock(ctx, bucketName)
+		if err != nil {
+			return status.Error(cosErrorCode(err, codes.Internal), err.Error())
+		}
+		if lock != nil {
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("versioning cannot be suspended on bucket %s, which has object lock enabled", bucketName))
+		}
+	}
+	return nil
+}
+
+// splitMountOptions splits mount options separated by commas or new lines
+func splitMountOptions(options string) []string {
+	var split []string
+	for _, option := range strings.FieldsFunc(options, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if option = strings.TrimSpace(option); option != "" {
+			split = append(split, option)
+		}
+	}
+	return split
+}
+
+func mountOptionKey(option string) string {
+	return strings.TrimSpace(strings.SplitN(option, "=", 2)[0])
+}
+
+// mergeMountOptions returns the base options with the extra options added, an extra
+// option replacing the base option of the same key
+func mergeMountOptions(base, extra []string) []string {
+	merged := append([]string{}, base...)
+	index := make(map[string]int, len(merged))
+	for i, option := range merged {
+		index[mountOptionKey(option)] = i
+	}
+	for _, option := range extra {
+		key := mountOptionKey(option)
+		if i, ok := index[key]; ok {
+			merged[i] = option
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, option)
+	}
+	return merged
+}
@@ -0,0 +1,190 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMergeMountOptions(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		base         []string
+		extra        string
+		expected     []string
+	}{
+		{
+			testCaseName: "No extra options",
+			base:         []string{"multipart_size=62", "kernel_cache"},
+			expected:     []string{"multipart_size=62", "kernel_cache"},
+		},
+		{
+			testCaseName: "Extra options replace and extend the base options",
+			base:         []string{"multipart_size=62", "kernel_cache"},
+			extra:        "multipart_size=128,\nparallel_count=8",
+			expected:     []string{"multipart_size=128", "kernel_cache", "parallel_count=8"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+		assert.Equal(t, tc.expected, mergeMountOptions(tc.base, splitMountOptions(tc.extra)))
+	}
+}
+
+func TestParseLifecycleParameters(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		params       map[string]string
+		expected     *s3client.BucketLifecycle
+		expectedErr  string
+	}{
+		{
+			testCaseName: "No lifecycle rule",
+			params:       map[string]string{"mounter": "s3fs", "archiveType": "Accelerated"},
+		},
+		{
+			testCaseName: "Every lifecycle rule",
+			params: map[string]string{
+				"expirationDays":           "365",
+				"archiveDays":              "30",
+				"archiveType":              "Accelerated",
+				"noncurrentExpirationDays": "7",
+				"abortMultipartDays":       "1",
+			},
+			expected: &s3client.BucketLifecycle{
+				ExpirationDays:           365,
+				ArchiveDays:              30,
+				ArchiveType:              "ACCELERATED",
+				NoncurrentExpirationDays: 7,
+				AbortMultipartDays:       1,
+			},
+		},
+		{
+			testCaseName: "Archive tier defaults to Glacier",
+			params:       map[string]string{"archiveDays": "30"},
+			expected:     &s3client.BucketLifecycle{ArchiveDays: 30, ArchiveType: "GLACIER"},
+		},
+		{
+			testCaseName: "Invalid number of days",
+			params:       map[string]string{"abortMultipartDays": "-1"},
+			expectedErr:  "abortMultipartDays must be a number of days",
+		},
+		{
+			testCaseName: "Invalid archive tier",
+			params:       map[string]string{"archiveDays": "30", "archiveType": "Tape"},
+			expectedErr:  "archiveType must be Glacier or Accelerated",
+		},
+		{
+			testCaseName: "Expiration before archiving",
+			params:       map[string]string{"expirationDays": "30", "archiveDays": "30"},
+			expectedErr:  "expirationDays 30 must be greater than archiveDays 30",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		actual, err := parseLifecycleParameters(tc.params)
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, actual)
+	}
+}
+
+func TestParseBucketParameters(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		params       map[string]string
+		expected     s3client.BucketOptions
+		expectedErr  string
+	}{
+		{
+			testCaseName: "No bucket setting",
+			params:       map[string]string{"mounter": "s3fs"},
+		},
+		{
+			testCaseName: "Versioning",
+			params:       map[string]string{"versioning": "true"},
+			expected:     s3client.BucketOptions{Versioning: true},
+		},
+		{
+			testCaseName: "Retention policy with default periods",
+			params:       map[string]string{"retentionDefaultDays": "30"},
+			expected:     s3client.BucketOptions{Retention: &s3client.BucketRetention{DefaultDays: 30, MaximumDays: 30}},
+		},
+		{
+			testCaseName: "Retention policy",
+			params:       map[string]string{"retentionMinimumDays": "1", "retentionDefaultDays": "30", "retentionMaximumDays": "365"},
+			expected:     s3client.BucketOptions{Retention: &s3client.BucketRetention{MinimumDays: 1, DefaultDays: 30, MaximumDays: 365}},
+		},
+		{
+			testCaseName: "Object lock",
+			params:       map[string]string{"objectLock": "true", "objectLockDays": "7", "versioning": "true"},
+			expected:     s3client.BucketOptions{Versioning: true, ObjectLock: &s3client.BucketObjectLock{DefaultDays: 7}},
+		},
+		{
+			testCaseName: "Retention policy without default period",
+			params:       map[string]string{"retentionMaximumDays": "365"},
+			expectedErr:  "retentionDefaultDays is required",
+		},
+		{
+			testCaseName: "Retention periods out of order",
+			params:       map[string]string{"retentionMinimumDays": "60", "retentionDefaultDays": "30"},
+			expectedErr:  "minimum 60 <= default 30 <= maximum 30",
+		},
+		{
+			testCaseName: "Retention period too long",
+			params:       map[string]string{"retentionDefaultDays": "400000"},
+			expectedErr:  "retentionMaximumDays must not exceed 365243",
+		},
+		{
+			testCaseName: "Object lock days without object lock",
+			params:       map[string]string{"objectLockDays": "7"},
+			expectedErr:  "objectLockDays requires objectLock",
+		},
+		{
+			testCaseName: "Object lock without versioning",
+			params:       map[string]string{"objectLock": "true", "versioning": "false"},
+			expectedErr:  "object lock requires versioning",
+		},
+		{
+			testCaseName: "Retention policy and object lock",
+			params:       map[string]string{"objectLock": "true", "retentionDefaultDays": "30"},
+			expectedErr:  "cannot be set on the same bucket",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		actual, err := parseBucketParameters(tc.params)
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, actual)
+	}
+}
@@ -11,13 +11,17 @@
 package driver
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/IBM/ibm-object-csi-driver/pkg/mounter"
 	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
 	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -31,8 +35,20 @@ type nodeServer struct {
 	NodeID       string
 	Mounter      mounter.NewMounterFactory
 	MounterUtils mounterUtils.MounterUtils
+	cosSession   s3client.ObjectStorageSessionFactory
+	Logger       *zap.Logger
+	// workload serves the credentials of the volumes mounted with workload identity,
+	// and the keys of the secrets their mounter fetches, it is nil when workload
+	// identity is disabled
+	workload *workloadIdentity
+	// usage keeps the usage of the volumes by volume ID, it is nil when the usage is
+	// computed at each call
+	usage *utils.Cache[int64]
 }
 
+// volumeUsageCacheSize is the number of volumes whose usage is kept by the node server
+const volumeUsageCacheSize = 256
+
 func (ns *nodeServer) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
 	klog.V(2).Infof("CSINodeServer-NodeStageVolume: Request %v", *req)
 
@@ -84,6 +100,12 @@ func (ns *nodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishV
 	if len(targetPath) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Target path missing in request")
 	}
+	// Two mounters racing on a target path would leave it unusable
+	release, err := ns.locks.acquire(targetPathLock, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	if req.GetVolumeCapability() == nil {
 		return nil, status.Error(codes.InvalidArgument, "Volume capability missing in request")
@@ -104,24 +126,35 @@ func (ns *nodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishV
 	attrib := req.GetVolumeContext()
 	mountFlags := req.GetVolumeCapability().GetMount().GetMountFlags()
 	klog.V(2).Infof("-NodePublishVolume-: targetPath: %v\ndeviceID: %v\nreadonly: %v\nvolumeId: %v\nattributes: %v\nmountFlags: %v\n",
-		targetPath, deviceID, readOnly, volumeID, attrib, mountFlags)
+		targetPath, deviceID, readOnly, volumeID, utils.MaskSecrets(attrib), mountFlags)
 
 	secretMap := req.GetSecrets()
-	secretMapCopy := make(map[string]string)
-	for k, v := range secretMap {
-		if k == "accessKey" || k == "secretKey" || k == "apiKey" || k == "kpRootKeyCRN" {
-			secretMapCopy[k] = "xxxxxxx"
-			continue
-		}
-		secretMapCopy[k] = v
-	}
-	klog.V(2).Infof("-NodePublishVolume-: secretMap: %v", secretMapCopy)
+	klog.V(2).Infof("-NodePublishVolume-: secretMap: %v", utils.MaskSecrets(secretMap))
 	if volumeMountGroup != "" {
 		secretMap["gid"] = volumeMountGroup
 	}
-
-	// If bucket name wasn't provided by user, we use temp bucket created for volume.
-	if secretMap["bucketName"] == "" {
+	// The mounters find the provider of the volume in the secret
+	provider, err := getProvider(secretMap, attrib)
+	if err != nil {
+		return nil, err
+	}
+	secretMap["provider"] = provider.Name
+
+	// The volume ID describes the bucket of the volume, the location in the secret
+	// taking precedence. Plain volume IDs of older releases need the PV.
+	if info, ok := utils.DecodeVolumeID(volumeID); ok {
+		secretMap["bucketName"] = info.BucketName
+		if info.Prefix != "" {
+			secretMap["objPath"] = info.Prefix
+		}
+		if secretMap["cosEndpoint"] == "" && info.Endpoint != "" {
+			secretMap["cosEndpoint"] = info.Endpoint
+		}
+		if secretMap["locationConstraint"] == "" && info.Region != "" {
+			secretMap["locationConstraint"] = info.Region
+		}
+	} else if secretMap["bucketName"] == "" {
+		// If bucket name wasn't provided by user, we use temp bucket created for volume.
 		tempBucketName, err := ns.Stats.GetBucketNameFromPV(volumeID)
 		if err != nil {
 			klog.Errorf("Unable to fetch pv %v", err)
@@ -136,12 +169,59 @@ func (ns *nodeServer) NodePublishVolume(_ context.Context, req *csi.NodePublishV
 		secretMap["bucketName"] = tempBucketName
 	}
 
-	mounterObj := ns.Mounter.NewMounter(attrib, secretMap, mountFlags)
+	if err = clientEncryption(attrib, secretMap); err != nil {
+		return nil, err
+	}
+
+	served, err := ns.publishCredentials(targetPath, provider, attrib, secretMap)
+	if err != nil {
+		return nil, err
+	}
+
+	// kubelet republishes the mounted volumes whose CSIDriver requires it, to renew
+	// their service account tokens and pick up the credentials rotated in the secret
+	mounted, err := ns.Stats.IsMountPoint(targetPath)
+	if err != nil {
+		klog.Errorf("Can not validate target mount point: %s %v", targetPath, err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if mounted {
+		klog.Infof("Volume %s already mounted to %s", volumeID, targetPath)
+		if !served {
+			if err = ns.updateCredentials(targetPath, attrib, secretMap); err != nil {
+				return nil, err
+			}
+		}
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	// Default mount options of the volume apply over those of the storage class, and
+	// the ones set through ControllerModifyVolume over those set at creation
+	mountFlags = mergeMountOptions(mountFlags, splitMountOptions(attrib["mountOptions"]))
+	if pvName := volumePVName(volumeID, attrib, targetPath); pvName == "" {
+		klog.Warningf("Unable to find the PV of volume %s, its mount options are not fetched", volumeID)
+	} else if mountOptions, err := ns.Stats.GetPVMountOptions(pvName); err != nil {
+		klog.Warningf("Unable to fetch mount options of volume %s: %v", volumeID, err)
+	} else {
+		mountFlags = mergeMountOptions(mountFlags, splitMountOptions(mountOptions))
+	}
+
+	mounterObj, err := ns.Mounter.NewMounter(attrib, secretMap, mountFlags)
+	if err != nil {
+		klog.Errorf("Unable to mount volume %s: %v", volumeID, err)
+		if ns.workload != nil {
+			ns.workload.unregister(targetPath)
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	klog.Info("-NodePublishVolume-: Mount")
 
 	if err = mounterObj.Mount("", targetPath); err != nil {
 		klog.Info("-Mount-: Error: ", err)
+		if ns.workload != nil {
+			ns.workload.unregister(targetPath)
+		}
 		return nil, err
 	}
 
@@ -161,6 +241,12 @@ func (ns *nodeServer) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpubl
 	if len(targetPath) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Target path missing in request")
 	}
+	// Two mounters racing on a target path would leave it unusable
+	release, err := ns.locks.acquire(targetPathLock, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	klog.Infof("Unmounting  target path %s", targetPath)
 
 	if err := ns.MounterUtils.FuseUnmount(targetPath); err != nil {
@@ -169,11 +255,193 @@ func (ns *nodeServer) NodeUnpublishVolume(_ context.Context, req *csi.NodeUnpubl
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	klog.Infof("Successfully unmounted  target path %s", targetPath)
+	if ns.workload != nil {
+		ns.workload.unregister(targetPath)
+	}
 
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
-func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+// publishCredentials has a volume mounted with workload identity authenticate to
+// the node server, which exchanges the service account token of the pod for the
+// credentials of the trusted profile or the role named in the secret. IBM COS takes
+// IAM tokens of trusted profiles from s3fs, the other providers temporary credentials
+// of roles from rclone.
+//
+// The volumes whose mounter can fetch the keys of their secret from the node server
+// authenticate to it too, for the running mounts to pick up the keys rotated in the
+// secret once the volume is republished: s3fs gets IAM tokens of the API key, and
+// rclone the HMAC keys. served tells whether the node server serves the credentials
+// of the volume.
+func (ns *nodeServer) publishCredentials(targetPath string, provider utils.Provider, attrib, secretMap map[string]string) (served bool, err error) {
+	workload := isWorkloadIdentity(secretMap)
+	if ns.workload == nil {
+		if workload {
+			return false, status.Error(codes.FailedPrecondition, fmt.Sprintf("workload identity is disabled on node %s", ns.NodeID))
+		}
+		return false, nil
+	}
+	mounterType := volumeMounter(attrib, secretMap)
+
+	var creds *s3client.ObjectStorageCredentials
+	if workload {
+		if creds, err = workloadCredentials(provider, mounterType, attrib, secretMap); err != nil {
+			return false, err
+		}
+	} else if creds = secretCredentials(provider, mounterType, secretMap); creds == nil {
+		return false, nil
+	}
+	key, rotated, err := ns.workload.register(targetPath, *creds)
+	if err != nil {
+		return false, status.Error(codes.Internal, err.Error())
+	}
+	if rotated {
+		klog.Infof("Credentials of the volume mounted to %s rotated", targetPath)
+		credentialRotationsTotal.WithLabelValues(mounterType, "applied").Inc()
+	}
+
+	if mounterType == constants.S3FS {
+		secretMap["apiKey"] = key
+		secretMap["iamEndpoint"] = ns.workload.url
+	} else {
+		secretMap["credentialsEndpoint"] = ns.workload.url + workloadCredentialsPath
+		secretMap["credentialsToken"] = key
+	}
+	return true, nil
+}
+
+// secretCredentials returns the keys of the secret of a volume its mounter can fetch
+// from the node server, or nil when it reads them from its files only: s3fs reads
+// HMAC keys from its passwd file, and rclone API keys from its config.
+func secretCredentials(provider utils.Provider, mounterType string, secretMap map[string]string) *s3client.ObjectStorageCredentials {
+	switch {
+	case mounterType == constants.S3FS && provider.IBMExtensions && secretMap["apiKey"] != "":
+		iamEndpoint := secretMap["iamEndpoint"]
+		if iamEndpoint == "" {
+			iamEndpoint = constants.DefaultIAMEndPoint
+		}
+		return &s3client.ObjectStorageCredentials{APIKey: secretMap["apiKey"], IAMEndpoint: iamEndpoint}
+	case mounterType == constants.RClone && provider.IBMExtensions && secretMap["apiKey"] != "" && secretMap["serviceId"] != "":
+		return nil
+	case mounterType == constants.RClone && secretMap["accessKey"] != "":
+		return &s3client.ObjectStorageCredentials{AccessKey: secretMap["accessKey"], SecretKey: secretMap["secretKey"]}
+	}
+	return nil
+}
+
+// updateCredentials rewrites the keys of the secret of a republished volume in the
+// files its mounter reads them from, when they are not served by the node server.
+// s3fs and rclone read those files once, when they mount the volume, the rotated
+// keys are used once the volume is remounted.
+func (ns *nodeServer) updateCredentials(targetPath string, attrib, secretMap map[string]string) error {
+	mounterObj, err := ns.Mounter.NewMounter(attrib, secretMap, nil)
+	if err != nil {
+		klog.Errorf("Unable to update the credentials of the volume mounted to %s: %v", targetPath, err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	rotated, err := mounterObj.UpdateCredentials(targetPath)
+	if err != nil {
+		klog.Errorf("Unable to update the credentials of the volume mounted to %s: %v", targetPath, err)
+		return status.Error(codes.Internal, err.Error())
+	}
+	if rotated {
+		mounterType := volumeMounter(attrib, secretMap)
+		klog.Warningf("Credentials of the volume mounted to %s rotated and rewritten, %s uses them once the volume is remounted", targetPath, mounterType)
+		credentialRotationsTotal.WithLabelValues(mounterType, "remount_required").Inc()
+	}
+	return nil
+}
+
+// isWorkloadIdentity tells whether a volume is mounted with workload identity
+func isWorkloadIdentity(secretMap map[string]string) bool {
+	return secretMap["trustedProfileId"] != "" || secretMap["roleArn"] != ""
+}
+
+// volumeMounter returns the mounter of a volume, s3fs unless rclone is named
+func volumeMounter(attrib, secretMap map[string]string) string {
+	mounterType, ok := attrib["mounter"]
+	if !ok {
+		mounterType = secretMap["mounter"]
+	}
+	if mounterType != constants.RClone {
+		return constants.S3FS
+	}
+	return mounterType
+}
+
+// clientEncryption checks the volumes encrypted on the client, by rclone with the
+// keys of their secret, and sets the options of their storage class in the secret
+// for the mounter. Such volumes are not mounted without their keys.
+func clientEncryption(attrib, secretMap map[string]string) error {
+	if attrib["clientEncryption"] != "true" && secretMap["clientEncryption"] != "true" {
+		return nil
+	}
+	mounterType, ok := attrib["mounter"]
+	if !ok {
+		mounterType = secretMap["mounter"]
+	}
+	if mounterType != constants.RClone {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("client-side encryption requires mounter %s", constants.RClone))
+	}
+	if secretMap["cryptPassword"] == "" || secretMap["cryptSalt"] == "" {
+		return status.Error(codes.InvalidArgument, "client-side encryption requires cryptPassword and cryptSalt in the secret")
+	}
+	secretMap["clientEncryption"] = "true"
+	if val, ok := attrib["encryptFileNames"]; ok {
+		secretMap["encryptFileNames"] = val
+	}
+	return nil
+}
+
+// workloadCredentials returns the credentials of a volume mounted with workload
+// identity, with the service account token of the pod
+func workloadCredentials(provider utils.Provider, mounterType string, attrib, secretMap map[string]string) (*s3client.ObjectStorageCredentials, error) {
+	audience := secretMap["tokenAudience"]
+	if audience == "" {
+		audience = provider.TokenAudience
+	}
+	token, err := serviceAccountToken(attrib, audience)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	secretMap["serviceAccountToken"] = token
+	creds, err := getCredentials(secretMap)
+	delete(secretMap, "serviceAccountToken")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case provider.IBMExtensions && creds.TrustedProfileID != "":
+		if mounterType != constants.S3FS {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("workload identity of provider %s requires mounter %s", provider.Name, constants.S3FS))
+		}
+	case !provider.IBMExtensions && creds.RoleARN != "":
+		if mounterType != constants.RClone {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("workload identity of provider %s requires mounter %s", provider.Name, constants.RClone))
+		}
+		if creds.STSEndpoint == "" {
+			creds.STSEndpoint = secretMap["cosEndpoint"]
+			if provider.Name == constants.ProviderAWS {
+				creds.STSEndpoint = constants.DefaultSTSEndPoint
+			}
+		}
+	default:
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("workload identity of provider %s requires %s", provider.Name, workloadIdentityParam(provider)))
+	}
+	return creds, nil
+}
+
+// workloadIdentityParam returns the secret parameter naming the identity assumed by
+// the volumes of provider mounted with workload identity
+func workloadIdentityParam(provider utils.Provider) string {
+	if provider.IBMExtensions {
+		return "trustedProfileId"
+	}
+	return "roleArn"
+}
+
+func (ns *nodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
 	klog.V(2).Infof("NodeGetVolumeStats: Request: %+v", *req)
 
 	volumeID := req.GetVolumeId()
@@ -188,7 +456,7 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 
 	klog.V(2).Info("NodeGetVolumeStats: Start getting Stats")
 	//  Making direct call to fs library for the sake of simplicity. That way we don't need to initialize VolumeStatsUtils. If there is a need for VolumeStatsUtils to grow bigger then we can use it
-	_, capacity, _, inodes, inodesFree, inodesUsed, err := ns.Stats.FSInfo(volumePath)
+	_, capacity, used, inodes, inodesFree, inodesUsed, err := ns.Stats.FSInfo(volumePath)
 
 	if err != nil {
 		data := map[string]string{"VolumeId": volumeID, "Error": err.Error()}
@@ -201,22 +469,25 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 		}, nil
 	}
 
-	totalCap, err := ns.Stats.GetTotalCapacityFromPV(volumeID)
-	if err != nil {
-		return nil, err
-	}
+	capAsInt64, capUsed := capacity, used
+	if pvName := volumePVName(volumeID, nil, volumePath); pvName == "" {
+		klog.Warningf("NodeGetVolumeStats: Unable to find the PV of volume %s from its path %s, reporting the stats of the mount", volumeID, volumePath)
+	} else {
+		totalCap, err := ns.Stats.GetTotalCapacityFromPV(pvName)
+		if err != nil {
+			return nil, err
+		}
+		if totalCapAsInt64, converted := totalCap.AsInt64(); converted {
+			capAsInt64 = totalCapAsInt64
+		}
 
-	capAsInt64, converted := totalCap.AsInt64()
-	if !converted {
-		capAsInt64 = capacity
+		capUsed, err = ns.volumeUsage(ctx, volumeID, pvName)
+		if err != nil {
+			return nil, err
+		}
 	}
 	klog.Info("NodeGetVolumeStats: Total Capacity of Volume: ", capAsInt64)
 
-	capUsed, err := ns.Stats.GetBucketUsage(volumeID)
-	if err != nil {
-		return nil, err
-	}
-
 	// Since `capAvailable` can be negative and K8s will roundoff from int64 to uint64 resulting in misleading value
 	// capAvailable := capAsInt64 - capUsed
 
@@ -241,6 +512,83 @@ func (ns *nodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 	return resp, nil
 }
 
+// volumeUsage returns the bytes stored in a volume, kept for a while when the node
+// server caches the usage, as kubelet polls it and listing the objects is costly
+func (ns *nodeServer) volumeUsage(ctx context.Context, volumeID, pvName string) (int64, error) {
+	if ns.usage != nil {
+		if used, ok := ns.usage.Get(volumeID); ok {
+			return used, nil
+		}
+	}
+	used, err := ns.getVolumeUsage(ctx, volumeID, pvName)
+	if err == nil && ns.usage != nil {
+		ns.usage.Add(volumeID, used)
+	}
+	return used, err
+}
+
+// getVolumeUsage returns the bytes stored in a volume. The usage of a volume sharing a
+// bucket, or of a volume whose provider does not report the usage of its buckets,
+// is the size of the objects listed with the credentials of the volume.
+func (ns *nodeServer) getVolumeUsage(ctx context.Context, volumeID, pvName string) (int64, error) {
+	info, ok := utils.DecodeVolumeID(volumeID)
+	if !ok || info.Prefix == "" {
+		used, err := ns.Stats.GetBucketUsage(pvName)
+		if !errors.Is(err, utils.ErrUsageUnsupported) {
+			return used, err
+		}
+	}
+
+	volume, err := ns.Stats.GetPVVolume(pvName)
+	if err != nil {
+		return 0, err
+	}
+	creds, err := getCredentials(volume.Secrets)
+	if err != nil {
+		return 0, err
+	}
+	provider, err := getProvider(volume.Secrets, volume.Attributes)
+	if err != nil {
+		return 0, err
+	}
+	bucketName, prefix := volume.Attributes["bucketName"], volume.Attributes["objPath"]
+	if ok {
+		bucketName, prefix = info.BucketName, info.Prefix
+	}
+	endPoint, locationConstraint := volumeLocation(volumeID, volume.Secrets)
+	sess := ns.cosSession.NewObjectStorageSession(provider, endPoint, locationConstraint, creds, ns.Logger)
+
+	objects, err := sess.ListObjects(ctx, bucketName, objectPrefix(prefix))
+	if err != nil {
+		return 0, status.Error(cosErrorCode(err, codes.Internal), fmt.Sprintf("unable to list objects of volume %s: %v", volumeID, err))
+	}
+	var used int64
+	for _, object := range objects {
+		used += object.Size
+	}
+	return used, nil
+}
+
+// volumePVName returns the name of the PV of a volume, which the nodes look up by name
+// rather than watching the PVs. The name is recorded in the volume context by the
+// provisioner run with --extra-create-metadata, and the PVs of plain volume IDs are
+// named after the volume. Otherwise kubelet publishes the volume at
+// <pods dir>/<pod>/volumes/kubernetes.io~csi/<PV>/mount. An empty name is returned
+// when none of them is found.
+func volumePVName(volumeID string, volumeContext map[string]string, volumePath string) string {
+	if pvName := volumeContext[constants.PVNameKey]; pvName != "" {
+		return pvName
+	}
+	if _, ok := utils.DecodeVolumeID(volumeID); !ok {
+		return volumeID
+	}
+	volumeDir := filepath.Dir(filepath.Clean(volumePath))
+	if filepath.Base(volumePath) != "mount" || filepath.Base(filepath.Dir(volumeDir)) != "kubernetes.io~csi" {
+		return ""
+	}
+	return filepath.Base(volumeDir)
+}
+
 func (ns *nodeServer) NodeExpandVolume(_ context.Context, _ *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 	return &csi.NodeExpandVolumeResponse{}, status.Error(codes.Unimplemented, "NodeExpandVolume is not implemented")
 }
@@ -18,12 +18,15 @@ package driver
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/IBM/ibm-object-csi-driver/pkg/mounter"
 	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
 	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/stretchr/testify/assert"
@@ -163,6 +166,44 @@ func TestNodePublishVolume(t *testing.T) {
 				GetBucketNameFromPVFn: func(volumeID string) (string, error) {
 					return bucketName, nil
 				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
+			}),
+			Mounter: &mounter.FakeMounterFactory{
+				Mounter: constants.S3FS,
+			},
+			expectedResp: &csi.NodePublishVolumeResponse{},
+			expectedErr:  nil,
+		},
+		{
+			testCaseName: "Positive: Bucket and location resolved from the volume ID",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				Secrets: map[string]string{
+					"accessKey": "testAccessKey",
+					"secretKey": "testSecretKey",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
 			}),
 			Mounter: &mounter.FakeMounterFactory{
 				Mounter: constants.S3FS,
@@ -305,6 +346,12 @@ func TestNodePublishVolume(t *testing.T) {
 				GetBucketNameFromPVFn: func(volumeID string) (string, error) {
 					return bucketName, nil
 				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
 			}),
 			Mounter: &mounter.FakeMounterFactory{
 				Mounter:       constants.S3FS,
@@ -313,14 +360,200 @@ func TestNodePublishVolume(t *testing.T) {
 			expectedResp: nil,
 			expectedErr:  errors.New("failed to mount s3fs"),
 		},
+		{
+			testCaseName: "Positive: Republished volume already mounted",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				Secrets: map[string]string{
+					"accessKey": "testAccessKey",
+					"secretKey": "testSecretKey",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return true, nil
+				},
+			}),
+			Mounter: &mounter.FakeMounterFactory{
+				Mounter:       constants.S3FS,
+				IsFailedMount: true,
+			},
+			expectedResp: &csi.NodePublishVolumeResponse{},
+			expectedErr:  nil,
+		},
+		{
+			testCaseName: "Negative: Failed to check the mount point",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				Secrets: map[string]string{
+					"accessKey": "testAccessKey",
+					"secretKey": "testSecretKey",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, errors.New("Transport endpoint is not connected")
+				},
+			}),
+			Mounter:      &mounter.FakeMounterFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("Transport endpoint is not connected"),
+		},
+		{
+			testCaseName: "Positive: Client-side encryption",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				VolumeContext: map[string]string{"mounter": constants.RClone, "clientEncryption": "true"},
+				Secrets: map[string]string{
+					"accessKey":     "testAccessKey",
+					"secretKey":     "testSecretKey",
+					"cryptPassword": "testCryptPassword",
+					"cryptSalt":     "testCryptSalt",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
+			}),
+			Mounter: &mounter.FakeMounterFactory{
+				Mounter: constants.RClone,
+			},
+			expectedResp: &csi.NodePublishVolumeResponse{},
+			expectedErr:  nil,
+		},
+		{
+			testCaseName: "Negative: Client-side encryption with s3fs",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				VolumeContext: map[string]string{"mounter": constants.S3FS, "clientEncryption": "true"},
+				Secrets: map[string]string{
+					"accessKey":     "testAccessKey",
+					"secretKey":     "testSecretKey",
+					"cryptPassword": "testCryptPassword",
+					"cryptSalt":     "testCryptSalt",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
+			}),
+			Mounter: &mounter.FakeMounterFactory{
+				Mounter: constants.S3FS,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("client-side encryption requires mounter rclone"),
+		},
+		{
+			testCaseName: "Negative: Client-side encryption keys missing",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				VolumeContext: map[string]string{"mounter": constants.RClone},
+				Secrets: map[string]string{
+					"accessKey":        "testAccessKey",
+					"secretKey":        "testSecretKey",
+					"clientEncryption": "true",
+					"cryptPassword":    "testCryptPassword",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
+			}),
+			Mounter: &mounter.FakeMounterFactory{
+				Mounter: constants.RClone,
+			},
+			expectedResp: nil,
+			expectedErr:  errors.New("client-side encryption requires cryptPassword and cryptSalt in the secret"),
+		},
+		{
+			testCaseName: "Negative: Workload identity disabled",
+			req: &csi.NodePublishVolumeRequest{
+				VolumeId:   testOwnedVolumeID,
+				TargetPath: testTargetPath,
+				VolumeCapability: &csi.VolumeCapability{
+					AccessMode: &csi.VolumeCapability_AccessMode{
+						Mode: volumeCapabilities[0],
+					},
+				},
+				Secrets: map[string]string{
+					"trustedProfileId": "testProfileID",
+				},
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+			}),
+			Mounter:      &mounter.FakeMounterFactory{},
+			expectedResp: nil,
+			expectedErr:  errors.New("workload identity is disabled"),
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
 
 		nodeServer := nodeServer{
-			Stats:   tc.driverStatsUtils,
-			Mounter: tc.Mounter,
+			S3Driver: &S3Driver{name: driverName},
+			Stats:    tc.driverStatsUtils,
+			Mounter:  tc.Mounter,
 		}
 		actualResp, actualErr := nodeServer.NodePublishVolume(ctx, tc.req)
 
@@ -393,6 +626,7 @@ func TestNodeUnpublishVolume(t *testing.T) {
 		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
 
 		nodeServer := nodeServer{
+			S3Driver:     &S3Driver{name: driverName},
 			MounterUtils: tc.mounterUtils,
 		}
 		actualResp, actualErr := nodeServer.NodeUnpublishVolume(ctx, tc.req)
@@ -415,6 +649,7 @@ func TestNodeGetVolumeStats(t *testing.T) {
 		testCaseName     string
 		req              *csi.NodeGetVolumeStatsRequest
 		driverStatsUtils utils.StatsUtils
+		cosSession       s3client.ObjectStorageSessionFactory
 		expectedResp     *csi.NodeGetVolumeStatsResponse
 		expectedErr      error
 	}{
@@ -452,6 +687,78 @@ func TestNodeGetVolumeStats(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			testCaseName: "Positive: Usage of a volume sharing a bucket scoped to its prefix",
+			req: &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   testPrefixVolumeID,
+				VolumePath: testKubeletTargetPath,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				FSInfoFn: func(path string) (int64, int64, int64, int64, int64, int64, error) {
+					return 1, 1, 1, 1, 1, 1, nil
+				},
+				GetTotalCapacityFromPVFn: func(pvName string) (resource.Quantity, error) {
+					if pvName != testPVName {
+						return resource.Quantity{}, fmt.Errorf("pv %s not found", pvName)
+					}
+					return resource.Quantity{}, nil
+				},
+				GetPVVolumeFn: func(pvName string) (*utils.DriverVolume, error) {
+					if pvName != testPVName {
+						return nil, fmt.Errorf("pv %s not found", pvName)
+					}
+					return &utils.DriverVolume{VolumeID: testPrefixVolumeID, Secrets: testSecret}, nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects: map[string][]s3client.ObjectInfo{
+					"shared-bucket": {{Key: "ns/claim/a", Size: 3}, {Key: "ns/claim/b", Size: 4}},
+				},
+			},
+			expectedResp: &csi.NodeGetVolumeStatsResponse{
+				Usage: []*csi.VolumeUsage{
+					{
+						Used: 7,
+						Unit: csi.VolumeUsage_BYTES,
+					},
+					{
+						Available: 1,
+						Total:     1,
+						Used:      1,
+						Unit:      csi.VolumeUsage_INODES,
+					},
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			testCaseName: "Positive: Stats of the mount when the PV is not found from the volume path",
+			req: &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   testPrefixVolumeID,
+				VolumePath: testTargetPath,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				FSInfoFn: func(path string) (int64, int64, int64, int64, int64, int64, error) {
+					return 1, 8, 3, 1, 1, 1, nil
+				},
+			}),
+			expectedResp: &csi.NodeGetVolumeStatsResponse{
+				Usage: []*csi.VolumeUsage{
+					{
+						Total: 8,
+						Used:  3,
+						Unit:  csi.VolumeUsage_BYTES,
+					},
+					{
+						Available: 1,
+						Total:     1,
+						Used:      1,
+						Unit:      csi.VolumeUsage_INODES,
+					},
+				},
+			},
+			expectedErr: nil,
+		},
 		{
 			testCaseName: "Negative: Volume ID is missing",
 			req:          &csi.NodeGetVolumeStatsRequest{},
@@ -485,6 +792,51 @@ func TestNodeGetVolumeStats(t *testing.T) {
 			},
 			expectedErr: nil,
 		},
+		{
+			testCaseName: "Positive: Usage of a bucket whose provider has no usage API summed from its objects",
+			req: &csi.NodeGetVolumeStatsRequest{
+				VolumeId:   testVolumeID,
+				VolumePath: testTargetPath,
+			},
+			driverStatsUtils: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				FSInfoFn: func(path string) (int64, int64, int64, int64, int64, int64, error) {
+					return 1, 1, 1, 1, 1, 1, nil
+				},
+				GetTotalCapacityFromPVFn: func(volumeID string) (resource.Quantity, error) {
+					return resource.Quantity{}, nil
+				},
+				GetBucketUsageFn: func(volumeID string) (int64, error) {
+					return 0, fmt.Errorf("%w: %s", utils.ErrUsageUnsupported, constants.ProviderMinIO)
+				},
+				GetPVVolumeFn: func(pvName string) (*utils.DriverVolume, error) {
+					return &utils.DriverVolume{
+						VolumeID:   pvName,
+						Secrets:    testSecret,
+						Attributes: map[string]string{"bucketName": "minio-bucket", "provider": constants.ProviderMinIO},
+					}, nil
+				},
+			}),
+			cosSession: &s3client.FakeCOSSessionFactory{
+				Objects: map[string][]s3client.ObjectInfo{
+					"minio-bucket": {{Key: "a", Size: 5}, {Key: "b", Size: 6}},
+				},
+			},
+			expectedResp: &csi.NodeGetVolumeStatsResponse{
+				Usage: []*csi.VolumeUsage{
+					{
+						Used: 11,
+						Unit: csi.VolumeUsage_BYTES,
+					},
+					{
+						Available: 1,
+						Total:     1,
+						Used:      1,
+						Unit:      csi.VolumeUsage_INODES,
+					},
+				},
+			},
+			expectedErr: nil,
+		},
 		{
 			testCaseName: "Negative: Failed to get total PV storage",
 			req: &csi.NodeGetVolumeStatsRequest{
@@ -528,7 +880,8 @@ func TestNodeGetVolumeStats(t *testing.T) {
 		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
 
 		nodeServer := nodeServer{
-			Stats: tc.driverStatsUtils,
+			Stats:      tc.driverStatsUtils,
+			cosSession: tc.cosSession,
 		}
 		actualResp, actualErr := nodeServer.NodeGetVolumeStats(ctx, tc.req)
 
@@ -545,6 +898,86 @@ func TestNodeGetVolumeStats(t *testing.T) {
 	}
 }
 
+func TestNodeGetVolumeStatsCachedUsage(t *testing.T) {
+	used, computed := int64(5), 0
+	nodeServer := nodeServer{
+		Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+			FSInfoFn: func(path string) (int64, int64, int64, int64, int64, int64, error) {
+				return 1, 1, 1, 1, 1, 1, nil
+			},
+			GetTotalCapacityFromPVFn: func(pvName string) (resource.Quantity, error) {
+				return resource.Quantity{}, nil
+			},
+			GetBucketUsageFn: func(pvName string) (int64, error) {
+				computed++
+				return used, nil
+			},
+		}),
+		usage: utils.NewCache[int64](volumeUsageCacheSize, time.Hour),
+	}
+	req := &csi.NodeGetVolumeStatsRequest{VolumeId: testVolumeID, VolumePath: testTargetPath}
+
+	resp, err := nodeServer.NodeGetVolumeStats(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), resp.Usage[0].Used)
+
+	// The usage is reported from the cache until it expires
+	used = 7
+	resp, err = nodeServer.NodeGetVolumeStats(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), resp.Usage[0].Used)
+	assert.Equal(t, 1, computed)
+
+	// The usage of a volume is computed at each call without cache
+	nodeServer.usage = nil
+	resp, err = nodeServer.NodeGetVolumeStats(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), resp.Usage[0].Used)
+	assert.Equal(t, 2, computed)
+}
+
+func TestVolumePVName(t *testing.T) {
+	testCases := []struct {
+		testCaseName  string
+		volumeID      string
+		volumeContext map[string]string
+		volumePath    string
+		expectedName  string
+	}{
+		{
+			testCaseName:  "Positive: PV name in the volume context",
+			volumeID:      testPrefixVolumeID,
+			volumeContext: map[string]string{constants.PVNameKey: "pv-from-context"},
+			volumePath:    testKubeletTargetPath,
+			expectedName:  "pv-from-context",
+		},
+		{
+			testCaseName: "Positive: PV named after a plain volume ID",
+			volumeID:     testVolumeID,
+			volumePath:   testTargetPath,
+			expectedName: testVolumeID,
+		},
+		{
+			testCaseName: "Positive: PV name in the kubelet target path",
+			volumeID:     testPrefixVolumeID,
+			volumePath:   testKubeletTargetPath,
+			expectedName: testPVName,
+		},
+		{
+			testCaseName: "Negative: PV name not found",
+			volumeID:     testPrefixVolumeID,
+			volumePath:   testTargetPath,
+			expectedName: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", zap.String("testcase", tc.testCaseName))
+
+		assert.Equal(t, tc.expectedName, volumePVName(tc.volumeID, tc.volumeContext, tc.volumePath))
+	}
+}
+
 func TestNodeExpandVolume(t *testing.T) {
 	t.Run("UnImplemented Method", func(t *testing.T) {
 		nodeServer := nodeServer{}
@@ -0,0 +1,62 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+)
+
+// lockKind is the kind of resource an operation works on. The keys of the different
+// kinds never conflict, a volume name could otherwise be taken for a snapshot.
+type lockKind string
+
+const (
+	volumeNameLock lockKind = "volume name"
+	volumeIDLock   lockKind = "volume"
+	snapshotLock   lockKind = "snapshot"
+	targetPathLock lockKind = "target path"
+)
+
+// operationLocks tracks the operations in flight, keyed by the kind and the name of
+// the resource they work on. A call conflicting with an operation in flight is
+// rejected with Aborted, for the sidecars to retry it once the operation is over.
+type operationLocks struct {
+	mutex sync.Mutex
+	keys  map[string]struct{}
+}
+
+// acquire marks an operation on the resource of the given kind and name as in
+// flight, and returns the function ending it. Aborted is returned when an operation
+// on the resource is already in flight.
+func (l *operationLocks) acquire(kind lockKind, name string) (func(), error) {
+	key := string(kind) + ":" + name
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, ok := l.keys[key]; ok {
+		klog.Warningf("An operation on %s %s is already in progress", kind, name)
+		return nil, status.Error(codes.Aborted, fmt.Sprintf("an operation on %s %s is already in progress", kind, name))
+	}
+	if l.keys == nil {
+		l.keys = map[string]struct{}{}
+	}
+	l.keys[key] = struct{}{}
+
+	return func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		delete(l.keys, key)
+	}, nil
+}
@@ -0,0 +1,144 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestOperationLocks(t *testing.T) {
+	locks := &operationLocks{}
+
+	release, err := locks.acquire(volumeIDLock, testVolumeID)
+	assert.NoError(t, err)
+	_, err = locks.acquire(volumeIDLock, testVolumeID)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Contains(t, err.Error(), "an operation on volume "+testVolumeID+" is already in progress")
+
+	releaseOther, err := locks.acquire(targetPathLock, testTargetPath)
+	assert.NoError(t, err)
+	releaseOther()
+
+	// The same name of another kind does not conflict
+	releaseOther, err = locks.acquire(volumeNameLock, testVolumeID)
+	assert.NoError(t, err)
+	releaseOther()
+
+	release()
+	release, err = locks.acquire(volumeIDLock, testVolumeID)
+	assert.NoError(t, err)
+	release()
+}
+
+func TestOperationLocksConcurrent(t *testing.T) {
+	locks := &operationLocks{}
+	start := make(chan struct{})
+	var acquired, aborted atomic.Int32
+	var releases sync.WaitGroup
+	var wg sync.WaitGroup
+	releases.Add(1)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			release, err := locks.acquire(volumeIDLock, testVolumeID)
+			if err != nil {
+				aborted.Add(1)
+				return
+			}
+			acquired.Add(1)
+			// The lock is held until every call went through
+			releases.Wait()
+			release()
+		}()
+	}
+	close(start)
+
+	assert.Eventually(t, func() bool { return acquired.Load()+aborted.Load() == 50 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), acquired.Load())
+	releases.Done()
+	wg.Wait()
+	assert.Empty(t, locks.keys)
+}
+
+func TestConflictingVolumeOperations(t *testing.T) {
+	defer func(wait time.Duration) { deleteJobWait = wait }(deleteJobWait)
+	deleteJobWait = 5 * time.Second
+
+	cosSession := &s3client.FakeCOSSessionFactory{DeletionBlocked: make(chan struct{})}
+	cs := &controllerServer{
+		S3Driver:   &S3Driver{name: driverName},
+		Stats:      utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{}),
+		cosSession: cosSession,
+	}
+	req := &csi.DeleteVolumeRequest{VolumeId: testOwnedVolumeID, Secrets: testSecret}
+
+	done := make(chan error)
+	go func() {
+		_, err := cs.DeleteVolume(ctx, req)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		cs.locks.mutex.Lock()
+		defer cs.locks.mutex.Unlock()
+		_, ok := cs.locks.keys[string(volumeIDLock)+":"+testOwnedVolumeID]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	_, err := cs.DeleteVolume(ctx, req)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	assert.Contains(t, err.Error(), "already in progress")
+	_, err = cs.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{
+		VolumeId:      testOwnedVolumeID,
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1024},
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	close(cosSession.DeletionBlocked)
+	assert.NoError(t, <-done)
+	_, err = cs.DeleteVolume(ctx, req)
+	assert.NoError(t, err)
+}
+
+func TestConflictingTargetPathOperations(t *testing.T) {
+	driver := &S3Driver{name: driverName}
+	ns := &nodeServer{S3Driver: driver}
+
+	release, err := driver.locks.acquire(targetPathLock, testTargetPath)
+	assert.NoError(t, err)
+
+	_, err = ns.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{VolumeId: testVolumeID, TargetPath: testTargetPath})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	_, err = ns.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: testVolumeID, TargetPath: testTargetPath})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	release()
+
+	// Another target path of the volume is not affected
+	_, err = ns.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{VolumeId: testVolumeID, TargetPath: testTargetPath + "-2"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
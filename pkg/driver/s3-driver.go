@@ -11,7 +11,11 @@
 package driver
 
 import (
+	"context"
 	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/IBM/ibm-csi-common/pkg/utils"
 	"github.com/IBM/ibm-object-csi-driver/pkg/mounter"
@@ -31,6 +35,15 @@ var (
 	// controllerCapabilities represents the capability of controller service
 	controllerCapabilities = []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+		csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+		csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
 	}
 
 	// nodeServerCapabilities represents the capability of node service.
@@ -53,6 +66,21 @@ type S3Driver struct {
 	ns  *nodeServer
 	cs  *controllerServer
 
+	// orphanCollectorOpts configures the collection of the orphaned buckets in controller mode
+	orphanCollectorOpts OrphanCollectorOptions
+	// workloadIdentityAddress is the address serving the credentials of workload
+	// identity in node mode, it is disabled when empty. The keys of the mounts are
+	// stored in workloadIdentityDir.
+	workloadIdentityAddress string
+	workloadIdentityDir     string
+	// volumeUsageTTL is how long the node server reports the usage of a volume before
+	// computing it again, it is computed at each call when zero
+	volumeUsageTTL time.Duration
+
+	// locks rejects the calls conflicting with an operation in flight, on the
+	// controller and node servers alike
+	locks operationLocks
+
 	logger *zap.Logger
 	vcap   []*csi.VolumeCapability_AccessMode
 	cscap  []*csi.ControllerServiceCapability
@@ -121,21 +149,30 @@ func newIdentityServer(d *S3Driver) *identityServer {
 }
 
 func newControllerServer(d *S3Driver, statsUtil pkgUtils.StatsUtils, s3cosSession s3client.ObjectStorageSessionFactory, logger *zap.Logger) *controllerServer {
+	// The cluster ID only tags the buckets created by the driver, it is left out when unknown
+	clusterID, err := statsUtil.GetClusterID()
+	if err != nil {
+		logger.Warn("Unable to get the cluster ID", zap.Error(err))
+	}
 	return &controllerServer{
 		S3Driver:   d,
 		Stats:      statsUtil,
 		cosSession: s3cosSession,
 		Logger:     logger,
+		clusterID:  clusterID,
 	}
 }
 
-func newNodeServer(d *S3Driver, statsUtil pkgUtils.StatsUtils, nodeID string, mountObj mounter.NewMounterFactory, mounterUtil mounterUtils.MounterUtils) *nodeServer {
+func newNodeServer(d *S3Driver, statsUtil pkgUtils.StatsUtils, nodeID string, mountObj mounter.NewMounterFactory, mounterUtil mounterUtils.MounterUtils,
+	s3cosSession s3client.ObjectStorageSessionFactory, logger *zap.Logger) *nodeServer {
 	return &nodeServer{
 		S3Driver:     d,
 		Stats:        statsUtil,
 		NodeID:       nodeID,
 		Mounter:      mountObj,
 		MounterUtils: mounterUtil,
+		cosSession:   s3cosSession,
+		Logger:       logger,
 	}
 }
 
@@ -157,22 +194,71 @@ func (driver *S3Driver) NewS3CosDriver(nodeID string, endpoint string, s3cosSess
 	if driver.mode == "controller" {
 		driver.cs = newControllerServer(driver, statsUtil, s3cosSession, driver.logger)
 	} else if driver.mode == "node" {
-		driver.ns = newNodeServer(driver, statsUtil, nodeID, mountObj, mounterUtil)
+		driver.ns = newNodeServer(driver, statsUtil, nodeID, mountObj, mounterUtil, s3cosSession, driver.logger)
 	} else if driver.mode == "controller-node" {
 		driver.cs = newControllerServer(driver, statsUtil, s3cosSession, driver.logger)
-		driver.ns = newNodeServer(driver, statsUtil, nodeID, mountObj, mounterUtil)
+		driver.ns = newNodeServer(driver, statsUtil, nodeID, mountObj, mounterUtil, s3cosSession, driver.logger)
 	}
 
 	return driver, nil
 }
 
+// EnableOrphanCollector collects the orphaned buckets alongside the controller
+// server, at the interval of the options
+func (driver *S3Driver) EnableOrphanCollector(opts OrphanCollectorOptions) {
+	driver.orphanCollectorOpts = opts
+}
+
+// EnableWorkloadIdentity serves the credentials of the volumes mounted with workload
+// identity on address, alongside the node server, the keys of the mounts being
+// stored in dir
+func (driver *S3Driver) EnableWorkloadIdentity(address, dir string) {
+	driver.workloadIdentityAddress = address
+	driver.workloadIdentityDir = dir
+}
+
+// EnableVolumeUsageCache has the node server keep the usage of the volumes for ttl,
+// rather than listing their objects at each NodeGetVolumeStats call
+func (driver *S3Driver) EnableVolumeUsageCache(ttl time.Duration) {
+	driver.volumeUsageTTL = ttl
+}
+
 func (driver *S3Driver) Run() {
 	driver.logger.Info("--S3CSIDriver Run--")
 	driver.logger.Info("Driver:", zap.Reflect("Driver Name", driver.name))
 	driver.logger.Info("Version:", zap.Reflect("Driver Version", driver.version))
 	// Initialize default library driver
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if driver.cs != nil && driver.orphanCollectorOpts.Interval > 0 {
+		newOrphanCollector(driver.cs, driver.orphanCollectorOpts).start(ctx)
+	}
+
+	if driver.ns != nil && driver.workloadIdentityAddress != "" {
+		workload := newWorkloadIdentity(driver.ns.cosSession, driver.workloadIdentityDir)
+		if err := workload.start(driver.workloadIdentityAddress); err != nil {
+			driver.logger.Fatal("Failed to serve the credentials of workload identity", zap.Error(err))
+		}
+		driver.ns.workload = workload
+	}
+	if driver.ns != nil && driver.volumeUsageTTL > 0 {
+		driver.ns.usage = pkgUtils.NewCache[int64](volumeUsageCacheSize, driver.volumeUsageTTL)
+	}
+
 	grpcServer := NewNonBlockingGRPCServer(driver.mode, driver.logger)
 	grpcServer.Start(driver.endpoint, driver.ids, driver.cs, driver.ns)
+	go func() {
+		<-ctx.Done()
+		driver.logger.Info("Stopping the driver")
+		// The deletions and copies running in the background are stopped first, for
+		// the calls waiting on them to return
+		if driver.cs != nil {
+			driver.cs.deleteJobs.removeAll()
+			driver.cs.copyJobs.removeAll()
+		}
+		grpcServer.Stop()
+	}()
 	grpcServer.Wait()
 }
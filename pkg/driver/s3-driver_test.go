@@ -112,7 +112,9 @@ func TestNewS3CosDriver(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, driver)
 
-	statsUtil := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{})
+	statsUtil := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+		GetClusterIDFn: func() (string, error) { return "test-cluster-id", nil },
+	})
 	mounterUtil := mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{})
 
 	csiDriver, err := driver.NewS3CosDriver(nodeID, endpoint, fakeCosSession, fakeMountObj, statsUtil, mounterUtil)
@@ -138,7 +140,9 @@ func TestNewS3CosDriver_mode_node(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, driver)
 
-	statsUtil := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{})
+	statsUtil := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+		GetClusterIDFn: func() (string, error) { return "test-cluster-id", nil },
+	})
 	mounterUtil := mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{})
 
 	csiDriver, err := driver.NewS3CosDriver(nodeID, endpoint, fakeCosSession, fakeMountObj, statsUtil, mounterUtil)
@@ -164,7 +168,9 @@ func TestNewS3CosDriver_mode_controller_node(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, driver)
 
-	statsUtil := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{})
+	statsUtil := utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+		GetClusterIDFn: func() (string, error) { return "test-cluster-id", nil },
+	})
 	mounterUtil := mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{})
 
 	csiDriver, err := driver.NewS3CosDriver(nodeID, endpoint, fakeCosSession, fakeMountObj, statsUtil, mounterUtil)
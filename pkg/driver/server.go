@@ -133,6 +133,7 @@ func (s *nonBlockingGRPCServer) Setup(endpoint string, ids csi.IdentityServer, c
 
 // serve ...
 func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
+	defer s.wg.Done()
 	s.logger.Info("nonBlockingGRPCServer-server", zap.Reflect("Endpoint", endpoint))
 	//! Setup
 	listener, err := s.Setup(endpoint, ids, cs, ns)
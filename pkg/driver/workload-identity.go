@@ -0,0 +1,292 @@
+/*******************************************************************************
+ * IBM Confidential
+ * OCO Source Materials
+ * IBM Cloud Kubernetes Service, 5737-D43
+ * (C) Copyright IBM Corp. 2023 All Rights Reserved.
+ * The source code for this program is not published or otherwise divested of
+ * its trade secrets, irrespective of what has been deposited with
+ * the U.S. Copyright Office.
+ ******************************************************************************/
+
+package driver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// workloadTokenPath serves IAM tokens to s3fs, as the token endpoint of IBM IAM
+	workloadTokenPath = "/identity/token"
+	// workloadCredentialsPath serves temporary credentials to rclone, as an endpoint
+	// of AWS container credentials
+	workloadCredentialsPath = "/credentials"
+	// secretCredentialsTTL is how long rclone uses the keys of a secret before it
+	// fetches them again, and picks up their rotation
+	secretCredentialsTTL = 5 * time.Minute
+)
+
+var credentialRotationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ibm_object_csi",
+	Name:      "mount_credential_rotations_total",
+	Help:      "Number of credential changes found on the republished volumes, by mounter and whether the mount picked them up live or reads them once remounted",
+}, []string{"mounter", "result"})
+
+func init() {
+	prometheus.MustRegister(credentialRotationsTotal)
+}
+
+// workloadIdentity serves the credentials of the volumes mounted with workload
+// identity to their FUSE process, on a loopback address of the node server. Neither
+// s3fs nor rclone can exchange a service account token, so s3fs is pointed at an IAM
+// token endpoint and rclone at an endpoint of container credentials served here.
+// Each mount authenticates with a random key, and its credentials are exchanged on
+// demand for the latest service account token of the pod, which kubelet renews by
+// republishing the volume.
+//
+// The volumes mounted with the keys of their secret are served the same way when
+// their mounter can fetch them, for the keys rotated in the secret to be picked up
+// by the running mounts once the volume is republished: the IAM tokens of the API
+// key to s3fs, and the HMAC keys to rclone. The keys of the mounts are stored in
+// dir, for a restarted node server to authenticate the running mounts again.
+type workloadIdentity struct {
+	cosSession s3client.ObjectStorageSessionFactory
+	// url is the base URL of the endpoints, once started
+	url string
+	dir string
+
+	mutex sync.Mutex
+	// mounts holds the credentials of the mounts, keyed by their key
+	mounts map[string]*workloadMount
+	// keys holds the key of each target path
+	keys map[string]string
+}
+
+type workloadMount struct {
+	creds s3client.ObjectStorageCredentials
+}
+
+func newWorkloadIdentity(cosSession s3client.ObjectStorageSessionFactory, dir string) *workloadIdentity {
+	return &workloadIdentity{
+		cosSession: cosSession,
+		dir:        dir,
+		mounts:     map[string]*workloadMount{},
+		keys:       map[string]string{},
+	}
+}
+
+// start serves the credentials on address, which should be a loopback address
+func (w *workloadIdentity) start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	w.url = "http://" + listener.Addr().String()
+	server := &http.Server{Handler: w, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := server.Serve(listener)
+		klog.Errorf("Workload identity endpoint stopped: %v", err)
+	}()
+	klog.Infof("Serving the credentials of workload identity on %s", w.url)
+	return nil
+}
+
+// register serves the credentials of the mount at targetPath, and returns the key
+// authenticating it. A republished mount keeps its key, with its credentials and
+// service account token updated, and rotated tells whether the credentials changed
+// other than by the renewal of the token.
+func (w *workloadIdentity) register(targetPath string, creds s3client.ObjectStorageCredentials) (key string, rotated bool, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	key, ok := w.keys[targetPath]
+	if ok {
+		previous, renewed := w.mounts[key].creds, creds
+		previous.ServiceAccountToken, renewed.ServiceAccountToken = "", ""
+		rotated = previous != renewed
+	} else {
+		if key, err = w.loadKey(targetPath); err != nil {
+			return "", false, err
+		}
+		w.keys[targetPath] = key
+	}
+	w.mounts[key] = &workloadMount{creds: creds}
+	return key, rotated, nil
+}
+
+// unregister stops serving the credentials of the mount at targetPath
+func (w *workloadIdentity) unregister(targetPath string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if key, ok := w.keys[targetPath]; ok {
+		delete(w.mounts, key)
+		delete(w.keys, targetPath)
+	}
+	if w.dir != "" {
+		if err := os.Remove(w.keyFile(targetPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			klog.Warningf("Unable to remove the key of the mount at %s: %v", targetPath, err)
+		}
+	}
+}
+
+// keyFile returns the file storing the key of the mount at targetPath
+func (w *workloadIdentity) keyFile(targetPath string) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%x", sha256.Sum256([]byte(targetPath))))
+}
+
+// loadKey returns the key stored for the mount at targetPath, the one its FUSE
+// process authenticates with, or a new key stored for the next runs
+func (w *workloadIdentity) loadKey(targetPath string) (string, error) {
+	if w.dir != "" {
+		b, err := os.ReadFile(w.keyFile(targetPath))
+		if err == nil && len(b) > 0 {
+			return string(b), nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("unable to read the key of %s: %w", targetPath, err)
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate the key of %s: %w", targetPath, err)
+	}
+	key := hex.EncodeToString(b)
+	if w.dir != "" {
+		if err := os.MkdirAll(w.dir, 0700); err != nil {
+			return "", fmt.Errorf("unable to store the key of %s: %w", targetPath, err)
+		}
+		if err := os.WriteFile(w.keyFile(targetPath), []byte(key), 0600); err != nil {
+			return "", fmt.Errorf("unable to store the key of %s: %w", targetPath, err)
+		}
+	}
+	return key, nil
+}
+
+// mount returns a copy of the mount authenticated by key
+func (w *workloadIdentity) mount(key string) (workloadMount, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for k, m := range w.mounts {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return *m, true
+		}
+	}
+	return workloadMount{}, false
+}
+
+func (w *workloadIdentity) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == workloadTokenPath && r.Method == http.MethodPost:
+		w.serveToken(rw, r)
+	case r.URL.Path == workloadCredentialsPath && r.Method == http.MethodGet:
+		w.serveCredentials(rw, r)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+// serveToken exchanges the service account token of the mount for an IAM token of
+// its trusted profile, or its API key for an IAM token. s3fs sends the key of the
+// mount as its API key.
+func (w *workloadIdentity) serveToken(rw http.ResponseWriter, r *http.Request) {
+	m, ok := w.mount(r.PostFormValue("apikey"))
+	var tok *token.Token
+	var err error
+	switch {
+	case ok && m.creds.TrustedProfileID != "":
+		tok, err = w.cosSession.TrustedProfileToken(r.Context(), &m.creds)
+	case ok && m.creds.APIKey != "":
+		tok, err = w.cosSession.APIKeyToken(r.Context(), &m.creds)
+	default:
+		http.Error(rw, "unknown key", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		klog.Errorf("Unable to get an IAM token: %v", err)
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(rw, tok)
+}
+
+// serveCredentials exchanges the service account token of the mount for temporary
+// credentials of its role, or returns the HMAC keys of its secret, to be fetched
+// again once expired. rclone sends the key of the mount as authorization.
+func (w *workloadIdentity) serveCredentials(rw http.ResponseWriter, r *http.Request) {
+	m, ok := w.mount(r.Header.Get("Authorization"))
+	var creds *s3client.TemporaryCredentials
+	var err error
+	switch {
+	case ok && m.creds.RoleARN != "":
+		creds, err = w.cosSession.AssumeRoleWithWebIdentity(r.Context(), &m.creds)
+	case ok && m.creds.AccessKey != "":
+		creds = &s3client.TemporaryCredentials{
+			AccessKey:  m.creds.AccessKey,
+			SecretKey:  m.creds.SecretKey,
+			Expiration: time.Now().Add(secretCredentialsTTL),
+		}
+	default:
+		http.Error(rw, "unknown key", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		klog.Errorf("Unable to assume role %s: %v", m.creds.RoleARN, err)
+		http.Error(rw, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(rw, struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string `json:",omitempty"`
+		Expiration      string
+	}{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		Token:           creds.SessionToken,
+		Expiration:      creds.Expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		klog.Errorf("Unable to write the credentials of workload identity: %v", err)
+	}
+}
+
+// serviceAccountToken returns the service account token of audience, among those
+// kubelet passes in the volume context of NodePublishVolume
+func serviceAccountToken(attrib map[string]string, audience string) (string, error) {
+	tokens := attrib[constants.ServiceAccountTokensKey]
+	if tokens == "" {
+		return "", fmt.Errorf("no service account token given by kubelet, tokenRequests of the CSIDriver must include audience %q", audience)
+	}
+	var byAudience map[string]struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(tokens), &byAudience); err != nil {
+		return "", fmt.Errorf("invalid service account tokens: %w", err)
+	}
+	if byAudience[audience].Token == "" {
+		return "", fmt.Errorf("no service account token of audience %q, tokenRequests of the CSIDriver must include it", audience)
+	}
+	return byAudience[audience].Token, nil
+}
@@ -0,0 +1,524 @@
+/**
+ * Copyright 2024 IBM Corp.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package driver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/mounter"
+	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func postToken(w *workloadIdentity, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, workloadTokenPath, strings.NewReader(url.Values{"apikey": {key}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	return rec
+}
+
+func getTemporaryCredentials(w *workloadIdentity, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, workloadCredentialsPath, nil)
+	req.Header.Set("Authorization", key)
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWorkloadIdentityToken(t *testing.T) {
+	cosSession := &s3client.FakeCOSSessionFactory{}
+	w := newWorkloadIdentity(cosSession, "")
+	key, rotated, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{TrustedProfileID: "testProfileID", ServiceAccountToken: "sa-1"})
+	assert.NoError(t, err)
+	assert.False(t, rotated)
+
+	rec := postToken(w, key)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Expiration  int64  `json:"expiration"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tok))
+	assert.Equal(t, "iam-token-sa-1", tok.AccessToken)
+	assert.NotZero(t, tok.Expiration)
+
+	// A republished mount keeps its key, and exchanges its latest token
+	republished, rotated, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{TrustedProfileID: "testProfileID", ServiceAccountToken: "sa-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, key, republished)
+	assert.False(t, rotated)
+	assert.NoError(t, json.Unmarshal(postToken(w, key).Body.Bytes(), &tok))
+	assert.Equal(t, "iam-token-sa-2", tok.AccessToken)
+
+	// The trusted profile changed in the secret is assumed once republished
+	_, rotated, err = w.register(testTargetPath, s3client.ObjectStorageCredentials{TrustedProfileID: "otherProfileID", ServiceAccountToken: "sa-3"})
+	assert.NoError(t, err)
+	assert.True(t, rotated)
+	assert.NoError(t, json.Unmarshal(postToken(w, key).Body.Bytes(), &tok))
+	assert.Equal(t, "iam-token-sa-3", tok.AccessToken)
+
+	assert.Equal(t, http.StatusUnauthorized, postToken(w, "unknown").Code)
+	// The credentials of IAM are not served as container credentials
+	assert.Equal(t, http.StatusUnauthorized, getTemporaryCredentials(w, key).Code)
+
+	cosSession.FailTokenExchange = true
+	assert.Equal(t, http.StatusBadGateway, postToken(w, key).Code)
+
+	w.unregister(testTargetPath)
+	assert.Equal(t, http.StatusUnauthorized, postToken(w, key).Code)
+	assert.Empty(t, w.keys)
+}
+
+func TestWorkloadIdentityAPIKeyToken(t *testing.T) {
+	w := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, "")
+	key, _, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{APIKey: "api-key-1", IAMEndpoint: constants.DefaultIAMEndPoint})
+	assert.NoError(t, err)
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	rec := postToken(w, key)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tok))
+	assert.Equal(t, "iam-token-api-key-1", tok.AccessToken)
+
+	// The running mount gets the tokens of the API key rotated in the secret
+	republished, rotated, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{APIKey: "api-key-2", IAMEndpoint: constants.DefaultIAMEndPoint})
+	assert.NoError(t, err)
+	assert.True(t, rotated)
+	assert.Equal(t, key, republished)
+	assert.NoError(t, json.Unmarshal(postToken(w, key).Body.Bytes(), &tok))
+	assert.Equal(t, "iam-token-api-key-2", tok.AccessToken)
+}
+
+func TestWorkloadIdentityCredentials(t *testing.T) {
+	w := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, "")
+	key, _, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{RoleARN: "testRoleARN", ServiceAccountToken: "sa-1"})
+	assert.NoError(t, err)
+	other, _, err := w.register(testTargetPath+"-2", s3client.ObjectStorageCredentials{RoleARN: "testRoleARN", ServiceAccountToken: "sa-2"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	rec := getTemporaryCredentials(w, key)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var creds map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &creds))
+	assert.Equal(t, "temporary-access-key", creds["AccessKeyId"])
+	assert.Equal(t, "temporary-secret-key", creds["SecretAccessKey"])
+	assert.Equal(t, "session-token-sa-1", creds["Token"])
+	assert.NotEmpty(t, creds["Expiration"])
+	assert.NoError(t, json.Unmarshal(getTemporaryCredentials(w, other).Body.Bytes(), &creds))
+	assert.Equal(t, "session-token-sa-2", creds["Token"])
+
+	assert.Equal(t, http.StatusUnauthorized, getTemporaryCredentials(w, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, postToken(w, key).Code)
+}
+
+func TestWorkloadIdentitySecretKeys(t *testing.T) {
+	w := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, "")
+	key, _, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{AccessKey: "access-key-1", SecretKey: "secret-key-1"})
+	assert.NoError(t, err)
+
+	rec := getTemporaryCredentials(w, key)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var creds map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &creds))
+	assert.Equal(t, "access-key-1", creds["AccessKeyId"])
+	assert.Equal(t, "secret-key-1", creds["SecretAccessKey"])
+	assert.NotContains(t, creds, "Token")
+	// rclone fetches the keys again once they expire
+	expiration, err := time.Parse(time.RFC3339, creds["Expiration"])
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(secretCredentialsTTL), expiration, time.Minute)
+
+	_, rotated, err := w.register(testTargetPath, s3client.ObjectStorageCredentials{AccessKey: "access-key-2", SecretKey: "secret-key-2"})
+	assert.NoError(t, err)
+	assert.True(t, rotated)
+	assert.NoError(t, json.Unmarshal(getTemporaryCredentials(w, key).Body.Bytes(), &creds))
+	assert.Equal(t, "access-key-2", creds["AccessKeyId"])
+	assert.Equal(t, "secret-key-2", creds["SecretAccessKey"])
+
+	// The keys are not exchanged for IAM tokens
+	assert.Equal(t, http.StatusUnauthorized, postToken(w, key).Code)
+}
+
+func TestWorkloadIdentityStoredKeys(t *testing.T) {
+	dir := t.TempDir()
+	c := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, dir)
+	key, _, err := c.register(testTargetPath, s3client.ObjectStorageCredentials{TrustedProfileID: "testProfileID", ServiceAccountToken: "sa-1"})
+	assert.NoError(t, err)
+	info, err := os.Stat(c.keyFile(testTargetPath))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A restarted node server registers the key the running mount authenticates with
+	restarted := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, dir)
+	republished, rotated, err := restarted.register(testTargetPath, s3client.ObjectStorageCredentials{TrustedProfileID: "testProfileID", ServiceAccountToken: "sa-2"})
+	assert.NoError(t, err)
+	assert.False(t, rotated)
+	assert.Equal(t, key, republished)
+	assert.Equal(t, http.StatusOK, postToken(restarted, key).Code)
+
+	other, _, err := restarted.register(testTargetPath+"-2", s3client.ObjectStorageCredentials{TrustedProfileID: "testProfileID"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	restarted.unregister(testTargetPath)
+	_, err = os.Stat(restarted.keyFile(testTargetPath))
+	assert.True(t, os.IsNotExist(err))
+	fresh, _, err := restarted.register(testTargetPath, s3client.ObjectStorageCredentials{TrustedProfileID: "testProfileID"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, fresh)
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	attrib := map[string]string{
+		constants.ServiceAccountTokensKey: `{"iam":{"token":"iam-sa-token","expirationTimestamp":"2024-01-01T00:00:00Z"}}`,
+	}
+	token, err := serviceAccountToken(attrib, constants.IAMTokenAudience)
+	assert.NoError(t, err)
+	assert.Equal(t, "iam-sa-token", token)
+
+	_, err = serviceAccountToken(attrib, constants.STSTokenAudience)
+	assert.ErrorContains(t, err, `no service account token of audience "sts.amazonaws.com"`)
+	_, err = serviceAccountToken(map[string]string{}, constants.IAMTokenAudience)
+	assert.ErrorContains(t, err, "no service account token given by kubelet")
+	_, err = serviceAccountToken(map[string]string{constants.ServiceAccountTokensKey: "{"}, constants.IAMTokenAudience)
+	assert.ErrorContains(t, err, "invalid service account tokens")
+}
+
+func TestNodePublishVolumeWorkloadIdentity(t *testing.T) {
+	tokens := `{"iam":{"token":"iam-sa-token"},"sts.amazonaws.com":{"token":"sts-sa-token"}}`
+	testCases := []struct {
+		testCaseName  string
+		attrib        map[string]string
+		secrets       map[string]string
+		isFailedMount bool
+		// expectedSecrets are set by NodePublishVolume for the mounter, with KEY and
+		// URL standing for the key of the mount and the URL of the credentials
+		expectedSecrets map[string]string
+		expectedCreds   s3client.ObjectStorageCredentials
+		expectedErr     codes.Code
+	}{
+		{
+			testCaseName: "Positive: Trusted profile mounted with s3fs",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: tokens},
+			secrets:      map[string]string{"trustedProfileId": "testProfileID"},
+			expectedSecrets: map[string]string{
+				"apiKey":      "KEY",
+				"iamEndpoint": "URL",
+			},
+			expectedCreds: s3client.ObjectStorageCredentials{
+				AuthType:            "workload",
+				IAMEndpoint:         constants.DefaultIAMEndPoint,
+				TrustedProfileID:    "testProfileID",
+				ServiceAccountToken: "iam-sa-token",
+			},
+		},
+		{
+			testCaseName: "Positive: Role of MinIO mounted with rclone",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: tokens, "mounter": constants.RClone},
+			secrets:      map[string]string{"roleArn": "testRoleARN", "provider": constants.ProviderMinIO, "cosEndpoint": "https://minio.example.com"},
+			expectedSecrets: map[string]string{
+				"credentialsEndpoint": "URL" + workloadCredentialsPath,
+				"credentialsToken":    "KEY",
+			},
+			expectedCreds: s3client.ObjectStorageCredentials{
+				AuthType:            "workload",
+				IAMEndpoint:         constants.DefaultIAMEndPoint,
+				RoleARN:             "testRoleARN",
+				STSEndpoint:         "https://minio.example.com",
+				ServiceAccountToken: "sts-sa-token",
+			},
+		},
+		{
+			testCaseName: "Positive: Role of AWS with a custom audience",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: `{"custom":{"token":"custom-sa-token"}}`},
+			secrets:      map[string]string{"roleArn": "testRoleARN", "provider": constants.ProviderAWS, "tokenAudience": "custom", "mounter": constants.RClone},
+			expectedSecrets: map[string]string{
+				"credentialsEndpoint": "URL" + workloadCredentialsPath,
+				"credentialsToken":    "KEY",
+			},
+			expectedCreds: s3client.ObjectStorageCredentials{
+				AuthType:            "workload",
+				IAMEndpoint:         constants.DefaultIAMEndPoint,
+				RoleARN:             "testRoleARN",
+				STSEndpoint:         constants.DefaultSTSEndPoint,
+				ServiceAccountToken: "custom-sa-token",
+			},
+		},
+		{
+			testCaseName: "Negative: Trusted profile mounted with rclone",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: tokens, "mounter": constants.RClone},
+			secrets:      map[string]string{"trustedProfileId": "testProfileID"},
+			expectedErr:  codes.InvalidArgument,
+		},
+		{
+			testCaseName: "Negative: Role mounted with s3fs",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: tokens},
+			secrets:      map[string]string{"roleArn": "testRoleARN", "provider": constants.ProviderCeph},
+			expectedErr:  codes.InvalidArgument,
+		},
+		{
+			testCaseName: "Negative: Role of IBM COS",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: tokens},
+			secrets:      map[string]string{"roleArn": "testRoleARN"},
+			expectedErr:  codes.InvalidArgument,
+		},
+		{
+			testCaseName: "Negative: Token of the audience missing",
+			attrib:       map[string]string{constants.ServiceAccountTokensKey: `{"sts.amazonaws.com":{"token":"sts-sa-token"}}`},
+			secrets:      map[string]string{"trustedProfileId": "testProfileID"},
+			expectedErr:  codes.InvalidArgument,
+		},
+		{
+			testCaseName:  "Negative: Mount failed",
+			attrib:        map[string]string{constants.ServiceAccountTokensKey: tokens},
+			secrets:       map[string]string{"trustedProfileId": "testProfileID"},
+			isFailedMount: true,
+			expectedErr:   codes.Unknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+
+		w := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, "")
+		w.url = "http://127.0.0.1:9081"
+		ns := &nodeServer{
+			S3Driver: &S3Driver{name: driverName},
+			Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return false, nil
+				},
+				GetPVMountOptionsFn: func(volumeID string) (string, error) {
+					return "", nil
+				},
+			}),
+			Mounter:  &mounter.FakeMounterFactory{Mounter: constants.S3FS, IsFailedMount: tc.isFailedMount},
+			workload: w,
+		}
+		req := &csi.NodePublishVolumeRequest{
+			VolumeId:   testOwnedVolumeID,
+			TargetPath: testTargetPath,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: volumeCapabilities[0],
+				},
+			},
+			VolumeContext: tc.attrib,
+			Secrets:       tc.secrets,
+		}
+		_, err := ns.NodePublishVolume(ctx, req)
+
+		if tc.expectedErr != codes.OK {
+			assert.Error(t, err)
+			assert.Equal(t, tc.expectedErr, status.Code(err))
+			assert.Empty(t, w.keys)
+			continue
+		}
+		assert.NoError(t, err)
+		key := w.keys[testTargetPath]
+		assert.NotEmpty(t, key)
+		for k, v := range tc.expectedSecrets {
+			v = strings.ReplaceAll(strings.ReplaceAll(v, "KEY", key), "URL", w.url)
+			assert.Equal(t, v, req.Secrets[k], k)
+		}
+		assert.NotContains(t, req.Secrets, "serviceAccountToken")
+		assert.Equal(t, tc.expectedCreds, w.mounts[key].creds)
+
+		ns.MounterUtils = mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
+			FuseUnmountFn: func(path string) error {
+				return nil
+			},
+		})
+		_, err = ns.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: testOwnedVolumeID, TargetPath: testTargetPath})
+		assert.NoError(t, err)
+		assert.Empty(t, w.keys)
+		assert.Empty(t, w.mounts)
+	}
+}
+
+func TestNodePublishVolumeCredentialRotation(t *testing.T) {
+	testCases := []struct {
+		testCaseName string
+		mounter      string
+		// registered are the credentials served to the mount before it is republished
+		registered *s3client.ObjectStorageCredentials
+		secrets    map[string]string
+		// isCredentialsUpdated tells whether the mounter found the credentials of
+		// its files changed
+		isCredentialsUpdated bool
+		// served tells whether the credentials are served to the mounter, rather than
+		// rewritten in its files
+		served            bool
+		expectedResult    string
+		expectedRotations float64
+	}{
+		{
+			testCaseName:      "HMAC keys served to rclone",
+			mounter:           constants.RClone,
+			registered:        &s3client.ObjectStorageCredentials{AccessKey: "access-key", SecretKey: "secret-key"},
+			secrets:           map[string]string{"accessKey": "access-key-2", "secretKey": "secret-key-2"},
+			served:            true,
+			expectedResult:    "applied",
+			expectedRotations: 1,
+		},
+		{
+			testCaseName:      "Same HMAC keys served to rclone",
+			mounter:           constants.RClone,
+			registered:        &s3client.ObjectStorageCredentials{AccessKey: "access-key", SecretKey: "secret-key"},
+			secrets:           map[string]string{"accessKey": "access-key", "secretKey": "secret-key"},
+			served:            true,
+			expectedResult:    "applied",
+			expectedRotations: 0,
+		},
+		{
+			testCaseName:      "API key served to s3fs",
+			mounter:           constants.S3FS,
+			registered:        &s3client.ObjectStorageCredentials{APIKey: "api-key", IAMEndpoint: constants.DefaultIAMEndPoint},
+			secrets:           map[string]string{"apiKey": "api-key-2", "serviceId": "testServiceID"},
+			served:            true,
+			expectedResult:    "applied",
+			expectedRotations: 1,
+		},
+		{
+			testCaseName: "Trusted profile changed for s3fs",
+			mounter:      constants.S3FS,
+			registered: &s3client.ObjectStorageCredentials{
+				AuthType:            "workload",
+				IAMEndpoint:         constants.DefaultIAMEndPoint,
+				TrustedProfileID:    "testProfileID",
+				ServiceAccountToken: "iam-sa-token",
+			},
+			secrets:           map[string]string{"trustedProfileId": "otherProfileID"},
+			served:            true,
+			expectedResult:    "applied",
+			expectedRotations: 1,
+		},
+		{
+			testCaseName:         "HMAC keys rewritten for s3fs",
+			mounter:              constants.S3FS,
+			secrets:              map[string]string{"accessKey": "access-key-2", "secretKey": "secret-key-2"},
+			isCredentialsUpdated: true,
+			expectedResult:       "remount_required",
+			expectedRotations:    1,
+		},
+		{
+			testCaseName:         "API key rewritten for rclone",
+			mounter:              constants.RClone,
+			secrets:              map[string]string{"apiKey": "api-key-2", "serviceId": "testServiceID"},
+			isCredentialsUpdated: true,
+			expectedResult:       "remount_required",
+			expectedRotations:    1,
+		},
+		{
+			testCaseName:      "Same HMAC keys left alone for s3fs",
+			mounter:           constants.S3FS,
+			secrets:           map[string]string{"accessKey": "access-key", "secretKey": "secret-key"},
+			expectedResult:    "remount_required",
+			expectedRotations: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+
+		w := newWorkloadIdentity(&s3client.FakeCOSSessionFactory{}, "")
+		w.url = "http://127.0.0.1:9081"
+		ns := &nodeServer{
+			S3Driver: &S3Driver{name: driverName},
+			Stats: utils.NewFakeStatsUtilsImpl(utils.FakeStatsUtilsFuncStruct{
+				CheckMountFn: func(targetPath string) error {
+					return nil
+				},
+				IsMountPointFn: func(targetPath string) (bool, error) {
+					return true, nil
+				},
+			}),
+			Mounter:  &mounter.FakeMounterFactory{Mounter: tc.mounter, IsCredentialsUpdated: tc.isCredentialsUpdated || tc.served},
+			workload: w,
+		}
+		var key string
+		if tc.registered != nil {
+			var err error
+			key, _, err = w.register(testTargetPath, *tc.registered)
+			assert.NoError(t, err)
+		}
+		rotations := credentialRotationsTotal.WithLabelValues(tc.mounter, tc.expectedResult)
+		before := testutil.ToFloat64(rotations)
+		remounts := credentialRotationsTotal.WithLabelValues(tc.mounter, "remount_required")
+		remountsBefore := testutil.ToFloat64(remounts)
+
+		req := &csi.NodePublishVolumeRequest{
+			VolumeId:   testOwnedVolumeID,
+			TargetPath: testTargetPath,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: volumeCapabilities[0],
+				},
+			},
+			VolumeContext: map[string]string{
+				"mounter":                         tc.mounter,
+				constants.ServiceAccountTokensKey: `{"iam":{"token":"iam-sa-token"}}`,
+			},
+			Secrets: tc.secrets,
+		}
+		_, err := ns.NodePublishVolume(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, before+tc.expectedRotations, testutil.ToFloat64(rotations))
+
+		if !tc.served {
+			// The keys of the secret are left for the mounter to rewrite
+			for k, v := range tc.secrets {
+				assert.Equal(t, v, req.Secrets[k], k)
+			}
+			assert.Empty(t, req.Secrets["credentialsEndpoint"])
+			assert.Empty(t, w.keys)
+			continue
+		}
+		// The files of the mounter are left alone, the running mount keeps
+		// authenticating with its key
+		assert.Equal(t, remountsBefore, testutil.ToFloat64(remounts))
+		assert.Equal(t, key, w.keys[testTargetPath])
+		if tc.mounter == constants.RClone {
+			assert.Equal(t, key, req.Secrets["credentialsToken"])
+			assert.Equal(t, tc.secrets["accessKey"], w.mounts[key].creds.AccessKey)
+		} else {
+			assert.Equal(t, key, req.Secrets["apiKey"])
+			assert.Equal(t, w.url, req.Secrets["iamEndpoint"])
+		}
+	}
+}
@@ -13,21 +13,23 @@ type fakercloneMounter struct {
 	uid           string
 	gid           string
 
-	isFailedMount bool
+	isFailedMount        bool
+	isCredentialsUpdated bool
 }
 
-func fakenewRcloneMounter(isFailedMount bool) Mounter {
+func fakenewRcloneMounter(isFailedMount, isCredentialsUpdated bool) Mounter {
 	return &fakercloneMounter{
-		bucketName:    bucketName,
-		objPath:       objPath,
-		endPoint:      endPoint,
-		locConstraint: region,
-		accessKeys:    keys,
-		authType:      authType,
-		kpRootKeyCrn:  "",
-		uid:           "",
-		gid:           "",
-		isFailedMount: isFailedMount,
+		bucketName:           bucketName,
+		objPath:              objPath,
+		endPoint:             endPoint,
+		locConstraint:        region,
+		accessKeys:           keys,
+		authType:             authType,
+		kpRootKeyCrn:         "",
+		uid:                  "",
+		gid:                  "",
+		isFailedMount:        isFailedMount,
+		isCredentialsUpdated: isCredentialsUpdated,
 	}
 }
 
@@ -41,3 +43,7 @@ func (rclone *fakercloneMounter) Mount(source string, target string) error {
 func (rclone *fakercloneMounter) Unmount(target string) error {
 	return nil
 }
+
+func (rclone *fakercloneMounter) UpdateCredentials(target string) (bool, error) {
+	return rclone.isCredentialsUpdated, nil
+}
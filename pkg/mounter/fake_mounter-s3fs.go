@@ -11,19 +11,21 @@ type fakes3fsMounter struct {
 	accessKeys    string
 	kpRootKeyCrn  string
 
-	isFailedMount bool
+	isFailedMount        bool
+	isCredentialsUpdated bool
 }
 
-func fakenewS3fsMounter(isFailedMount bool) Mounter {
+func fakenewS3fsMounter(isFailedMount, isCredentialsUpdated bool) Mounter {
 	return &fakes3fsMounter{
-		bucketName:    bucketName,
-		objPath:       objPath,
-		endPoint:      endPoint,
-		locConstraint: region,
-		accessKeys:    keys,
-		authType:      authType,
-		kpRootKeyCrn:  "",
-		isFailedMount: isFailedMount,
+		bucketName:           bucketName,
+		objPath:              objPath,
+		endPoint:             endPoint,
+		locConstraint:        region,
+		accessKeys:           keys,
+		authType:             authType,
+		kpRootKeyCrn:         "",
+		isFailedMount:        isFailedMount,
+		isCredentialsUpdated: isCredentialsUpdated,
 	}
 }
 
@@ -37,3 +39,7 @@ func (s3fs *fakes3fsMounter) Mount(source string, target string) error {
 func (s3fs *fakes3fsMounter) Unmount(target string) error {
 	return nil
 }
+
+func (s3fs *fakes3fsMounter) UpdateCredentials(target string) (bool, error) {
+	return s3fs.isCredentialsUpdated, nil
+}
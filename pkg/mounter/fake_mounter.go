@@ -14,15 +14,17 @@ const (
 type FakeMounterFactory struct {
 	Mounter       string
 	IsFailedMount bool
+	// IsCredentialsUpdated is returned by UpdateCredentials
+	IsCredentialsUpdated bool
 }
 
-func (f *FakeMounterFactory) NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) Mounter {
+func (f *FakeMounterFactory) NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) (Mounter, error) {
 	switch f.Mounter {
 	case constants.S3FS:
-		return fakenewS3fsMounter(f.IsFailedMount)
+		return fakenewS3fsMounter(f.IsFailedMount, f.IsCredentialsUpdated), nil
 	case constants.RClone:
-		return fakenewRcloneMounter(f.IsFailedMount)
+		return fakenewRcloneMounter(f.IsFailedMount, f.IsCredentialsUpdated), nil
 	default:
-		return fakenewS3fsMounter(f.IsFailedMount)
+		return fakenewS3fsMounter(f.IsFailedMount, f.IsCredentialsUpdated), nil
 	}
 }
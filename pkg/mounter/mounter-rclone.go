@@ -16,11 +16,14 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	pkgUtils "github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"k8s.io/klog/v2"
 )
 
@@ -33,11 +36,27 @@ type RcloneMounter struct {
 	LocConstraint string //From Secret in SC
 	AuthType      string
 	AccessKeys    string
-	KpRootKeyCrn  string
-	UID           string
-	GID           string
-	MountOptions  []string
-	MounterUtils  utils.MounterUtils
+	// APIKey and ServiceInstanceID authenticate with IAM, the tokens being fetched
+	// from the public IAM endpoint
+	APIKey            string
+	ServiceInstanceID string
+	KpRootKeyCrn      string
+	UID               string
+	GID               string
+	MountOptions      []string
+	MounterUtils      utils.MounterUtils
+	Provider          pkgUtils.Provider
+	// CredentialsEndpoint serves the credentials of the mount, to the requests
+	// authorized by CredentialsToken
+	CredentialsEndpoint string
+	CredentialsToken    string
+	// Encryption has rclone encrypt the objects before they leave the node, with a
+	// crypt remote over the bucket keyed by CryptPassword and CryptSalt. The names
+	// of the objects are encrypted too with EncryptFileNames.
+	Encryption       bool
+	CryptPassword    string
+	CryptSalt        string
+	EncryptFileNames bool
 }
 
 const (
@@ -45,12 +64,15 @@ const (
 	configPath     = "/root/.config/rclone"
 	configFileName = "rclone.conf"
 	remote         = "ibmcos"
+	cryptRemote    = "ibmcos-crypt"
 	s3Type         = "s3"
-	cosProvider    = "IBMCOS"
 	envAuth        = "true"
 )
 
-func NewRcloneMounter(secretMap map[string]string, mountOptions []string, mounterUtils utils.MounterUtils) Mounter {
+// credentialOptions are the options of the rclone config holding the keys of a mount
+var credentialOptions = []string{"access_key_id", "secret_access_key", "ibm_api_key", "ibm_resource_instance_id"}
+
+func NewRcloneMounter(secretMap map[string]string, mountOptions []string, mounterUtils utils.MounterUtils) (Mounter, error) {
 	klog.Info("-newRcloneMounter-")
 
 	var (
@@ -58,8 +80,8 @@ func NewRcloneMounter(secretMap map[string]string, mountOptions []string, mounte
 		check     bool
 		accessKey string
 		secretKey string
-		// apiKey    string
-		mounter *RcloneMounter
+		apiKey    string
+		mounter   *RcloneMounter
 	)
 
 	mounter = &RcloneMounter{}
@@ -85,21 +107,50 @@ func NewRcloneMounter(secretMap map[string]string, mountOptions []string, mounte
 	if val, check = secretMap["kpRootKeyCRN"]; check {
 		mounter.KpRootKeyCrn = val
 	}
+	mounter.Provider = getProvider(secretMap)
+
+	if val, check = secretMap["apiKey"]; check {
+		apiKey = val
+	}
+
+	// IBM COS authenticates with the API key when the service instance is known, as
+	// the controller does
+	if apiKey != "" && secretMap["serviceId"] != "" && mounter.Provider.IBMExtensions {
+		mounter.APIKey = apiKey
+		mounter.ServiceInstanceID = secretMap["serviceId"]
+		mounter.AuthType = "iam"
+	} else {
+		mounter.AccessKeys = fmt.Sprintf("%s:%s", accessKey, secretKey)
+		mounter.AuthType = "hmac"
+	}
 
-	// Since IAM support for rClone is not there and api key is required param now, commented below piece of code
-	// Uncommnet when IAM support for rClone is available
+	// The keys are left out for rclone to get the temporary credentials of workload
+	// identity from the endpoint of the node server
+	if secretMap["credentialsEndpoint"] != "" {
+		mounter.CredentialsEndpoint = secretMap["credentialsEndpoint"]
+		mounter.CredentialsToken = secretMap["credentialsToken"]
+		mounter.AccessKeys = ""
+		mounter.APIKey = ""
+		mounter.ServiceInstanceID = ""
+		mounter.AuthType = "endpoint"
+	}
 
-	// if val, check = secretMap["apiKey"]; check {
-	// 	apiKey = val
-	// }
+	switch {
+	case mounter.AuthType == "hmac" && apiKey != "" && accessKey == "":
+		return nil, fmt.Errorf("rclone authenticates with apiKey on IBM COS only and together with serviceId, accessKey and secretKey are missing")
+	// The IAM signer of rclone gets its tokens from the public IAM endpoint, which
+	// cannot be changed
+	case mounter.AuthType == "iam" && secretMap["iamEndpoint"] != "" && strings.TrimSuffix(secretMap["iamEndpoint"], "/") != constants.DefaultIAMEndPoint:
+		return nil, fmt.Errorf("rclone authenticates with IAM at %s only, iamEndpoint %s is not supported", constants.DefaultIAMEndPoint, secretMap["iamEndpoint"])
+	}
 
-	// if apiKey != "" {
-	// 	mounter.AccessKeys = fmt.Sprintf(":%s", apiKey)
-	// 	mounter.AuthType = "iam"
-	// } else {
-	mounter.AccessKeys = fmt.Sprintf("%s:%s", accessKey, secretKey)
-	mounter.AuthType = "hmac"
-	// }
+	// The node server sets clientEncryption of the storage class in the secret
+	if secretMap["clientEncryption"] == "true" {
+		mounter.Encryption = true
+		mounter.CryptPassword = secretMap["cryptPassword"]
+		mounter.CryptSalt = secretMap["cryptSalt"]
+		mounter.EncryptFileNames = secretMap["encryptFileNames"] == "true"
+	}
 
 	if val, check = secretMap["gid"]; check {
 		mounter.GID = val
@@ -110,15 +161,15 @@ func NewRcloneMounter(secretMap map[string]string, mountOptions []string, mounte
 		mounter.UID = secretMap["uid"]
 	}
 
-	klog.Infof("newRcloneMounter args:\n\tbucketName: [%s]\n\tobjPath: [%s]\n\tendPoint: [%s]\n\tlocationConstraint: [%s]\n\tauthType: [%s]",
-		mounter.BucketName, mounter.ObjPath, mounter.EndPoint, mounter.LocConstraint, mounter.AuthType)
+	klog.Infof("newRcloneMounter args:\n\tbucketName: [%s]\n\tobjPath: [%s]\n\tendPoint: [%s]\n\tlocationConstraint: [%s]\n\tauthType: [%s]\n\tprovider: [%s]\n\tclientEncryption: [%t]",
+		mounter.BucketName, mounter.ObjPath, mounter.EndPoint, mounter.LocConstraint, mounter.AuthType, mounter.Provider.Name, mounter.Encryption)
 
 	updatedOptions := updateMountOptions(mountOptions, secretMap)
 	mounter.MountOptions = updatedOptions
 
 	mounter.MounterUtils = mounterUtils
 
-	return mounter
+	return mounter, nil
 }
 
 func updateMountOptions(dafaultMountOptions []string, secretMap map[string]string) []string {
@@ -172,6 +223,10 @@ func (rclone *RcloneMounter) Mount(source string, target string) error {
 	var bucketName string
 	var pathExist bool
 	var err error
+	// Encrypted volumes are never mounted in plaintext
+	if rclone.Encryption && (rclone.CryptPassword == "" || rclone.CryptSalt == "") {
+		return fmt.Errorf("RcloneMounter Mount: client-side encryption requires cryptPassword and cryptSalt in the secret, not mounting %s", target)
+	}
 	metaPath := path.Join(metaRootRclone, fmt.Sprintf("%x", sha256.Sum256([]byte(target))))
 
 	if pathExist, err = checkPath(metaPath); err != nil {
@@ -193,10 +248,10 @@ func (rclone *RcloneMounter) Mount(source string, target string) error {
 		return err
 	}
 
-	if rclone.ObjPath != "" {
-		bucketName = fmt.Sprintf("%s:%s/%s", remote, rclone.BucketName, rclone.ObjPath)
-	} else {
-		bucketName = fmt.Sprintf("%s:%s", remote, rclone.BucketName)
+	bucketName = bucketRemote(rclone)
+	// The crypt remote is layered over the bucket
+	if rclone.Encryption {
+		bucketName = cryptRemote + ":"
 	}
 
 	args := []string{
@@ -216,7 +271,19 @@ func (rclone *RcloneMounter) Mount(source string, target string) error {
 		uidOpt := "--uid=" + rclone.UID
 		args = append(args, uidOpt)
 	}
-	return rclone.MounterUtils.FuseMount(target, constants.RClone, args)
+	return rclone.MounterUtils.FuseMount(target, constants.RClone, args, mountEnv(rclone)...)
+}
+
+// mountEnv returns the environment of rclone. The credentials served by the node
+// server are fetched by env_auth from the endpoint of container credentials.
+func mountEnv(rclone *RcloneMounter) []string {
+	if rclone.CredentialsEndpoint == "" {
+		return nil
+	}
+	return []string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI=" + rclone.CredentialsEndpoint,
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN=" + rclone.CredentialsToken,
+	}
 }
 
 func (rclone *RcloneMounter) Unmount(target string) error {
@@ -229,33 +296,162 @@ func (rclone *RcloneMounter) Unmount(target string) error {
 	return rclone.MounterUtils.FuseUnmount(target)
 }
 
+// bucketRemote returns the path of the bucket of a mount on the remote of rclone
+func bucketRemote(rclone *RcloneMounter) string {
+	if rclone.ObjPath != "" {
+		return fmt.Sprintf("%s:%s/%s", remote, rclone.BucketName, rclone.ObjPath)
+	}
+	return fmt.Sprintf("%s:%s", remote, rclone.BucketName)
+}
+
 var createConfigFunc = createConfig
 
+// obscure returns a password obscured by rclone, which reads the passwords of its
+// config that way. The password is passed on the standard input, not to show in
+// the arguments of the process.
+func obscure(password string) (string, error) {
+	cmd := exec.Command(constants.RClone, "obscure", "-") // #nosec G204: fixed arguments
+	cmd.Stdin = strings.NewReader(password)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot obscure the password: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+var obscureFunc = obscure
+
 // Function that wraps writePass
 var createConfigWrap = func(configPathWithVolID string, rclone *RcloneMounter) error {
 	return createConfigFunc(configPathWithVolID, rclone)
 }
 
-func createConfig(configPathWithVolID string, rclone *RcloneMounter) error {
-	var accessKey string
-	var secretKey string
-	keys := strings.Split(rclone.AccessKeys, ":")
-	if len(keys) == 2 {
-		accessKey = keys[0]
-		secretKey = keys[1]
-	}
-	configParams := []string{
+// configParams returns the lines of the rclone config of a mount
+func configParams(rclone *RcloneMounter) []string {
+	params := []string{
 		"[" + remote + "]",
 		"type = " + s3Type,
 		"endpoint = " + rclone.EndPoint,
-		"provider = " + cosProvider,
+		"provider = " + rclone.Provider.RcloneProvider,
 		"env_auth = " + envAuth,
 		"location_constraint = " + rclone.LocConstraint,
-		"access_key_id = " + accessKey,
-		"secret_access_key = " + secretKey,
+	}
+	params = append(params, credentialParams(rclone)...)
+	// Requests are signed for the region of the volume, IBM COS telling it by the endpoint
+	if !rclone.Provider.IBMExtensions {
+		params = append(params, "region = "+rclone.LocConstraint)
+	}
+	if rclone.Provider.VirtualHostedStyle {
+		params = append(params, "force_path_style = false")
 	}
 
-	configParams = append(configParams, rclone.MountOptions...)
+	return append(params, rclone.MountOptions...)
+}
+
+// credentialParams returns the lines of the rclone config holding the keys of a mount.
+// Without keys, rclone authenticates with IAM or gets them from its environment.
+func credentialParams(rclone *RcloneMounter) []string {
+	var params []string
+	accessKey, secretKey, found := strings.Cut(rclone.AccessKeys, ":")
+	if found && accessKey != "" {
+		params = append(params, "access_key_id = "+accessKey, "secret_access_key = "+secretKey)
+	}
+	if rclone.APIKey != "" {
+		params = append(params, "ibm_api_key = "+rclone.APIKey, "ibm_resource_instance_id = "+rclone.ServiceInstanceID)
+	}
+	return params
+}
+
+// UpdateCredentials rewrites the keys of the rclone config of the volume mounted to
+// target with those of the secret, leaving the other lines as they are. rclone reads
+// its config when it mounts the volume.
+func (rclone *RcloneMounter) UpdateCredentials(target string) (bool, error) {
+	configPathWithVolID := path.Join(configPath, fmt.Sprintf("%x", sha256.Sum256([]byte(target))))
+	return rewriteConfigCredentials(path.Join(configPathWithVolID, configFileName), credentialParams(rclone))
+}
+
+// rewriteConfigCredentials replaces the keys of the bucket remote in an rclone config
+// by credentials, and rewrites the config if they changed
+func rewriteConfigCredentials(configFile string, credentials []string) (bool, error) {
+	data, err := os.ReadFile(configFile) // #nosec G304 used for rclone
+	if err != nil {
+		return false, fmt.Errorf("cannot read rclone config %s: %w", configFile, err)
+	}
+
+	var lines, previous []string
+	section, replaced := "", false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if strings.HasPrefix(line, "[") {
+			// The keys go at the end of the bucket remote when it had none
+			if section == remote && !replaced {
+				lines, replaced = append(lines, credentials...), true
+			}
+			section = strings.Trim(line, "[]")
+		}
+		option, _, _ := strings.Cut(line, " = ")
+		if section == remote && slices.Contains(credentialOptions, option) {
+			previous = append(previous, line)
+			if !replaced {
+				lines, replaced = append(lines, credentials...), true
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if section == remote && !replaced {
+		lines = append(lines, credentials...)
+	}
+	if slices.Equal(previous, credentials) {
+		return false, nil
+	}
+
+	// The config holds the keys of the volume, readable by root only, including the
+	// configs written by earlier releases
+	if err = os.Chmod(configFile, 0600); err != nil {
+		return false, fmt.Errorf("cannot change permissions of rclone config %s: %w", configFile, err)
+	}
+	if err = os.WriteFile(configFile, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return false, fmt.Errorf("cannot rewrite rclone config %s: %w", configFile, err)
+	}
+	return true, nil
+}
+
+// cryptParams returns the lines of the crypt remote of an encrypted mount, which
+// encrypts the objects of the bucket with the obscured password and salt
+func cryptParams(rclone *RcloneMounter) ([]string, error) {
+	password, err := obscureFunc(rclone.CryptPassword)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := obscureFunc(rclone.CryptSalt)
+	if err != nil {
+		return nil, err
+	}
+	filenameEncryption := "off"
+	if rclone.EncryptFileNames {
+		filenameEncryption = "standard"
+	}
+	return []string{
+		"[" + cryptRemote + "]",
+		"type = crypt",
+		"remote = " + bucketRemote(rclone),
+		"filename_encryption = " + filenameEncryption,
+		fmt.Sprintf("directory_name_encryption = %t", rclone.EncryptFileNames),
+		"password = " + password,
+		"password2 = " + salt,
+	}, nil
+}
+
+func createConfig(configPathWithVolID string, rclone *RcloneMounter) error {
+	configParams := configParams(rclone)
+	if rclone.Encryption {
+		crypt, err := cryptParams(rclone)
+		if err != nil {
+			klog.Errorf("RcloneMounter Mount: Cannot configure client-side encryption: %v", err)
+			return err
+		}
+		configParams = append(configParams, crypt...)
+	}
 
 	if err := os.MkdirAll(configPathWithVolID, 0755); // #nosec G301: used for rclone
 	err != nil {
@@ -275,7 +471,8 @@ func createConfig(configPathWithVolID string, rclone *RcloneMounter) error {
 		}
 	}()
 
-	err = os.Chmod(configFile, 0644) // #nosec G302: used for rclone
+	// The config holds the keys of the volume, readable by root only
+	err = os.Chmod(configFile, 0600)
 	if err != nil {
 		klog.Errorf("RcloneMounter Mount: Cannot change permissions on file  %s: %v", configFileName, err)
 		return err
@@ -3,9 +3,13 @@ package mounter
 
 import (
 	"errors"
+	"maps"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,8 +30,14 @@ var secretMapRClone = map[string]string{
 
 var mountOptionsRClone = []string{"opt1=val1", "opt2=val2"}
 
+func newTestRcloneMounter(t *testing.T, secretMap map[string]string, mountOptions []string, optsUtils mounterUtils.MounterUtils) Mounter {
+	mounter, err := NewRcloneMounter(secretMap, mountOptions, optsUtils)
+	assert.NoError(t, err)
+	return mounter
+}
+
 func TestNewRcloneMounter_Success(t *testing.T) {
-	mounter := NewRcloneMounter(secretMapRClone, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	mounter := newTestRcloneMounter(t, secretMapRClone, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
 
 	rCloneMounter, ok := mounter.(*RcloneMounter)
 	if !ok {
@@ -56,7 +66,7 @@ func TestNewRcloneMounter_Success_Hmac(t *testing.T) {
 		"uid":                "fake-uid",
 	}
 
-	mounter := NewRcloneMounter(secretMap, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	mounter := newTestRcloneMounter(t, secretMap, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
 
 	rCloneMounter, ok := mounter.(*RcloneMounter)
 	if !ok {
@@ -83,7 +93,7 @@ func TestNewRcloneMounter_Only_GID(t *testing.T) {
 		"kpRootKeyCRN":       "test-kp-root-key-crn",
 		"gid":                "1001",
 	}
-	mounter := NewRcloneMounter(secretMap, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	mounter := newTestRcloneMounter(t, secretMap, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
 
 	rCloneMounter, ok := mounter.(*RcloneMounter)
 	if !ok {
@@ -111,7 +121,7 @@ func TestNewRcloneMounter_MountOptsInSecret_Invalid(t *testing.T) {
 		"uid":                "1001",
 		"mountOptions":       "upload_concurrency",
 	}
-	mounter := NewRcloneMounter(secretMap, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	mounter := newTestRcloneMounter(t, secretMap, mountOptionsRClone, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
 
 	rCloneMounter, ok := mounter.(*RcloneMounter)
 	if !ok {
@@ -127,7 +137,7 @@ func TestNewRcloneMounter_MountOptsInSecret_Invalid(t *testing.T) {
 }
 
 func Test_RcloneMount_Positive(t *testing.T) {
-	mounter := NewRcloneMounter(secretMapRClone, mountOptionsRClone,
+	mounter := newTestRcloneMounter(t, secretMapRClone, mountOptionsRClone,
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseMountFn: func(path string, comm string, args []string) error {
 				return nil
@@ -172,7 +182,7 @@ func Test_RcloneMount_Positive_Empty_ObjPath(t *testing.T) {
 		"gid":                "fake-gid",
 		"uid":                "fake-uid",
 	}
-	mounter := NewRcloneMounter(secretMap, mountOptionsRClone,
+	mounter := newTestRcloneMounter(t, secretMap, mountOptionsRClone,
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseMountFn: func(path string, comm string, args []string) error {
 				return nil
@@ -206,7 +216,7 @@ func Test_RcloneMount_Positive_Empty_ObjPath(t *testing.T) {
 }
 
 func Test_RcloneMount_Error_Creating_Mount_Point(t *testing.T) {
-	mounter := NewRcloneMounter(secretMapRClone, mountOptionsRClone,
+	mounter := newTestRcloneMounter(t, secretMapRClone, mountOptionsRClone,
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseMountFn: func(path string, comm string, args []string) error {
 				return nil
@@ -233,7 +243,7 @@ func Test_RcloneMount_Error_Creating_Mount_Point(t *testing.T) {
 }
 
 func Test_RcloneMount_Error_Creating_ConfigFile(t *testing.T) {
-	mounter := NewRcloneMounter(secretMapRClone, mountOptionsRClone,
+	mounter := newTestRcloneMounter(t, secretMapRClone, mountOptionsRClone,
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseMountFn: func(path string, comm string, args []string) error {
 				return nil
@@ -268,7 +278,7 @@ func Test_RcloneMount_Error_Creating_ConfigFile(t *testing.T) {
 }
 
 func Test_RcloneMount_ErrorMount(t *testing.T) {
-	mounter := NewRcloneMounter(secretMapRClone, mountOptionsRClone,
+	mounter := newTestRcloneMounter(t, secretMapRClone, mountOptionsRClone,
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseMountFn: func(path string, comm string, args []string) error {
 				return errors.New("error mounting volume")
@@ -315,7 +325,7 @@ func Test_RcloneUnmount_Positive(t *testing.T) {
 		"gid":                "fake-gid",
 		"uid":                "fake-uid",
 	}
-	mounter := NewRcloneMounter(secretMap, []string{"mountOption1", "mountOption2"},
+	mounter := newTestRcloneMounter(t, secretMap, []string{"mountOption1", "mountOption2"},
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseUnmountFn: func(path string) error {
 				return nil
@@ -360,7 +370,7 @@ func Test_RcloneUnmount_Error(t *testing.T) {
 		"gid":                "fake-gid",
 		"uid":                "fake-uid",
 	}
-	mounter := NewRcloneMounter(secretMap, []string{"mountOption1", "mountOption2"},
+	mounter := newTestRcloneMounter(t, secretMap, []string{"mountOption1", "mountOption2"},
 		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
 			FuseUnmountFn: func(path string) error {
 				return errors.New("error unmounting volume")
@@ -400,3 +410,278 @@ func TestUpdateRCloneMountOptions(t *testing.T) {
 		"additional_option=value3",
 	})
 }
+
+func TestRcloneConfigParams_Providers(t *testing.T) {
+	mounter := newTestRcloneMounter(t, secretMapRClone, nil, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	params := configParams(mounter.(*RcloneMounter))
+	assert.Contains(t, params, "provider = IBMCOS")
+	assert.NotContains(t, params, "region = test-loc-constraint")
+
+	secrets := maps.Clone(secretMapRClone)
+	secrets["provider"] = constants.ProviderCeph
+	mounter = newTestRcloneMounter(t, secrets, nil, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	params = configParams(mounter.(*RcloneMounter))
+	assert.Contains(t, params, "provider = Ceph")
+	assert.Contains(t, params, "region = test-loc-constraint")
+	assert.NotContains(t, params, "force_path_style = false")
+
+	secrets["provider"] = constants.ProviderAWS
+	mounter = newTestRcloneMounter(t, secrets, nil, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+	params = configParams(mounter.(*RcloneMounter))
+	assert.Contains(t, params, "provider = AWS")
+	assert.Contains(t, params, "force_path_style = false")
+}
+
+func Test_RcloneMount_WorkloadIdentity(t *testing.T) {
+	secrets := maps.Clone(secretMapRClone)
+	secrets["provider"] = constants.ProviderMinIO
+	secrets["credentialsEndpoint"] = "http://127.0.0.1:9081/credentials"
+	secrets["credentialsToken"] = "test-key"
+	var mountEnv []string
+	mounter := newTestRcloneMounter(t, secrets, nil,
+		mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
+			FuseMountEnvFn: func(path string, comm string, args []string, env []string) error {
+				mountEnv = env
+				return nil
+			},
+		}))
+	rCloneMounter := mounter.(*RcloneMounter)
+	assert.Equal(t, "endpoint", rCloneMounter.AuthType)
+	params := configParams(rCloneMounter)
+	assert.Contains(t, params, "env_auth = true")
+	assert.NotContains(t, strings.Join(params, "\n"), "access_key_id")
+
+	mkdirAllFunc = func(path string, perm os.FileMode) error { return nil }
+	defer func() { mkdirAllFunc = os.MkdirAll }()
+	createConfigFunc = func(configPathWithVolID string, rclone *RcloneMounter) error { return nil }
+	defer func() { createConfigFunc = createConfig }()
+
+	assert.NoError(t, rCloneMounter.Mount("source", "/tmp/test-mount"))
+	assert.Equal(t, []string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9081/credentials",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN=test-key",
+	}, mountEnv)
+}
+
+func TestRcloneConfigParams_AuthTypes(t *testing.T) {
+	testCases := []struct {
+		testCaseName     string
+		secrets          map[string]string
+		expectedAuthType string
+		expectedParams   []string
+		unexpectedParams []string
+	}{
+		{
+			testCaseName:     "HMAC keys",
+			secrets:          map[string]string{"accessKey": "test-access-key", "secretKey": "test-secret-key", "apiKey": "test-api-key"},
+			expectedAuthType: "hmac",
+			expectedParams:   []string{"access_key_id = test-access-key", "secret_access_key = test-secret-key"},
+			unexpectedParams: []string{"ibm_api_key", "ibm_resource_instance_id"},
+		},
+		{
+			testCaseName:     "IAM API key",
+			secrets:          map[string]string{"accessKey": "test-access-key", "secretKey": "test-secret-key", "apiKey": "test-api-key", "serviceId": "test-service-id"},
+			expectedAuthType: "iam",
+			expectedParams:   []string{"ibm_api_key = test-api-key", "ibm_resource_instance_id = test-service-id"},
+			unexpectedParams: []string{"access_key_id", "secret_access_key", "ibm_iam_endpoint"},
+		},
+		{
+			testCaseName:     "IAM API key of another provider",
+			secrets:          map[string]string{"accessKey": "test-access-key", "secretKey": "test-secret-key", "apiKey": "test-api-key", "serviceId": "test-service-id", "provider": constants.ProviderMinIO},
+			expectedAuthType: "hmac",
+			expectedParams:   []string{"access_key_id = test-access-key"},
+			unexpectedParams: []string{"ibm_api_key"},
+		},
+		{
+			testCaseName:     "No keys",
+			secrets:          map[string]string{},
+			expectedAuthType: "hmac",
+			unexpectedParams: []string{"access_key_id", "secret_access_key", "ibm_api_key"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+
+		mounter := newTestRcloneMounter(t, tc.secrets, nil, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{}))
+		rCloneMounter := mounter.(*RcloneMounter)
+		assert.Equal(t, tc.expectedAuthType, rCloneMounter.AuthType)
+		params := configParams(rCloneMounter)
+		for _, param := range tc.expectedParams {
+			assert.Contains(t, params, param)
+		}
+		for _, param := range tc.unexpectedParams {
+			assert.NotContains(t, strings.Join(params, "\n"), param)
+		}
+	}
+}
+
+func Test_RcloneMount_IAM(t *testing.T) {
+	mkdirAllFunc = func(path string, perm os.FileMode) error { return nil }
+	defer func() { mkdirAllFunc = os.MkdirAll }()
+	var config []string
+	createConfigFunc = func(configPathWithVolID string, rclone *RcloneMounter) error {
+		config = configParams(rclone)
+		return nil
+	}
+	defer func() { createConfigFunc = createConfig }()
+
+	secrets := map[string]string{"bucketName": "test-bucket-name", "apiKey": "test-api-key", "serviceId": "test-service-id"}
+	mounted := 0
+	fakeUtils := mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
+		FuseMountFn: func(path string, comm string, args []string) error {
+			mounted++
+			return nil
+		},
+	})
+
+	assert.NoError(t, newTestRcloneMounter(t, secrets, nil, fakeUtils).Mount("source", "/tmp/test-mount"))
+	assert.Contains(t, config, "ibm_api_key = test-api-key")
+	assert.Contains(t, config, "ibm_resource_instance_id = test-service-id")
+	assert.NotContains(t, strings.Join(config, "\n"), "ibm_iam_endpoint")
+
+	// The public IAM endpoint may be set explicitly
+	secrets["iamEndpoint"] = constants.DefaultIAMEndPoint + "/"
+	assert.NoError(t, newTestRcloneMounter(t, secrets, nil, fakeUtils).Mount("source", "/tmp/test-mount"))
+	assert.Equal(t, 2, mounted)
+
+	// rclone gets its tokens from the public IAM endpoint only
+	secrets["iamEndpoint"] = "https://private.iam.cloud.ibm.com"
+	_, err := NewRcloneMounter(secrets, nil, fakeUtils)
+	assert.ErrorContains(t, err, "iamEndpoint https://private.iam.cloud.ibm.com is not supported")
+
+	// An API key without service instance is not mounted without keys
+	secrets = map[string]string{"bucketName": "test-bucket-name", "apiKey": "test-api-key"}
+	_, err = NewRcloneMounter(secrets, nil, fakeUtils)
+	assert.ErrorContains(t, err, "accessKey and secretKey are missing")
+	assert.Equal(t, 2, mounted)
+}
+
+func TestRcloneCryptParams(t *testing.T) {
+	obscureFunc = func(password string) (string, error) { return "obscured-" + password, nil }
+	defer func() { obscureFunc = obscure }()
+
+	testCases := []struct {
+		testCaseName   string
+		secrets        map[string]string
+		expectedParams []string
+	}{
+		{
+			testCaseName: "File names in plaintext",
+			secrets:      map[string]string{"bucketName": "test-bucket-name", "clientEncryption": "true", "cryptPassword": "test-password", "cryptSalt": "test-salt"},
+			expectedParams: []string{"[ibmcos-crypt]", "type = crypt", "remote = ibmcos:test-bucket-name", "filename_encryption = off",
+				"directory_name_encryption = false", "password = obscured-test-password", "password2 = obscured-test-salt"},
+		},
+		{
+			testCaseName: "File names encrypted",
+			secrets: map[string]string{"bucketName": "test-bucket-name", "objPath": "test-obj-path", "clientEncryption": "true", "cryptPassword": "test-password",
+				"cryptSalt": "test-salt", "encryptFileNames": "true"},
+			expectedParams: []string{"[ibmcos-crypt]", "type = crypt", "remote = ibmcos:test-bucket-name/test-obj-path", "filename_encryption = standard",
+				"directory_name_encryption = true", "password = obscured-test-password", "password2 = obscured-test-salt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+		mounter := newTestRcloneMounter(t, tc.secrets, nil, nil).(*RcloneMounter)
+		assert.True(t, mounter.Encryption)
+		params, err := cryptParams(mounter)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectedParams, params)
+	}
+
+	obscureFunc = func(password string) (string, error) { return "", errors.New("rclone not found") }
+	_, err := cryptParams(newTestRcloneMounter(t, testCases[0].secrets, nil, nil).(*RcloneMounter))
+	assert.ErrorContains(t, err, "rclone not found")
+}
+
+func Test_RcloneMount_Encryption(t *testing.T) {
+	mkdirAllFunc = func(path string, perm os.FileMode) error { return nil }
+	defer func() { mkdirAllFunc = os.MkdirAll }()
+	configured := 0
+	createConfigFunc = func(configPathWithVolID string, rclone *RcloneMounter) error {
+		configured++
+		return nil
+	}
+	defer func() { createConfigFunc = createConfig }()
+
+	var mountArgs []string
+	fakeUtils := mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
+		FuseMountFn: func(path string, comm string, args []string) error {
+			mountArgs = args
+			return nil
+		},
+	})
+
+	secrets := map[string]string{"bucketName": "test-bucket-name", "clientEncryption": "true", "cryptPassword": "test-password", "cryptSalt": "test-salt"}
+	assert.NoError(t, newTestRcloneMounter(t, secrets, nil, fakeUtils).Mount("source", "/tmp/test-mount"))
+	assert.Equal(t, "ibmcos-crypt:", mountArgs[1])
+	assert.Equal(t, 1, configured)
+
+	// Volumes are not mounted in plaintext without their keys
+	mountArgs = nil
+	delete(secrets, "cryptSalt")
+	err := newTestRcloneMounter(t, secrets, nil, fakeUtils).Mount("source", "/tmp/test-mount")
+	assert.ErrorContains(t, err, "client-side encryption requires cryptPassword and cryptSalt")
+	assert.Nil(t, mountArgs)
+	assert.Equal(t, 1, configured)
+}
+
+func TestRewriteConfigCredentials(t *testing.T) {
+	configFile := path.Join(t.TempDir(), configFileName)
+	config := strings.Join([]string{
+		"[" + remote + "]",
+		"type = s3",
+		"access_key_id = access-key-1",
+		"secret_access_key = secret-key-1",
+		"opt1 = val1",
+		"[" + cryptRemote + "]",
+		"type = crypt",
+		"password = obscured",
+	}, "\n") + "\n"
+	assert.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	info, err := os.Stat(configFile)
+	assert.NoError(t, err)
+
+	// The same keys leave the config alone
+	rewritten, err := rewriteConfigCredentials(configFile, []string{"access_key_id = access-key-1", "secret_access_key = secret-key-1"})
+	assert.NoError(t, err)
+	assert.False(t, rewritten)
+
+	// The rotated keys are rewritten in place, the other lines kept
+	rewritten, err = rewriteConfigCredentials(configFile, []string{"access_key_id = access-key-2", "secret_access_key = secret-key-2"})
+	assert.NoError(t, err)
+	assert.True(t, rewritten)
+	data, err := os.ReadFile(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.ReplaceAll(config, "-key-1", "-key-2"), string(data))
+	updated, err := os.Stat(configFile)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(info, updated))
+	assert.Equal(t, os.FileMode(0600), updated.Mode().Perm())
+
+	// The keys replaced by an API key go at the end of the bucket remote
+	rewritten, err = rewriteConfigCredentials(configFile, []string{"ibm_api_key = api-key", "ibm_resource_instance_id = instance"})
+	assert.NoError(t, err)
+	assert.True(t, rewritten)
+	data, err = os.ReadFile(configFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "type = s3\nibm_api_key = api-key\nibm_resource_instance_id = instance\nopt1 = val1\n["+cryptRemote+"]")
+
+	_, err = rewriteConfigCredentials(path.Join(t.TempDir(), configFileName), nil)
+	assert.ErrorContains(t, err, "cannot read rclone config")
+}
+
+func TestCreateConfig(t *testing.T) {
+	configPathWithVolID := path.Join(t.TempDir(), "volume")
+	mounter := newTestRcloneMounter(t, map[string]string{"bucketName": "test-bucket-name", "apiKey": "test-api-key", "serviceId": "test-service-id"}, nil, nil)
+	assert.NoError(t, createConfig(configPathWithVolID, mounter.(*RcloneMounter)))
+
+	configFile := path.Join(configPathWithVolID, configFileName)
+	info, err := os.Stat(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, err := os.ReadFile(configFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "ibm_api_key = test-api-key\n")
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	pkgUtils "github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"k8s.io/klog/v2"
 )
 
@@ -33,8 +34,11 @@ type S3fsMounter struct {
 	AuthType      string
 	AccessKeys    string
 	KpRootKeyCrn  string
-	MountOptions  []string
-	MounterUtils  utils.MounterUtils
+	// IAMEndpoint is the endpoint the API key is exchanged at in IAM authentication
+	IAMEndpoint  string
+	MountOptions []string
+	MounterUtils utils.MounterUtils
+	Provider     pkgUtils.Provider
 }
 
 const (
@@ -81,16 +85,22 @@ func NewS3fsMounter(secretMap map[string]string, mountOptions []string, mounterU
 		mounter.KpRootKeyCrn = val
 	}
 
-	if apiKey != "" {
+	// IAM authentication is specific to IBM COS
+	mounter.Provider = getProvider(secretMap)
+	if apiKey != "" && mounter.Provider.IBMExtensions {
 		mounter.AccessKeys = fmt.Sprintf(":%s", apiKey)
 		mounter.AuthType = "iam"
+		mounter.IAMEndpoint = secretMap["iamEndpoint"]
+		if mounter.IAMEndpoint == "" {
+			mounter.IAMEndpoint = constants.DefaultIAMEndPoint
+		}
 	} else {
 		mounter.AccessKeys = fmt.Sprintf("%s:%s", accessKey, secretKey)
 		mounter.AuthType = "hmac"
 	}
 
-	klog.Infof("newS3fsMounter args:\n\tbucketName: [%s]\n\tobjPath: [%s]\n\tendPoint: [%s]\n\tlocationConstraint: [%s]\n\tauthType: [%s]\n\tkpRootKeyCrn: [%s]",
-		mounter.BucketName, mounter.ObjPath, mounter.EndPoint, mounter.LocConstraint, mounter.AuthType, mounter.KpRootKeyCrn)
+	klog.Infof("newS3fsMounter args:\n\tbucketName: [%s]\n\tobjPath: [%s]\n\tendPoint: [%s]\n\tlocationConstraint: [%s]\n\tauthType: [%s]\n\tkpRootKeyCrn: [%s]\n\tprovider: [%s]",
+		mounter.BucketName, mounter.ObjPath, mounter.EndPoint, mounter.LocConstraint, mounter.AuthType, mounter.KpRootKeyCrn, mounter.Provider.Name)
 
 	updatedOptions := updateS3FSMountOptions(mountOptions, secretMap)
 	mounter.MountOptions = updatedOptions
@@ -138,14 +148,20 @@ func (s3fs *S3fsMounter) Mount(source string, target string) error {
 	args := []string{
 		bucketName,
 		target,
-		"-o", "sigv2",
-		"-o", "use_path_request_style",
+	}
+	if s3fs.Provider.SignatureV2 {
+		args = append(args, "-o", "sigv2")
+	}
+	if !s3fs.Provider.VirtualHostedStyle {
+		args = append(args, "-o", "use_path_request_style")
+	}
+	args = append(args,
 		"-o", fmt.Sprintf("passwd_file=%s", passwdFile),
 		"-o", fmt.Sprintf("url=%s", s3fs.EndPoint),
 		"-o", fmt.Sprintf("endpoint=%s", s3fs.LocConstraint),
 		"-o", "allow_other",
 		"-o", "mp_umask=002",
-	}
+	)
 
 	for _, val := range s3fs.MountOptions {
 		args = append(args, "-o")
@@ -154,13 +170,35 @@ func (s3fs *S3fsMounter) Mount(source string, target string) error {
 
 	if s3fs.AuthType != "hmac" {
 		args = append(args, "-o", "ibm_iam_auth")
-		args = append(args, "-o", "ibm_iam_endpoint="+constants.DefaultIAMEndPoint)
+		args = append(args, "-o", "ibm_iam_endpoint="+s3fs.IAMEndpoint)
 	} else {
 		args = append(args, "-o", "default_acl=private")
 	}
 	return s3fs.MounterUtils.FuseMount(target, constants.S3FS, args)
 }
 
+// UpdateCredentials rewrites the passwd file of the volume mounted to target with
+// the keys of the secret. s3fs reads it when it mounts the volume.
+func (s3fs *S3fsMounter) UpdateCredentials(target string) (bool, error) {
+	metaPath := path.Join(metaRoot, fmt.Sprintf("%x", sha256.Sum256([]byte(target))))
+	return rewritePass(path.Join(metaPath, passFile), s3fs.AccessKeys)
+}
+
+// rewritePass rewrites a passwd file whose content changed
+func rewritePass(passwdFile, content string) (bool, error) {
+	data, err := os.ReadFile(passwdFile) // #nosec G304: Value is dynamic
+	if err != nil {
+		return false, fmt.Errorf("cannot read passwd file %s: %w", passwdFile, err)
+	}
+	if string(data) == content {
+		return false, nil
+	}
+	if err = writePassWrap(passwdFile, content); err != nil {
+		return false, fmt.Errorf("cannot rewrite passwd file %s: %w", passwdFile, err)
+	}
+	return true, nil
+}
+
 var writePassFunc = writePass
 
 // Function that wraps writePass
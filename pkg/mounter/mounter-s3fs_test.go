@@ -3,9 +3,12 @@ package mounter
 
 import (
 	"errors"
+	"maps"
 	"os"
+	"path"
 	"testing"
 
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -508,3 +511,88 @@ func TestUpdateS3FSMountOptions_Invalid_Mount_Options(t *testing.T) {
 		"uid=1001",
 	})
 }
+
+func Test_Mount_Providers(t *testing.T) {
+	FakeMkdirAll := func(path string, perm os.FileMode) error {
+		return nil
+	}
+	mkdirAllFunc = FakeMkdirAll
+	defer func() { mkdirAllFunc = os.MkdirAll }()
+	FakeWritePass := func(pwFileName string, pwFileContent string) error {
+		return nil
+	}
+	writePassFunc = FakeWritePass
+	defer func() { writePassFunc = writePass }()
+
+	testCases := []struct {
+		testCaseName string
+		provider     string
+		expected     []string
+		unexpected   []string
+	}{
+		{
+			testCaseName: "IBM COS",
+			provider:     "",
+			expected:     []string{"sigv2", "use_path_request_style", "ibm_iam_auth"},
+		},
+		{
+			testCaseName: "MinIO",
+			provider:     constants.ProviderMinIO,
+			expected:     []string{"use_path_request_style", "default_acl=private"},
+			unexpected:   []string{"sigv2", "ibm_iam_auth"},
+		},
+		{
+			testCaseName: "AWS",
+			provider:     constants.ProviderAWS,
+			expected:     []string{"default_acl=private"},
+			unexpected:   []string{"sigv2", "use_path_request_style", "ibm_iam_auth"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Log("Testcase being executed", tc.testCaseName)
+		secrets := maps.Clone(secretMap)
+		secrets["provider"] = tc.provider
+		var mountArgs []string
+		mounter := NewS3fsMounter(secrets, nil, mounterUtils.NewFakeMounterUtilsImpl(mounterUtils.FakeMounterUtilsFuncStruct{
+			FuseMountFn: func(path string, comm string, args []string) error {
+				mountArgs = args
+				return nil
+			},
+		}))
+
+		assert.NoError(t, mounter.Mount("source", "/tmp/test-mount"))
+		for _, option := range tc.expected {
+			assert.Contains(t, mountArgs, option)
+		}
+		for _, option := range tc.unexpected {
+			assert.NotContains(t, mountArgs, option)
+		}
+	}
+}
+
+func TestRewritePass(t *testing.T) {
+	passwdFile := path.Join(t.TempDir(), passFile)
+	assert.NoError(t, writePass(passwdFile, "access-key-1:secret-key-1"))
+	info, err := os.Stat(passwdFile)
+	assert.NoError(t, err)
+
+	rewritten, err := rewritePass(passwdFile, "access-key-1:secret-key-1")
+	assert.NoError(t, err)
+	assert.False(t, rewritten)
+
+	// Shorter keys leave nothing of the previous ones
+	rewritten, err = rewritePass(passwdFile, ":api-key")
+	assert.NoError(t, err)
+	assert.True(t, rewritten)
+	data, err := os.ReadFile(passwdFile)
+	assert.NoError(t, err)
+	assert.Equal(t, ":api-key", string(data))
+	updated, err := os.Stat(passwdFile)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(info, updated))
+	assert.Equal(t, os.FileMode(0600), updated.Mode().Perm())
+
+	_, err = rewritePass(path.Join(t.TempDir(), passFile), ":api-key")
+	assert.ErrorContains(t, err, "cannot read passwd file")
+}
@@ -7,25 +7,29 @@ import (
 
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	pkgUtils "github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"k8s.io/klog/v2"
 )
 
 type Mounter interface {
 	Mount(source string, target string) error
 	Unmount(target string) error
+	// UpdateCredentials rewrites in place the credentials of the volume mounted to
+	// target, in the file the mounter reads them from, and tells whether they changed
+	UpdateCredentials(target string) (bool, error)
 }
 
 type CSIMounterFactory struct{}
 
 type NewMounterFactory interface {
-	NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) Mounter
+	NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) (Mounter, error)
 }
 
 func NewCSIMounterFactory() *CSIMounterFactory {
 	return &CSIMounterFactory{}
 }
 
-func (s *CSIMounterFactory) NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) Mounter {
+func (s *CSIMounterFactory) NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) (Mounter, error) {
 	klog.Info("-NewMounter-")
 	var mounter, val string
 	var check bool
@@ -44,15 +48,25 @@ func (s *CSIMounterFactory) NewMounter(attrib map[string]string, secretMap map[s
 
 	switch mounter {
 	case constants.S3FS:
-		return NewS3fsMounter(secretMap, mountFlags, mounterUtils)
+		return NewS3fsMounter(secretMap, mountFlags, mounterUtils), nil
 	case constants.RClone:
 		return NewRcloneMounter(secretMap, mountFlags, mounterUtils)
 	default:
 		// default to s3fs
-		return NewS3fsMounter(secretMap, mountFlags, mounterUtils)
+		return NewS3fsMounter(secretMap, mountFlags, mounterUtils), nil
 	}
 }
 
+// getProvider returns the provider of a volume, set in the secret by the node server
+func getProvider(secretMap map[string]string) pkgUtils.Provider {
+	provider, err := pkgUtils.GetProvider(secretMap["provider"])
+	if err != nil {
+		klog.Warningf("%v, mounting as %s", err, pkgUtils.DefaultProvider.Name)
+		return pkgUtils.DefaultProvider
+	}
+	return provider
+}
+
 func checkPath(path string) (bool, error) {
 	if path == "" {
 		return false, errors.New("undefined path")
@@ -85,7 +99,7 @@ func isCorruptedMnt(err error) bool {
 }
 
 func writePass(pwFileName string, pwFileContent string) error {
-	pwFile, err := os.OpenFile(pwFileName, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304: Value is dynamic
+	pwFile, err := os.OpenFile(pwFileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304: Value is dynamic
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@ package mounter
 import (
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	mounterUtils "github.com/IBM/ibm-object-csi-driver/pkg/mounter/utils"
+	pkgUtils "github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"github.com/stretchr/testify/assert"
 
 	"reflect"
@@ -40,8 +41,10 @@ func TestNewMounter(t *testing.T) {
 				AccessKeys:    ":test-api-key",
 				AuthType:      "iam",
 				KpRootKeyCrn:  "test-kp-root-key-crn",
+				IAMEndpoint:   constants.DefaultIAMEndPoint,
 				MountOptions:  []string{"opt1=val1"},
 				MounterUtils:  &(mounterUtils.MounterOptsUtils{}),
+				Provider:      pkgUtils.DefaultProvider,
 			},
 			expectedErr: nil,
 		},
@@ -72,6 +75,7 @@ func TestNewMounter(t *testing.T) {
 				GID:           "fake-gid",
 				MountOptions:  []string{"opt1=val1", "opt2=val2"},
 				MounterUtils:  &(mounterUtils.MounterOptsUtils{}),
+				Provider:      pkgUtils.DefaultProvider,
 			},
 			expectedErr: nil,
 		},
@@ -98,6 +102,7 @@ func TestNewMounter(t *testing.T) {
 				KpRootKeyCrn:  "test-kp-root-key-crn",
 				MountOptions:  []string{},
 				MounterUtils:  &(mounterUtils.MounterOptsUtils{}),
+				Provider:      pkgUtils.DefaultProvider,
 			},
 			expectedErr: nil,
 		},
@@ -107,7 +112,8 @@ func TestNewMounter(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			factory := &CSIMounterFactory{}
 
-			result := factory.NewMounter(test.attrib, test.secretMap, test.mountOptions)
+			result, err := factory.NewMounter(test.attrib, test.secretMap, test.mountOptions)
+			assert.Equal(t, test.expectedErr, err)
 
 			assert.Equal(t, result, test.expected)
 
@@ -1,8 +1,10 @@
 package utils
 
 type FakeMounterUtilsFuncStruct struct {
-	FuseMountFn   func(path string, comm string, args []string) error
-	FuseUnmountFn func(path string) error
+	FuseMountFn func(path string, comm string, args []string) error
+	// FuseMountEnvFn is called in place of FuseMountFn when set, along with the environment
+	FuseMountEnvFn func(path string, comm string, args []string, env []string) error
+	FuseUnmountFn  func(path string) error
 }
 
 type FakeMounterUtilsFuncStructImpl struct {
@@ -17,7 +19,10 @@ func NewFakeMounterUtilsImpl(reqFn FakeMounterUtilsFuncStruct) *FakeMounterUtils
 	}
 }
 
-func (m *FakeMounterUtilsFuncStructImpl) FuseMount(path string, comm string, args []string) error {
+func (m *FakeMounterUtilsFuncStructImpl) FuseMount(path string, comm string, args []string, env ...string) error {
+	if m.FuncStruct.FuseMountEnvFn != nil {
+		return m.FuncStruct.FuseMountEnvFn(path, comm, args, env)
+	}
 	if m.FuncStruct.FuseMountFn != nil {
 		return m.FuncStruct.FuseMountFn(path, comm, args)
 	}
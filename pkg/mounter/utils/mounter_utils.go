@@ -18,16 +18,21 @@ var command = exec.Command
 
 type MounterUtils interface {
 	FuseUnmount(path string) error
-	FuseMount(path string, comm string, args []string) error
+	// FuseMount runs the FUSE command, with env added to its environment
+	FuseMount(path string, comm string, args []string, env ...string) error
 }
 
 type MounterOptsUtils struct {
 }
 
-func (su *MounterOptsUtils) FuseMount(path string, comm string, args []string) error {
+func (su *MounterOptsUtils) FuseMount(path string, comm string, args []string, env ...string) error {
 	klog.Info("-fuseMount-")
 	klog.Infof("fuseMount args:\n\tpath: <%s>\n\tcommand: <%s>\n\targs: <%s>", path, comm, args)
 	cmd := command(comm, args...)
+	// The environment may hold credentials, it is not logged
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	err := cmd.Start()
 
 	if err != nil {
@@ -0,0 +1,104 @@
+package s3client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+)
+
+// The errors returned by the sessions wrap one of these when their cause is known,
+// to be checked with errors.Is. The error of the SDK stays wrapped as well.
+var (
+	// ErrBucketNotFound is returned when a bucket does not exist
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrBucketTaken is returned when a bucket name is owned by another account
+	ErrBucketTaken = errors.New("bucket name owned by another account")
+	// ErrAccessDenied is returned when the credentials are not allowed the request
+	ErrAccessDenied = errors.New("access denied")
+	// ErrThrottled is returned when the endpoint asks for the requests to slow down
+	ErrThrottled = errors.New("request throttled")
+	// ErrInvalidCredentials is returned when the credentials are expired or invalid
+	ErrInvalidCredentials = errors.New("credentials expired or invalid")
+	// ErrEndpointUnreachable is returned when the endpoint cannot be reached
+	ErrEndpointUnreachable = errors.New("endpoint unreachable")
+	// ErrBucketProtected is returned when objects of a bucket cannot be deleted because
+	// of a retention policy or object lock
+	ErrBucketProtected = errors.New("objects are protected by a retention policy or object lock")
+)
+
+// s3Error is an error of the SDK along with the sentinel of its cause. It reads as
+// the error of the SDK.
+type s3Error struct {
+	kind error
+	err  error
+}
+
+func (e *s3Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *s3Error) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// classifyError wraps an error of the SDK with the sentinel of its cause. The
+// context error of a cancelled request is wrapped instead, the SDK hiding it.
+// Errors of unknown cause are returned as they are.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind := errorKind(err); kind != nil {
+		return &s3Error{kind: kind, err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case request.CanceledErrorCode:
+			return aerr.OrigErr()
+		// The responses to HEAD requests carry the status text as code
+		case "NoSuchBucket", "NotFound":
+			return ErrBucketNotFound
+		case "BucketAlreadyExists":
+			return ErrBucketTaken
+		case "AccessDenied", "AllAccessDisabled", "Forbidden":
+			return ErrAccessDenied
+		case "SlowDown", "ServiceUnavailable":
+			return ErrThrottled
+		case "InvalidAccessKeyId", "SignatureDoesNotMatch", "InvalidToken", "TokenRefreshRequired",
+			"ErrFetchingIAMToken", "TokenManagerRetrieveError":
+			return ErrInvalidCredentials
+		case request.ErrCodeRequestError, request.ErrCodeResponseTimeout, "RequestTimeout":
+			return ErrEndpointUnreachable
+		}
+		if request.IsErrorThrottle(aerr) {
+			return ErrThrottled
+		}
+		if request.IsErrorExpiredCreds(aerr) {
+			return ErrInvalidCredentials
+		}
+	}
+
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) {
+		switch rerr.StatusCode() {
+		case http.StatusUnauthorized:
+			return ErrInvalidCredentials
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return ErrThrottled
+		}
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return ErrEndpointUnreachable
+	}
+	return nil
+}
@@ -1,8 +1,17 @@
 package s3client
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"go.uber.org/zap"
 )
 
@@ -11,6 +20,50 @@ type FakeCOSSessionFactory struct {
 	FailCheckBucketAccess bool
 	FailCreateBucket      bool
 	FailDeleteBucket      bool
+	FailListBuckets       bool
+	FailListObjects       bool
+	FailDeleteObjects     bool
+	FailCopyObject        bool
+	FailSetBucketTags     bool
+	FailGetBucketTags     bool
+	FailGetObject         bool
+	FailUploadObject      bool
+	FailGetLifecycle      bool
+	FailSetLifecycle      bool
+	FailSetVersioning     bool
+	FailGetProtection     bool
+	FailTokenExchange     bool
+
+	// Buckets is returned by ListBuckets
+	Buckets []string
+	// TakenBuckets are owned by another account, they cannot be accessed nor created
+	TakenBuckets []string
+	// Objects holds the objects returned by ListObjects, keyed by bucket
+	Objects map[string][]ObjectInfo
+	// BucketTags holds the tags returned by GetBucketTags and set by SetBucketTags, keyed by bucket
+	BucketTags map[string]map[string]string
+	// Lifecycle is returned by GetBucketLifecycle and replaced by SetBucketLifecycle
+	// and CreateBucket
+	Lifecycle BucketLifecycle
+	// Versioning is set by SetBucketVersioning and CreateBucket
+	Versioning *bool
+	// Retention and ObjectLock are returned by GetBucketRetention and GetBucketObjectLock,
+	// and set by CreateBucket
+	Retention  *BucketRetention
+	ObjectLock *BucketObjectLock
+	// ProtectedBuckets hold objects under retention, DeleteBucket fails with ErrBucketProtected
+	ProtectedBuckets []string
+	// DeletionBlocked, when set, blocks DeleteBucket and DeleteObjects until it is closed
+	// or their context is done
+	DeletionBlocked chan struct{}
+	// DeletedBuckets records the buckets passed to DeleteBucket
+	DeletedBuckets []string
+	// TagsRead records the buckets passed to GetBucketTags
+	TagsRead []string
+	// DeletedPrefixes records the bucket and prefix passed to DeleteObjects, as "bucket/prefix"
+	DeletedPrefixes []string
+	// Providers records the names of the providers of the sessions created
+	Providers []string
 }
 
 type fakeCOSSession struct {
@@ -18,33 +71,212 @@ type fakeCOSSession struct {
 }
 
 // NewObjectStorageSession method creates a new fake object store session
-func (f *FakeCOSSessionFactory) NewObjectStorageSession(endpoint, region string, creds *ObjectStorageCredentials, lgr *zap.Logger) ObjectStorageSession {
+func (f *FakeCOSSessionFactory) NewObjectStorageSession(provider utils.Provider, endpoint, region string, creds *ObjectStorageCredentials, lgr *zap.Logger) ObjectStorageSession {
+	f.Providers = append(f.Providers, provider.Name)
 	return &fakeCOSSession{
 		factory: f,
 	}
 }
 
-func (s *fakeCOSSession) CheckBucketAccess(bucket string) error {
+// TrustedProfileToken returns a fake IAM token derived from the service account token
+func (f *FakeCOSSessionFactory) TrustedProfileToken(ctx context.Context, creds *ObjectStorageCredentials) (*token.Token, error) {
+	if f.FailTokenExchange {
+		return nil, fmt.Errorf("cannot get an IAM token of trusted profile %s: %w", creds.TrustedProfileID, ErrInvalidCredentials)
+	}
+	return &token.Token{
+		AccessToken: "iam-token-" + creds.ServiceAccountToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   3600,
+		Expiration:  time.Now().Add(time.Hour).Unix(),
+	}, nil
+}
+
+// APIKeyToken returns a fake IAM token derived from the API key
+func (f *FakeCOSSessionFactory) APIKeyToken(ctx context.Context, creds *ObjectStorageCredentials) (*token.Token, error) {
+	if f.FailTokenExchange {
+		return nil, fmt.Errorf("cannot get an IAM token of the API key: %w", ErrInvalidCredentials)
+	}
+	return &token.Token{
+		AccessToken: "iam-token-" + creds.APIKey,
+		TokenType:   "Bearer",
+		ExpiresIn:   3600,
+		Expiration:  time.Now().Add(time.Hour).Unix(),
+	}, nil
+}
+
+// AssumeRoleWithWebIdentity returns fake temporary credentials derived from the
+// service account token
+func (f *FakeCOSSessionFactory) AssumeRoleWithWebIdentity(ctx context.Context, creds *ObjectStorageCredentials) (*TemporaryCredentials, error) {
+	if f.FailTokenExchange {
+		return nil, fmt.Errorf("cannot assume role %s: %w", creds.RoleARN, ErrInvalidCredentials)
+	}
+	return &TemporaryCredentials{
+		AccessKey:    "temporary-access-key",
+		SecretKey:    "temporary-secret-key",
+		SessionToken: "session-token-" + creds.ServiceAccountToken,
+		Expiration:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func (s *fakeCOSSession) CheckBucketAccess(ctx context.Context, bucket string) error {
 	if s.factory.FailCheckBucketAccess {
 		return errors.New("failed to check bucket access")
 	}
+	if slices.Contains(s.factory.TakenBuckets, bucket) {
+		return classifyError(awserr.New("Forbidden", "Forbidden", nil))
+	}
 	return nil
 }
 
-func (s *fakeCOSSession) CheckObjectPathExistence(bucket, objectpath string) (bool, error) {
+func (s *fakeCOSSession) CheckObjectPathExistence(ctx context.Context, bucket, objectpath string) (bool, error) {
 	return true, nil
 }
 
-func (s *fakeCOSSession) CreateBucket(bucket, kpRootKeyCrn string) (string, error) {
+func (s *fakeCOSSession) CreateBucket(ctx context.Context, bucket string, opts BucketOptions) (string, error) {
 	if s.factory.FailCreateBucket {
 		return "", errors.New("failed to create bucket")
 	}
+	if slices.Contains(s.factory.TakenBuckets, bucket) {
+		return "", classifyError(awserr.New("BucketAlreadyExists", "the requested bucket name is not available", nil))
+	}
+	if opts.Versioning || opts.ObjectLock != nil {
+		enabled := true
+		s.factory.Versioning = &enabled
+	}
+	s.factory.Retention = opts.Retention
+	s.factory.ObjectLock = opts.ObjectLock
+	if opts.Lifecycle != nil {
+		s.factory.Lifecycle = *opts.Lifecycle
+	}
 	return "", nil
 }
 
-func (s *fakeCOSSession) DeleteBucket(bucket string) error {
+func (s *fakeCOSSession) DeleteBucket(ctx context.Context, bucket string, progress *DeleteProgress) error {
+	if s.factory.DeletionBlocked != nil {
+		select {
+		case <-s.factory.DeletionBlocked:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	if s.factory.FailDeleteBucket {
 		return errors.New("failed to delete bucket")
 	}
+	if slices.Contains(s.factory.ProtectedBuckets, bucket) {
+		return fmt.Errorf("%w: cannot delete bucket %s", ErrBucketProtected, bucket)
+	}
+	s.factory.DeletedBuckets = append(s.factory.DeletedBuckets, bucket)
+	if progress != nil {
+		progress.Deleted.Add(int64(len(s.factory.Objects[bucket])))
+	}
 	return nil
 }
+
+func (s *fakeCOSSession) ListBuckets(ctx context.Context) ([]string, error) {
+	if s.factory.FailListBuckets {
+		return nil, errors.New("failed to list buckets")
+	}
+	return s.factory.Buckets, nil
+}
+
+func (s *fakeCOSSession) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	if s.factory.FailListObjects {
+		return nil, errors.New("failed to list objects")
+	}
+	return s.factory.Objects[bucket], nil
+}
+
+func (s *fakeCOSSession) DeleteObjects(ctx context.Context, bucket, prefix string, progress *DeleteProgress) error {
+	if s.factory.DeletionBlocked != nil {
+		select {
+		case <-s.factory.DeletionBlocked:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if s.factory.FailDeleteObjects {
+		return errors.New("failed to delete objects")
+	}
+	s.factory.DeletedPrefixes = append(s.factory.DeletedPrefixes, bucket+"/"+prefix)
+	return nil
+}
+
+func (s *fakeCOSSession) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if s.factory.FailCopyObject {
+		return errors.New("failed to copy object")
+	}
+	return nil
+}
+
+func (s *fakeCOSSession) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if s.factory.FailGetObject {
+		return nil, errors.New("failed to get object")
+	}
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+func (s *fakeCOSSession) UploadObject(ctx context.Context, bucket, key string, body io.Reader, size int64) error {
+	if s.factory.FailUploadObject {
+		return errors.New("failed to upload object")
+	}
+	return nil
+}
+
+func (s *fakeCOSSession) SetBucketTags(ctx context.Context, bucket string, tags map[string]string) error {
+	if s.factory.FailSetBucketTags {
+		return errors.New("failed to set bucket tags")
+	}
+	if s.factory.BucketTags == nil {
+		s.factory.BucketTags = map[string]map[string]string{}
+	}
+	s.factory.BucketTags[bucket] = tags
+	return nil
+}
+
+func (s *fakeCOSSession) GetBucketTags(ctx context.Context, bucket string) (map[string]string, error) {
+	s.factory.TagsRead = append(s.factory.TagsRead, bucket)
+	if s.factory.FailGetBucketTags {
+		return nil, errors.New("failed to get bucket tags")
+	}
+	if tags, ok := s.factory.BucketTags[bucket]; ok {
+		return tags, nil
+	}
+	return map[string]string{}, nil
+}
+
+func (s *fakeCOSSession) GetBucketLifecycle(ctx context.Context, bucket string) (BucketLifecycle, error) {
+	if s.factory.FailGetLifecycle {
+		return BucketLifecycle{}, errors.New("failed to get bucket lifecycle")
+	}
+	return s.factory.Lifecycle, nil
+}
+
+func (s *fakeCOSSession) SetBucketLifecycle(ctx context.Context, bucket string, lifecycle BucketLifecycle) error {
+	if s.factory.FailSetLifecycle {
+		return errors.New("failed to set bucket lifecycle")
+	}
+	s.factory.Lifecycle = lifecycle
+	return nil
+}
+
+func (s *fakeCOSSession) SetBucketVersioning(ctx context.Context, bucket string, enabled bool) error {
+	if s.factory.FailSetVersioning {
+		return errors.New("failed to set bucket versioning")
+	}
+	s.factory.Versioning = &enabled
+	return nil
+}
+
+func (s *fakeCOSSession) GetBucketRetention(ctx context.Context, bucket string) (*BucketRetention, error) {
+	if s.factory.FailGetProtection {
+		return nil, errors.New("failed to get bucket retention")
+	}
+	return s.factory.Retention, nil
+}
+
+func (s *fakeCOSSession) GetBucketObjectLock(ctx context.Context, bucket string) (*BucketObjectLock, error) {
+	if s.factory.FailGetProtection {
+		return nil, errors.New("failed to get bucket object lock")
+	}
+	return s.factory.ObjectLock, nil
+}
@@ -0,0 +1,350 @@
+package s3client
+
+import (
+	"crypto/md5" // #nosec G501: ETags are MD5 digests
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeS3Server is an in-process S3 endpoint keeping its buckets in memory, for the
+// tests to run sessions against. It serves the subset of the S3 API used by the
+// driver, with the buckets addressed in the path of the URLs. Requests are not
+// authenticated, the signature scheme of each request is recorded.
+type FakeS3Server struct {
+	*httptest.Server
+
+	mutex   sync.Mutex
+	buckets map[string]*fakeBucket
+	// signatures records the scheme of the Authorization header of each request
+	signatures []string
+}
+
+type fakeBucket struct {
+	location   string
+	versioning bool
+	objects    map[string]fakeObject
+}
+
+type fakeObject struct {
+	data     []byte
+	metadata http.Header
+	etag     string
+}
+
+// NewFakeS3Server starts a fake S3 endpoint, to be closed by the caller
+func NewFakeS3Server() *FakeS3Server {
+	f := &FakeS3Server{buckets: map[string]*fakeBucket{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+// BucketLocation returns the location constraint a bucket was created with
+func (f *FakeS3Server) BucketLocation(bucket string) (string, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	b, ok := f.buckets[bucket]
+	if !ok {
+		return "", false
+	}
+	return b.location, true
+}
+
+// Signatures returns the scheme of the Authorization header of the requests served
+func (f *FakeS3Server) Signatures() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return slices.Clone(f.signatures)
+}
+
+type fakeS3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+func (f *FakeS3Server) serve(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	f.signatures = append(f.signatures, scheme)
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		f.listBuckets(w)
+	case bucket == "":
+		writeFakeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	case key == "" && r.Method == http.MethodPut && len(query) == 0:
+		f.createBucket(w, r, bucket)
+	case f.buckets[bucket] == nil:
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeFakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+	case key == "":
+		f.serveBucket(w, r, bucket, query)
+	default:
+		f.serveObject(w, r, f.buckets[bucket], key)
+	}
+}
+
+func (f *FakeS3Server) createBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	if _, ok := f.buckets[bucket]; ok {
+		writeFakeS3Error(w, http.StatusConflict, "BucketAlreadyOwnedByYou")
+		return
+	}
+	var config struct {
+		LocationConstraint string
+	}
+	if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+		if err := xml.Unmarshal(body, &config); err != nil {
+			writeFakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+	}
+	f.buckets[bucket] = &fakeBucket{location: config.LocationConstraint, objects: map[string]fakeObject{}}
+}
+
+func (f *FakeS3Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string, query url.Values) {
+	b := f.buckets[bucket]
+	switch {
+	case r.Method == http.MethodHead:
+	case r.Method == http.MethodDelete && len(query) == 0:
+		if len(b.objects) > 0 {
+			writeFakeS3Error(w, http.StatusConflict, "BucketNotEmpty")
+			return
+		}
+		delete(f.buckets, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		listObjectsV2(w, bucket, b, query)
+	case r.Method == http.MethodGet && query.Has("versions"):
+		listObjectVersions(w, bucket, b, query.Get("prefix"))
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		writeFakeS3Response(w, struct {
+			XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+			Bucket      string
+			IsTruncated bool
+		}{Bucket: bucket})
+	case r.Method == http.MethodPost && query.Has("delete"):
+		deleteObjects(w, r, b)
+	case r.Method == http.MethodPut && query.Has("versioning"):
+		var config struct {
+			Status string
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := xml.Unmarshal(body, &config); err != nil {
+			writeFakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		b.versioning = config.Status == "Enabled"
+	default:
+		writeFakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *FakeS3Server) serveObject(w http.ResponseWriter, r *http.Request, b *fakeBucket, key string) {
+	if len(r.URL.Query()) > 0 {
+		writeFakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var object fakeObject
+		source := r.Header.Get("X-Amz-Copy-Source")
+		if source != "" {
+			source, _ = url.PathUnescape(source)
+			srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+			src, ok := f.buckets[srcBucket]
+			if !ok {
+				writeFakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+				return
+			}
+			if object, ok = src.objects[srcKey]; !ok {
+				writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+		} else {
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeFakeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+				return
+			}
+			digest := md5.Sum(data) // #nosec G401: ETags are MD5 digests
+			object = fakeObject{data: data, metadata: http.Header{}, etag: `"` + hex.EncodeToString(digest[:]) + `"`}
+			for name, values := range r.Header {
+				if strings.HasPrefix(name, "X-Amz-Meta-") {
+					object.metadata[name] = values
+				}
+			}
+		}
+		b.objects[key] = object
+		w.Header().Set("ETag", object.etag)
+		if source != "" {
+			writeFakeS3Response(w, struct {
+				XMLName xml.Name `xml:"CopyObjectResult"`
+				ETag    string
+			}{ETag: object.etag})
+		}
+	case http.MethodGet, http.MethodHead:
+		object, ok := b.objects[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for name, values := range object.metadata {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", object.etag)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object.data)
+		}
+	case http.MethodDelete:
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *FakeS3Server) listBuckets(w http.ResponseWriter) {
+	type bucket struct {
+		Name         string
+		CreationDate time.Time
+	}
+	var buckets []bucket
+	for name := range f.buckets {
+		buckets = append(buckets, bucket{Name: name, CreationDate: time.Now().UTC()})
+	}
+	slices.SortFunc(buckets, func(a, b bucket) int { return strings.Compare(a.Name, b.Name) })
+	writeFakeS3Response(w, struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Buckets: buckets})
+}
+
+type fakeS3Object struct {
+	Key          string
+	Size         int
+	ETag         string
+	LastModified time.Time
+}
+
+// listObjectsV2 lists the objects after the continuation token, which is the last
+// key of the previous page
+func listObjectsV2(w http.ResponseWriter, bucket string, b *fakeBucket, query url.Values) {
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n > 0 {
+		maxKeys = n
+	}
+	after := query.Get("continuation-token")
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []fakeS3Object
+	}{Name: bucket, Prefix: query.Get("prefix"), MaxKeys: maxKeys}
+	for _, key := range b.sortedKeys(result.Prefix) {
+		if key <= after {
+			continue
+		}
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[maxKeys-1].Key
+			break
+		}
+		object := b.objects[key]
+		result.Contents = append(result.Contents, fakeS3Object{Key: key, Size: len(object.data), ETag: object.etag, LastModified: time.Now().UTC()})
+	}
+	result.KeyCount = len(result.Contents)
+	writeFakeS3Response(w, result)
+}
+
+// listObjectVersions lists the objects as their only version, the fake server
+// keeping a single version of each object
+func listObjectVersions(w http.ResponseWriter, bucket string, b *fakeBucket, prefix string) {
+	type version struct {
+		Key       string
+		VersionId string //nolint:revive // the element name of the S3 API
+		IsLatest  bool
+		Size      int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListVersionsResult"`
+		Name        string
+		Prefix      string
+		IsTruncated bool
+		Versions    []version `xml:"Version"`
+	}{Name: bucket, Prefix: prefix}
+	for _, key := range b.sortedKeys(prefix) {
+		result.Versions = append(result.Versions, version{Key: key, VersionId: "null", IsLatest: true, Size: len(b.objects[key].data)})
+	}
+	writeFakeS3Response(w, result)
+}
+
+func deleteObjects(w http.ResponseWriter, r *http.Request, b *fakeBucket) {
+	var request struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	if err := xml.Unmarshal(body, &request); err != nil {
+		writeFakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	type deleted struct {
+		Key string
+	}
+	result := struct {
+		XMLName xml.Name  `xml:"DeleteResult"`
+		Deleted []deleted `xml:"Deleted"`
+	}{}
+	for _, object := range request.Objects {
+		delete(b.objects, object.Key)
+		result.Deleted = append(result.Deleted, deleted{Key: object.Key})
+	}
+	writeFakeS3Response(w, result)
+}
+
+func (b *fakeBucket) sortedKeys(prefix string) []string {
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func writeFakeS3Response(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(response)
+}
+
+func writeFakeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(fakeS3Error{Code: code, Message: code})
+}
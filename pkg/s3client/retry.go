@@ -0,0 +1,133 @@
+package s3client
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RetryPolicy tells how the failed requests of a session are retried. Only the
+// idempotent operations are retried, when the endpoint is throttling the requests,
+// cannot be reached or fails with a server error.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a request, the first one included.
+	// Requests are not retried when it is 1 or less.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, doubled at each retry
+	BaseBackoff time.Duration
+	// MaxBackoff bounds the delay between two attempts
+	MaxBackoff time.Duration
+	// Jitter is the fraction of the delay, between 0 and 1, randomly taken off
+	// so that the requests failing together are not retried together
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the retry policy of the sessions unless set otherwise
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseBackoff: 200 * time.Millisecond,
+	MaxBackoff:  20 * time.Second,
+	Jitter:      0.5,
+}
+
+// nonIdempotentOperations are never retried: a retried CreateMultipartUpload leaves
+// an upload behind, and a retried CompleteMultipartUpload fails once the first
+// attempt went through
+var nonIdempotentOperations = map[string]bool{
+	"CreateMultipartUpload":   true,
+	"CompleteMultipartUpload": true,
+}
+
+var (
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ibm_object_csi",
+		Name:      "cos_request_retries_total",
+		Help:      "Number of COS requests retried, by operation and cause of the failure",
+	}, []string{"operation", "reason"})
+	giveUpsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ibm_object_csi",
+		Name:      "cos_request_giveups_total",
+		Help:      "Number of retryable COS requests failed after their last attempt, by operation and cause of the failure",
+	}, []string{"operation", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(retriesTotal, giveUpsTotal)
+}
+
+// retryer applies a RetryPolicy to the requests of a session
+type retryer struct {
+	policy RetryPolicy
+}
+
+var _ request.Retryer = retryer{}
+
+func (r retryer) MaxRetries() int {
+	return max(r.policy.MaxAttempts-1, 0)
+}
+
+func (r retryer) ShouldRetry(req *request.Request) bool {
+	reason := retryReason(req)
+	if reason == "" || nonIdempotentOperations[req.Operation.Name] {
+		return false
+	}
+	if req.RetryCount >= r.MaxRetries() {
+		giveUpsTotal.WithLabelValues(req.Operation.Name, reason).Inc()
+		return false
+	}
+	return true
+}
+
+// RetryRules returns the delay before the next attempt, growing exponentially. The
+// delay asked by a throttling endpoint is honoured, within MaxBackoff.
+func (r retryer) RetryRules(req *request.Request) time.Duration {
+	retriesTotal.WithLabelValues(req.Operation.Name, retryReason(req)).Inc()
+
+	if delay, ok := retryAfter(req); ok {
+		return min(delay, r.policy.MaxBackoff)
+	}
+	delay := r.policy.MaxBackoff
+	if req.RetryCount < 30 {
+		delay = min(r.policy.BaseBackoff<<req.RetryCount, r.policy.MaxBackoff)
+	}
+	jitter := min(max(r.policy.Jitter, 0), 1)
+	// #nosec G404: the jitter needs no secure random numbers
+	return delay - time.Duration(jitter*rand.Float64()*float64(delay))
+}
+
+// retryReason returns the cause of the failure of a request, or an empty string
+// when retrying it would not help
+func retryReason(req *request.Request) string {
+	switch kind := errorKind(req.Error); kind {
+	case ErrThrottled:
+		return "throttled"
+	case ErrEndpointUnreachable:
+		return "unreachable"
+	case nil:
+	default:
+		return ""
+	}
+	var rerr awserr.RequestFailure
+	if errors.As(req.Error, &rerr) && rerr.StatusCode() >= http.StatusInternalServerError {
+		return "server_error"
+	}
+	return ""
+}
+
+// retryAfter returns the delay asked by the endpoint in the Retry-After header
+func retryAfter(req *request.Request) (time.Duration, bool) {
+	if req.HTTPResponse == nil {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(req.HTTPResponse.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
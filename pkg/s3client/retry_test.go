@@ -0,0 +1,118 @@
+package s3client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+// newFailingEndpoint returns an endpoint answering with status to the first
+// failures requests, and with 200 afterwards, along with its request count
+func newFailingEndpoint(t *testing.T, status, failures int) (string, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &calls
+}
+
+func newRetryingSession(endpoint string, policy RetryPolicy) ObjectStorageSession {
+	f := NewObjectStorageSessionFactory(0, policy, SessionCache{})
+	return f.NewObjectStorageSession(utils.DefaultProvider, endpoint, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+}
+
+func Test_Retry_Throttled(t *testing.T) {
+	endpoint, calls := newFailingEndpoint(t, http.StatusServiceUnavailable, 2)
+	retries := testutil.ToFloat64(retriesTotal.WithLabelValues("HeadBucket", "throttled"))
+
+	err := newRetryingSession(endpoint, testRetryPolicy).CheckBucketAccess(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, retries+2, testutil.ToFloat64(retriesTotal.WithLabelValues("HeadBucket", "throttled")))
+}
+
+func Test_Retry_ServerError(t *testing.T) {
+	endpoint, calls := newFailingEndpoint(t, http.StatusInternalServerError, 1)
+	err := newRetryingSession(endpoint, testRetryPolicy).CheckBucketAccess(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func Test_Retry_GiveUp(t *testing.T) {
+	endpoint, calls := newFailingEndpoint(t, http.StatusServiceUnavailable, 10)
+	giveUps := testutil.ToFloat64(giveUpsTotal.WithLabelValues("HeadBucket", "throttled"))
+
+	err := newRetryingSession(endpoint, testRetryPolicy).CheckBucketAccess(ctx, testBucket)
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, giveUps+1, testutil.ToFloat64(giveUpsTotal.WithLabelValues("HeadBucket", "throttled")))
+}
+
+func Test_Retry_NotRetryable(t *testing.T) {
+	endpoint, calls := newFailingEndpoint(t, http.StatusForbidden, 10)
+	err := newRetryingSession(endpoint, testRetryPolicy).CheckBucketAccess(ctx, testBucket)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func Test_Retry_Disabled(t *testing.T) {
+	endpoint, calls := newFailingEndpoint(t, http.StatusServiceUnavailable, 10)
+	err := newRetryingSession(endpoint, RetryPolicy{MaxAttempts: 1}).CheckBucketAccess(ctx, testBucket)
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func Test_Retry_NonIdempotentOperation(t *testing.T) {
+	r := retryer{policy: testRetryPolicy}
+	req := &request.Request{Error: awserr.New("SlowDown", "", nil)}
+
+	req.Operation = &request.Operation{Name: "PutObject"}
+	assert.True(t, r.ShouldRetry(req))
+	req.Operation = &request.Operation{Name: "CompleteMultipartUpload"}
+	assert.False(t, r.ShouldRetry(req))
+}
+
+func Test_Retry_Backoff(t *testing.T) {
+	r := retryer{policy: RetryPolicy{MaxAttempts: 10, BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}}
+	req := &request.Request{Operation: &request.Operation{Name: "HeadBucket"}, Error: awserr.New("SlowDown", "", nil)}
+
+	for retryCount, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		req.RetryCount = retryCount
+		assert.Equal(t, expected*time.Millisecond, r.RetryRules(req))
+	}
+
+	r.policy.Jitter = 0.5
+	req.RetryCount = 1
+	for i := 0; i < 10; i++ {
+		delay := r.RetryRules(req)
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.LessOrEqual(t, delay, 200*time.Millisecond)
+	}
+}
+
+func Test_Retry_RetryAfter(t *testing.T) {
+	r := retryer{policy: RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Second}}
+	req := &request.Request{
+		Operation:    &request.Operation{Name: "HeadBucket"},
+		Error:        awserr.New("SlowDown", "", nil),
+		HTTPResponse: &http.Response{Header: http.Header{"Retry-After": []string{"2"}}},
+	}
+	assert.Equal(t, 2*time.Second, r.RetryRules(req))
+
+	req.HTTPResponse.Header.Set("Retry-After", "60")
+	assert.Equal(t, 5*time.Second, r.RetryRules(req))
+}
@@ -17,16 +17,29 @@
 package s3client
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/IBM/ibm-cos-sdk-go/aws"
 	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
 	"github.com/IBM/ibm-cos-sdk-go/aws/credentials"
 	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam"
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
 	"github.com/IBM/ibm-cos-sdk-go/aws/session"
 	"github.com/IBM/ibm-cos-sdk-go/service/s3"
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"go.uber.org/zap"
 )
 
@@ -46,30 +59,207 @@ type ObjectStorageCredentials struct {
 	KpRootKeyCRN string
 	//IAMEndpoint ...
 	IAMEndpoint string
+	// TrustedProfileID is the IBM IAM trusted profile assumed with the service account
+	// token in workload identity authentication
+	TrustedProfileID string
+	// RoleARN is the role assumed through AWS STS with the service account token in
+	// workload identity authentication
+	RoleARN string
+	// STSEndpoint is the AWS STS endpoint the role is assumed at
+	STSEndpoint string
+	// ServiceAccountToken is the token of the pod exchanged for short-lived credentials
+	ServiceAccountToken string
 }
 
-// ObjectStorageSession is an interface of an object store session
+// ObjectStorageSession is an interface of an object store session. The requests
+// sent by its methods are cancelled with their context.
 type ObjectStorageSession interface {
 	// CheckBucketAccess method check that a bucket can be accessed
-	CheckBucketAccess(bucket string) error
+	CheckBucketAccess(ctx context.Context, bucket string) error
 
 	// CheckObjectPathExistence method checks that object-path exists inside bucket
-	CheckObjectPathExistence(bucket, objectpath string) (bool, error)
+	CheckObjectPathExistence(ctx context.Context, bucket, objectpath string) (bool, error)
 
-	// CreateBucket methods creates a new bucket
-	CreateBucket(bucket, kpRootKeyCrn string) (string, error)
+	// CreateBucket methods creates a new bucket with the given options
+	CreateBucket(ctx context.Context, bucket string, opts BucketOptions) (string, error)
 
-	// DeleteBucket methods deletes a bucket (with all of its objects)
-	DeleteBucket(bucket string) error
+	// DeleteBucket methods deletes a bucket (with all of its objects and object versions),
+	// aborting the uploads in progress. progress, if set, counts the objects deleted.
+	// ErrBucketProtected is returned when objects under retention are left.
+	DeleteBucket(ctx context.Context, bucket string, progress *DeleteProgress) error
+
+	// ListBuckets method lists the names of all buckets visible to the credentials
+	ListBuckets(ctx context.Context) ([]string, error)
+
+	// ListObjects method lists all objects of a bucket whose key starts with prefix
+	ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+
+	// DeleteObjects method deletes all objects of a bucket whose key starts with prefix,
+	// along with their versions and uploads in progress. progress, if set, counts the
+	// objects deleted.
+	DeleteObjects(ctx context.Context, bucket, prefix string, progress *DeleteProgress) error
+
+	// CopyObject method copies an object server-side, possibly into another bucket
+	CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error
+
+	// GetObject method returns the content of an object, to be closed by the caller
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+
+	// UploadObject method writes an object from a stream of the given size, in parts
+	// when it is large. A negative size stands for an unknown size.
+	UploadObject(ctx context.Context, bucket, key string, body io.Reader, size int64) error
+
+	// SetBucketTags method records tags on a bucket, replacing any existing ones
+	SetBucketTags(ctx context.Context, bucket string, tags map[string]string) error
+
+	// GetBucketTags method returns the tags recorded on a bucket
+	GetBucketTags(ctx context.Context, bucket string) (map[string]string, error)
+
+	// GetBucketLifecycle method returns the lifecycle rules of a bucket
+	GetBucketLifecycle(ctx context.Context, bucket string) (BucketLifecycle, error)
+
+	// SetBucketLifecycle method replaces the lifecycle rules of a bucket, removing them when none is set
+	SetBucketLifecycle(ctx context.Context, bucket string, lifecycle BucketLifecycle) error
+
+	// SetBucketVersioning method enables or suspends the versioning of a bucket
+	SetBucketVersioning(ctx context.Context, bucket string, enabled bool) error
+
+	// GetBucketRetention method returns the retention policy of a bucket, nil when it has none
+	GetBucketRetention(ctx context.Context, bucket string) (*BucketRetention, error)
+
+	// GetBucketObjectLock method returns the object lock settings of a bucket, nil when it is not enabled
+	GetBucketObjectLock(ctx context.Context, bucket string) (*BucketObjectLock, error)
+}
+
+// ObjectInfo holds the key, size and entity tag of an object stored in a bucket
+type ObjectInfo struct {
+	Key  string
+	Size int64
+	ETag string
+}
+
+// BucketOptions holds the settings applied to a bucket when it is created
+type BucketOptions struct {
+	// KPRootKeyCRN is the Key Protect root key encrypting the bucket, if any
+	KPRootKeyCRN string
+	// Lifecycle holds the lifecycle rules installed on the bucket, if any
+	Lifecycle *BucketLifecycle
+	// Versioning enables the versioning of the bucket
+	Versioning bool
+	// Retention holds the retention policy of the bucket, if any
+	Retention *BucketRetention
+	// ObjectLock enables object lock on the bucket, if set
+	ObjectLock *BucketObjectLock
+}
+
+// BucketRetention holds the retention periods of the objects of a bucket, in days
+type BucketRetention struct {
+	MinimumDays int64
+	DefaultDays int64
+	MaximumDays int64
+}
+
+// BucketObjectLock holds the object lock settings of a bucket. Objects are locked
+// in compliance mode, for DefaultDays unless set otherwise when they are written.
+type BucketObjectLock struct {
+	DefaultDays int64
+}
+
+// BucketLifecycle holds the lifecycle rules of a bucket. A rule whose number of
+// days is zero is not set.
+type BucketLifecycle struct {
+	// ExpirationDays is the age in days at which objects are deleted
+	ExpirationDays int64
+	// ArchiveDays is the age in days at which objects move to the archive tier
+	ArchiveDays int64
+	// ArchiveType is the storage class of the archive tier, GLACIER or ACCELERATED
+	ArchiveType string
+	// NoncurrentExpirationDays is the number of days after which noncurrent object
+	// versions are deleted
+	NoncurrentExpirationDays int64
+	// AbortMultipartDays is the number of days after which incomplete multipart
+	// uploads are aborted
+	AbortMultipartDays int64
+}
+
+// lifecycleRuleID is the ID of the lifecycle rule set by SetBucketLifecycle
+const lifecycleRuleID = "csi-lifecycle"
+
+// uploadPartSize is the size of the parts of the objects uploaded by UploadObject
+const uploadPartSize = 16 * 1024 * 1024
+
+const (
+	// deleteBatchSize is the number of keys deleted by a request, the most S3 allows
+	deleteBatchSize = 1000
+	// deleteWorkers is the number of delete requests run in parallel
+	deleteWorkers = 8
+)
+
+// DeleteProgress counts the objects and object versions deleted by DeleteBucket and
+// DeleteObjects. It may be read while the deletion runs.
+type DeleteProgress struct {
+	Deleted atomic.Int64
 }
 
 // COSSessionFactory represents a COS (S3) session factory
-type COSSessionFactory struct{}
+type COSSessionFactory struct {
+	// requestTimeout bounds each request sent to the endpoint, retries included,
+	// unless it is zero
+	requestTimeout time.Duration
+	// retry tells how the failed requests are retried
+	retry RetryPolicy
+	// clients are the clients of the sessions created lately, reused along with
+	// their IAM token by the sessions of the same endpoint and credentials
+	clients *utils.Cache[*s3.S3]
+	// tags keeps the tags of the buckets of the sessions, which cannot tag buckets
+	// without it
+	tags BucketTagStore
+}
+
+// BucketTagStore keeps the tags of the buckets, as the COS S3 API has no bucket tagging
+type BucketTagStore interface {
+	// GetBucketTags returns the tags of a bucket, none when it was never tagged
+	GetBucketTags(ctx context.Context, bucket string) (map[string]string, error)
+	// SetBucketTags replaces the tags of a bucket
+	SetBucketTags(ctx context.Context, bucket string, tags map[string]string) error
+	// DeleteBucketTags drops the tags of a bucket
+	DeleteBucketTags(ctx context.Context, bucket string) error
+}
+
+// errNoBucketTagStore is returned when the tags of a bucket are used by the sessions
+// of a factory with no store of bucket tags
+var errNoBucketTagStore = errors.New("no store of bucket tags")
+
+// SessionCache tells how many clients of the sessions are kept for reuse, and for how long
+type SessionCache struct {
+	// Size is the maximum number of clients kept, the least recently used one is
+	// dropped beyond it. Clients are not reused when it is 0.
+	Size int
+	// TTL is how long a client is reused after its creation, or forever when it is 0
+	TTL time.Duration
+}
+
+// DefaultSessionCache is the session cache of the factories unless set otherwise
+var DefaultSessionCache = SessionCache{
+	Size: 256,
+	TTL:  30 * time.Minute,
+}
 
 // ObjectStorageSessionFactory is an interface of an object store session factory
 type ObjectStorageSessionFactory interface {
 	// NewObjectStorageBackend method creates a new object store session
-	NewObjectStorageSession(endpoint, locationConstraint string, creds *ObjectStorageCredentials, lgr *zap.Logger) ObjectStorageSession
+	NewObjectStorageSession(provider utils.Provider, endpoint, locationConstraint string, creds *ObjectStorageCredentials, lgr *zap.Logger) ObjectStorageSession
+
+	// TrustedProfileToken exchanges the service account token of workload identity
+	// credentials for an IAM token of their trusted profile
+	TrustedProfileToken(ctx context.Context, creds *ObjectStorageCredentials) (*token.Token, error)
+
+	// APIKeyToken exchanges the API key of the credentials for an IAM token
+	APIKeyToken(ctx context.Context, creds *ObjectStorageCredentials) (*token.Token, error)
+
+	// AssumeRoleWithWebIdentity exchanges the service account token of workload
+	// identity credentials for temporary credentials of their role
+	AssumeRoleWithWebIdentity(ctx context.Context, creds *ObjectStorageCredentials) (*TemporaryCredentials, error)
 }
 
 var _ ObjectStorageSessionFactory = &COSSessionFactory{}
@@ -78,39 +268,86 @@ var _ ObjectStorageSessionFactory = &COSSessionFactory{}
 type COSSession struct {
 	logger *zap.Logger
 	svc    s3API
+	// opts are applied to the requests sent to the endpoint
+	opts []request.Option
+	// bucketLocation is the location constraint of the buckets created, if any
+	bucketLocation string
+	// tags keeps the tags of the buckets, if any
+	tags BucketTagStore
 }
 
-func NewObjectStorageSessionFactory() *COSSessionFactory {
-	return &COSSessionFactory{}
+// NewObjectStorageSessionFactory returns a factory of sessions whose requests time
+// out after requestTimeout, or only with their context when it is zero, and are
+// retried according to the retry policy. The sessions of the same endpoint and
+// credentials share a client, kept according to cache.
+func NewObjectStorageSessionFactory(requestTimeout time.Duration, retry RetryPolicy, cache SessionCache) *COSSessionFactory {
+	return &COSSessionFactory{
+		requestTimeout: requestTimeout,
+		retry:          retry,
+		clients:        utils.NewCache[*s3.S3](cache.Size, cache.TTL),
+	}
+}
+
+// SetBucketTagStore keeps the tags of the buckets of the sessions in store
+func (s *COSSessionFactory) SetBucketTagStore(store BucketTagStore) {
+	s.tags = store
+}
+
+// withRequestTimeout bounds a request sent to the endpoint, retries included. The
+// timeout is not applied to GetObject, whose body is read once the request completes.
+func withRequestTimeout(timeout time.Duration) request.Option {
+	return func(r *request.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		r.SetContext(ctx)
+		r.Handlers.Complete.PushBack(func(*request.Request) { cancel() })
+	}
 }
 
 type s3API interface {
-	HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
-	CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
-	ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error)
-	ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
-	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
-	DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error)
+	HeadBucketWithContext(ctx aws.Context, input *s3.HeadBucketInput, opts ...request.Option) (*s3.HeadBucketOutput, error)
+	CreateBucketWithContext(ctx aws.Context, input *s3.CreateBucketInput, opts ...request.Option) (*s3.CreateBucketOutput, error)
+	ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error)
+	ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error)
+	DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error)
+	DeleteBucketWithContext(ctx aws.Context, input *s3.DeleteBucketInput, opts ...request.Option) (*s3.DeleteBucketOutput, error)
+	ListBucketsWithContext(ctx aws.Context, input *s3.ListBucketsInput, opts ...request.Option) (*s3.ListBucketsOutput, error)
+	CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error)
+	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+	CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error)
+	CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error)
+	ListMultipartUploadsWithContext(ctx aws.Context, input *s3.ListMultipartUploadsInput, opts ...request.Option) (*s3.ListMultipartUploadsOutput, error)
+	GetBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.GetBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfigurationWithContext(ctx aws.Context, input *s3.PutBucketLifecycleConfigurationInput, opts ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	DeleteBucketLifecycleWithContext(ctx aws.Context, input *s3.DeleteBucketLifecycleInput, opts ...request.Option) (*s3.DeleteBucketLifecycleOutput, error)
+	PutBucketVersioningWithContext(ctx aws.Context, input *s3.PutBucketVersioningInput, opts ...request.Option) (*s3.PutBucketVersioningOutput, error)
+	ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error)
+	PutBucketProtectionConfigurationWithContext(ctx aws.Context, input *s3.PutBucketProtectionConfigurationInput, opts ...request.Option) (*s3.PutBucketProtectionConfigurationOutput, error)
+	GetBucketProtectionConfigurationWithContext(ctx aws.Context, input *s3.GetBucketProtectionConfigurationInput, opts ...request.Option) (*s3.GetBucketProtectionConfigurationOutput, error)
+	PutObjectLockConfigurationWithContext(ctx aws.Context, input *s3.PutObjectLockConfigurationInput, opts ...request.Option) (*s3.PutObjectLockConfigurationOutput, error)
+	GetObjectLockConfigurationWithContext(ctx aws.Context, input *s3.GetObjectLockConfigurationInput, opts ...request.Option) (*s3.GetObjectLockConfigurationOutput, error)
 }
 
-func (s *COSSession) CheckBucketAccess(bucket string) error {
-	_, err := s.svc.HeadBucket(&s3.HeadBucketInput{
+func (s *COSSession) CheckBucketAccess(ctx context.Context, bucket string) error {
+	_, err := s.svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
 		Bucket: aws.String(bucket),
-	})
-	return err
+	}, s.opts...)
+	return classifyError(err)
 }
 
-func (s *COSSession) CheckObjectPathExistence(bucket string, objectpath string) (bool, error) {
+func (s *COSSession) CheckObjectPathExistence(ctx context.Context, bucket string, objectpath string) (bool, error) {
 	s.logger.Info("CheckObjectPathExistence args", zap.String("bucket", bucket), zap.String("objectpath", objectpath))
 	objectpath = strings.TrimPrefix(objectpath, "/")
-	resp, err := s.svc.ListObjectsV2(&s3.ListObjectsV2Input{
+	resp, err := s.svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
 		Bucket:  aws.String(bucket),
 		MaxKeys: aws.Int64(1),
 		Prefix:  aws.String(objectpath),
-	})
+	}, s.opts...)
 	if err != nil {
 		s.logger.Error("cannot list bucket", zap.String("bucket", bucket))
-		return false, fmt.Errorf("cannot list bucket '%s': %v", bucket, err)
+		return false, fmt.Errorf("cannot list bucket '%s': %w", bucket, classifyError(err))
 	}
 	if len(resp.Contents) == 1 {
 		object := *(resp.Contents[0].Key)
@@ -121,18 +358,21 @@ func (s *COSSession) CheckObjectPathExistence(bucket string, objectpath string)
 	return false, nil
 }
 
-func (s *COSSession) CreateBucket(bucket, kpRootKeyCrn string) (res string, err error) {
-	if kpRootKeyCrn != "" {
-		_, err = s.svc.CreateBucket(&s3.CreateBucketInput{
-			Bucket:                      aws.String(bucket),
-			IBMSSEKPCustomerRootKeyCrn:  aws.String(kpRootKeyCrn),
-			IBMSSEKPEncryptionAlgorithm: aws.String(constants.KPEncryptionAlgorithm),
-		})
-	} else {
-		_, err = s.svc.CreateBucket(&s3.CreateBucketInput{
-			Bucket: aws.String(bucket),
-		})
+func (s *COSSession) CreateBucket(ctx context.Context, bucket string, opts BucketOptions) (res string, err error) {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	}
+	if opts.KPRootKeyCRN != "" {
+		input.IBMSSEKPCustomerRootKeyCrn = aws.String(opts.KPRootKeyCRN)
+		input.IBMSSEKPEncryptionAlgorithm = aws.String(constants.KPEncryptionAlgorithm)
+	}
+	if opts.ObjectLock != nil {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
 	}
+	if s.bucketLocation != "" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(s.bucketLocation)}
+	}
+	_, err = s.svc.CreateBucketWithContext(ctx, input, s.opts...)
 
 	if err != nil {
 		// TODO
@@ -140,46 +380,580 @@ func (s *COSSession) CreateBucket(bucket, kpRootKeyCrn string) (res string, err
 		// The requested bucket name is not available. The bucket namespace is shared by all users of the system.
 		// Please select a different name and try again.
 
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "BucketAlreadyOwnedByYou" {
-			s.logger.Warn("bucket already exists", zap.String("bucket", bucket))
-			return fmt.Sprintf("bucket '%s' already exists", bucket), nil
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "BucketAlreadyOwnedByYou" {
+			return "", classifyError(err)
 		}
-		return "", err
+		s.logger.Warn("bucket already exists", zap.String("bucket", bucket))
+		res = fmt.Sprintf("bucket '%s' already exists", bucket)
 	}
 
-	return "", nil
+	// The settings are applied again on a bucket already owned, left without them
+	// by an interrupted attempt
+	if opts.Versioning || opts.ObjectLock != nil {
+		if err = s.SetBucketVersioning(ctx, bucket, true); err != nil {
+			return res, err
+		}
+	}
+	if opts.Retention != nil {
+		if err = s.setBucketRetention(ctx, bucket, *opts.Retention); err != nil {
+			return res, err
+		}
+	}
+	if opts.ObjectLock != nil && opts.ObjectLock.DefaultDays > 0 {
+		if err = s.setBucketObjectLock(ctx, bucket, *opts.ObjectLock); err != nil {
+			return res, err
+		}
+	}
+	if opts.Lifecycle != nil {
+		if err = s.SetBucketLifecycle(ctx, bucket, *opts.Lifecycle); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
 }
 
-func (s *COSSession) DeleteBucket(bucket string) error {
-	resp, err := s.svc.ListObjects(&s3.ListObjectsInput{
+func (s *COSSession) DeleteBucket(ctx context.Context, bucket string, progress *DeleteProgress) error {
+	err := s.emptyBucket(ctx, bucket, "", progress)
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == "NoSuchBucket" {
+		s.logger.Warn("bucket already deleted", zap.String("bucket", bucket))
+		return s.deleteBucketTags(ctx, bucket)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.DeleteBucketWithContext(ctx, &s3.DeleteBucketInput{
 		Bucket: aws.String(bucket),
+	}, s.opts...)
+	if err != nil {
+		return s.protectionError(ctx, bucket, classifyError(err))
+	}
+	return s.deleteBucketTags(ctx, bucket)
+}
+
+// emptyBucket deletes the objects whose key starts with prefix, along with their
+// versions and delete markers, after aborting the multipart uploads in progress.
+// Keys are listed a page at a time, each page being deleted by a batch request.
+func (s *COSSession) emptyBucket(ctx context.Context, bucket, prefix string, progress *DeleteProgress) error {
+	if progress == nil {
+		progress = &DeleteProgress{}
+	}
+	if err := s.abortMultipartUploads(ctx, bucket, prefix); err != nil {
+		return err
+	}
+	// Deleting the objects of a versioned bucket leaves delete markers, the versions
+	// are listed once the objects are gone
+	err := s.deletePages(ctx, bucket, progress, func(page func([]*s3.ObjectIdentifier) bool) error {
+		input := &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucket),
+			MaxKeys: aws.Int64(deleteBatchSize),
+		}
+		if prefix != "" {
+			input.Prefix = aws.String(prefix)
+		}
+		for {
+			resp, err := s.svc.ListObjectsV2WithContext(ctx, input, s.opts...)
+			if err != nil {
+				return fmt.Errorf("cannot list bucket '%s': %w", bucket, classifyError(err))
+			}
+			var ids []*s3.ObjectIdentifier
+			for _, obj := range resp.Contents {
+				ids = append(ids, &s3.ObjectIdentifier{Key: obj.Key})
+			}
+			if !page(ids) || !aws.BoolValue(resp.IsTruncated) || resp.NextContinuationToken == nil {
+				return nil
+			}
+			input.ContinuationToken = resp.NextContinuationToken
+		}
 	})
+	if err != nil {
+		return err
+	}
+
+	return s.deletePages(ctx, bucket, progress, func(page func([]*s3.ObjectIdentifier) bool) error {
+		input := &s3.ListObjectVersionsInput{
+			Bucket:  aws.String(bucket),
+			MaxKeys: aws.Int64(deleteBatchSize),
+		}
+		if prefix != "" {
+			input.Prefix = aws.String(prefix)
+		}
+		for {
+			resp, err := s.svc.ListObjectVersionsWithContext(ctx, input, s.opts...)
+			if err != nil {
+				return fmt.Errorf("cannot list object versions of bucket '%s': %w", bucket, classifyError(err))
+			}
+			var ids []*s3.ObjectIdentifier
+			for _, v := range resp.Versions {
+				ids = append(ids, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+			for _, m := range resp.DeleteMarkers {
+				ids = append(ids, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+			}
+			if !page(ids) || !aws.BoolValue(resp.IsTruncated) {
+				return nil
+			}
+			input.KeyMarker = resp.NextKeyMarker
+			input.VersionIdMarker = resp.NextVersionIdMarker
+		}
+	})
+}
+
+// deletePages deletes the pages of keys produced by list, by parallel workers. list
+// stops when page returns false, after a batch failed or once ctx is done.
+func (s *COSSession) deletePages(ctx context.Context, bucket string, progress *DeleteProgress, list func(page func([]*s3.ObjectIdentifier) bool) error) error {
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	failed := make(chan struct{})
+	batches := make(chan []*s3.ObjectIdentifier)
+	for i := 0; i < deleteWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ids := range batches {
+				if err := s.deleteBatch(ctx, bucket, ids); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+					continue
+				}
+				progress.Deleted.Add(int64(len(ids)))
+			}
+		}()
+	}
+
+	err := list(func(ids []*s3.ObjectIdentifier) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		if len(ids) == 0 {
+			return true
+		}
+		select {
+		case batches <- ids:
+			return true
+		case <-failed:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(batches)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
 
+// deleteBatch deletes up to deleteBatchSize objects or object versions with a
+// single request
+func (s *COSSession) deleteBatch(ctx context.Context, bucket string, ids []*s3.ObjectIdentifier) error {
+	resp, err := s.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+	}, s.opts...)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchBucket" {
-			s.logger.Warn("bucket already deleted", zap.String("bucket", bucket))
+		return s.protectionError(ctx, bucket, fmt.Errorf("cannot delete objects of bucket '%s': %w", bucket, classifyError(err)))
+	}
+	if len(resp.Errors) > 0 {
+		failed := resp.Errors[0]
+		return s.protectionError(ctx, bucket, fmt.Errorf("cannot delete %d objects of bucket '%s', object %s: %s",
+			len(resp.Errors), bucket, aws.StringValue(failed.Key), aws.StringValue(failed.Message)))
+	}
+	return nil
+}
+
+// abortMultipartUploads aborts the multipart uploads in progress whose key starts
+// with prefix, whose parts would otherwise keep the bucket from being deleted
+func (s *COSSession) abortMultipartUploads(ctx context.Context, bucket, prefix string) error {
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	for {
+		resp, err := s.svc.ListMultipartUploadsWithContext(ctx, input, s.opts...)
+		if err != nil {
+			return fmt.Errorf("cannot list multipart uploads of bucket '%s': %w", bucket, classifyError(err))
+		}
+		for _, upload := range resp.Uploads {
+			_, err = s.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			}, s.opts...)
+			if err != nil {
+				return fmt.Errorf("cannot abort upload of object %s/%s: %w", bucket, aws.StringValue(upload.Key), classifyError(err))
+			}
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
 			return nil
 		}
+		input.KeyMarker = resp.NextKeyMarker
+		input.UploadIdMarker = resp.NextUploadIdMarker
+	}
+}
 
-		return fmt.Errorf("cannot list bucket '%s': %v", bucket, err)
+// protectionError wraps a deletion error with ErrBucketProtected when the bucket
+// has a retention policy or object lock, which keep objects from being deleted
+func (s *COSSession) protectionError(ctx context.Context, bucket string, err error) error {
+	protection, perr := s.svc.GetBucketProtectionConfigurationWithContext(ctx, &s3.GetBucketProtectionConfigurationInput{
+		Bucket: aws.String(bucket),
+	}, s.opts...)
+	if perr == nil && protection.ProtectionConfiguration != nil &&
+		aws.StringValue(protection.ProtectionConfiguration.Status) == s3.BucketProtectionStatusRetention {
+		return fmt.Errorf("%w: %w", ErrBucketProtected, err)
 	}
+	lock, lerr := s.svc.GetObjectLockConfigurationWithContext(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+	}, s.opts...)
+	if lerr == nil && lock.ObjectLockConfiguration != nil &&
+		aws.StringValue(lock.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled {
+		return fmt.Errorf("%w: %w", ErrBucketProtected, err)
+	}
+	return err
+}
 
-	for _, key := range resp.Contents {
-		_, err = s.svc.DeleteObject(&s3.DeleteObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    key.Key,
-		})
+func (s *COSSession) ListBuckets(ctx context.Context) ([]string, error) {
+	resp, err := s.svc.ListBucketsWithContext(ctx, &s3.ListBucketsInput{}, s.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list buckets: %w", classifyError(err))
+	}
 
+	buckets := make([]string, 0, len(resp.Buckets))
+	for _, b := range resp.Buckets {
+		buckets = append(buckets, aws.StringValue(b.Name))
+	}
+	return buckets, nil
+}
+
+func (s *COSSession) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var (
+		objects []ObjectInfo
+		token   *string
+	)
+	for {
+		input := &s3.ListObjectsV2Input{
+			Bucket:            aws.String(bucket),
+			ContinuationToken: token,
+		}
+		if prefix != "" {
+			input.Prefix = aws.String(prefix)
+		}
+		resp, err := s.svc.ListObjectsV2WithContext(ctx, input, s.opts...)
 		if err != nil {
-			return fmt.Errorf("cannot delete object %s/%s: %v", bucket, *key.Key, err)
+			return nil, fmt.Errorf("cannot list bucket '%s': %w", bucket, classifyError(err))
+		}
+
+		for _, obj := range resp.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:  aws.StringValue(obj.Key),
+				Size: aws.Int64Value(obj.Size),
+				ETag: strings.Trim(aws.StringValue(obj.ETag), "\""),
+			})
 		}
+
+		if !aws.BoolValue(resp.IsTruncated) || resp.NextContinuationToken == nil {
+			return objects, nil
+		}
+		token = resp.NextContinuationToken
+	}
+}
+
+func (s *COSSession) DeleteObjects(ctx context.Context, bucket, prefix string, progress *DeleteProgress) error {
+	return s.emptyBucket(ctx, bucket, prefix, progress)
+}
+
+func (s *COSSession) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	source := (&url.URL{Path: srcBucket + "/" + srcKey}).EscapedPath()
+	_, err := s.svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(source),
+	}, s.opts...)
+	if err != nil {
+		return fmt.Errorf("cannot copy object %s/%s to %s/%s: %w", srcBucket, srcKey, dstBucket, dstKey, classifyError(err))
 	}
+	return nil
+}
 
-	_, err = s.svc.DeleteBucket(&s3.DeleteBucketInput{
+func (s *COSSession) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	resp, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get object %s/%s: %w", bucket, key, classifyError(err))
+	}
+	return resp.Body, nil
+}
 
-	return err
+func (s *COSSession) UploadObject(ctx context.Context, bucket, key string, body io.Reader, size int64) error {
+	// The buffer of a small object holds one more byte, for its end to be seen. It is
+	// grown to a whole part when the stream turns out longer than its size.
+	bufSize := int64(uploadPartSize)
+	if size >= 0 && size < bufSize {
+		bufSize = size + 1
+	}
+	buf := make([]byte, bufSize)
+	n, err := io.ReadFull(body, buf)
+	if err == nil && len(buf) < uploadPartSize {
+		buf = append(buf, make([]byte, uploadPartSize-len(buf))...)
+		var m int
+		m, err = io.ReadFull(body, buf[n:])
+		n += m
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The whole object fits in a single part
+		_, err = s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(buf[:n]),
+		}, s.opts...)
+		if err != nil {
+			return fmt.Errorf("cannot upload object %s/%s: %w", bucket, key, classifyError(err))
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read object %s/%s: %w", bucket, key, classifyError(err))
+	}
+
+	upload, err := s.svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s.opts...)
+	if err != nil {
+		return fmt.Errorf("cannot upload object %s/%s: %w", bucket, key, classifyError(err))
+	}
+
+	abort := func(err error) error {
+		// The upload is aborted even when ctx is done, its parts would be left behind
+		if _, aerr := s.svc.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		}, s.opts...); aerr != nil {
+			s.logger.Warn("cannot abort multipart upload", zap.String("bucket", bucket), zap.String("key", key), zap.Error(aerr))
+		}
+		return fmt.Errorf("cannot upload object %s/%s: %w", bucket, key, classifyError(err))
+	}
+
+	var parts []*s3.CompletedPart
+	for partNumber := int64(1); n > 0; partNumber++ {
+		part, err := s.svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String(key),
+			UploadId:   upload.UploadId,
+			PartNumber: aws.Int64(partNumber),
+			Body:       bytes.NewReader(buf[:n]),
+		}, s.opts...)
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       part.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+
+		n, err = io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+	}
+
+	_, err = s.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	}, s.opts...)
+	if err != nil {
+		return abort(err)
+	}
+	return nil
+}
+
+func (s *COSSession) SetBucketTags(ctx context.Context, bucket string, tags map[string]string) error {
+	if s.tags == nil {
+		return fmt.Errorf("cannot tag bucket '%s': %w", bucket, errNoBucketTagStore)
+	}
+	if err := s.tags.SetBucketTags(ctx, bucket, tags); err != nil {
+		return fmt.Errorf("cannot tag bucket '%s': %w", bucket, err)
+	}
+	return nil
+}
+
+func (s *COSSession) GetBucketTags(ctx context.Context, bucket string) (map[string]string, error) {
+	if s.tags == nil {
+		return nil, fmt.Errorf("cannot read tags of bucket '%s': %w", bucket, errNoBucketTagStore)
+	}
+	tags, err := s.tags.GetBucketTags(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tags of bucket '%s': %w", bucket, err)
+	}
+	return tags, nil
+}
+
+// deleteBucketTags drops the tags of a deleted bucket, for a bucket created later
+// with the same name not to be taken for it
+func (s *COSSession) deleteBucketTags(ctx context.Context, bucket string) error {
+	if s.tags == nil {
+		return nil
+	}
+	if err := s.tags.DeleteBucketTags(ctx, bucket); err != nil {
+		return fmt.Errorf("cannot delete tags of bucket '%s': %w", bucket, err)
+	}
+	return nil
+}
+
+func (s *COSSession) GetBucketLifecycle(ctx context.Context, bucket string) (BucketLifecycle, error) {
+	var lifecycle BucketLifecycle
+	resp, err := s.svc.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	}, s.opts...)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NoSuchLifecycleConfiguration" {
+			return lifecycle, nil
+		}
+		return lifecycle, fmt.Errorf("cannot read lifecycle of bucket '%s': %w", bucket, classifyError(err))
+	}
+
+	for _, rule := range resp.Rules {
+		if aws.StringValue(rule.Status) != s3.ExpirationStatusEnabled {
+			continue
+		}
+		if rule.Expiration != nil && rule.Expiration.Days != nil {
+			lifecycle.ExpirationDays = *rule.Expiration.Days
+		}
+		for _, transition := range rule.Transitions {
+			if transition.Days != nil {
+				lifecycle.ArchiveDays = *transition.Days
+				lifecycle.ArchiveType = aws.StringValue(transition.StorageClass)
+			}
+		}
+		if rule.NoncurrentVersionExpiration != nil && rule.NoncurrentVersionExpiration.NoncurrentDays != nil {
+			lifecycle.NoncurrentExpirationDays = *rule.NoncurrentVersionExpiration.NoncurrentDays
+		}
+		if rule.AbortIncompleteMultipartUpload != nil && rule.AbortIncompleteMultipartUpload.DaysAfterInitiation != nil {
+			lifecycle.AbortMultipartDays = *rule.AbortIncompleteMultipartUpload.DaysAfterInitiation
+		}
+	}
+	return lifecycle, nil
+}
+
+func (s *COSSession) SetBucketLifecycle(ctx context.Context, bucket string, lifecycle BucketLifecycle) error {
+	rule := &s3.LifecycleRule{
+		ID:     aws.String(lifecycleRuleID),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+	}
+	if lifecycle.ExpirationDays > 0 {
+		rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(lifecycle.ExpirationDays)}
+	}
+	if lifecycle.ArchiveDays > 0 {
+		rule.Transitions = []*s3.Transition{{
+			Days:         aws.Int64(lifecycle.ArchiveDays),
+			StorageClass: aws.String(lifecycle.ArchiveType),
+		}}
+	}
+	if lifecycle.NoncurrentExpirationDays > 0 {
+		rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(lifecycle.NoncurrentExpirationDays)}
+	}
+	if lifecycle.AbortMultipartDays > 0 {
+		rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(lifecycle.AbortMultipartDays)}
+	}
+
+	var err error
+	if rule.Expiration == nil && rule.Transitions == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		_, err = s.svc.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(bucket),
+		}, s.opts...)
+	} else {
+		_, err = s.svc.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+			Bucket: aws.String(bucket),
+			LifecycleConfiguration: &s3.LifecycleConfiguration{
+				Rules: []*s3.LifecycleRule{rule},
+			},
+		}, s.opts...)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot set lifecycle of bucket '%s': %w", bucket, classifyError(err))
+	}
+	return nil
+}
+
+func (s *COSSession) SetBucketVersioning(ctx context.Context, bucket string, enabled bool) error {
+	state := s3.BucketVersioningStatusSuspended
+	if enabled {
+		state = s3.BucketVersioningStatusEnabled
+	}
+	_, err := s.svc.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(state),
+		},
+	}, s.opts...)
+	if err != nil {
+		return fmt.Errorf("cannot set versioning of bucket '%s': %w", bucket, classifyError(err))
+	}
+	return nil
+}
+
+func (s *COSSession) GetBucketRetention(ctx context.Context, bucket string) (*BucketRetention, error) {
+	resp, err := s.svc.GetBucketProtectionConfigurationWithContext(ctx, &s3.GetBucketProtectionConfigurationInput{
+		Bucket: aws.String(bucket),
+	}, s.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read retention policy of bucket '%s': %w", bucket, classifyError(err))
+	}
+	protection := resp.ProtectionConfiguration
+	if protection == nil || aws.StringValue(protection.Status) != s3.BucketProtectionStatusRetention {
+		return nil, nil
+	}
+	retention := &BucketRetention{}
+	if protection.MinimumRetention != nil {
+		retention.MinimumDays = aws.Int64Value(protection.MinimumRetention.Days)
+	}
+	if protection.DefaultRetention != nil {
+		retention.DefaultDays = aws.Int64Value(protection.DefaultRetention.Days)
+	}
+	if protection.MaximumRetention != nil {
+		retention.MaximumDays = aws.Int64Value(protection.MaximumRetention.Days)
+	}
+	return retention, nil
+}
+
+func (s *COSSession) GetBucketObjectLock(ctx context.Context, bucket string) (*BucketObjectLock, error) {
+	resp, err := s.svc.GetObjectLockConfigurationWithContext(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+	}, s.opts...)
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "ObjectLockConfigurationNotFoundError" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read object lock of bucket '%s': %w", bucket, classifyError(err))
+	}
+	config := resp.ObjectLockConfiguration
+	if config == nil || aws.StringValue(config.ObjectLockEnabled) != s3.ObjectLockEnabledEnabled {
+		return nil, nil
+	}
+	lock := &BucketObjectLock{}
+	if config.Rule != nil && config.Rule.DefaultRetention != nil {
+		lock.DefaultDays = aws.Int64Value(config.Rule.DefaultRetention.Days)
+	}
+	return lock, nil
 }
 
 func NewS3Client(lgr *zap.Logger) (ObjectStorageSession, error) {
@@ -189,23 +963,100 @@ func NewS3Client(lgr *zap.Logger) (ObjectStorageSession, error) {
 	return cosSession, nil
 }
 
-// NewObjectStorageSession method creates a new object store session
-func (s *COSSessionFactory) NewObjectStorageSession(endpoint, locationConstraint string, creds *ObjectStorageCredentials, lgr *zap.Logger) ObjectStorageSession {
+// NewObjectStorageSession method creates a new object store session. The client of
+// a session created lately with the same endpoint and credentials is reused, and
+// with it the IAM token, refreshed by the SDK before it expires.
+func (s *COSSessionFactory) NewObjectStorageSession(provider utils.Provider, endpoint, locationConstraint string, creds *ObjectStorageCredentials, lgr *zap.Logger) ObjectStorageSession {
+	cosSession := &COSSession{
+		svc:    s.client(provider, endpoint, locationConstraint, creds),
+		logger: lgr,
+		tags:   s.tags,
+	}
+	if s.requestTimeout > 0 {
+		cosSession.opts = []request.Option{withRequestTimeout(s.requestTimeout)}
+	}
+	// Buckets are created in us-east-1 unless a location constraint is given, which
+	// must then be another region
+	if provider.LocationConstraint && locationConstraint != "us-east-1" {
+		cosSession.bucketLocation = locationConstraint
+	}
+	return cosSession
+}
+
+// client returns the client of the sessions of an endpoint and credentials
+func (s *COSSessionFactory) client(provider utils.Provider, endpoint, locationConstraint string, creds *ObjectStorageCredentials) *s3.S3 {
+	key := sessionKey(provider, endpoint, locationConstraint, creds)
+	if s.clients != nil {
+		if client, ok := s.clients.Get(key); ok {
+			return client
+		}
+	}
+
 	var sdkCreds *credentials.Credentials
 	if creds.AuthType == "iam" {
 		sdkCreds = ibmiam.NewStaticCredentials(aws.NewConfig(), creds.IAMEndpoint+"/identity/token", creds.APIKey, creds.ServiceInstanceID)
 	} else {
 		sdkCreds = credentials.NewStaticCredentials(creds.AccessKey, creds.SecretKey, "")
 	}
-	sess := session.Must(session.NewSession(&aws.Config{
-		S3ForcePathStyle: aws.Bool(true),
-		Endpoint:         aws.String(endpoint),
-		Credentials:      sdkCreds,
-		Region:           aws.String(locationConstraint),
-	}))
+	// The retryer decides on every failure, the SDK handlers would otherwise retry
+	// some of them on their own
+	sess := session.Must(session.NewSession(request.WithRetryer(&aws.Config{
+		S3ForcePathStyle:        aws.Bool(!provider.VirtualHostedStyle),
+		Endpoint:                aws.String(endpoint),
+		Credentials:             sdkCreds,
+		Region:                  aws.String(locationConstraint),
+		EnforceShouldRetryCheck: aws.Bool(true),
+	}, retryer{policy: s.retry})))
 
-	return &COSSession{
-		svc:    s3.New(sess),
-		logger: lgr,
+	client := s3.New(sess)
+	if s.clients != nil {
+		s.clients.Add(key, client)
+	}
+	return client
+}
+
+// sessionKey identifies the sessions of an endpoint and credentials, without
+// holding the credentials themselves
+func sessionKey(provider utils.Provider, endpoint, locationConstraint string, creds *ObjectStorageCredentials) string {
+	fingerprint := sha256.New()
+	for _, field := range []string{creds.AuthType, creds.AccessKey, creds.SecretKey, creds.APIKey, creds.ServiceInstanceID, creds.IAMEndpoint} {
+		fingerprint.Write([]byte(field))
+		fingerprint.Write([]byte{0})
+	}
+	return provider.Name + "|" + endpoint + "|" + locationConstraint + "|" + hex.EncodeToString(fingerprint.Sum(nil))
+}
+
+func (s *COSSession) setBucketRetention(ctx context.Context, bucket string, retention BucketRetention) error {
+	_, err := s.svc.PutBucketProtectionConfigurationWithContext(ctx, &s3.PutBucketProtectionConfigurationInput{
+		Bucket: aws.String(bucket),
+		ProtectionConfiguration: &s3.ProtectionConfiguration{
+			Status:           aws.String(s3.BucketProtectionStatusRetention),
+			MinimumRetention: &s3.BucketProtectionMinimumRetention{Days: aws.Int64(retention.MinimumDays)},
+			DefaultRetention: &s3.BucketProtectionDefaultRetention{Days: aws.Int64(retention.DefaultDays)},
+			MaximumRetention: &s3.BucketProtectionMaximumRetention{Days: aws.Int64(retention.MaximumDays)},
+		},
+	}, s.opts...)
+	if err != nil {
+		return fmt.Errorf("cannot set retention policy of bucket '%s': %w", bucket, classifyError(err))
+	}
+	return nil
+}
+
+func (s *COSSession) setBucketObjectLock(ctx context.Context, bucket string, lock BucketObjectLock) error {
+	_, err := s.svc.PutObjectLockConfigurationWithContext(ctx, &s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			Rule: &s3.ObjectLockRule{
+				DefaultRetention: &s3.DefaultRetention{
+					Mode: aws.String(s3.ObjectLockRetentionModeCompliance),
+					Days: aws.Int64(lock.DefaultDays),
+				},
+			},
+		},
+	}, s.opts...)
+	if err != nil {
+		return fmt.Errorf("cannot set object lock of bucket '%s': %w", bucket, classifyError(err))
 	}
+	return nil
 }
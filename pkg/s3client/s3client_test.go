@@ -1,12 +1,25 @@
 package s3client
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/IBM/ibm-cos-sdk-go/aws"
 	"github.com/IBM/ibm-cos-sdk-go/aws/awserr"
+	"github.com/IBM/ibm-cos-sdk-go/aws/request"
 	"github.com/IBM/ibm-cos-sdk-go/service/s3"
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -16,9 +29,46 @@ type fakeS3API struct {
 	ErrCreateBucket  error
 	ErrListObjects   error
 	ErrListObjectsV2 error
-	ErrDeleteObject  error
+	ErrDeleteObjects error
+	ErrListUploads   error
 	ErrDeleteBucket  error
+	ErrListBuckets   error
+	ErrCopyObject    error
+	ErrPutObject     error
+	ErrGetObject     error
+	ErrUploadPart    error
+	ErrGetLifecycle  error
+	ErrPutLifecycle  error
+	ErrPutVersioning error
 	ObjectPath       string
+	LifecycleRules   []*s3.LifecycleRule
+	Versions         []*s3.ObjectVersion
+	Retention        bool
+	ObjectLocked     bool
+	// Objects are listed by ListObjectsV2 a page at a time, instead of testObject
+	Objects []string
+	// Uploads are listed by ListMultipartUploads
+	Uploads []*s3.MultipartUpload
+	// DeleteErrors are returned by DeleteObjects for the keys that could not be deleted
+	DeleteErrors []*s3.Error
+
+	copySource       *string
+	putObjects       int
+	parts            int
+	completed        bool
+	aborted          bool
+	deletedLifecycle bool
+	versioning       *string
+	lockEnabled      *bool
+	bucketConfig     *s3.CreateBucketConfiguration
+	protection       *s3.ProtectionConfiguration
+	objectLock       *s3.ObjectLockConfiguration
+	deletedVersions  []string
+	abortedUploads   []string
+
+	mutex         sync.Mutex
+	deleteBatches int
+	deletedKeys   int
 }
 
 const (
@@ -37,38 +87,162 @@ const (
 )
 
 var (
+	ctx        = context.Background()
 	testObject = "test-object"
 	errFoo     = errors.New(errFooMsg)
 )
 
-func (a *fakeS3API) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+func (a *fakeS3API) HeadBucketWithContext(_ aws.Context, input *s3.HeadBucketInput, _ ...request.Option) (*s3.HeadBucketOutput, error) {
 	return nil, a.ErrHeadBucket
 }
 
-func (a *fakeS3API) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+func (a *fakeS3API) CreateBucketWithContext(_ aws.Context, input *s3.CreateBucketInput, _ ...request.Option) (*s3.CreateBucketOutput, error) {
+	a.lockEnabled = input.ObjectLockEnabledForBucket
+	a.bucketConfig = input.CreateBucketConfiguration
 	return nil, a.ErrCreateBucket
 }
 
-func (a *fakeS3API) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+func (a *fakeS3API) ListObjectsWithContext(_ aws.Context, input *s3.ListObjectsInput, _ ...request.Option) (*s3.ListObjectsOutput, error) {
 	return &s3.ListObjectsOutput{
 		Contents: []*s3.Object{{Key: &testObject}},
 	}, a.ErrListObjects
 }
 
-func (a *fakeS3API) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
-	return &s3.ListObjectsV2Output{
-		Contents: []*s3.Object{{Key: &testObject}},
-	}, a.ErrListObjectsV2
+func (a *fakeS3API) ListObjectsV2WithContext(_ aws.Context, input *s3.ListObjectsV2Input, _ ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if a.Objects == nil {
+		return &s3.ListObjectsV2Output{
+			Contents: []*s3.Object{{Key: &testObject}},
+		}, a.ErrListObjectsV2
+	}
+
+	start, _ := strconv.Atoi(aws.StringValue(input.ContinuationToken))
+	end := min(start+int(aws.Int64Value(input.MaxKeys)), len(a.Objects))
+	resp := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(a.Objects))}
+	for _, key := range a.Objects[start:end] {
+		resp.Contents = append(resp.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	if end < len(a.Objects) {
+		resp.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return resp, a.ErrListObjectsV2
 }
 
-func (a *fakeS3API) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
-	return nil, a.ErrDeleteObject
+func (a *fakeS3API) DeleteObjectsWithContext(_ aws.Context, input *s3.DeleteObjectsInput, _ ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.ErrDeleteObjects != nil {
+		return nil, a.ErrDeleteObjects
+	}
+	a.deleteBatches++
+	a.deletedKeys += len(input.Delete.Objects)
+	for _, id := range input.Delete.Objects {
+		if id.VersionId != nil {
+			a.deletedVersions = append(a.deletedVersions, aws.StringValue(id.VersionId))
+		}
+	}
+	return &s3.DeleteObjectsOutput{Errors: a.DeleteErrors}, nil
 }
 
-func (a *fakeS3API) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+func (a *fakeS3API) ListMultipartUploadsWithContext(_ aws.Context, input *s3.ListMultipartUploadsInput, _ ...request.Option) (*s3.ListMultipartUploadsOutput, error) {
+	return &s3.ListMultipartUploadsOutput{Uploads: a.Uploads}, a.ErrListUploads
+}
+
+func (a *fakeS3API) DeleteBucketWithContext(_ aws.Context, input *s3.DeleteBucketInput, _ ...request.Option) (*s3.DeleteBucketOutput, error) {
 	return nil, a.ErrDeleteBucket
 }
 
+func (a *fakeS3API) ListBucketsWithContext(_ aws.Context, input *s3.ListBucketsInput, _ ...request.Option) (*s3.ListBucketsOutput, error) {
+	return &s3.ListBucketsOutput{
+		Buckets: []*s3.Bucket{{Name: aws.String(testBucket)}},
+	}, a.ErrListBuckets
+}
+
+func (a *fakeS3API) CopyObjectWithContext(_ aws.Context, input *s3.CopyObjectInput, _ ...request.Option) (*s3.CopyObjectOutput, error) {
+	a.copySource = input.CopySource
+	return nil, a.ErrCopyObject
+}
+
+func (a *fakeS3API) PutObjectWithContext(_ aws.Context, input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	a.putObjects++
+	return nil, a.ErrPutObject
+}
+
+func (a *fakeS3API) GetObjectWithContext(_ aws.Context, input *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(testObject))}, a.ErrGetObject
+}
+
+func (a *fakeS3API) CreateMultipartUploadWithContext(_ aws.Context, input *s3.CreateMultipartUploadInput, _ ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (a *fakeS3API) UploadPartWithContext(_ aws.Context, input *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+	a.parts++
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, a.ErrUploadPart
+}
+
+func (a *fakeS3API) CompleteMultipartUploadWithContext(_ aws.Context, input *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	a.completed = true
+	return nil, nil
+}
+
+func (a *fakeS3API) AbortMultipartUploadWithContext(_ aws.Context, input *s3.AbortMultipartUploadInput, _ ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	a.aborted = true
+	a.abortedUploads = append(a.abortedUploads, aws.StringValue(input.UploadId))
+	return nil, nil
+}
+
+func (a *fakeS3API) GetBucketLifecycleConfigurationWithContext(_ aws.Context, input *s3.GetBucketLifecycleConfigurationInput, _ ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: a.LifecycleRules}, a.ErrGetLifecycle
+}
+
+func (a *fakeS3API) PutBucketLifecycleConfigurationWithContext(_ aws.Context, input *s3.PutBucketLifecycleConfigurationInput, _ ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	a.LifecycleRules = input.LifecycleConfiguration.Rules
+	return nil, a.ErrPutLifecycle
+}
+
+func (a *fakeS3API) DeleteBucketLifecycleWithContext(_ aws.Context, input *s3.DeleteBucketLifecycleInput, _ ...request.Option) (*s3.DeleteBucketLifecycleOutput, error) {
+	a.LifecycleRules = nil
+	a.deletedLifecycle = true
+	return nil, a.ErrPutLifecycle
+}
+
+func (a *fakeS3API) PutBucketVersioningWithContext(_ aws.Context, input *s3.PutBucketVersioningInput, _ ...request.Option) (*s3.PutBucketVersioningOutput, error) {
+	a.versioning = input.VersioningConfiguration.Status
+	return nil, a.ErrPutVersioning
+}
+
+func (a *fakeS3API) ListObjectVersionsWithContext(_ aws.Context, input *s3.ListObjectVersionsInput, _ ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	return &s3.ListObjectVersionsOutput{Versions: a.Versions}, nil
+}
+
+func (a *fakeS3API) PutBucketProtectionConfigurationWithContext(_ aws.Context, input *s3.PutBucketProtectionConfigurationInput, _ ...request.Option) (*s3.PutBucketProtectionConfigurationOutput, error) {
+	a.protection = input.ProtectionConfiguration
+	return nil, nil
+}
+
+func (a *fakeS3API) GetBucketProtectionConfigurationWithContext(_ aws.Context, input *s3.GetBucketProtectionConfigurationInput, _ ...request.Option) (*s3.GetBucketProtectionConfigurationOutput, error) {
+	if !a.Retention {
+		return &s3.GetBucketProtectionConfigurationOutput{}, nil
+	}
+	return &s3.GetBucketProtectionConfigurationOutput{
+		ProtectionConfiguration: &s3.ProtectionConfiguration{Status: aws.String(s3.BucketProtectionStatusRetention)},
+	}, nil
+}
+
+func (a *fakeS3API) PutObjectLockConfigurationWithContext(_ aws.Context, input *s3.PutObjectLockConfigurationInput, _ ...request.Option) (*s3.PutObjectLockConfigurationOutput, error) {
+	a.objectLock = input.ObjectLockConfiguration
+	return nil, nil
+}
+
+func (a *fakeS3API) GetObjectLockConfigurationWithContext(_ aws.Context, input *s3.GetObjectLockConfigurationInput, _ ...request.Option) (*s3.GetObjectLockConfigurationOutput, error) {
+	if !a.ObjectLocked {
+		return nil, awserr.New("ObjectLockConfigurationNotFoundError", "", nil)
+	}
+	return &s3.GetObjectLockConfigurationOutput{
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled)},
+	}, nil
+}
+
 func getSession(svc s3API) ObjectStorageSession {
 	return &COSSession{
 		logger: zap.NewNop(),
@@ -78,28 +252,78 @@ func getSession(svc s3API) ObjectStorageSession {
 
 func Test_NewObjectStorageSession_Positive(t *testing.T) {
 	f := &COSSessionFactory{}
-	sess := f.NewObjectStorageSession(testEndpoint, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	sess := f.NewObjectStorageSession(utils.DefaultProvider, testEndpoint, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
 	assert.NotNil(t, sess)
 }
 
 func Test_NewObjectStorageIAMSession_Positive(t *testing.T) {
 	f := &COSSessionFactory{}
-	sess := f.NewObjectStorageSession(testEndpoint, testRegion,
+	sess := f.NewObjectStorageSession(utils.DefaultProvider, testEndpoint, testRegion,
 		&ObjectStorageCredentials{ServiceInstanceID: testServiceInstanceID, APIKey: testAPIKey, IAMEndpoint: testIAMEndpoint}, zap.NewNop())
 	assert.NotNil(t, sess)
 }
 
+func Test_NewObjectStorageSession_Cached(t *testing.T) {
+	f := NewObjectStorageSessionFactory(0, DefaultRetryPolicy, SessionCache{Size: 2, TTL: time.Minute})
+	creds := &ObjectStorageCredentials{AuthType: "iam", ServiceInstanceID: testServiceInstanceID, APIKey: testAPIKey, IAMEndpoint: testIAMEndpoint}
+	svc := func(endpoint string, creds *ObjectStorageCredentials) s3API {
+		return f.NewObjectStorageSession(utils.DefaultProvider, endpoint, testRegion, creds, zap.NewNop()).(*COSSession).svc
+	}
+
+	sess := svc(testEndpoint, creds)
+	assert.Same(t, sess, svc(testEndpoint, &ObjectStorageCredentials{AuthType: "iam", ServiceInstanceID: testServiceInstanceID, APIKey: testAPIKey, IAMEndpoint: testIAMEndpoint}))
+	other := svc("other-endpoint", creds)
+	assert.NotSame(t, sess, other)
+	assert.Same(t, sess, svc(testEndpoint, creds))
+	assert.NotSame(t, sess, svc(testEndpoint, &ObjectStorageCredentials{AuthType: "iam", ServiceInstanceID: testServiceInstanceID, APIKey: "rotated", IAMEndpoint: testIAMEndpoint}))
+	// The client of the other endpoint was the least recently used one
+	assert.Same(t, sess, svc(testEndpoint, creds))
+	assert.NotSame(t, other, svc("other-endpoint", creds))
+	assert.Equal(t, 2, f.clients.Len())
+}
+
+func Test_NewObjectStorageSession_NotCached(t *testing.T) {
+	f := NewObjectStorageSessionFactory(0, DefaultRetryPolicy, SessionCache{})
+	creds := &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}
+	sess := f.NewObjectStorageSession(utils.DefaultProvider, testEndpoint, testRegion, creds, zap.NewNop()).(*COSSession)
+	assert.NotSame(t, sess.svc, f.NewObjectStorageSession(utils.DefaultProvider, testEndpoint, testRegion, creds, zap.NewNop()).(*COSSession).svc)
+}
+
+func Test_SessionKey(t *testing.T) {
+	creds := &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}
+	key := sessionKey(utils.DefaultProvider, testEndpoint, testRegion, creds)
+	assert.NotContains(t, key, testSecretKey)
+	assert.Equal(t, key, sessionKey(utils.DefaultProvider, testEndpoint, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}))
+	assert.NotEqual(t, key, sessionKey(utils.DefaultProvider, testEndpoint, "other-region", creds))
+	minio, _ := utils.GetProvider(constants.ProviderMinIO)
+	assert.NotEqual(t, key, sessionKey(minio, testEndpoint, testRegion, creds))
+	// Fields are delimited, moving a character from one to the other changes the key
+	assert.NotEqual(t, key, sessionKey(utils.DefaultProvider, testEndpoint, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey + "s", SecretKey: "key"}))
+}
+
 func Test_CheckBucketAccess_Error(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrHeadBucket: errFoo})
-	err := sess.CheckBucketAccess(testBucket)
+	err := sess.CheckBucketAccess(ctx, testBucket)
 	if assert.Error(t, err) {
 		assert.EqualError(t, err, errFooMsg)
 	}
 }
 
+func Test_CheckBucketAccess_NotFound(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrHeadBucket: awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")})
+	err := sess.CheckBucketAccess(ctx, testBucket)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func Test_CheckBucketAccess_Forbidden(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrHeadBucket: awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), http.StatusForbidden, "")})
+	err := sess.CheckBucketAccess(ctx, testBucket)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
+
 func Test_CheckBucketAccess_Positive(t *testing.T) {
 	sess := getSession(&fakeS3API{})
-	err := sess.CheckBucketAccess(testBucket)
+	err := sess.CheckBucketAccess(ctx, testBucket)
 	assert.NoError(t, err)
 }
 
@@ -107,7 +331,7 @@ func Test_CheckObjectPathExistence_Positive(t *testing.T) {
 	testObject = strings.TrimPrefix(testObjectPath, "/")
 	testObject = testObject + "/"
 	sess := getSession(&fakeS3API{ObjectPath: testObject})
-	exist, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	exist, err := sess.CheckObjectPathExistence(ctx, testBucket, testObjectPath)
 	assert.NoError(t, err)
 	assert.Equal(t, exist, true)
 }
@@ -115,7 +339,7 @@ func Test_CheckObjectPathExistence_Positive(t *testing.T) {
 func Test_CheckObjectPathExistence_WithoutSuffix(t *testing.T) {
 	testObject = strings.TrimPrefix(testObjectPath, "/")
 	sess := getSession(&fakeS3API{ObjectPath: testObject})
-	exist, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	exist, err := sess.CheckObjectPathExistence(ctx, testBucket, testObjectPath)
 	assert.NoError(t, err)
 	assert.Equal(t, exist, true)
 }
@@ -123,14 +347,14 @@ func Test_CheckObjectPathExistence_WithoutSuffix(t *testing.T) {
 func Test_CheckObjectPathExistence_PathNotFound(t *testing.T) {
 	sess := getSession(&fakeS3API{ObjectPath: "test/object-path-xxxx"})
 	testObject = "test/object-path-xxxx"
-	exist, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	exist, err := sess.CheckObjectPathExistence(ctx, testBucket, testObjectPath)
 	assert.NoError(t, err)
 	assert.Equal(t, exist, false)
 }
 
 func Test_CheckObjectPathExistence_Error(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrListObjectsV2: errFoo})
-	_, err := sess.CheckObjectPathExistence(testBucket, testObjectPath)
+	_, err := sess.CheckObjectPathExistence(ctx, testBucket, testObjectPath)
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "cannot list bucket")
 	}
@@ -138,49 +362,221 @@ func Test_CheckObjectPathExistence_Error(t *testing.T) {
 
 func Test_CreateBucketAccess_Error(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrCreateBucket: errFoo})
-	_, err := sess.CreateBucket(testBucket, testKpRootKeyCrn)
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{KPRootKeyCRN: testKpRootKeyCrn})
 	if assert.Error(t, err) {
 		assert.EqualError(t, err, errFooMsg)
 	}
 }
 
+func Test_CreateBucket_BucketTaken(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrCreateBucket: awserr.New("BucketAlreadyExists", "", nil)})
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{})
+	assert.ErrorIs(t, err, ErrBucketTaken)
+	var aerr awserr.Error
+	if assert.ErrorAs(t, err, &aerr) {
+		assert.Equal(t, "BucketAlreadyExists", aerr.Code())
+	}
+}
+
 func Test_CreateBucketAccess_BucketAlreadyExists_Positive(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrCreateBucket: awserr.New("BucketAlreadyOwnedByYou", "", errFoo)})
-	_, err := sess.CreateBucket(testBucket, testKpRootKeyCrn)
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{KPRootKeyCRN: testKpRootKeyCrn})
 	assert.NoError(t, err)
 }
 
 func Test_CreateBucket_Positive(t *testing.T) {
 	sess := getSession(&fakeS3API{})
-	_, err := sess.CreateBucket(testBucket, testKpRootKeyCrn)
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{KPRootKeyCRN: testKpRootKeyCrn})
+	assert.NoError(t, err)
+}
+
+func Test_CreateBucket_Lifecycle_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{Lifecycle: &BucketLifecycle{ExpirationDays: 30, AbortMultipartDays: 2}})
+	assert.NoError(t, err)
+	if assert.Len(t, api.LifecycleRules, 1) {
+		assert.Equal(t, int64(30), aws.Int64Value(api.LifecycleRules[0].Expiration.Days))
+		assert.Equal(t, int64(2), aws.Int64Value(api.LifecycleRules[0].AbortIncompleteMultipartUpload.DaysAfterInitiation))
+	}
+}
+
+func Test_CreateBucket_LifecycleError(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrPutLifecycle: errFoo})
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{Lifecycle: &BucketLifecycle{ExpirationDays: 30}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot set lifecycle of bucket")
+	}
+}
+
+func Test_CreateBucket_Retention_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{Retention: &BucketRetention{MinimumDays: 1, DefaultDays: 30, MaximumDays: 365}})
 	assert.NoError(t, err)
+	if assert.NotNil(t, api.protection) {
+		assert.Equal(t, s3.BucketProtectionStatusRetention, aws.StringValue(api.protection.Status))
+		assert.Equal(t, int64(1), aws.Int64Value(api.protection.MinimumRetention.Days))
+		assert.Equal(t, int64(30), aws.Int64Value(api.protection.DefaultRetention.Days))
+		assert.Equal(t, int64(365), aws.Int64Value(api.protection.MaximumRetention.Days))
+	}
+	assert.Nil(t, api.versioning)
+}
+
+func Test_CreateBucket_ObjectLock_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{ObjectLock: &BucketObjectLock{DefaultDays: 7}})
+	assert.NoError(t, err)
+	assert.True(t, aws.BoolValue(api.lockEnabled))
+	assert.Equal(t, s3.BucketVersioningStatusEnabled, aws.StringValue(api.versioning))
+	if assert.NotNil(t, api.objectLock) {
+		assert.Equal(t, s3.ObjectLockRetentionModeCompliance, aws.StringValue(api.objectLock.Rule.DefaultRetention.Mode))
+		assert.Equal(t, int64(7), aws.Int64Value(api.objectLock.Rule.DefaultRetention.Days))
+	}
+}
+
+func Test_DeleteBucket_ObjectVersions_Positive(t *testing.T) {
+	api := &fakeS3API{Versions: []*s3.ObjectVersion{
+		{Key: aws.String(testObject), VersionId: aws.String("v1")},
+		{Key: aws.String(testObject), VersionId: aws.String("v2")},
+	}}
+	sess := getSession(api)
+	err := sess.DeleteBucket(ctx, testBucket, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2"}, api.deletedVersions)
+}
+
+func Test_DeleteBucket_Paginated_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	for i := 0; i < 2500; i++ {
+		api.Objects = append(api.Objects, fmt.Sprintf("object-%d", i))
+	}
+	progress := &DeleteProgress{}
+	sess := getSession(api)
+	err := sess.DeleteBucket(ctx, testBucket, progress)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, api.deleteBatches)
+	assert.Equal(t, 2500, api.deletedKeys)
+	assert.Equal(t, int64(2500), progress.Deleted.Load())
+}
+
+func Test_DeleteBucket_Cancelled(t *testing.T) {
+	api := &fakeS3API{}
+	for i := 0; i < 2500; i++ {
+		api.Objects = append(api.Objects, fmt.Sprintf("object-%d", i))
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	sess := getSession(api)
+	err := sess.DeleteBucket(cancelled, testBucket, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, api.deleteBatches)
+}
+
+func Test_RequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	f := NewObjectStorageSessionFactory(50*time.Millisecond, DefaultRetryPolicy, SessionCache{})
+	sess := f.NewObjectStorageSession(utils.DefaultProvider, server.URL, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+	start := time.Now()
+	err := sess.CheckBucketAccess(ctx, testBucket)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func Test_ClassifyError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected error
+	}{
+		{awserr.New("NoSuchBucket", "", nil), ErrBucketNotFound},
+		{awserr.New("AccessDenied", "", nil), ErrAccessDenied},
+		{awserr.New("SlowDown", "", nil), ErrThrottled},
+		{awserr.NewRequestFailure(awserr.New("Throttled", "", nil), http.StatusTooManyRequests, ""), ErrThrottled},
+		{awserr.New("InvalidAccessKeyId", "", nil), ErrInvalidCredentials},
+		{awserr.New("ExpiredToken", "", nil), ErrInvalidCredentials},
+		{awserr.New(request.ErrCodeRequestError, "send request failed", errFoo), ErrEndpointUnreachable},
+		{awserr.New(request.CanceledErrorCode, "", context.Canceled), context.Canceled},
+	}
+	for _, tc := range testCases {
+		err := classifyError(tc.err)
+		assert.ErrorIs(t, err, tc.expected)
+		assert.Equal(t, tc.err.Error(), err.Error())
+	}
+	assert.Equal(t, errFoo, classifyError(errFoo))
+	assert.NoError(t, classifyError(nil))
+}
+
+func Test_DeleteBucket_MultipartUploads_Positive(t *testing.T) {
+	api := &fakeS3API{Uploads: []*s3.MultipartUpload{
+		{Key: aws.String(testObject), UploadId: aws.String("upload-1")},
+		{Key: aws.String(testObject), UploadId: aws.String("upload-2")},
+	}}
+	sess := getSession(api)
+	err := sess.DeleteBucket(ctx, testBucket, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"upload-1", "upload-2"}, api.abortedUploads)
+}
+
+func Test_DeleteBucket_ListUploadsError(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrListUploads: errFoo})
+	err := sess.DeleteBucket(ctx, testBucket, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot list multipart uploads")
+	}
+}
+
+func Test_DeleteBucket_KeyErrors(t *testing.T) {
+	sess := getSession(&fakeS3API{DeleteErrors: []*s3.Error{{Key: aws.String(testObject), Message: aws.String(errFooMsg)}}})
+	err := sess.DeleteBucket(ctx, testBucket, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot delete 1 objects")
+		assert.NotErrorIs(t, err, ErrBucketProtected)
+	}
+}
+
+func Test_DeleteBucket_Protected(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrDeleteObjects: errFoo, Retention: true})
+	err := sess.DeleteBucket(ctx, testBucket, nil)
+	assert.ErrorIs(t, err, ErrBucketProtected)
+
+	sess = getSession(&fakeS3API{ErrDeleteBucket: errFoo, ObjectLocked: true})
+	err = sess.DeleteBucket(ctx, testBucket, nil)
+	assert.ErrorIs(t, err, ErrBucketProtected)
 }
 
 func Test_DeleteBucket_BucketAlreadyDeleted_Positive(t *testing.T) {
-	sess := getSession(&fakeS3API{ErrListObjects: awserr.New("NoSuchBucket", "", errFoo)})
-	err := sess.DeleteBucket(testBucket)
+	sess := getSession(&fakeS3API{ErrListUploads: awserr.New("NoSuchBucket", "", errFoo)})
+	err := sess.DeleteBucket(ctx, testBucket, nil)
 	assert.NoError(t, err)
 }
 
 func Test_DeleteBucket_ListObjectsError(t *testing.T) {
-	sess := getSession(&fakeS3API{ErrListObjects: errFoo})
-	err := sess.DeleteBucket(testBucket)
+	sess := getSession(&fakeS3API{ErrListObjectsV2: errFoo})
+	err := sess.DeleteBucket(ctx, testBucket, nil)
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "cannot list bucket")
 	}
 }
 
 func Test_DeleteBucket_DeleteObjectError(t *testing.T) {
-	sess := getSession(&fakeS3API{ErrDeleteObject: errFoo})
-	err := sess.DeleteBucket(testBucket)
+	sess := getSession(&fakeS3API{ErrDeleteObjects: errFoo})
+	err := sess.DeleteBucket(ctx, testBucket, nil)
 	if assert.Error(t, err) {
-		assert.Contains(t, err.Error(), "cannot delete object")
+		assert.Contains(t, err.Error(), "cannot delete objects")
 	}
 }
 
 func Test_DeleteBucket_Error(t *testing.T) {
 	sess := getSession(&fakeS3API{ErrDeleteBucket: errFoo})
-	err := sess.DeleteBucket(testBucket)
+	err := sess.DeleteBucket(ctx, testBucket, nil)
 	if assert.Error(t, err) {
 		assert.EqualError(t, err, errFooMsg)
 	}
@@ -188,6 +584,379 @@ func Test_DeleteBucket_Error(t *testing.T) {
 
 func Test_DeleteBucket_Positive(t *testing.T) {
 	sess := getSession(&fakeS3API{})
-	err := sess.DeleteBucket(testBucket)
+	err := sess.DeleteBucket(ctx, testBucket, nil)
+	assert.NoError(t, err)
+}
+
+func Test_ListBuckets_Positive(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	buckets, err := sess.ListBuckets(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{testBucket}, buckets)
+}
+
+func Test_ListBuckets_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrListBuckets: errFoo})
+	_, err := sess.ListBuckets(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot list buckets")
+	}
+}
+
+func Test_ListObjects_Positive(t *testing.T) {
+	testObject = "test-object"
+	sess := getSession(&fakeS3API{})
+	objects, err := sess.ListObjects(ctx, testBucket, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []ObjectInfo{{Key: testObject}}, objects)
+}
+
+func Test_ListObjects_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrListObjectsV2: errFoo})
+	_, err := sess.ListObjects(ctx, testBucket, "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot list bucket")
+	}
+}
+
+func Test_DeleteObjects_Positive(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	err := sess.DeleteObjects(ctx, testBucket, "prefix/", nil)
+	assert.NoError(t, err)
+}
+
+func Test_DeleteObjects_ListObjectsError(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrListObjectsV2: errFoo})
+	err := sess.DeleteObjects(ctx, testBucket, "prefix/", nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), errFooMsg)
+	}
+}
+
+func Test_DeleteObjects_DeleteObjectError(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrDeleteObjects: errFoo})
+	err := sess.DeleteObjects(ctx, testBucket, "prefix/", nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot delete objects")
+	}
+}
+
+func Test_CopyObject_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.CopyObject(ctx, testBucket, "dir/some object", "dst-bucket", "dir/some object")
+	assert.NoError(t, err)
+	assert.Equal(t, testBucket+"/dir/some%20object", aws.StringValue(api.copySource))
+}
+
+func Test_CopyObject_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrCopyObject: errFoo})
+	err := sess.CopyObject(ctx, testBucket, testObject, "dst-bucket", testObject)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot copy object")
+	}
+}
+
+// fakeBucketTagStore keeps the tags of the buckets in memory
+type fakeBucketTagStore struct {
+	tags map[string]map[string]string
+	err  error
+}
+
+func (f *fakeBucketTagStore) GetBucketTags(_ context.Context, bucket string) (map[string]string, error) {
+	if tags, ok := f.tags[bucket]; ok {
+		return tags, f.err
+	}
+	return map[string]string{}, f.err
+}
+
+func (f *fakeBucketTagStore) SetBucketTags(_ context.Context, bucket string, tags map[string]string) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.tags == nil {
+		f.tags = map[string]map[string]string{}
+	}
+	f.tags[bucket] = tags
+	return nil
+}
+
+func (f *fakeBucketTagStore) DeleteBucketTags(_ context.Context, bucket string) error {
+	delete(f.tags, bucket)
+	return f.err
+}
+
+func getTaggingSession(svc s3API, store BucketTagStore) ObjectStorageSession {
+	sess := getSession(svc).(*COSSession)
+	sess.tags = store
+	return sess
+}
+
+func Test_SetBucketTags_Positive(t *testing.T) {
+	store := &fakeBucketTagStore{}
+	sess := getTaggingSession(&fakeS3API{}, store)
+	err := sess.SetBucketTags(ctx, testBucket, map[string]string{"csi-tag": "value", "csi-other": "other"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"csi-tag": "value", "csi-other": "other"}, store.tags[testBucket])
+}
+
+func Test_SetBucketTags_Error(t *testing.T) {
+	sess := getTaggingSession(&fakeS3API{}, &fakeBucketTagStore{err: errFoo})
+	err := sess.SetBucketTags(ctx, testBucket, map[string]string{"csi-tag": "value"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot tag bucket")
+	}
+}
+
+func Test_SetBucketTags_NoStore(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	err := sess.SetBucketTags(ctx, testBucket, map[string]string{"csi-tag": "value"})
+	assert.ErrorIs(t, err, errNoBucketTagStore)
+}
+
+func Test_GetBucketTags_Positive(t *testing.T) {
+	sess := getTaggingSession(&fakeS3API{}, &fakeBucketTagStore{tags: map[string]map[string]string{testBucket: {"csi-tag": "value"}}})
+	tags, err := sess.GetBucketTags(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"csi-tag": "value"}, tags)
+}
+
+func Test_GetBucketTags_NotTagged(t *testing.T) {
+	sess := getTaggingSession(&fakeS3API{}, &fakeBucketTagStore{})
+	tags, err := sess.GetBucketTags(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+}
+
+func Test_GetBucketTags_Error(t *testing.T) {
+	sess := getTaggingSession(&fakeS3API{}, &fakeBucketTagStore{err: errFoo})
+	_, err := sess.GetBucketTags(ctx, testBucket)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot read tags of bucket")
+	}
+}
+
+func Test_DeleteBucket_DeletesTags(t *testing.T) {
+	store := &fakeBucketTagStore{tags: map[string]map[string]string{testBucket: {"csi-tag": "value"}}}
+	sess := getTaggingSession(&fakeS3API{}, store)
+	assert.NoError(t, sess.DeleteBucket(ctx, testBucket, nil))
+	assert.NotContains(t, store.tags, testBucket)
+}
+
+func Test_GetObject_Positive(t *testing.T) {
+	sess := getSession(&fakeS3API{})
+	body, err := sess.GetObject(ctx, testBucket, testObject)
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(body)
+	assert.Equal(t, testObject, string(content))
+}
+
+func Test_GetObject_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrGetObject: errFoo})
+	_, err := sess.GetObject(ctx, testBucket, testObject)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "cannot get object "+testBucket+"/"+testObject+": "+errFooMsg)
+	}
+}
+
+func Test_UploadObject_SmallObject(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.UploadObject(ctx, testBucket, testObject, strings.NewReader(testObject), int64(len(testObject)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, api.putObjects)
+	assert.Equal(t, 0, api.parts)
+}
+
+func Test_UploadObject_Multipart(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.UploadObject(ctx, testBucket, testObject, bytes.NewReader(make([]byte, 2*uploadPartSize+1)), -1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, api.putObjects)
+	assert.Equal(t, 3, api.parts)
+	assert.True(t, api.completed)
+}
+
+func Test_UploadObject_LongerThanSize(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.UploadObject(ctx, testBucket, testObject, bytes.NewReader(make([]byte, uploadPartSize+1)), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, api.putObjects)
+	assert.Equal(t, 2, api.parts)
+	assert.True(t, api.completed)
+}
+
+func Test_UploadObject_PartError(t *testing.T) {
+	api := &fakeS3API{ErrUploadPart: errFoo}
+	sess := getSession(api)
+	err := sess.UploadObject(ctx, testBucket, testObject, bytes.NewReader(make([]byte, uploadPartSize+1)), uploadPartSize+1)
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "cannot upload object "+testBucket+"/"+testObject+": "+errFooMsg)
+	}
+	assert.True(t, api.aborted)
+	assert.False(t, api.completed)
+}
+
+func Test_SetBucketLifecycle_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	lifecycle := BucketLifecycle{ExpirationDays: 30, ArchiveDays: 7, ArchiveType: s3.TransitionStorageClassGlacier}
+	err := sess.SetBucketLifecycle(ctx, testBucket, lifecycle)
+	assert.NoError(t, err)
+	if assert.Len(t, api.LifecycleRules, 1) {
+		assert.Equal(t, int64(30), aws.Int64Value(api.LifecycleRules[0].Expiration.Days))
+		assert.Equal(t, int64(7), aws.Int64Value(api.LifecycleRules[0].Transitions[0].Days))
+	}
+
+	actual, err := sess.GetBucketLifecycle(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, lifecycle, actual)
+}
+
+func Test_SetBucketLifecycle_NoncurrentVersionsAndUploads(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	lifecycle := BucketLifecycle{NoncurrentExpirationDays: 14, AbortMultipartDays: 3}
+	err := sess.SetBucketLifecycle(ctx, testBucket, lifecycle)
+	assert.NoError(t, err)
+	if assert.Len(t, api.LifecycleRules, 1) {
+		assert.Nil(t, api.LifecycleRules[0].Expiration)
+		assert.Equal(t, int64(14), aws.Int64Value(api.LifecycleRules[0].NoncurrentVersionExpiration.NoncurrentDays))
+		assert.Equal(t, int64(3), aws.Int64Value(api.LifecycleRules[0].AbortIncompleteMultipartUpload.DaysAfterInitiation))
+	}
+
+	actual, err := sess.GetBucketLifecycle(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, lifecycle, actual)
+}
+
+func Test_SetBucketLifecycle_NoRule(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.SetBucketLifecycle(ctx, testBucket, BucketLifecycle{})
+	assert.NoError(t, err)
+	assert.True(t, api.deletedLifecycle)
+}
+
+func Test_SetBucketLifecycle_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrPutLifecycle: errFoo})
+	err := sess.SetBucketLifecycle(ctx, testBucket, BucketLifecycle{ExpirationDays: 30})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot set lifecycle of bucket")
+	}
+}
+
+func Test_GetBucketLifecycle_NotConfigured(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrGetLifecycle: awserr.New("NoSuchLifecycleConfiguration", "", errFoo)})
+	lifecycle, err := sess.GetBucketLifecycle(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, BucketLifecycle{}, lifecycle)
+}
+
+func Test_GetBucketLifecycle_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrGetLifecycle: errFoo})
+	_, err := sess.GetBucketLifecycle(ctx, testBucket)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot read lifecycle of bucket")
+	}
+}
+
+func Test_SetBucketVersioning_Positive(t *testing.T) {
+	api := &fakeS3API{}
+	sess := getSession(api)
+	err := sess.SetBucketVersioning(ctx, testBucket, false)
+	assert.NoError(t, err)
+	assert.Equal(t, s3.BucketVersioningStatusSuspended, aws.StringValue(api.versioning))
+}
+
+func Test_SetBucketVersioning_Error(t *testing.T) {
+	sess := getSession(&fakeS3API{ErrPutVersioning: errFoo})
+	err := sess.SetBucketVersioning(ctx, testBucket, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot set versioning of bucket")
+	}
+}
+
+func Test_GetBucketRetention(t *testing.T) {
+	sess := getSession(&fakeS3API{Retention: true})
+	retention, err := sess.GetBucketRetention(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, &BucketRetention{}, retention)
+
+	sess = getSession(&fakeS3API{})
+	retention, err = sess.GetBucketRetention(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Nil(t, retention)
+}
+
+func Test_GetBucketObjectLock(t *testing.T) {
+	sess := getSession(&fakeS3API{ObjectLocked: true})
+	lock, err := sess.GetBucketObjectLock(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, &BucketObjectLock{}, lock)
+
+	sess = getSession(&fakeS3API{})
+	lock, err = sess.GetBucketObjectLock(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Nil(t, lock)
+}
+
+func Test_Provider_FakeServer(t *testing.T) {
+	server := NewFakeS3Server()
+	defer server.Close()
+	minio, _ := utils.GetProvider(constants.ProviderMinIO)
+	f := NewObjectStorageSessionFactory(0, DefaultRetryPolicy, SessionCache{})
+	store := &fakeBucketTagStore{}
+	f.SetBucketTagStore(store)
+	sess := f.NewObjectStorageSession(minio, server.URL, testRegion, &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}, zap.NewNop())
+
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{Versioning: true})
+	assert.NoError(t, err)
+	location, ok := server.BucketLocation(testBucket)
+	assert.True(t, ok)
+	assert.Empty(t, location)
+	assert.NoError(t, sess.CheckBucketAccess(ctx, testBucket))
+
+	assert.NoError(t, sess.UploadObject(ctx, testBucket, "dir/object", strings.NewReader("data"), 4))
+	tags, err := sess.GetBucketTags(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+	assert.NoError(t, sess.SetBucketTags(ctx, testBucket, map[string]string{"tag": "value"}))
+	tags, err = sess.GetBucketTags(ctx, testBucket)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", tags["tag"])
+	objects, err := sess.ListObjects(ctx, testBucket, "dir/")
+	assert.NoError(t, err)
+	assert.Equal(t, []ObjectInfo{{Key: "dir/object", Size: 4, ETag: "8d777f385d3dfec8815d20f7496026dc"}}, objects)
+
+	assert.NoError(t, sess.DeleteBucket(ctx, testBucket, nil))
+	assert.ErrorIs(t, sess.CheckBucketAccess(ctx, testBucket), ErrBucketNotFound)
+	assert.Empty(t, store.tags)
+	for _, signature := range server.Signatures() {
+		assert.Equal(t, "AWS4-HMAC-SHA256", signature)
+	}
+}
+
+func Test_Provider_BucketLocation(t *testing.T) {
+	awsProvider, _ := utils.GetProvider(constants.ProviderAWS)
+	f := &COSSessionFactory{}
+	creds := &ObjectStorageCredentials{AccessKey: testAccessKey, SecretKey: testSecretKey}
+
+	sess := f.NewObjectStorageSession(awsProvider, testEndpoint, "eu-west-1", creds, zap.NewNop()).(*COSSession)
+	assert.Equal(t, "eu-west-1", sess.bucketLocation)
+	assert.False(t, *sess.svc.(*s3.S3).Config.S3ForcePathStyle)
+	// Buckets of us-east-1 are created without location constraint
+	assert.Empty(t, f.NewObjectStorageSession(awsProvider, testEndpoint, "us-east-1", creds, zap.NewNop()).(*COSSession).bucketLocation)
+	sess = f.NewObjectStorageSession(utils.DefaultProvider, testEndpoint, testRegion, creds, zap.NewNop()).(*COSSession)
+	assert.Empty(t, sess.bucketLocation)
+	assert.True(t, *sess.svc.(*s3.S3).Config.S3ForcePathStyle)
+
+	api := &fakeS3API{}
+	sess = getSession(api).(*COSSession)
+	sess.bucketLocation = "eu-west-1"
+	_, err := sess.CreateBucket(ctx, testBucket, BucketOptions{})
 	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", *api.bucketConfig.LocationConstraint)
 }
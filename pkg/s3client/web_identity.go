@@ -0,0 +1,138 @@
+package s3client
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
+)
+
+// roleSessionName names the sessions of the roles assumed through AWS STS
+const roleSessionName = "ibm-object-csi-driver"
+
+// TemporaryCredentials are short-lived AWS credentials, along with their session token
+type TemporaryCredentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expiration   time.Time
+}
+
+// TrustedProfileToken exchanges the service account token of the credentials, a
+// compute resource token, for an IAM token of their trusted profile
+func (s *COSSessionFactory) TrustedProfileToken(ctx context.Context, creds *ObjectStorageCredentials) (*token.Token, error) {
+	form := url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:cr-token"},
+		"cr_token":   {creds.ServiceAccountToken},
+		"profile_id": {creds.TrustedProfileID},
+	}
+	var iamToken token.Token
+	err := s.postForm(ctx, creds.IAMEndpoint+"/identity/token", form, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&iamToken)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get an IAM token of trusted profile %s: %w", creds.TrustedProfileID, err)
+	}
+	return &iamToken, nil
+}
+
+// APIKeyToken exchanges the API key of the credentials for an IAM token
+func (s *COSSessionFactory) APIKeyToken(ctx context.Context, creds *ObjectStorageCredentials) (*token.Token, error) {
+	form := url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"},
+		"apikey":     {creds.APIKey},
+	}
+	var iamToken token.Token
+	err := s.postForm(ctx, creds.IAMEndpoint+"/identity/token", form, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&iamToken)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get an IAM token of the API key: %w", err)
+	}
+	return &iamToken, nil
+}
+
+// AssumeRoleWithWebIdentity exchanges the service account token of the credentials
+// for temporary credentials of their role
+func (s *COSSessionFactory) AssumeRoleWithWebIdentity(ctx context.Context, creds *ObjectStorageCredentials) (*TemporaryCredentials, error) {
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {creds.RoleARN},
+		"RoleSessionName":  {roleSessionName},
+		"WebIdentityToken": {creds.ServiceAccountToken},
+	}
+	var response struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      time.Time
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	err := s.postForm(ctx, creds.STSEndpoint, form, func(body io.Reader) error {
+		return xml.NewDecoder(body).Decode(&response)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot assume role %s: %w", creds.RoleARN, err)
+	}
+	return &TemporaryCredentials{
+		AccessKey:    response.Credentials.AccessKeyID,
+		SecretKey:    response.Credentials.SecretAccessKey,
+		SessionToken: response.Credentials.SessionToken,
+		Expiration:   response.Credentials.Expiration,
+	}, nil
+}
+
+// postForm posts a form to a token endpoint and decodes its response. The errors
+// wrap the sentinel of their cause.
+func (s *COSSessionFactory) postForm(ctx context.Context, endpoint string, form url.Values, decode func(io.Reader) error) error {
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var nerr net.Error
+		if errors.As(err, &nerr) && ctx.Err() == nil {
+			return fmt.Errorf("%w: %v", ErrEndpointUnreachable, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		switch resp.StatusCode {
+		case http.StatusBadRequest, http.StatusUnauthorized:
+			return fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		case http.StatusForbidden:
+			return fmt.Errorf("%w: %v", ErrAccessDenied, err)
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return fmt.Errorf("%w: %v", ErrThrottled, err)
+		}
+		return err
+	}
+	if err = decode(resp.Body); err != nil {
+		return fmt.Errorf("cannot decode the response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package s3client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TrustedProfileToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/identity/token", r.URL.Path)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ibm:params:oauth:grant-type:cr-token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "test-profile", r.PostForm.Get("profile_id"))
+		if r.PostForm.Get("cr_token") != "sa-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errorCode":"BXNIM0415E","errorMessage":"Provided cr_token is invalid"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"iam-token","token_type":"Bearer","expires_in":3600,"expiration":1700000000}`))
+	}))
+	defer server.Close()
+	f := NewObjectStorageSessionFactory(time.Second, DefaultRetryPolicy, SessionCache{})
+	creds := &ObjectStorageCredentials{IAMEndpoint: server.URL, TrustedProfileID: "test-profile", ServiceAccountToken: "sa-token"}
+
+	iamToken, err := f.TrustedProfileToken(context.Background(), creds)
+	assert.NoError(t, err)
+	assert.Equal(t, "iam-token", iamToken.AccessToken)
+	assert.Equal(t, int64(1700000000), iamToken.Expiration)
+
+	creds.ServiceAccountToken = "expired"
+	_, err = f.TrustedProfileToken(context.Background(), creds)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorContains(t, err, "Provided cr_token is invalid")
+}
+
+func Test_APIKeyToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/identity/token", r.URL.Path)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ibm:params:oauth:grant-type:apikey", r.PostForm.Get("grant_type"))
+		if r.PostForm.Get("apikey") != "api-key" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errorCode":"BXNIM0415E","errorMessage":"Provided API key could not be found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"iam-token","token_type":"Bearer","expires_in":3600,"expiration":1700000000}`))
+	}))
+	defer server.Close()
+	f := NewObjectStorageSessionFactory(time.Second, DefaultRetryPolicy, SessionCache{})
+	creds := &ObjectStorageCredentials{IAMEndpoint: server.URL, APIKey: "api-key"}
+
+	iamToken, err := f.APIKeyToken(context.Background(), creds)
+	assert.NoError(t, err)
+	assert.Equal(t, "iam-token", iamToken.AccessToken)
+
+	creds.APIKey = "revoked"
+	_, err = f.APIKeyToken(context.Background(), creds)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorContains(t, err, "Provided API key could not be found")
+}
+
+func Test_AssumeRoleWithWebIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.PostForm.Get("Action"))
+		assert.Equal(t, "sa-token", r.PostForm.Get("WebIdentityToken"))
+		if r.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/test" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code></Error></ErrorResponse>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse>
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIATEST</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2024-01-01T12:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer server.Close()
+	f := NewObjectStorageSessionFactory(time.Second, DefaultRetryPolicy, SessionCache{})
+	creds := &ObjectStorageCredentials{STSEndpoint: server.URL, RoleARN: "arn:aws:iam::123456789012:role/test", ServiceAccountToken: "sa-token"}
+
+	temporary, err := f.AssumeRoleWithWebIdentity(context.Background(), creds)
+	assert.NoError(t, err)
+	assert.Equal(t, TemporaryCredentials{
+		AccessKey:    "ASIATEST",
+		SecretKey:    "secret",
+		SessionToken: "session",
+		Expiration:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}, *temporary)
+
+	creds.RoleARN = "arn:aws:iam::123456789012:role/other"
+	_, err = f.AssumeRoleWithWebIdentity(context.Background(), creds)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+
+	creds.STSEndpoint = "http://127.0.0.1:1"
+	_, err = f.AssumeRoleWithWebIdentity(context.Background(), creds)
+	assert.ErrorIs(t, err, ErrEndpointUnreachable)
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// BucketTagConfigMaps keeps the tags of the buckets in config maps, one per bucket,
+// as the COS S3 API has no bucket tagging. The tags are kept out of the objects of
+// the buckets, where the workloads would see them.
+type BucketTagConfigMaps struct {
+	namespace string
+	k8sClient func() (kubernetes.Interface, error)
+}
+
+// NewBucketTagConfigMaps returns a store of bucket tags in the config maps of the
+// given namespace, or of the namespace of the pod when it is empty
+func NewBucketTagConfigMaps(namespace string) *BucketTagConfigMaps {
+	return &BucketTagConfigMaps{
+		namespace: namespace,
+		k8sClient: func() (kubernetes.Interface, error) { return createK8sClient() },
+	}
+}
+
+// GetBucketTags returns the tags of a bucket, none when it was never tagged
+func (s *BucketTagConfigMaps) GetBucketTags(ctx context.Context, bucket string) (map[string]string, error) {
+	configMaps, err := s.configMaps()
+	if err != nil {
+		return nil, err
+	}
+	configMap, err := configMaps.Get(ctx, bucketTagsName(bucket), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(configMap.Data))
+	for k, v := range configMap.Data {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+// SetBucketTags replaces the tags of a bucket
+func (s *BucketTagConfigMaps) SetBucketTags(ctx context.Context, bucket string, tags map[string]string) error {
+	configMaps, err := s.configMaps()
+	if err != nil {
+		return err
+	}
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        bucketTagsName(bucket),
+			Labels:      map[string]string{constants.BucketTagsLabel: "true"},
+			Annotations: map[string]string{constants.BucketAnnotation: bucket},
+		},
+		Data: tags,
+	}
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	}
+	return err
+}
+
+// DeleteBucketTags drops the tags of a bucket
+func (s *BucketTagConfigMaps) DeleteBucketTags(ctx context.Context, bucket string) error {
+	configMaps, err := s.configMaps()
+	if err != nil {
+		return err
+	}
+	err = configMaps.Delete(ctx, bucketTagsName(bucket), metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *BucketTagConfigMaps) configMaps() (corev1.ConfigMapInterface, error) {
+	k8sClient, err := s.k8sClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace := s.namespace
+	if namespace == "" {
+		if namespace, err = podNamespace(); err != nil {
+			return nil, err
+		}
+	}
+	return k8sClient.CoreV1().ConfigMaps(namespace), nil
+}
+
+// bucketTagsName returns the name of the config map holding the tags of a bucket.
+// Bucket names are valid config map names.
+func bucketTagsName(bucket string) string {
+	return constants.BucketTagsConfigMapPrefix + bucket
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBucketTagConfigMaps(t *testing.T) {
+	ctx := context.Background()
+	k8sClient := fake.NewSimpleClientset()
+	store := &BucketTagConfigMaps{
+		namespace: "test-namespace",
+		k8sClient: func() (kubernetes.Interface, error) { return k8sClient, nil },
+	}
+
+	tags, err := store.GetBucketTags(ctx, "test-bucket")
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	assert.NoError(t, store.SetBucketTags(ctx, "test-bucket", map[string]string{"csi-tag": "value", "csi-other": "other"}))
+	assert.NoError(t, store.SetBucketTags(ctx, "test-bucket", map[string]string{"csi-tag": "updated"}))
+	tags, err = store.GetBucketTags(ctx, "test-bucket")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"csi-tag": "updated"}, tags)
+
+	configMap, err := k8sClient.CoreV1().ConfigMaps("test-namespace").Get(ctx, "csi-bucket-tags-test-bucket", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "true", configMap.Labels[constants.BucketTagsLabel])
+	assert.Equal(t, "test-bucket", configMap.Annotations[constants.BucketAnnotation])
+
+	assert.NoError(t, store.DeleteBucketTags(ctx, "test-bucket"))
+	assert.NoError(t, store.DeleteBucketTags(ctx, "test-bucket"))
+	tags, err = store.GetBucketTags(ctx, "test-bucket")
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a bounded cache safe for concurrent use. An entry expires ttl after it
+// was added, and the least recently used entry is evicted to make room for a new one.
+type Cache[V any] struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// lru orders the entries from the most to the least recently used
+	lru *list.List
+	now func() time.Time
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// NewCache returns a cache of at most size entries, each expiring ttl after it was
+// added, or never when ttl is zero
+func NewCache[V any](size int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value of key, unless it is missing or expired
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry[V])
+		if c.ttl == 0 || c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			return entry.value, true
+		}
+		c.remove(elem)
+	}
+	var zero V
+	return zero, false
+}
+
+// Add sets the value of key, evicting the least recently used entry when the cache is full
+func (c *Cache[V]) Add(key string, value V) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	for c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry[V]{key: key, value: value, expires: c.now().Add(c.ttl)})
+}
+
+// Len returns the number of entries in the cache, the expired ones included
+func (c *Cache[V]) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache[V]) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry[V]).key)
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache[int](2, 0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	// a becomes the most recently used entry, b is evicted for c
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	c.Add("c", 3)
+
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	value, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, value)
+
+	c.Add("c", 4)
+	value, _ = c.Get("c")
+	assert.Equal(t, 4, value)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Now()
+	c := NewCache[int](2, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Add("a", 1)
+
+	now = now.Add(59 * time.Second)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	now = now.Add(time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := NewCache[int](0, time.Minute)
+	c.Add("a", 1)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
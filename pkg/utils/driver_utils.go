@@ -2,19 +2,26 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/IBM/go-sdk-core/v5/core"
 	rc "github.com/IBM/ibm-cos-sdk-go-config/v2/resourceconfigurationv1"
 	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
@@ -25,21 +32,68 @@ type StatsUtils interface {
 	BucketToDelete(volumeID string) (string, error)
 	FSInfo(path string) (int64, int64, int64, int64, int64, int64, error)
 	CheckMount(targetPath string) error
-	GetTotalCapacityFromPV(volumeID string) (resource.Quantity, error)
-	GetBucketUsage(volumeID string) (int64, error)
+	IsMountPoint(targetPath string) (bool, error)
+	GetTotalCapacityFromPV(pvName string) (resource.Quantity, error)
+	GetBucketUsage(pvName string) (int64, error)
 	GetBucketNameFromPV(volumeID string) (string, error)
+	GetPVAttributes(volumeID string) (map[string]string, error)
+	ListDriverVolumes(driverName string) ([]DriverVolume, error)
+	GetDriverVolume(volumeID string) (*DriverVolume, error)
+	GetPVVolume(pvName string) (*DriverVolume, error)
+	SetBucketHardQuota(apiKey, bucketName string, quotaBytes int64) error
+	GetPVMountOptions(pvName string) (string, error)
+	SetPVMountOptions(volumeID, mountOptions string) error
+	GetClusterID() (string, error)
+	GetSecret(namespace, name string) (map[string]string, error)
 }
 
 type DriverStatsUtils struct {
+	// ResourceConfigs are the resource configuration clients created lately, reused
+	// along with their IAM token by the next calls with the same endpoint and API key,
+	// rather than exchanging the API key again at every stats poll. A client is
+	// created at each call when it is nil.
+	ResourceConfigs *Cache[*rc.ResourceConfigurationV1]
 }
 
+const (
+	// DefaultResourceConfigCacheSize is the number of resource configuration clients
+	// kept for reuse unless set otherwise
+	DefaultResourceConfigCacheSize = 64
+	// DefaultResourceConfigCacheTTL is how long a resource configuration client is
+	// reused after its creation unless set otherwise
+	DefaultResourceConfigCacheTTL = 30 * time.Minute
+)
+
+// NewDriverStatsUtils returns the stats utils keeping up to cacheSize resource
+// configuration clients, each for cacheTTL after its creation
+func NewDriverStatsUtils(cacheSize int, cacheTTL time.Duration) *DriverStatsUtils {
+	return &DriverStatsUtils{ResourceConfigs: NewCache[*rc.ResourceConfigurationV1](cacheSize, cacheTTL)}
+}
+
+// DriverVolume describes a persistent volume provisioned by the driver, along with
+// the secret of its claim and the nodes running pods that use it
+type DriverVolume struct {
+	VolumeID      string
+	CapacityBytes int64
+	Attributes    map[string]string
+	Secrets       map[string]string
+	NodeIDs       []string
+}
+
+// ErrVolumeNotFound is returned by GetDriverVolume when the volume has no PV
+var ErrVolumeNotFound = errors.New("volume not found")
+
+// ErrUsageUnsupported is returned by GetBucketUsage when the provider of the volume
+// does not report the usage of its buckets
+var ErrUsageUnsupported = errors.New("bucket usage not reported by the provider")
+
 func (su *DriverStatsUtils) BucketToDelete(volumeID string) (string, error) {
 	clientset, err := createK8sClient()
 	if err != nil {
 		return "", err
 	}
 
-	pv, err := clientset.CoreV1().PersistentVolumes().Get(context.Background(), volumeID, metav1.GetOptions{})
+	pv, err := findPV(clientset, volumeID)
 	if err != nil {
 		klog.Errorf("Unable to fetch bucket %v", err)
 		return "", err
@@ -76,8 +130,22 @@ func (su *DriverStatsUtils) CheckMount(targetPath string) error {
 	return nil
 }
 
-func (su *DriverStatsUtils) GetTotalCapacityFromPV(volumeID string) (resource.Quantity, error) {
-	pv, err := getPV(volumeID)
+// IsMountPoint tells whether a volume is mounted at targetPath
+func (su *DriverStatsUtils) IsMountPoint(targetPath string) (bool, error) {
+	out, err := exec.Command("mountpoint", targetPath).CombinedOutput()
+	outStr := strings.TrimSpace(string(out))
+	switch {
+	case err == nil:
+		return true, nil
+	case strings.HasSuffix(outStr, "is not a mountpoint"), strings.HasSuffix(outStr, "No such file or directory"):
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s: %w", outStr, err)
+	}
+}
+
+func (su *DriverStatsUtils) GetTotalCapacityFromPV(pvName string) (resource.Quantity, error) {
+	pv, err := getPV(pvName)
 	if err != nil {
 		return resource.Quantity{}, err
 	}
@@ -86,28 +154,44 @@ func (su *DriverStatsUtils) GetTotalCapacityFromPV(volumeID string) (resource.Qu
 	return capacity, nil
 }
 
-func (su *DriverStatsUtils) GetBucketUsage(volumeID string) (int64, error) {
-	ep, err := getEPBasedOnCluserInfra()
+// GetBucketUsage returns the bytes stored in the bucket of the volume of a PV
+func (su *DriverStatsUtils) GetBucketUsage(pvName string) (int64, error) {
+	pv, err := getPV(pvName)
+	if err != nil {
+		return 0, err
+	}
+	secret, err := fetchSecretOfPV(pv)
+	if err != nil {
+		return 0, err
+	}
+
+	// The provider in the secret takes precedence over the one of the storage class
+	providerName := string(secret.Data["provider"])
+	if providerName == "" && pv.Spec.CSI != nil {
+		providerName = pv.Spec.CSI.VolumeAttributes["provider"]
+	}
+	provider, err := GetProvider(providerName)
 	if err != nil {
 		return 0, err
 	}
+	if !provider.ResourceConfiguration {
+		return 0, fmt.Errorf("%w: %s", ErrUsageUnsupported, provider.Name)
+	}
 
-	secret, err := fetchSecretUsingPV(volumeID)
+	ep, err := getEPBasedOnCluserInfra()
 	if err != nil {
 		return 0, err
 	}
 
 	apiKey := string(secret.Data["apiKey"])
 	bucketName := string(secret.Data["bucketName"])
-
-	rcOptions := &rc.ResourceConfigurationV1Options{
-		URL: ep,
-		Authenticator: &core.IamAuthenticator{
-			ApiKey: apiKey, // pragma: allowlist secret
-			URL:    constants.IAMEP,
-		},
+	if pv.Spec.CSI != nil {
+		if info, ok := DecodeVolumeID(pv.Spec.CSI.VolumeHandle); ok {
+			bucketName = info.BucketName
+		}
 	}
-	resourceConfig, err := rc.NewResourceConfigurationV1(rcOptions)
+
+	resourceConfig, err := su.newResourceConfig(ep, apiKey)
 	if err != nil {
 		klog.Error("Failed to create resource config")
 		return 0, err
@@ -126,6 +210,83 @@ func (su *DriverStatsUtils) GetBucketUsage(volumeID string) (int64, error) {
 	return *res.BytesUsed, nil
 }
 
+// SetBucketHardQuota limits the bytes stored in a bucket. The resource configuration
+// API authenticates with IAM, so the quota cannot be set without an API key.
+func (su *DriverStatsUtils) SetBucketHardQuota(apiKey, bucketName string, quotaBytes int64) error {
+	if apiKey == "" {
+		return errors.New("an apiKey is required to set the quota of a bucket")
+	}
+
+	ep, err := getEPBasedOnCluserInfra()
+	if err != nil {
+		return err
+	}
+
+	resourceConfig, err := su.newResourceConfig(ep, apiKey)
+	if err != nil {
+		klog.Error("Failed to create resource config")
+		return err
+	}
+
+	patch, err := (&rc.BucketPatch{HardQuota: &quotaBytes}).AsPatch()
+	if err != nil {
+		return err
+	}
+	bucketOptions := &rc.UpdateBucketConfigOptions{
+		Bucket:      &bucketName,
+		BucketPatch: patch,
+	}
+
+	if _, err = resourceConfig.UpdateBucketConfig(bucketOptions); err != nil {
+		klog.Errorf("Failed to set hard quota of bucket %s: %v", bucketName, err)
+		return fmt.Errorf("cannot set hard quota of bucket %s: %v", bucketName, err)
+	}
+	klog.Infof("Set hard quota of bucket %s to %d bytes", bucketName, quotaBytes)
+	return nil
+}
+
+// GetPVMountOptions returns the default mount options recorded on a PV
+func (su *DriverStatsUtils) GetPVMountOptions(pvName string) (string, error) {
+	pv, err := getPV(pvName)
+	if err != nil {
+		return "", err
+	}
+	return pv.Annotations[constants.MountOptionsAnnotation], nil
+}
+
+// SetPVMountOptions records the default mount options of a volume on its PV, for the
+// nodes to apply on the next mount. Empty options remove the annotation.
+func (su *DriverStatsUtils) SetPVMountOptions(volumeID, mountOptions string) error {
+	k8sClient, err := createK8sClient()
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if mountOptions != "" {
+		value = mountOptions
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{constants.MountOptionsAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	pv, err := findPV(k8sClient, volumeID)
+	if err != nil {
+		return fmt.Errorf("error getting PV: %v", err)
+	}
+	_, err = k8sClient.CoreV1().PersistentVolumes().Patch(context.Background(), pv.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		klog.Errorf("Unable to annotate pv %s: %v", volumeID, err)
+		return fmt.Errorf("error annotating PV: %v", err)
+	}
+	return nil
+}
+
 func (su *DriverStatsUtils) GetBucketNameFromPV(volumeID string) (string, error) {
 	pv, err := getPV(volumeID)
 	if err != nil {
@@ -136,6 +297,170 @@ func (su *DriverStatsUtils) GetBucketNameFromPV(volumeID string) (string, error)
 	return tempBucketName, nil
 }
 
+func (su *DriverStatsUtils) GetPVAttributes(volumeID string) (map[string]string, error) {
+	k8sClient, err := createK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pv, err := findPV(k8sClient, volumeID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting PV: %v", err)
+	}
+
+	return pv.Spec.CSI.VolumeAttributes, nil
+}
+
+func (su *DriverStatsUtils) ListDriverVolumes(driverName string) ([]DriverVolume, error) {
+	k8sClient, err := createK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pvs, err := k8sClient.CoreV1().PersistentVolumes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing PVs: %v", err)
+	}
+
+	// Pods are listed once per namespace, to find the nodes using each claim
+	podsByNamespace := map[string][]v1.Pod{}
+	volumes := []DriverVolume{}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+			continue
+		}
+		volume, err := newDriverVolume(k8sClient, pv, podsByNamespace)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, *volume)
+	}
+	return volumes, nil
+}
+
+func (su *DriverStatsUtils) GetDriverVolume(volumeID string) (*DriverVolume, error) {
+	k8sClient, err := createK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pv, err := findPV(k8sClient, volumeID)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeNotFound, volumeID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting PV: %v", err)
+	}
+	if pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("%w: %s is not a CSI volume", ErrVolumeNotFound, volumeID)
+	}
+	return newDriverVolume(k8sClient, pv, map[string][]v1.Pod{})
+}
+
+// GetPVVolume describes the volume of a PV found by name, without the nodes using it.
+// It serves the nodes, which look the PVs up by name rather than watching them.
+func (su *DriverStatsUtils) GetPVVolume(pvName string) (*DriverVolume, error) {
+	pv, err := getPV(pvName)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeNotFound, pvName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pv.Spec.CSI == nil {
+		return nil, fmt.Errorf("%w: %s is not a CSI volume", ErrVolumeNotFound, pvName)
+	}
+	return newPVVolume(pv), nil
+}
+
+// newPVVolume describes a PV, fetching the secret of its claim
+func newPVVolume(pv *v1.PersistentVolume) *DriverVolume {
+	volume := &DriverVolume{
+		VolumeID:   pv.Spec.CSI.VolumeHandle,
+		Attributes: pv.Spec.CSI.VolumeAttributes,
+		NodeIDs:    []string{},
+	}
+	if capacity, ok := pv.Spec.Capacity[v1.ResourceStorage]; ok {
+		volume.CapacityBytes = capacity.Value()
+	}
+
+	claim := pv.Spec.ClaimRef
+	if claim == nil {
+		return volume
+	}
+	secret, err := getSecret(claim.Name, claim.Namespace)
+	if err != nil {
+		klog.Warningf("Unable to fetch secret of pv %s: %v", pv.Name, err)
+	} else {
+		volume.Secrets = make(map[string]string, len(secret.Data))
+		for k, v := range secret.Data {
+			volume.Secrets[k] = string(v)
+		}
+	}
+	return volume
+}
+
+// newDriverVolume describes a PV, fetching the secret and the pods of its claim.
+// podsByNamespace caches the pods listed in the namespaces already visited.
+func newDriverVolume(k8sClient *kubernetes.Clientset, pv *v1.PersistentVolume, podsByNamespace map[string][]v1.Pod) (*DriverVolume, error) {
+	volume := newPVVolume(pv)
+	claim := pv.Spec.ClaimRef
+	if claim == nil {
+		return volume, nil
+	}
+
+	pods, ok := podsByNamespace[claim.Namespace]
+	if !ok {
+		podList, err := k8sClient.CoreV1().Pods(claim.Namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error listing pods: %v", err)
+		}
+		pods = podList.Items
+		podsByNamespace[claim.Namespace] = pods
+	}
+	volume.NodeIDs = getClaimNodes(pods, claim.Name)
+	return volume, nil
+}
+
+// getClaimNodes returns the nodes running pods that use the given claim
+func getClaimNodes(pods []v1.Pod, claimName string) []string {
+	nodes := []string{}
+	seen := map[string]bool{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == "" || seen[pod.Spec.NodeName] ||
+			pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil && vol.PersistentVolumeClaim.ClaimName == claimName {
+				nodes = append(nodes, pod.Spec.NodeName)
+				seen[pod.Spec.NodeName] = true
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// maskedKeys are the keys of the secrets and volume attributes holding credentials
+var maskedKeys = []string{"accessKey", "secretKey", "apiKey", "kpRootKeyCRN", "serviceAccountToken",
+	"cryptPassword", "cryptSalt", constants.ServiceAccountTokensKey}
+
+// MaskSecrets returns a copy of secrets or volume attributes to be logged, with the
+// credentials masked
+func MaskSecrets(secretMap map[string]string) map[string]string {
+	masked := make(map[string]string)
+	for k, v := range secretMap {
+		if slices.Contains(maskedKeys, k) {
+			masked[k] = "xxxxxxx"
+			continue
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
 func ReplaceAndReturnCopy(req interface{}) (interface{}, error) {
 	switch r := req.(type) {
 	case *csi.CreateVolumeRequest:
@@ -148,16 +473,8 @@ func ReplaceAndReturnCopy(req interface{}) (interface{}, error) {
 		inReq = req.(*csi.CreateVolumeRequest)
 
 		// Modify the Secrets map in the new request
-		newReq.Secrets = make(map[string]string)
-		secretMap := inReq.GetSecrets()
-
-		for k, v := range secretMap {
-			if k == "accessKey" || k == "secretKey" || k == "apiKey" || k == "kpRootKeyCRN" {
-				newReq.Secrets[k] = "xxxxxxx"
-				continue
-			}
-			newReq.Secrets[k] = v
-		}
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
+		newReq.Parameters = MaskSecrets(inReq.GetParameters())
 		return newReq, nil
 	case *csi.DeleteVolumeRequest:
 		// Create a new DeleteVolumeRequest and copy the original values
@@ -169,16 +486,7 @@ func ReplaceAndReturnCopy(req interface{}) (interface{}, error) {
 		inReq = req.(*csi.DeleteVolumeRequest)
 
 		// Modify the Secrets map in the new request
-		newReq.Secrets = make(map[string]string)
-		secretMap := inReq.GetSecrets()
-
-		for k, v := range secretMap {
-			if k == "accessKey" || k == "secretKey" || k == "apiKey" || k == "kpRootKeyCRN" {
-				newReq.Secrets[k] = "xxxxxxx"
-				continue
-			}
-			newReq.Secrets[k] = v
-		}
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
 
 		return newReq, nil
 	case *csi.NodePublishVolumeRequest:
@@ -191,16 +499,74 @@ func ReplaceAndReturnCopy(req interface{}) (interface{}, error) {
 		inReq = req.(*csi.NodePublishVolumeRequest)
 
 		// Modify the Secrets map in the new request
-		newReq.Secrets = make(map[string]string)
-		secretMap := inReq.GetSecrets()
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
+		// The volume context holds the service account tokens of the pod
+		newReq.VolumeContext = MaskSecrets(inReq.GetVolumeContext())
 
-		for k, v := range secretMap {
-			if k == "accessKey" || k == "secretKey" || k == "apiKey" || k == "kpRootKeyCRN" {
-				newReq.Secrets[k] = "xxxxxxx"
-				continue
-			}
-			newReq.Secrets[k] = v
-		}
+		return newReq, nil
+	case *csi.CreateSnapshotRequest:
+		// Create a new CreateSnapshotRequest and copy the original values
+		var inReq *csi.CreateSnapshotRequest
+
+		newReq := &csi.CreateSnapshotRequest{}
+		*newReq = *r
+
+		inReq = req.(*csi.CreateSnapshotRequest)
+
+		// Modify the Secrets map in the new request
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
+
+		return newReq, nil
+	case *csi.DeleteSnapshotRequest:
+		// Create a new DeleteSnapshotRequest and copy the original values
+		var inReq *csi.DeleteSnapshotRequest
+
+		newReq := &csi.DeleteSnapshotRequest{}
+		*newReq = *r
+
+		inReq = req.(*csi.DeleteSnapshotRequest)
+
+		// Modify the Secrets map in the new request
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
+
+		return newReq, nil
+	case *csi.ListSnapshotsRequest:
+		// Create a new ListSnapshotsRequest and copy the original values
+		var inReq *csi.ListSnapshotsRequest
+
+		newReq := &csi.ListSnapshotsRequest{}
+		*newReq = *r
+
+		inReq = req.(*csi.ListSnapshotsRequest)
+
+		// Modify the Secrets map in the new request
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
+
+		return newReq, nil
+	case *csi.ControllerExpandVolumeRequest:
+		// Create a new ControllerExpandVolumeRequest and copy the original values
+		var inReq *csi.ControllerExpandVolumeRequest
+
+		newReq := &csi.ControllerExpandVolumeRequest{}
+		*newReq = *r
+
+		inReq = req.(*csi.ControllerExpandVolumeRequest)
+
+		// Modify the Secrets map in the new request
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
+
+		return newReq, nil
+	case *csi.ControllerModifyVolumeRequest:
+		// Create a new ControllerModifyVolumeRequest and copy the original values
+		var inReq *csi.ControllerModifyVolumeRequest
+
+		newReq := &csi.ControllerModifyVolumeRequest{}
+		*newReq = *r
+
+		inReq = req.(*csi.ControllerModifyVolumeRequest)
+
+		// Modify the Secrets map in the new request
+		newReq.Secrets = MaskSecrets(inReq.GetSecrets())
 
 		return newReq, nil
 
@@ -227,21 +593,37 @@ func createK8sClient() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
-func getPV(volumeID string) (*v1.PersistentVolume, error) {
+// getPV returns a PV by name. The nodes look the PVs up this way, only the controller
+// watches them.
+func getPV(pvName string) (*v1.PersistentVolume, error) {
 	k8sClient, err := createK8sClient()
 	if err != nil {
 		return nil, err
 	}
 
-	pv, err := k8sClient.CoreV1().PersistentVolumes().Get(context.Background(), volumeID, metav1.GetOptions{})
+	pv, err := k8sClient.CoreV1().PersistentVolumes().Get(context.Background(), pvName, metav1.GetOptions{})
 	if err != nil {
 		klog.Errorf("Unable to fetch pv %v", err)
-		return nil, fmt.Errorf("error getting PV: %v", err)
+		return nil, fmt.Errorf("error getting PV: %w", err)
 	}
 
 	return pv, nil
 }
 
+// findPV returns the PV of a volume. The PVs of plain volume IDs are named after the
+// volume, the others are found by their volume handle in the informer cache.
+func findPV(k8sClient kubernetes.Interface, volumeID string) (*v1.PersistentVolume, error) {
+	if _, ok := DecodeVolumeID(volumeID); !ok {
+		return k8sClient.CoreV1().PersistentVolumes().Get(context.Background(), volumeID, metav1.GetOptions{})
+	}
+
+	indexer, err := getPVIndexer(k8sClient)
+	if err != nil {
+		return nil, err
+	}
+	return findIndexedPV(indexer, volumeID)
+}
+
 func getSecret(pvcName, pvcNamespace string) (*v1.Secret, error) {
 	k8sClient, err := createK8sClient()
 	if err != nil {
@@ -256,6 +638,42 @@ func getSecret(pvcName, pvcNamespace string) (*v1.Secret, error) {
 	return secret, nil
 }
 
+// GetClusterID returns the ID of the cluster, read from the cluster-info config map
+// of IBM Cloud clusters, or the UID of the kube-system namespace otherwise
+func (su *DriverStatsUtils) GetClusterID() (string, error) {
+	k8sClient, err := createK8sClient()
+	if err != nil {
+		return "", err
+	}
+
+	configMap, err := k8sClient.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "cluster-info", metav1.GetOptions{})
+	if err == nil {
+		var clusterConfig map[string]string
+		if err = json.Unmarshal([]byte(configMap.Data["cluster-config.json"]), &clusterConfig); err == nil && clusterConfig["cluster_id"] != "" {
+			return clusterConfig["cluster_id"], nil
+		}
+	}
+
+	namespace, err := k8sClient.CoreV1().Namespaces().Get(context.TODO(), "kube-system", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error getting the kube-system namespace: %v", err)
+	}
+	return string(namespace.UID), nil
+}
+
+// GetSecret returns the data of a secret
+func (su *DriverStatsUtils) GetSecret(namespace, name string) (map[string]string, error) {
+	secret, err := getSecret(name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
+
 func getEPBasedOnCluserInfra() (string, error) {
 	k8sClient, err := createK8sClient()
 	if err != nil {
@@ -284,16 +702,36 @@ func getEPBasedOnCluserInfra() (string, error) {
 	return constants.ResourceConfigEPPrivate, nil
 }
 
-func fetchSecretUsingPV(volumeID string) (*v1.Secret, error) {
-	pv, err := getPV(volumeID)
+func (su *DriverStatsUtils) newResourceConfig(ep, apiKey string) (*rc.ResourceConfigurationV1, error) {
+	apiKeyHash := sha256.Sum256([]byte(apiKey))
+	key := ep + "|" + hex.EncodeToString(apiKeyHash[:])
+	if su.ResourceConfigs != nil {
+		if resourceConfig, ok := su.ResourceConfigs.Get(key); ok {
+			return resourceConfig, nil
+		}
+	}
+
+	resourceConfig, err := rc.NewResourceConfigurationV1(&rc.ResourceConfigurationV1Options{
+		URL: ep,
+		Authenticator: &core.IamAuthenticator{
+			ApiKey: apiKey, // pragma: allowlist secret
+			URL:    constants.IAMEP,
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
+	if su.ResourceConfigs != nil {
+		su.ResourceConfigs.Add(key, resourceConfig)
+	}
+	return resourceConfig, nil
+}
 
-	pvcName := pv.Spec.ClaimRef.Name
-	if pvcName == "" {
-		return nil, fmt.Errorf("PVC name not found for PV with ID: %s", volumeID)
+func fetchSecretOfPV(pv *v1.PersistentVolume) (*v1.Secret, error) {
+	if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.Name == "" {
+		return nil, fmt.Errorf("PVC name not found for PV: %s", pv.Name)
 	}
+	pvcName := pv.Spec.ClaimRef.Name
 	pvcNamespace := pv.Spec.ClaimRef.Namespace
 	if pvcNamespace == "" {
 		pvcNamespace = "default"
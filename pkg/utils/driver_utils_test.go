@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceAndReturnCopy(t *testing.T) {
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId: "test-volume",
+		Secrets:  map[string]string{"accessKey": "key", "serviceAccountToken": "token", "bucketName": "bucket"},
+		VolumeContext: map[string]string{
+			constants.ServiceAccountTokensKey: `{"sts.amazonaws.com":{"token":"token"}}`,
+			"mounter":                         constants.RClone,
+			"cryptPassword":                   "password",
+			"cryptSalt":                       "salt",
+		},
+	}
+	modifiedRequest, err := ReplaceAndReturnCopy(req)
+	assert.NoError(t, err)
+
+	modified := modifiedRequest.(*csi.NodePublishVolumeRequest)
+	assert.Equal(t, map[string]string{"accessKey": "xxxxxxx", "serviceAccountToken": "xxxxxxx", "bucketName": "bucket"}, modified.GetSecrets())
+	assert.Equal(t, map[string]string{constants.ServiceAccountTokensKey: "xxxxxxx", "mounter": constants.RClone,
+		"cryptPassword": "xxxxxxx", "cryptSalt": "xxxxxxx"}, modified.GetVolumeContext())
+	// The request itself is left untouched
+	assert.Equal(t, "token", req.GetSecrets()["serviceAccountToken"])
+	assert.Contains(t, req.GetVolumeContext()[constants.ServiceAccountTokensKey], "token")
+
+	// The encryption keys of the other requests are masked as well
+	createRequest, err := ReplaceAndReturnCopy(&csi.CreateVolumeRequest{
+		Name:       "test-volume",
+		Secrets:    map[string]string{"cryptPassword": "password", "cryptSalt": "salt", "bucketName": "bucket"},
+		Parameters: map[string]string{"cryptPassword": "password", "mounter": constants.RClone},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cryptPassword": "xxxxxxx", "cryptSalt": "xxxxxxx", "bucketName": "bucket"},
+		createRequest.(*csi.CreateVolumeRequest).GetSecrets())
+	assert.Equal(t, map[string]string{"cryptPassword": "xxxxxxx", "mounter": constants.RClone},
+		createRequest.(*csi.CreateVolumeRequest).GetParameters())
+
+	_, err = ReplaceAndReturnCopy(&csi.NodeUnpublishVolumeRequest{})
+	assert.ErrorContains(t, err, "unsupported request type")
+}
+
+func TestNewResourceConfigCached(t *testing.T) {
+	su := NewDriverStatsUtils(DefaultResourceConfigCacheSize, DefaultResourceConfigCacheTTL)
+	first, err := su.newResourceConfig("https://config.test", "api-key-1")
+	assert.NoError(t, err)
+	second, err := su.newResourceConfig("https://config.test", "api-key-1")
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+
+	// Another API key gets another client
+	other, err := su.newResourceConfig("https://config.test", "api-key-2")
+	assert.NoError(t, err)
+	assert.NotSame(t, first, other)
+	assert.Equal(t, 2, su.ResourceConfigs.Len())
+
+	// Without cache, a client is created at each call
+	su = &DriverStatsUtils{}
+	first, err = su.newResourceConfig("https://config.test", "api-key-1")
+	assert.NoError(t, err)
+	second, err = su.newResourceConfig("https://config.test", "api-key-1")
+	assert.NoError(t, err)
+	assert.NotSame(t, first, second)
+}
@@ -5,10 +5,20 @@ import "k8s.io/apimachinery/pkg/api/resource"
 type FakeStatsUtilsFuncStruct struct {
 	FSInfoFn                 func(path string) (int64, int64, int64, int64, int64, int64, error)
 	CheckMountFn             func(targetPath string) error
+	IsMountPointFn           func(targetPath string) (bool, error)
 	BucketToDeleteFn         func(volumeID string) (string, error)
-	GetTotalCapacityFromPVFn func(volumeID string) (resource.Quantity, error)
-	GetBucketUsageFn         func(volumeID string) (int64, error)
+	GetTotalCapacityFromPVFn func(pvName string) (resource.Quantity, error)
+	GetBucketUsageFn         func(pvName string) (int64, error)
 	GetBucketNameFromPVFn    func(volumeID string) (string, error)
+	GetPVAttributesFn        func(volumeID string) (map[string]string, error)
+	ListDriverVolumesFn      func(driverName string) ([]DriverVolume, error)
+	GetDriverVolumeFn        func(volumeID string) (*DriverVolume, error)
+	GetPVVolumeFn            func(pvName string) (*DriverVolume, error)
+	SetBucketHardQuotaFn     func(apiKey, bucketName string, quotaBytes int64) error
+	GetPVMountOptionsFn      func(pvName string) (string, error)
+	SetPVMountOptionsFn      func(volumeID, mountOptions string) error
+	GetClusterIDFn           func() (string, error)
+	GetSecretFn              func(namespace, name string) (map[string]string, error)
 }
 
 type FakeStatsUtilsFuncStructImpl struct {
@@ -37,6 +47,13 @@ func (m *FakeStatsUtilsFuncStructImpl) CheckMount(targetPath string) error {
 	panic("requested method should not be nil")
 }
 
+func (m *FakeStatsUtilsFuncStructImpl) IsMountPoint(targetPath string) (bool, error) {
+	if m.FuncStruct.IsMountPointFn != nil {
+		return m.FuncStruct.IsMountPointFn(targetPath)
+	}
+	panic("requested method should not be nil")
+}
+
 func (m *FakeStatsUtilsFuncStructImpl) BucketToDelete(volumeID string) (string, error) {
 	if m.FuncStruct.BucketToDeleteFn != nil {
 		return m.FuncStruct.BucketToDeleteFn(volumeID)
@@ -44,16 +61,16 @@ func (m *FakeStatsUtilsFuncStructImpl) BucketToDelete(volumeID string) (string,
 	panic("requested method should not be nil")
 }
 
-func (m *FakeStatsUtilsFuncStructImpl) GetTotalCapacityFromPV(volumeID string) (resource.Quantity, error) {
+func (m *FakeStatsUtilsFuncStructImpl) GetTotalCapacityFromPV(pvName string) (resource.Quantity, error) {
 	if m.FuncStruct.GetTotalCapacityFromPVFn != nil {
-		return m.FuncStruct.GetTotalCapacityFromPVFn(volumeID)
+		return m.FuncStruct.GetTotalCapacityFromPVFn(pvName)
 	}
 	panic("requested method should not be nil")
 }
 
-func (m *FakeStatsUtilsFuncStructImpl) GetBucketUsage(volumeID string) (int64, error) {
+func (m *FakeStatsUtilsFuncStructImpl) GetBucketUsage(pvName string) (int64, error) {
 	if m.FuncStruct.GetBucketUsageFn != nil {
-		return m.FuncStruct.GetBucketUsageFn(volumeID)
+		return m.FuncStruct.GetBucketUsageFn(pvName)
 	}
 	panic("requested method should not be nil")
 }
@@ -64,3 +81,66 @@ func (m *FakeStatsUtilsFuncStructImpl) GetBucketNameFromPV(volumeID string) (str
 	}
 	panic("requested method should not be nil")
 }
+
+func (m *FakeStatsUtilsFuncStructImpl) GetPVAttributes(volumeID string) (map[string]string, error) {
+	if m.FuncStruct.GetPVAttributesFn != nil {
+		return m.FuncStruct.GetPVAttributesFn(volumeID)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) ListDriverVolumes(driverName string) ([]DriverVolume, error) {
+	if m.FuncStruct.ListDriverVolumesFn != nil {
+		return m.FuncStruct.ListDriverVolumesFn(driverName)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) GetDriverVolume(volumeID string) (*DriverVolume, error) {
+	if m.FuncStruct.GetDriverVolumeFn != nil {
+		return m.FuncStruct.GetDriverVolumeFn(volumeID)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) GetPVVolume(pvName string) (*DriverVolume, error) {
+	if m.FuncStruct.GetPVVolumeFn != nil {
+		return m.FuncStruct.GetPVVolumeFn(pvName)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) SetBucketHardQuota(apiKey, bucketName string, quotaBytes int64) error {
+	if m.FuncStruct.SetBucketHardQuotaFn != nil {
+		return m.FuncStruct.SetBucketHardQuotaFn(apiKey, bucketName, quotaBytes)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) GetPVMountOptions(pvName string) (string, error) {
+	if m.FuncStruct.GetPVMountOptionsFn != nil {
+		return m.FuncStruct.GetPVMountOptionsFn(pvName)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) SetPVMountOptions(volumeID, mountOptions string) error {
+	if m.FuncStruct.SetPVMountOptionsFn != nil {
+		return m.FuncStruct.SetPVMountOptionsFn(volumeID, mountOptions)
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) GetClusterID() (string, error) {
+	if m.FuncStruct.GetClusterIDFn != nil {
+		return m.FuncStruct.GetClusterIDFn()
+	}
+	panic("requested method should not be nil")
+}
+
+func (m *FakeStatsUtilsFuncStructImpl) GetSecret(namespace, name string) (map[string]string, error) {
+	if m.FuncStruct.GetSecretFn != nil {
+		return m.FuncStruct.GetSecretFn(namespace, name)
+	}
+	panic("requested method should not be nil")
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace" // #nosec G101 not a credential
+
+// RunAsLeader runs fn while the process holds the lease of the given name, so that a
+// single replica runs it. The context of fn is cancelled when the lease is lost, and
+// fn runs again once the lease is acquired back, until ctx is done. The lease is
+// created in the namespace of the pod when namespace is empty.
+func RunAsLeader(ctx context.Context, namespace, name string, fn func(context.Context)) error {
+	k8sClient, err := createK8sClient()
+	if err != nil {
+		return err
+	}
+
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	if namespace == "" {
+		if namespace, err = podNamespace(); err != nil {
+			return err
+		}
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Client:     k8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: fn,
+				OnStoppedLeading: func() {
+					klog.Infof("%s released the lease %s/%s", identity, namespace, name)
+				},
+			},
+		})
+	}
+	return nil
+}
+
+// podNamespace returns the namespace of the pod, from the environment or from its
+// service account
+func podNamespace() (string, error) {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace, nil
+	}
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
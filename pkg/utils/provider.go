@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+)
+
+// Provider describes how the driver uses an S3 compatible object storage
+type Provider struct {
+	Name string
+	// SignatureV2 has s3fs sign its requests with AWS signature version 2, rather
+	// than version 4
+	SignatureV2 bool
+	// VirtualHostedStyle addresses the buckets in the host name of the URLs, rather
+	// than in their path
+	VirtualHostedStyle bool
+	// RcloneProvider is the provider of the rclone s3 backend
+	RcloneProvider string
+	// LocationConstraint creates the buckets with their region as location constraint,
+	// rather than in the region of the endpoint
+	LocationConstraint bool
+	// DefaultRegion is the region of the volumes whose locationConstraint is not set,
+	// which is then required when empty
+	DefaultRegion string
+	// ResourceConfiguration tells whether the usage and the quota of the buckets are
+	// handled by the IBM COS resource configuration API. The usage is otherwise the
+	// size of the objects listed, and quotas are not supported.
+	ResourceConfiguration bool
+	// IBMExtensions tells whether IAM authentication, Key Protect encryption and
+	// bucket retention policies are supported
+	IBMExtensions bool
+	// TokenAudience is the audience of the service account tokens exchanged for the
+	// credentials of the volumes mounted with workload identity
+	TokenAudience string
+}
+
+var providers = map[string]Provider{
+	constants.ProviderIBMCOS: {
+		Name:                  constants.ProviderIBMCOS,
+		SignatureV2:           true,
+		RcloneProvider:        "IBMCOS",
+		ResourceConfiguration: true,
+		IBMExtensions:         true,
+		TokenAudience:         constants.IAMTokenAudience,
+	},
+	constants.ProviderAWS: {
+		Name:               constants.ProviderAWS,
+		VirtualHostedStyle: true,
+		RcloneProvider:     "AWS",
+		LocationConstraint: true,
+		DefaultRegion:      "us-east-1",
+		TokenAudience:      constants.STSTokenAudience,
+	},
+	constants.ProviderMinIO: {
+		Name:           constants.ProviderMinIO,
+		RcloneProvider: "Minio",
+		DefaultRegion:  "us-east-1",
+		TokenAudience:  constants.STSTokenAudience,
+	},
+	constants.ProviderCeph: {
+		Name:           constants.ProviderCeph,
+		RcloneProvider: "Ceph",
+		DefaultRegion:  "us-east-1",
+		TokenAudience:  constants.STSTokenAudience,
+	},
+}
+
+// DefaultProvider is the provider of the volumes whose provider is not set
+var DefaultProvider = providers[constants.ProviderIBMCOS]
+
+// GetProvider returns the provider named name, or DefaultProvider when name is empty
+func GetProvider(name string) (Provider, error) {
+	if name == "" {
+		return DefaultProvider, nil
+	}
+	provider, ok := providers[name]
+	if !ok {
+		return Provider{}, fmt.Errorf("unknown provider %q, supported providers are %s, %s, %s and %s",
+			name, constants.ProviderIBMCOS, constants.ProviderAWS, constants.ProviderMinIO, constants.ProviderCeph)
+	}
+	return provider, nil
+}
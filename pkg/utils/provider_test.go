@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProvider(t *testing.T) {
+	provider, err := GetProvider("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultProvider, provider)
+	assert.Equal(t, constants.ProviderIBMCOS, provider.Name)
+
+	provider, err = GetProvider(constants.ProviderMinIO)
+	assert.NoError(t, err)
+	assert.Equal(t, "Minio", provider.RcloneProvider)
+	assert.False(t, provider.IBMExtensions)
+
+	_, err = GetProvider("gcs")
+	assert.ErrorContains(t, err, `unknown provider "gcs"`)
+}
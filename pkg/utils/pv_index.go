@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// volumeHandleIndex indexes the PVs by the volume handle of their CSI source
+const volumeHandleIndex = "volumeHandle"
+
+// pvIndexSyncTimeout is how long the PVs are listed for, before a lookup gives up
+var pvIndexSyncTimeout = time.Minute
+
+// pvIndex holds the PVs watched by an informer, indexed by volume handle. The PVs of
+// the volume IDs describing their volume are not named after it, looking them up in
+// the cache spares a list of all the PVs at each lookup. The informer is started by
+// the first lookup and runs for the life of the driver.
+var pvIndex struct {
+	mutex   sync.Mutex
+	indexer cache.Indexer
+}
+
+func volumeHandleIndexFunc(obj interface{}) ([]string, error) {
+	pv, ok := obj.(*v1.PersistentVolume)
+	if !ok || pv.Spec.CSI == nil {
+		return nil, nil
+	}
+	return []string{pv.Spec.CSI.VolumeHandle}, nil
+}
+
+// getPVIndexer returns the indexer of the PVs, starting their informer on first use
+func getPVIndexer(k8sClient kubernetes.Interface) (cache.Indexer, error) {
+	pvIndex.mutex.Lock()
+	defer pvIndex.mutex.Unlock()
+	if pvIndex.indexer != nil {
+		return pvIndex.indexer, nil
+	}
+	indexer, err := startPVIndexer(k8sClient)
+	if err != nil {
+		return nil, err
+	}
+	pvIndex.indexer = indexer
+	return indexer, nil
+}
+
+// startPVIndexer starts an informer of the PVs and waits for its cache to be filled.
+// The informer is stopped when the cache cannot be filled, for the next lookup to
+// start another one.
+func startPVIndexer(k8sClient kubernetes.Interface) (cache.Indexer, error) {
+	factory := informers.NewSharedInformerFactory(k8sClient, 0)
+	informer := factory.Core().V1().PersistentVolumes().Informer()
+	if err := informer.AddIndexers(cache.Indexers{volumeHandleIndex: volumeHandleIndexFunc}); err != nil {
+		return nil, err
+	}
+
+	stopCh := make(chan struct{})
+	factory.Start(stopCh)
+	ctx, cancel := context.WithTimeout(context.Background(), pvIndexSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		close(stopCh)
+		return nil, errors.New("timed out listing the PVs")
+	}
+	klog.Info("Started the informer of the PVs")
+	return informer.GetIndexer(), nil
+}
+
+// findIndexedPV returns the PV of the given volume handle
+func findIndexedPV(indexer cache.Indexer, volumeID string) (*v1.PersistentVolume, error) {
+	objs, err := indexer.ByIndex(volumeHandleIndex, volumeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, apierrors.NewNotFound(v1.Resource("persistentvolumes"), volumeID)
+	}
+	// The objects of the cache are shared, they must not be modified
+	return objs[0].(*v1.PersistentVolume).DeepCopy(), nil
+}
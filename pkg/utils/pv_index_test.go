@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindPV(t *testing.T) {
+	volumeID := EncodeVolumeID(VolumeIDInfo{BucketName: "test-bucket", Owned: true, Region: "test-region"})
+	csiPV := func(name, handle string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: "test-driver", VolumeHandle: handle},
+				},
+			},
+		}
+	}
+	defer func() { pvIndex.indexer = nil }()
+	k8sClient := fake.NewSimpleClientset(
+		csiPV("pvc-1", volumeID),
+		csiPV("plainVolumeID", "plainVolumeID"),
+		&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "nfs"}},
+	)
+
+	pv, err := findPV(k8sClient, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, "pvc-1", pv.Name)
+
+	pv, err = findPV(k8sClient, "plainVolumeID")
+	assert.NoError(t, err)
+	assert.Equal(t, "plainVolumeID", pv.Name)
+
+	_, err = findPV(k8sClient, EncodeVolumeID(VolumeIDInfo{BucketName: "other-bucket", Owned: true}))
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// The PVs are listed once, later lookups are served by the cache
+	lists := 0
+	for _, action := range k8sClient.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "persistentvolumes" {
+			lists++
+		}
+	}
+	assert.Equal(t, 1, lists)
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+)
+
+// VolumeIDInfo is the description of a volume encoded in its volume ID, so that
+// the volume can be found without its PV
+type VolumeIDInfo struct {
+	BucketName string
+	// Owned tells whether the bucket was created for the volume, and is deleted with it
+	Owned bool
+	// Prefix holds the objects of a volume sharing its bucket with other volumes. The
+	// objects are deleted with the volume, the bucket is not.
+	Prefix string
+	// Provider is the name of the provider of the bucket, empty for IBM COS in the
+	// volume IDs of the first version
+	Provider string
+	// Endpoint and Region are left empty when they do not fit in the volume ID
+	Endpoint string
+	Region   string
+}
+
+// EncodeVolumeID returns the volume ID describing a volume, as
+// "v2:<o|s>:<provider>:<bucket>:<region>:<endpoint>", or
+// "v2:p:<provider>:<bucket>/<prefix>:<region>:<endpoint>" for a volume sharing its
+// bucket. The https scheme of the endpoint is implied. The endpoint, then the region,
+// are left out when the ID would exceed the length allowed by CSI.
+func EncodeVolumeID(info VolumeIDInfo) string {
+	ownership, location := "s", info.BucketName
+	switch {
+	case info.Prefix != "":
+		ownership, location = "p", info.BucketName+"/"+info.Prefix
+	case info.Owned:
+		ownership = "o"
+	}
+	endpoint := strings.TrimPrefix(info.Endpoint, "https://")
+
+	fields := []string{constants.VolumeIDVersion, ownership, info.Provider, location, info.Region, endpoint}
+	volumeID := strings.Join(fields, ":")
+	if len(volumeID) > constants.MaxVolumeIDLength {
+		fields[5] = ""
+		volumeID = strings.Join(fields, ":")
+	}
+	if len(volumeID) > constants.MaxVolumeIDLength {
+		fields[4] = ""
+		volumeID = strings.Join(fields, ":")
+	}
+	return volumeID
+}
+
+// DecodeVolumeID returns the description of a volume encoded in its volume ID, of
+// either version. It returns false for the plain volume IDs of the volumes created
+// by older releases.
+func DecodeVolumeID(volumeID string) (*VolumeIDInfo, bool) {
+	var provider string
+	fields := strings.SplitN(volumeID, ":", 6)
+	switch {
+	case len(fields) == 6 && fields[0] == constants.VolumeIDVersion:
+		provider = fields[2]
+		fields = append(fields[:2], fields[3:]...)
+	case len(fields) >= 5 && fields[0] == constants.VolumeIDVersion1:
+		// The endpoint of the first version is the last field, and may hold a port
+		fields = strings.SplitN(volumeID, ":", 5)
+	default:
+		return nil, false
+	}
+	if fields[2] == "" {
+		return nil, false
+	}
+
+	info := &VolumeIDInfo{
+		BucketName: fields[2],
+		Provider:   provider,
+		Endpoint:   fields[4],
+		Region:     fields[3],
+	}
+	switch fields[1] {
+	case "o":
+		info.Owned = true
+	case "s":
+	case "p":
+		var found bool
+		info.BucketName, info.Prefix, found = strings.Cut(fields[2], "/")
+		if !found || info.BucketName == "" || info.Prefix == "" {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if info.Endpoint != "" && !strings.Contains(info.Endpoint, "://") {
+		info.Endpoint = "https://" + info.Endpoint
+	}
+	return info, true
+}
+
+// EncodeSnapshotID returns the ID of the snapshot held by a bucket, as
+// "<provider>:<bucket>", or the bucket name alone for IBM COS as in the snapshot IDs
+// of earlier releases
+func EncodeSnapshotID(provider, bucketName string) string {
+	if provider == "" || provider == constants.ProviderIBMCOS {
+		return bucketName
+	}
+	return provider + ":" + bucketName
+}
+
+// DecodeSnapshotID returns the provider and the bucket of a snapshot, the provider
+// being empty for IBM COS. Bucket names hold no colon.
+func DecodeSnapshotID(snapshotID string) (string, string) {
+	if provider, bucketName, found := strings.Cut(snapshotID, ":"); found {
+		return provider, bucketName
+	}
+	return "", snapshotID
+}
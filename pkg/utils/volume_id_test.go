@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeID(t *testing.T) {
+	info := VolumeIDInfo{BucketName: "bucket", Prefix: "ns/claim", Provider: constants.ProviderMinIO, Region: "us-east-1", Endpoint: "http://minio:9000"}
+	volumeID := EncodeVolumeID(info)
+	assert.Equal(t, "v2:p:minio:bucket/ns/claim:us-east-1:http://minio:9000", volumeID)
+	decoded, ok := DecodeVolumeID(volumeID)
+	assert.True(t, ok)
+	assert.Equal(t, info, *decoded)
+
+	// The volume IDs of the first version have no provider
+	decoded, ok = DecodeVolumeID("v1:o:bucket:us-south:s3.us.cloud-object-storage.appdomain.cloud")
+	assert.True(t, ok)
+	assert.Equal(t, VolumeIDInfo{BucketName: "bucket", Owned: true, Region: "us-south", Endpoint: "https://s3.us.cloud-object-storage.appdomain.cloud"}, *decoded)
+
+	_, ok = DecodeVolumeID("pvc-1234")
+	assert.False(t, ok)
+	_, ok = DecodeVolumeID("v2:o:bucket:us-south")
+	assert.False(t, ok)
+}
+
+func TestSnapshotID(t *testing.T) {
+	assert.Equal(t, "snapshot-1", EncodeSnapshotID(constants.ProviderIBMCOS, "snapshot-1"))
+	assert.Equal(t, "aws:snapshot-1", EncodeSnapshotID(constants.ProviderAWS, "snapshot-1"))
+
+	provider, bucketName := DecodeSnapshotID("aws:snapshot-1")
+	assert.Equal(t, constants.ProviderAWS, provider)
+	assert.Equal(t, "snapshot-1", bucketName)
+	provider, bucketName = DecodeSnapshotID("snapshot-1")
+	assert.Empty(t, provider)
+	assert.Equal(t, "snapshot-1", bucketName)
+}
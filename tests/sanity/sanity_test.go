@@ -12,17 +12,26 @@
 package sanity
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam/token"
 	cloudProvider "github.com/IBM/ibm-csi-common/pkg/ibmcloudprovider"
+	"github.com/IBM/ibm-object-csi-driver/pkg/constants"
 	csiDriver "github.com/IBM/ibm-object-csi-driver/pkg/driver"
 	"github.com/IBM/ibm-object-csi-driver/pkg/mounter"
 	"github.com/IBM/ibm-object-csi-driver/pkg/s3client"
+	"github.com/IBM/ibm-object-csi-driver/pkg/utils"
 	"github.com/google/uuid"
 	"github.com/kubernetes-csi/csi-test/v5/pkg/sanity"
 	"go.uber.org/zap"
@@ -47,10 +56,10 @@ func TestSanity(t *testing.T) {
 	}
 
 	skipTests := strings.Join([]string{
-		"CreateVolume.*should fail when requesting to create a volume with already existing name and different capacity",
 		"NodeGetVolumeStats.*should fail when volume is not found",                         // since volume_condition is supported, so instead of err, response is sent
 		"NodeGetVolumeStats.*should fail when volume does not exist on the specified path", // since volume_condition is supported, so instead of err, response is sent
 		"ValidateVolumeCapabilities.*should fail when the requested volume does not exist",
+		"ControllerGetCapabilities.*should return appropriate capabilities", // csi-test v5.2.0 does not know the MODIFY_VOLUME capability
 	}, "|")
 	err := flag.Set("ginkgo.skip", skipTests)
 	if err != nil {
@@ -78,11 +87,12 @@ func TestSanity(t *testing.T) {
 
 	// Run sanity test
 	config := sanity.TestConfig{
-		TargetPath:  TargetPath,
-		StagingPath: StagePath,
-		Address:     CSIEndpoint,
-		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
-		SecretsFile: "../../tests/secret.yaml",
+		TargetPath:     TargetPath,
+		StagingPath:    StagePath,
+		Address:        CSIEndpoint,
+		DialOptions:    []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		SecretsFile:    "../../tests/secret.yaml",
+		TestVolumeSize: 1024 * 1024 * 1024,
 		TestVolumeParameters: map[string]string{
 			"bucketName": "fakeBucketName",
 		},
@@ -105,7 +115,7 @@ func initCSIDriverForSanity(t *testing.T) *csiDriver.S3Driver {
 	nodeID := "fakeNodeID"
 	session := FakeNewObjectStorageSessionFactory()
 	mountObj := FakeNewS3fsMounterFactory()
-	statsUtil := &FakeNewDriverStatsUtils{}
+	statsUtil := &FakeNewDriverStatsUtils{factory: session}
 	mounterUtil := &FakeNewMounterOptsUtils{}
 
 	// Creating test logger
@@ -127,10 +137,23 @@ func initCSIDriverForSanity(t *testing.T) *csiDriver.S3Driver {
 }
 
 // Fake ObjectStorageSessionFactory
-type FakeObjectStorageSessionFactory struct{}
+// The buckets are kept in memory, shared by all sessions created by the factory
+type FakeObjectStorageSessionFactory struct {
+	mutex   sync.Mutex
+	buckets map[string]*fakeBucket
+}
+
+type fakeBucket struct {
+	objects    map[string]int64
+	tags       map[string]string
+	lifecycle  s3client.BucketLifecycle
+	versioning bool
+}
 
 func FakeNewObjectStorageSessionFactory() *FakeObjectStorageSessionFactory {
-	return &FakeObjectStorageSessionFactory{}
+	return &FakeObjectStorageSessionFactory{
+		buckets: map[string]*fakeBucket{},
+	}
 }
 
 type fakeObjectStorageSession struct {
@@ -138,29 +161,199 @@ type fakeObjectStorageSession struct {
 	logger  *zap.Logger
 }
 
-func (f *FakeObjectStorageSessionFactory) NewObjectStorageSession(endpoint, locationConstraint string, creds *s3client.ObjectStorageCredentials, lgr *zap.Logger) s3client.ObjectStorageSession {
+func (f *FakeObjectStorageSessionFactory) NewObjectStorageSession(_ utils.Provider, endpoint, locationConstraint string, creds *s3client.ObjectStorageCredentials, lgr *zap.Logger) s3client.ObjectStorageSession {
 	return &fakeObjectStorageSession{
 		factory: f,
 		logger:  lgr,
 	}
 }
 
-func (s *fakeObjectStorageSession) CheckBucketAccess(bucket string) error {
+func (f *FakeObjectStorageSessionFactory) APIKeyToken(ctx context.Context, creds *s3client.ObjectStorageCredentials) (*token.Token, error) {
+	return nil, errors.New("IAM tokens are not supported by the fake object storage")
+}
+
+func (f *FakeObjectStorageSessionFactory) TrustedProfileToken(ctx context.Context, creds *s3client.ObjectStorageCredentials) (*token.Token, error) {
+	return nil, errors.New("workload identity is not supported by the fake object storage")
+}
+
+func (f *FakeObjectStorageSessionFactory) AssumeRoleWithWebIdentity(ctx context.Context, creds *s3client.ObjectStorageCredentials) (*s3client.TemporaryCredentials, error) {
+	return nil, errors.New("workload identity is not supported by the fake object storage")
+}
+
+func (s *fakeObjectStorageSession) CheckBucketAccess(ctx context.Context, bucket string) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	if _, ok := s.factory.buckets[bucket]; !ok {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
 	return nil
 }
 
-func (s *fakeObjectStorageSession) CheckObjectPathExistence(bucket, objectpath string) (bool, error) {
+func (s *fakeObjectStorageSession) CheckObjectPathExistence(ctx context.Context, bucket, objectpath string) (bool, error) {
 	return true, nil
 }
 
-func (s *fakeObjectStorageSession) CreateBucket(bucket, kpRootKeyCrn string) (string, error) {
+func (s *fakeObjectStorageSession) CreateBucket(ctx context.Context, bucket string, opts s3client.BucketOptions) (string, error) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	if _, ok := s.factory.buckets[bucket]; !ok {
+		s.factory.buckets[bucket] = &fakeBucket{objects: map[string]int64{}, tags: map[string]string{}}
+	}
 	return "", nil
 }
 
-func (s *fakeObjectStorageSession) DeleteBucket(bucket string) error {
+func (s *fakeObjectStorageSession) DeleteBucket(ctx context.Context, bucket string, progress *s3client.DeleteProgress) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	delete(s.factory.buckets, bucket)
+	return nil
+}
+
+func (s *fakeObjectStorageSession) ListBuckets(ctx context.Context) ([]string, error) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	buckets := []string{}
+	for name := range s.factory.buckets {
+		buckets = append(buckets, name)
+	}
+	return buckets, nil
+}
+
+func (s *fakeObjectStorageSession) ListObjects(ctx context.Context, bucket, prefix string) ([]s3client.ObjectInfo, error) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+	objects := []s3client.ObjectInfo{}
+	for key, size := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, s3client.ObjectInfo{Key: key, Size: size})
+		}
+	}
+	return objects, nil
+}
+
+func (s *fakeObjectStorageSession) DeleteObjects(ctx context.Context, bucket, prefix string, progress *s3client.DeleteProgress) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(b.objects, key)
+		}
+	}
+	return nil
+}
+
+func (s *fakeObjectStorageSession) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	src, ok := s.factory.buckets[srcBucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", srcBucket)
+	}
+	dst, ok := s.factory.buckets[dstBucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", dstBucket)
+	}
+	dst.objects[dstKey] = src.objects[srcKey]
 	return nil
 }
 
+func (s *fakeObjectStorageSession) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+	size, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("object %s/%s not found", bucket, key)
+	}
+	return io.NopCloser(bytes.NewReader(make([]byte, size))), nil
+}
+
+func (s *fakeObjectStorageSession) UploadObject(ctx context.Context, bucket, key string, body io.Reader, size int64) error {
+	size, err := io.Copy(io.Discard, body)
+	if err != nil {
+		return err
+	}
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
+	b.objects[key] = size
+	return nil
+}
+
+func (s *fakeObjectStorageSession) SetBucketTags(ctx context.Context, bucket string, tags map[string]string) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
+	b.tags = tags
+	return nil
+}
+
+func (s *fakeObjectStorageSession) GetBucketTags(ctx context.Context, bucket string) (map[string]string, error) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	if b, ok := s.factory.buckets[bucket]; ok {
+		return b.tags, nil
+	}
+	return map[string]string{}, nil
+}
+
+func (s *fakeObjectStorageSession) GetBucketLifecycle(ctx context.Context, bucket string) (s3client.BucketLifecycle, error) {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return s3client.BucketLifecycle{}, fmt.Errorf("bucket %s not found", bucket)
+	}
+	return b.lifecycle, nil
+}
+
+func (s *fakeObjectStorageSession) SetBucketLifecycle(ctx context.Context, bucket string, lifecycle s3client.BucketLifecycle) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
+	b.lifecycle = lifecycle
+	return nil
+}
+
+func (s *fakeObjectStorageSession) SetBucketVersioning(ctx context.Context, bucket string, enabled bool) error {
+	s.factory.mutex.Lock()
+	defer s.factory.mutex.Unlock()
+	b, ok := s.factory.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("bucket %s not found", bucket)
+	}
+	b.versioning = enabled
+	return nil
+}
+
+func (s *fakeObjectStorageSession) GetBucketRetention(ctx context.Context, bucket string) (*s3client.BucketRetention, error) {
+	return nil, nil
+}
+
+func (s *fakeObjectStorageSession) GetBucketObjectLock(ctx context.Context, bucket string) (*s3client.BucketObjectLock, error) {
+	return nil, nil
+}
+
 // Fake NewMounterFactory
 type FakeS3fsMounterFactory struct{}
 
@@ -170,9 +363,9 @@ func FakeNewS3fsMounterFactory() *FakeS3fsMounterFactory {
 
 type Fakes3fsMounter struct{}
 
-func (s *FakeS3fsMounterFactory) NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) mounter.Mounter {
+func (s *FakeS3fsMounterFactory) NewMounter(attrib map[string]string, secretMap map[string]string, mountFlags []string) (mounter.Mounter, error) {
 	klog.Info("-New S3FS Fake Mounter-")
-	return &Fakes3fsMounter{}
+	return &Fakes3fsMounter{}, nil
 }
 
 func (s3fs *Fakes3fsMounter) Mount(source string, target string) error {
@@ -185,6 +378,10 @@ func (s3fs *Fakes3fsMounter) Unmount(target string) error {
 	return nil
 }
 
+func (s3fs *Fakes3fsMounter) UpdateCredentials(target string) (bool, error) {
+	return false, nil
+}
+
 // For Id Generation
 type providerIDGenerator struct{}
 
@@ -212,16 +409,31 @@ func (su *FakeNewMounterOptsUtils) FuseUnmount(path string) error {
 	return nil
 }
 
-func (m *FakeNewMounterOptsUtils) FuseMount(path string, comm string, args []string) error {
+func (m *FakeNewMounterOptsUtils) FuseMount(path string, comm string, args []string, env ...string) error {
 	return nil
 }
 
 // Fake DriverStatsUtils
+// The persistent volumes are the buckets tagged by CreateVolume in the fake object storage
 type FakeNewDriverStatsUtils struct {
+	factory *FakeObjectStorageSessionFactory
+}
+
+// volumeBucket returns the bucket created for a volume
+func (su *FakeNewDriverStatsUtils) volumeBucket(volumeID string) (string, bool) {
+	su.factory.mutex.Lock()
+	defer su.factory.mutex.Unlock()
+	for name, b := range su.factory.buckets {
+		if b.tags[constants.VolumeIDTag] == volumeID {
+			return name, true
+		}
+	}
+	return "", false
 }
 
 func (su *FakeNewDriverStatsUtils) BucketToDelete(volumeID string) (string, error) {
-	return "", nil
+	bucket, _ := su.volumeBucket(volumeID)
+	return bucket, nil
 }
 
 func (su *FakeNewDriverStatsUtils) FSInfo(path string) (int64, int64, int64, int64, int64, int64, error) {
@@ -235,6 +447,10 @@ func (su *FakeNewDriverStatsUtils) CheckMount(targetPath string) error {
 	return nil
 }
 
+func (su *FakeNewDriverStatsUtils) IsMountPoint(targetPath string) (bool, error) {
+	return false, nil
+}
+
 func (su *FakeNewDriverStatsUtils) GetTotalCapacityFromPV(volumeID string) (resource.Quantity, error) {
 	return resource.Quantity{}, nil
 }
@@ -244,9 +460,71 @@ func (su *FakeNewDriverStatsUtils) GetBucketUsage(volumeID string) (int64, error
 }
 
 func (su *FakeNewDriverStatsUtils) GetBucketNameFromPV(volumeID string) (string, error) {
+	bucket, _ := su.volumeBucket(volumeID)
+	return bucket, nil
+}
+
+func (su *FakeNewDriverStatsUtils) GetPVAttributes(volumeID string) (map[string]string, error) {
+	bucket, ok := su.volumeBucket(volumeID)
+	if !ok {
+		return nil, fmt.Errorf("pv %s not found", volumeID)
+	}
+	return map[string]string{"bucketName": bucket, "userProvidedBucket": "false"}, nil
+}
+
+func (su *FakeNewDriverStatsUtils) ListDriverVolumes(driverName string) ([]utils.DriverVolume, error) {
+	su.factory.mutex.Lock()
+	defer su.factory.mutex.Unlock()
+	volumes := []utils.DriverVolume{}
+	for name, b := range su.factory.buckets {
+		if volumeID := b.tags[constants.VolumeIDTag]; volumeID != "" {
+			capacity, _ := strconv.ParseInt(b.tags[constants.CapacityBytesTag], 10, 64)
+			volumes = append(volumes, utils.DriverVolume{
+				VolumeID:      volumeID,
+				CapacityBytes: capacity,
+				Attributes:    map[string]string{"bucketName": name, "userProvidedBucket": "false"},
+				Secrets:       map[string]string{"accessKey": "FJDSJ", "secretKey": "DSG643HGDS", "cosEndpoint": "http://127.0.0.1:9000"},
+				NodeIDs:       []string{},
+			})
+		}
+	}
+	return volumes, nil
+}
+
+func (su *FakeNewDriverStatsUtils) GetPVVolume(pvName string) (*utils.DriverVolume, error) {
+	return su.GetDriverVolume(pvName)
+}
+
+func (su *FakeNewDriverStatsUtils) GetDriverVolume(volumeID string) (*utils.DriverVolume, error) {
+	volumes, _ := su.ListDriverVolumes("")
+	for i := range volumes {
+		if volumes[i].VolumeID == volumeID {
+			return &volumes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", utils.ErrVolumeNotFound, volumeID)
+}
+
+func (su *FakeNewDriverStatsUtils) SetBucketHardQuota(apiKey, bucketName string, quotaBytes int64) error {
+	return nil
+}
+
+func (su *FakeNewDriverStatsUtils) GetPVMountOptions(volumeID string) (string, error) {
 	return "", nil
 }
 
+func (su *FakeNewDriverStatsUtils) SetPVMountOptions(volumeID, mountOptions string) error {
+	return nil
+}
+
+func (su *FakeNewDriverStatsUtils) GetClusterID() (string, error) {
+	return "fake-cluster-id", nil
+}
+
+func (su *FakeNewDriverStatsUtils) GetSecret(namespace, name string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
 func createTargetDir(targetPath string) error {
 	fileInfo, err := os.Stat(targetPath)
 	if err != nil && os.IsNotExist(err) {